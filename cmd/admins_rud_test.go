@@ -100,7 +100,7 @@ func TestAdmins(t *testing.T){
 			if resp.StatusCode == http.StatusOK{
 				var gotAdmins []models.UserOutput
 				body,_ := ioutil.ReadAll(resp.Body)
-				err:=json.Unmarshal(body,&gotAdmins)
+				err:=json.Unmarshal(body,&models.Page{Data: &gotAdmins})
 				if err!=nil{
 					t.Fatalf("response is not in appropriate format:%v",err)
 				}
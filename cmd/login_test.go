@@ -60,5 +60,5 @@ func TestLogInController(t *testing.T) {
 			testhelpers.AssertStatus(t, resp.StatusCode,test.wantedStatus)
 		})
 	}
-	testhelpers.ClearInvalidTokens()
+	testhelpers.ClearRevokedTokens()
 }
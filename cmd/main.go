@@ -1,44 +1,112 @@
 package main
 
 import (
-	"github.com/sirupsen/logrus"
+	"context"
+	"fmt"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/database/memory"
 	"github.com/vds/go-resman/pkg/database/mysql"
+	"github.com/vds/go-resman/pkg/database/postgres"
+	"github.com/vds/go-resman/pkg/database/sqlite"
+	"github.com/vds/go-resman/pkg/encryption"
 	"github.com/vds/go-resman/pkg/logger"
 	"github.com/vds/go-resman/pkg/server"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
 func main() {
-	// create database instance
-	// when not using db4free the restaurant
-	logger.InitLogger(logrus.InfoLevel)
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "5000"
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:]))
+		case "seed":
+			os.Exit(runSeed(os.Args[2:]))
+		}
 	}
-	dbURL := os.Getenv("DBURL")
-	if dbURL == "" {
-		//dbURL = "root:password@tcp(localhost:3306)/restaurant_management?charset=utf8mb4&collation=utf8mb4_unicode_ci&parseTime=true&multiStatements=true"
-		dbURL = "vardhaman:password@tcp(db4free.net:3306)/restaurant12?charset=utf8mb4&collation=utf8mb4_unicode_ci&parseTime=true&multiStatements=true"
+
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		os.Exit(2)
 	}
-	db, err := mysql.NewMySqlDB(dbURL)
+	logger.InitLogger(cfg.Level())
+
+	// create database instance, the server makes it hash with the configured hasher
+	db, err := openDatabase(&cfg.Database)
 	if err != nil {
-		panic(err)
+		logger.LogFatal(fmt.Sprintf("can not connect to database: %v", err))
+	}
+	if closer, ok := db.(io.Closer); ok {
+		defer closer.Close()
 	}
 
 	// create server
-	s, err := server.NewServer(db)
+	s, err := server.NewServer(db, cfg)
+	if err != nil {
+		logger.LogFatal(fmt.Sprintf("can not create server: %v", err))
+	}
+
+	err = s.ListenAndServe(withSignals())
 	if err != nil {
-		panic(err)
+		logger.LogFatal(fmt.Sprintf("server stopped: %v", err))
 	}
+}
+
+// withSignals returns a context that is cancelled once the process receives SIGTERM or SIGINT
+func withSignals() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		<-signals
+		cancel()
+	}()
+	return ctx
+}
 
-	router, err := s.Start()
+// newDatabase connects to the configured database and makes it hash passwords with the configured hasher
+func newDatabase(cfg *config.Config) (database.Database, error) {
+	hasher, err := encryption.NewPasswordHasher(&cfg.Password)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	err = router.Engine.Run(":" + port)
+	db, err := openDatabase(&cfg.Database)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	db.SetPasswordHasher(hasher)
+	return db, nil
+}
+
+// openDatabase selects the database backend from the scheme of the configured url,
+// urls without a known scheme are treated as mysql data source names
+func openDatabase(cfg *config.Database) (database.Database, error) {
+	dbURL := cfg.URL
+	switch {
+	case strings.HasPrefix(dbURL, "postgres://"), strings.HasPrefix(dbURL, "postgresql://"):
+		db, err := postgres.NewPostgresDB(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case strings.HasPrefix(dbURL, "sqlite://"):
+		db, err := sqlite.NewSqliteDB(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case strings.HasPrefix(dbURL, "memory://"):
+		return memory.NewMemoryDB(), nil
+	default:
+		db, err := mysql.NewMySqlDB(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
 	}
 }
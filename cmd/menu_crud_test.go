@@ -327,7 +327,7 @@ func TestMenu(t *testing.T) {
 			if test.wantedStatus == 200 {
 				var gotMenu []models.DishOutput
 				body, _ := ioutil.ReadAll(resp.Body)
-				err := json.Unmarshal(body, &gotMenu)
+				err := json.Unmarshal(body, &models.Page{Data: &gotMenu})
 				if err != nil {
 					t.Fatalf("response not in correct format:%v", err)
 				}
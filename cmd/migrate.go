@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database/mysql"
+	"github.com/vds/go-resman/pkg/database/postgres"
+	"github.com/vds/go-resman/pkg/database/sqlite"
+	"github.com/vds/go-resman/pkg/logger"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const migrateUsage = `usage: resman migrate <command> [argument] [flags]
+
+commands:
+  up [n]       apply all or the next n pending migrations
+  down [n]     roll back the last n migrations, 1 by default
+  goto <v>     migrate up or down to version v
+  force <v>    record version v as applied without running it, clears the dirty flag
+  version      print the applied version
+
+The database is configured with the same file, environment and flags as the server
+and migrations are not applied on start up when -db-skip-migrate is set.
+`
+
+// runMigrate implements the migrate command and returns the exit code of the process
+func runMigrate(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	command, args := args[0], args[1:]
+	var argument string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		argument, args = args[0], args[1:]
+	}
+
+	cfg, err := config.Parse(args)
+	if err == nil {
+		err = cfg.Database.Validate()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		return 2
+	}
+	// results are printed for the user, the logger only reports what the backends do
+	logger.InitLogger(cfg.Level())
+	run, err := migrateCommand(command, argument)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\n%s", err, migrateUsage)
+		return 2
+	}
+
+	migration, err := newMigrate(&cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can not connect to database: %v\n", err)
+		return 1
+	}
+	defer migration.Close()
+
+	err = run(migration)
+	// stepping down from the first version reports the missing previous file
+	if err == migrate.ErrNoChange || os.IsNotExist(err) {
+		fmt.Println("no change")
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate %s failed: %v\n", command, err)
+		return 1
+	}
+	version, dirty, err := migration.Version()
+	if err == migrate.ErrNilVersion {
+		fmt.Println("no migration applied")
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can not read version: %v\n", err)
+		return 1
+	}
+	if dirty {
+		fmt.Printf("version %d (dirty)\n", version)
+		return 0
+	}
+	fmt.Printf("version %d\n", version)
+	return 0
+}
+
+// migrateCommand checks the argument of command and returns the function running it
+func migrateCommand(command, argument string) (func(m *migrate.Migrate) error, error) {
+	number := func(required bool, fallback int) (int, error) {
+		if argument == "" {
+			if required {
+				return 0, fmt.Errorf("%s needs a version", command)
+			}
+			return fallback, nil
+		}
+		n, err := strconv.Atoi(argument)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%s needs a positive number, got %q", command, argument)
+		}
+		return n, nil
+	}
+	switch command {
+	case "up":
+		n, err := number(false, 0)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return (*migrate.Migrate).Up, nil
+		}
+		return func(m *migrate.Migrate) error { return m.Steps(n) }, nil
+	case "down":
+		n, err := number(false, 1)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("down needs a positive number of steps, got %q", argument)
+		}
+		return func(m *migrate.Migrate) error { return m.Steps(-n) }, nil
+	case "goto":
+		v, err := number(true, 0)
+		if err != nil {
+			return nil, err
+		}
+		return func(m *migrate.Migrate) error { return m.Migrate(uint(v)) }, nil
+	case "force":
+		v, err := number(true, 0)
+		if err != nil {
+			return nil, err
+		}
+		return func(m *migrate.Migrate) error { return m.Force(v) }, nil
+	case "version":
+		if argument != "" {
+			return nil, fmt.Errorf("version takes no argument, got %q", argument)
+		}
+		return func(m *migrate.Migrate) error { return nil }, nil
+	}
+	return nil, fmt.Errorf("unknown migrate command %q", command)
+}
+
+// newMigrate selects the backend the same way as openDatabase
+func newMigrate(cfg *config.Database) (*migrate.Migrate, error) {
+	dbURL := cfg.URL
+	switch {
+	case strings.HasPrefix(dbURL, "postgres://"), strings.HasPrefix(dbURL, "postgresql://"):
+		return postgres.NewMigrate(cfg)
+	case strings.HasPrefix(dbURL, "sqlite://"):
+		return sqlite.NewMigrate(cfg)
+	case strings.HasPrefix(dbURL, "memory://"):
+		return nil, errors.New("the memory database has no migrations")
+	default:
+		return mysql.NewMigrate(cfg)
+	}
+}
@@ -204,7 +204,7 @@ func TestOwners(t *testing.T) {
 			testhelpers.AssertStatus(t, resp.StatusCode, test.wantedStatus)
 			var gotOwners []models.UserOutput
 			body, _ := ioutil.ReadAll(resp.Body)
-			err = json.Unmarshal(body, &gotOwners)
+			err = json.Unmarshal(body, &models.Page{Data: &gotOwners})
 			if err != nil {
 				t.Fatalf("response not in correct format:%v", err)
 			}
@@ -13,10 +13,8 @@ func TestRegistration(t *testing.T){
 		user 	   *models.UserReg
 		wantedStatus 		int
 	}{
-		{name:"When an admin is successfully created",user:&testhelpers.AdminToRegister,wantedStatus: http.StatusOK},
-		{name:"When a superAdmin is successfully created",user: &testhelpers.SuperAdminToRegister,wantedStatus: http.StatusOK},
-		{name:"duplicate mail for admin",user: &testhelpers.AdminToRegister,wantedStatus: http.StatusBadRequest},
-		{name:"duplicate mail for super admin",user: &testhelpers.SuperAdminToRegister,wantedStatus: http.StatusBadRequest},
+		{name:"admins are invited",user:&testhelpers.AdminToRegister,wantedStatus: http.StatusForbidden},
+		{name:"registration is closed once a superAdmin exists",user: &testhelpers.SuperAdminToRegister,wantedStatus: http.StatusForbidden},
 		{name:"Empty Require Field",user: &models.UserReg{  Role:"admin",Email: "",Name: "admin1",Password: "pass1"},wantedStatus: http.StatusBadRequest},
 		{name:"Registration with invalid role",user: &models.UserReg{  Role:"otherRole",Email: "a@gmail.com",Name: "admin1",Password: "pass1"},wantedStatus: http.StatusNotFound},
 	}
@@ -214,7 +214,7 @@ func TestRestaurants(t *testing.T) {
 			testhelpers.AssertStatus(t, resp.StatusCode, http.StatusOK)
 			var gotRestaurants []models.RestaurantOutput
 			body, _ := ioutil.ReadAll(resp.Body)
-			err = json.Unmarshal(body, &gotRestaurants)
+			err = json.Unmarshal(body, &models.Page{Data: &gotRestaurants})
 			if err != nil {
 				t.Fatalf("response not in correct format:%v", err)
 			}
@@ -268,7 +268,7 @@ func TestRestaurants(t *testing.T) {
 			if test.wantedStatus == http.StatusOK {
 				var gotRestaurants []models.RestaurantOutput
 				body, _ := ioutil.ReadAll(resp.Body)
-				err = json.Unmarshal(body, &gotRestaurants)
+				err = json.Unmarshal(body, &models.Page{Data: &gotRestaurants})
 				if err != nil {
 					t.Fatalf("response not in correct format:%v", err)
 				}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/seed"
+	"io"
+	"os"
+	"strings"
+)
+
+const seedUsage = `usage: resman seed <fixture.yaml|fixture.json> [flags]
+
+Creates the super admins, admins, owners, restaurants and dishes of the fixture that are not
+in the database yet, see fixtures/demo.yaml. The database is configured with the same file,
+environment and flags as the server.
+`
+
+// runSeed implements the seed command and returns the exit code of the process
+func runSeed(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") || args[0] == "help" {
+		fmt.Fprint(os.Stderr, seedUsage)
+		return 2
+	}
+	path, args := args[0], args[1:]
+
+	cfg, err := config.Parse(args)
+	if err == nil {
+		err = cfg.Database.Validate()
+	}
+	if err == nil {
+		err = cfg.Password.Validate()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		return 2
+	}
+	logger.InitLogger(cfg.Level())
+	fixture, err := seed.LoadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can not load fixture: %v\n", err)
+		return 2
+	}
+
+	db, err := newDatabase(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can not connect to database: %v\n", err)
+		return 1
+	}
+	if closer, ok := db.(io.Closer); ok {
+		defer closer.Close()
+	}
+	// the database logs expect the request fields of the http handlers
+	ctx := context.WithValue(context.Background(), "reqId", "seed")
+	ctx = context.WithValue(ctx, "reqUrl", path)
+	result, err := seed.Apply(ctx, db, fixture)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can not apply fixture: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%d records created\n", result.Created)
+	return 0
+}
@@ -0,0 +1,834 @@
+// Package config loads the server configuration.
+//
+// Values are resolved in the following order, later sources overriding earlier ones:
+// built in defaults, a YAML or TOML file, environment variables and command line flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minSecretLength is the minimum number of bytes accepted for the jwt signing secret
+const minSecretLength = 16
+
+// errors
+var (
+	ErrNoDatabaseURL    = errors.New("database url is required")
+	ErrInvalidPort      = errors.New("port must be a number between 1 and 65535")
+	ErrInvalidLogLevel  = errors.New("log level is not valid")
+	ErrInvalidPurge     = errors.New("token purge interval must be positive")
+	ErrInvalidRetention = errors.New("deleted account retention can not be negative")
+	ErrShortSecret      = fmt.Errorf("jwt secret must be at least %d bytes", minSecretLength)
+	ErrInvalidLifetime  = errors.New("token lifetime must be positive")
+	ErrInvalidPool      = errors.New("database pool settings can not be negative")
+	ErrInvalidShutdown  = errors.New("shutdown timeout must be positive")
+	ErrInvalidBuckets   = errors.New("histogram buckets must be positive and in increasing order")
+	ErrInvalidKeys      = errors.New("jwt keys need a unique id and a file, the signing key must be one of them")
+	ErrInvalidLockout   = errors.New("lockout thresholds can not be negative and its durations must be positive with the maximum at least the base")
+	ErrInvalidMail      = errors.New("mail driver must be log, file with a directory or smtp with a host and port, and a sender is required")
+	ErrInvalidOIDC      = errors.New("oidc login needs a client id, a redirect url, a role and a positive state lifetime")
+	ErrInvalidBoot      = errors.New("bootstrap super admin needs an email, a name and a password")
+	ErrInvalidPassword  = errors.New("password hasher must be argon2id or bcrypt with valid parameters and the length limits must be positive with the maximum at least the minimum")
+	ErrFileFormat       = errors.New("config file must be .yaml, .yml or .toml")
+	ErrUnexpectedArgs   = errors.New("unexpected command line arguments")
+)
+
+type Config struct {
+	Port     string `yaml:"port" toml:"port"`
+	LogLevel string `yaml:"logLevel" toml:"logLevel"`
+	// ShutdownTimeout is how long in-flight requests are given to complete once the server is asked to stop
+	ShutdownTimeout Duration  `yaml:"shutdownTimeout" toml:"shutdownTimeout"`
+	Database        Database  `yaml:"database" toml:"database"`
+	Auth            Auth      `yaml:"auth" toml:"auth"`
+	CORS            CORS      `yaml:"cors" toml:"cors"`
+	Metrics         Metrics   `yaml:"metrics" toml:"metrics"`
+	Mail            Mail      `yaml:"mail" toml:"mail"`
+	Lockout         Lockout   `yaml:"lockout" toml:"lockout"`
+	Password        Password  `yaml:"password" toml:"password"`
+	RBAC            RBAC      `yaml:"rbac" toml:"rbac"`
+	OIDC            OIDC      `yaml:"oidc" toml:"oidc"`
+	Bootstrap       Bootstrap `yaml:"bootstrap" toml:"bootstrap"`
+}
+
+// Database holds the data source and connection pool settings, zero pool values keep the driver defaults
+type Database struct {
+	URL             string   `yaml:"url" toml:"url"`
+	MaxOpenConns    int      `yaml:"maxOpenConns" toml:"maxOpenConns"`
+	MaxIdleConns    int      `yaml:"maxIdleConns" toml:"maxIdleConns"`
+	ConnMaxLifetime Duration `yaml:"connMaxLifetime" toml:"connMaxLifetime"`
+	// SkipMigrate leaves applying migrations to the migrate command instead of doing it on start up
+	SkipMigrate bool `yaml:"skipMigrate" toml:"skipMigrate"`
+}
+
+// Auth holds the settings used to sign and verify jwt tokens. Tokens are signed with the
+// asymmetric key named by SigningKey when keys are configured and with Secret otherwise
+type Auth struct {
+	// Secret signs HS256 tokens, with keys configured it only verifies tokens issued before the switch
+	Secret string `yaml:"secret" toml:"secret"`
+	// Keys are verified by their kid, keeping retired keys here lets their tokens expire normally
+	Keys       []Key  `yaml:"keys" toml:"keys"`
+	SigningKey string `yaml:"signingKey" toml:"signingKey"`
+	// TokenLifetime is the lifetime of access tokens, clients renew them with their refresh token
+	TokenLifetime        Duration `yaml:"tokenLifetime" toml:"tokenLifetime"`
+	RefreshTokenLifetime Duration `yaml:"refreshTokenLifetime" toml:"refreshTokenLifetime"`
+	// PurgeInterval is how often expired revocations and refresh tokens are deleted
+	PurgeInterval Duration `yaml:"purgeInterval" toml:"purgeInterval"`
+	// DeletedAccountRetention is how long deleted accounts can be reactivated before they are purged,
+	// they are never purged when it is zero
+	DeletedAccountRetention Duration `yaml:"deletedAccountRetention" toml:"deletedAccountRetention"`
+	// ResetTokenLifetime is how long the link of a password reset email can be used
+	ResetTokenLifetime Duration `yaml:"resetTokenLifetime" toml:"resetTokenLifetime"`
+	// PasswordResetURL is the page that completes a password reset, the token is added to it as
+	// the token query parameter. The email only contains the token when it is empty
+	PasswordResetURL string `yaml:"passwordResetURL" toml:"passwordResetURL"`
+	// VerificationTokenLifetime is how long the link sent to verify the email of a new account can be used
+	VerificationTokenLifetime Duration `yaml:"verificationTokenLifetime" toml:"verificationTokenLifetime"`
+	// EmailVerificationURL is the page that completes a verification the same way as PasswordResetURL,
+	// the email only contains the token when it is empty
+	EmailVerificationURL string `yaml:"emailVerificationURL" toml:"emailVerificationURL"`
+	// ChallengeLifetime is how long a user has to enter a two-factor code after their password
+	ChallengeLifetime Duration `yaml:"challengeLifetime" toml:"challengeLifetime"`
+	// TOTPIssuer names the server in authenticator apps
+	TOTPIssuer string `yaml:"totpIssuer" toml:"totpIssuer"`
+	// InvitationLifetime is how long the link of an invitation email can be used
+	InvitationLifetime Duration `yaml:"invitationLifetime" toml:"invitationLifetime"`
+	// InvitationURL is the page that accepts an invitation the same way as PasswordResetURL,
+	// the email only contains the token when it is empty
+	InvitationURL string `yaml:"invitationURL" toml:"invitationURL"`
+	// ImpersonationLifetime is how long a token issued to act as another user can be used, it can not be refreshed
+	ImpersonationLifetime Duration `yaml:"impersonationLifetime" toml:"impersonationLifetime"`
+	// ImpersonationReadOnly refuses the requests that could change data while impersonating
+	ImpersonationReadOnly bool `yaml:"impersonationReadOnly" toml:"impersonationReadOnly"`
+}
+
+// Key is a PEM encoded RSA or Ed25519 key, a private key can sign tokens while a public key only verifies them
+type Key struct {
+	ID   string `yaml:"id" toml:"id"`
+	File string `yaml:"file" toml:"file"`
+}
+
+// CORS holds the values of the Access-Control-Allow-* response headers
+type CORS struct {
+	AllowOrigin  string   `yaml:"allowOrigin" toml:"allowOrigin"`
+	AllowHeaders []string `yaml:"allowHeaders" toml:"allowHeaders"`
+	AllowMethods []string `yaml:"allowMethods" toml:"allowMethods"`
+}
+
+// Metrics holds the prometheus settings
+type Metrics struct {
+	// Buckets are the upper bounds in milliseconds of the request duration histogram
+	Buckets []float64 `yaml:"buckets" toml:"buckets"`
+}
+
+// Mail selects how emails are sent, the log and file drivers are meant for local testing
+type Mail struct {
+	// Driver is smtp, file or log
+	Driver string `yaml:"driver" toml:"driver"`
+	From   string `yaml:"from" toml:"from"`
+	// Dir receives one file per email with the file driver
+	Dir  string `yaml:"dir" toml:"dir"`
+	SMTP SMTP   `yaml:"smtp" toml:"smtp"`
+}
+
+// SMTP holds the server emails are sent through, the connection is upgraded with STARTTLS when the
+// server supports it and authentication is only attempted when Username is set
+type SMTP struct {
+	Host     string `yaml:"host" toml:"host"`
+	Port     int    `yaml:"port" toml:"port"`
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+}
+
+// Lockout limits failed logins. Reaching its threshold of failures locks a user or source ip for
+// BaseDuration, every further failure doubles the lock up to MaxDuration.
+// Failures are forgotten ResetAfter the last one, a zero threshold disables the limit
+type Lockout struct {
+	AccountThreshold int      `yaml:"accountThreshold" toml:"accountThreshold"`
+	IPThreshold      int      `yaml:"ipThreshold" toml:"ipThreshold"`
+	BaseDuration     Duration `yaml:"baseDuration" toml:"baseDuration"`
+	MaxDuration      Duration `yaml:"maxDuration" toml:"maxDuration"`
+	ResetAfter       Duration `yaml:"resetAfter" toml:"resetAfter"`
+}
+
+// Password selects how passwords are hashed and the policy new passwords have to meet. Hashes of another
+// algorithm or older parameters are still accepted and replaced on the next successful login
+type Password struct {
+	// Hasher is argon2id or bcrypt
+	Hasher string `yaml:"hasher" toml:"hasher"`
+	// Memory in KiB, Iterations and Parallelism are the argon2id parameters
+	Memory      int `yaml:"memory" toml:"memory"`
+	Iterations  int `yaml:"iterations" toml:"iterations"`
+	Parallelism int `yaml:"parallelism" toml:"parallelism"`
+	BcryptCost  int `yaml:"bcryptCost" toml:"bcryptCost"`
+	// MinLength and MaxLength count characters, bcrypt only reads the first 72 bytes of a password
+	MinLength int `yaml:"minLength" toml:"minLength"`
+	MaxLength int `yaml:"maxLength" toml:"maxLength"`
+	// BreachedList is a file of passwords that can not be chosen, one per line either as is or as the
+	// hex sha1 of the password optionally followed by :count like the downloads of Pwned Passwords
+	BreachedList string `yaml:"breachedList" toml:"breachedList"`
+}
+
+// RBAC defines roles next to the built in superAdmin, admin and owner ones, a role named after a built in one replaces it
+type RBAC struct {
+	Roles map[string]Role `yaml:"roles" toml:"roles"`
+}
+
+// Role grants permissions such as restaurant:update, restaurant:* grants every action on restaurants and * every
+// permission. Scope is all, created or owned and limits the owners and restaurants the role acts on to every one,
+// the ones its users created or the restaurants its users own
+type Role struct {
+	Scope       string   `yaml:"scope" toml:"scope"`
+	Permissions []string `yaml:"permissions" toml:"permissions"`
+}
+
+// OIDC lets admins log in with an OpenID Connect identity provider instead of a password, it is disabled
+// while Issuer is empty. The verified email of an identity selects the account of Role it logs in as
+type OIDC struct {
+	// Issuer is the url the discovery document is read from, it has to match the iss claim of ID tokens
+	Issuer       string `yaml:"issuer" toml:"issuer"`
+	ClientID     string `yaml:"clientID" toml:"clientID"`
+	ClientSecret string `yaml:"clientSecret" toml:"clientSecret"`
+	// RedirectURL is the callback registered with the provider, it has to reach /login/oidc/callback
+	RedirectURL string   `yaml:"redirectURL" toml:"redirectURL"`
+	Scopes      []string `yaml:"scopes" toml:"scopes"`
+	Role        string   `yaml:"role" toml:"role"`
+	// StateLifetime is how long a user has to complete a login at the provider
+	StateLifetime Duration `yaml:"stateLifetime" toml:"stateLifetime"`
+}
+
+// Bootstrap creates the first super admin when the server starts without one, it is disabled while
+// Email is empty. The account is created verified and later starts leave it unchanged
+type Bootstrap struct {
+	Email    string `yaml:"email" toml:"email"`
+	Name     string `yaml:"name" toml:"name"`
+	Password string `yaml:"password" toml:"password"`
+}
+
+// Duration is a time.Duration read from strings such as "90s" or "2h"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	value, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = value
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Default returns the configuration used for values that are not set anywhere else,
+// it has no database url or jwt secret so those must always be provided
+func Default() *Config {
+	return &Config{
+		Port:            "5000",
+		LogLevel:        "info",
+		ShutdownTimeout: Duration{15 * time.Second},
+		Auth: Auth{
+			TokenLifetime:             Duration{15 * time.Minute},
+			RefreshTokenLifetime:      Duration{30 * 24 * time.Hour},
+			PurgeInterval:             Duration{time.Hour},
+			DeletedAccountRetention:   Duration{30 * 24 * time.Hour},
+			ResetTokenLifetime:        Duration{time.Hour},
+			VerificationTokenLifetime: Duration{48 * time.Hour},
+			ChallengeLifetime:         Duration{5 * time.Minute},
+			TOTPIssuer:                "resman",
+			InvitationLifetime:        Duration{72 * time.Hour},
+			ImpersonationLifetime:     Duration{15 * time.Minute},
+		},
+		CORS: CORS{
+			AllowOrigin:  "*",
+			AllowHeaders: []string{"Content-Type", "Token", "Authorization", "X-API-Key"},
+			AllowMethods: []string{"GET", "POST", "PUT", "DELETE"},
+		},
+		Metrics: Metrics{
+			Buckets: []float64{2, 4, 6, 8, 10},
+		},
+		Mail: Mail{
+			Driver: "log",
+			From:   "resman@localhost",
+			SMTP:   SMTP{Port: 587},
+		},
+		Lockout: Lockout{
+			AccountThreshold: 5,
+			IPThreshold:      50,
+			BaseDuration:     Duration{time.Minute},
+			MaxDuration:      Duration{time.Hour},
+			ResetAfter:       Duration{time.Hour},
+		},
+		Password: Password{
+			Hasher:      "argon2id",
+			Memory:      19 * 1024,
+			Iterations:  2,
+			Parallelism: 1,
+			BcryptCost:  10,
+			MinLength:   8,
+			MaxLength:   128,
+		},
+		OIDC: OIDC{
+			Scopes:        []string{"openid", "email", "profile"},
+			Role:          "admin",
+			StateLifetime: Duration{10 * time.Minute},
+		},
+	}
+}
+
+// setting is a value that can be set from an environment variable and a command line flag
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	set   func(cfg *Config, value string) error
+}
+
+var settings = []setting{
+	{"PORT", "port", "port the server listens on", func(cfg *Config, value string) error {
+		cfg.Port = value
+		return nil
+	}},
+	{"LOG_LEVEL", "log-level", "log level (debug, info, warn, error)", func(cfg *Config, value string) error {
+		cfg.LogLevel = value
+		return nil
+	}},
+	{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "time given to in-flight requests on shutdown", func(cfg *Config, value string) error {
+		return cfg.ShutdownTimeout.UnmarshalText([]byte(value))
+	}},
+	{"DBURL", "db-url", "database url, the scheme selects the backend", func(cfg *Config, value string) error {
+		cfg.Database.URL = value
+		return nil
+	}},
+	{"DB_MAX_OPEN_CONNS", "db-max-open-conns", "maximum number of open database connections", func(cfg *Config, value string) error {
+		return setInt(&cfg.Database.MaxOpenConns, value)
+	}},
+	{"DB_MAX_IDLE_CONNS", "db-max-idle-conns", "maximum number of idle database connections", func(cfg *Config, value string) error {
+		return setInt(&cfg.Database.MaxIdleConns, value)
+	}},
+	{"DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "maximum lifetime of a database connection", func(cfg *Config, value string) error {
+		return cfg.Database.ConnMaxLifetime.UnmarshalText([]byte(value))
+	}},
+	{"DB_SKIP_MIGRATE", "db-skip-migrate", "do not apply migrations on start up (true or false)", func(cfg *Config, value string) error {
+		skip, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		cfg.Database.SkipMigrate = skip
+		return nil
+	}},
+	{"JWT_SECRET", "jwt-secret", "secret used to sign jwt tokens", func(cfg *Config, value string) error {
+		cfg.Auth.Secret = value
+		return nil
+	}},
+	{"JWT_KEYS", "jwt-keys", "comma separated list of id=file jwt keys", func(cfg *Config, value string) error {
+		cfg.Auth.Keys = []Key{}
+		for _, item := range splitList(value) {
+			parts := strings.SplitN(item, "=", 2)
+			if len(parts) != 2 {
+				return ErrInvalidKeys
+			}
+			cfg.Auth.Keys = append(cfg.Auth.Keys, Key{ID: strings.TrimSpace(parts[0]), File: strings.TrimSpace(parts[1])})
+		}
+		return nil
+	}},
+	{"JWT_SIGNING_KEY", "jwt-signing-key", "id of the jwt key used to sign new tokens", func(cfg *Config, value string) error {
+		cfg.Auth.SigningKey = value
+		return nil
+	}},
+	{"TOKEN_LIFETIME", "token-lifetime", "lifetime of issued jwt access tokens", func(cfg *Config, value string) error {
+		return cfg.Auth.TokenLifetime.UnmarshalText([]byte(value))
+	}},
+	{"REFRESH_TOKEN_LIFETIME", "refresh-token-lifetime", "lifetime of issued refresh tokens", func(cfg *Config, value string) error {
+		return cfg.Auth.RefreshTokenLifetime.UnmarshalText([]byte(value))
+	}},
+	{"TOKEN_PURGE_INTERVAL", "token-purge-interval", "interval between purges of expired token records", func(cfg *Config, value string) error {
+		return cfg.Auth.PurgeInterval.UnmarshalText([]byte(value))
+	}},
+	{"DELETED_ACCOUNT_RETENTION", "deleted-account-retention", "time deleted accounts are kept before they are purged, 0 keeps them", func(cfg *Config, value string) error {
+		return cfg.Auth.DeletedAccountRetention.UnmarshalText([]byte(value))
+	}},
+	{"RESET_TOKEN_LIFETIME", "reset-token-lifetime", "lifetime of password reset tokens", func(cfg *Config, value string) error {
+		return cfg.Auth.ResetTokenLifetime.UnmarshalText([]byte(value))
+	}},
+	{"PASSWORD_RESET_URL", "password-reset-url", "page completing password resets, linked from reset emails", func(cfg *Config, value string) error {
+		cfg.Auth.PasswordResetURL = value
+		return nil
+	}},
+	{"VERIFICATION_TOKEN_LIFETIME", "verification-token-lifetime", "lifetime of email verification tokens", func(cfg *Config, value string) error {
+		return cfg.Auth.VerificationTokenLifetime.UnmarshalText([]byte(value))
+	}},
+	{"CHALLENGE_TOKEN_LIFETIME", "challenge-token-lifetime", "time given to enter a two-factor code after the password", func(cfg *Config, value string) error {
+		return cfg.Auth.ChallengeLifetime.UnmarshalText([]byte(value))
+	}},
+	{"TOTP_ISSUER", "totp-issuer", "name of the server shown by authenticator apps", func(cfg *Config, value string) error {
+		cfg.Auth.TOTPIssuer = value
+		return nil
+	}},
+	{"EMAIL_VERIFICATION_URL", "email-verification-url", "page completing email verifications, linked from verification emails", func(cfg *Config, value string) error {
+		cfg.Auth.EmailVerificationURL = value
+		return nil
+	}},
+	{"INVITATION_LIFETIME", "invitation-lifetime", "lifetime of invitation links", func(cfg *Config, value string) error {
+		return cfg.Auth.InvitationLifetime.UnmarshalText([]byte(value))
+	}},
+	{"INVITATION_URL", "invitation-url", "page accepting invitations, linked from invitation emails", func(cfg *Config, value string) error {
+		cfg.Auth.InvitationURL = value
+		return nil
+	}},
+	{"IMPERSONATION_LIFETIME", "impersonation-lifetime", "lifetime of tokens acting as another user", func(cfg *Config, value string) error {
+		return cfg.Auth.ImpersonationLifetime.UnmarshalText([]byte(value))
+	}},
+	{"IMPERSONATION_READ_ONLY", "impersonation-read-only", "refuse requests changing data while impersonating (true or false)", func(cfg *Config, value string) error {
+		readOnly, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		cfg.Auth.ImpersonationReadOnly = readOnly
+		return nil
+	}},
+	{"CORS_ALLOW_ORIGIN", "cors-allow-origin", "value of the Access-Control-Allow-Origin header", func(cfg *Config, value string) error {
+		cfg.CORS.AllowOrigin = value
+		return nil
+	}},
+	{"CORS_ALLOW_HEADERS", "cors-allow-headers", "comma separated list of allowed request headers", func(cfg *Config, value string) error {
+		cfg.CORS.AllowHeaders = splitList(value)
+		return nil
+	}},
+	{"CORS_ALLOW_METHODS", "cors-allow-methods", "comma separated list of allowed request methods", func(cfg *Config, value string) error {
+		cfg.CORS.AllowMethods = splitList(value)
+		return nil
+	}},
+	{"METRICS_BUCKETS", "metrics-buckets", "comma separated request duration histogram buckets in milliseconds", func(cfg *Config, value string) error {
+		buckets := []float64{}
+		for _, item := range splitList(value) {
+			bucket, err := strconv.ParseFloat(item, 64)
+			if err != nil {
+				return err
+			}
+			buckets = append(buckets, bucket)
+		}
+		cfg.Metrics.Buckets = buckets
+		return nil
+	}},
+	{"MAIL_DRIVER", "mail-driver", "how emails are sent (smtp, file, log)", func(cfg *Config, value string) error {
+		cfg.Mail.Driver = value
+		return nil
+	}},
+	{"MAIL_FROM", "mail-from", "sender address of emails", func(cfg *Config, value string) error {
+		cfg.Mail.From = value
+		return nil
+	}},
+	{"MAIL_DIR", "mail-dir", "directory emails are written to by the file driver", func(cfg *Config, value string) error {
+		cfg.Mail.Dir = value
+		return nil
+	}},
+	{"SMTP_HOST", "smtp-host", "smtp server host", func(cfg *Config, value string) error {
+		cfg.Mail.SMTP.Host = value
+		return nil
+	}},
+	{"SMTP_PORT", "smtp-port", "smtp server port", func(cfg *Config, value string) error {
+		return setInt(&cfg.Mail.SMTP.Port, value)
+	}},
+	{"SMTP_USERNAME", "smtp-username", "smtp user name", func(cfg *Config, value string) error {
+		cfg.Mail.SMTP.Username = value
+		return nil
+	}},
+	{"SMTP_PASSWORD", "smtp-password", "smtp password", func(cfg *Config, value string) error {
+		cfg.Mail.SMTP.Password = value
+		return nil
+	}},
+	{"LOCKOUT_ACCOUNT_THRESHOLD", "lockout-account-threshold", "failed logins locking a user, 0 disables it", func(cfg *Config, value string) error {
+		return setInt(&cfg.Lockout.AccountThreshold, value)
+	}},
+	{"LOCKOUT_IP_THRESHOLD", "lockout-ip-threshold", "failed logins locking a source ip, 0 disables it", func(cfg *Config, value string) error {
+		return setInt(&cfg.Lockout.IPThreshold, value)
+	}},
+	{"LOCKOUT_BASE_DURATION", "lockout-base-duration", "first lock, doubled by every further failure", func(cfg *Config, value string) error {
+		return cfg.Lockout.BaseDuration.UnmarshalText([]byte(value))
+	}},
+	{"LOCKOUT_MAX_DURATION", "lockout-max-duration", "longest lockout", func(cfg *Config, value string) error {
+		return cfg.Lockout.MaxDuration.UnmarshalText([]byte(value))
+	}},
+	{"LOCKOUT_RESET_AFTER", "lockout-reset-after", "time after the last failed login its count is forgotten", func(cfg *Config, value string) error {
+		return cfg.Lockout.ResetAfter.UnmarshalText([]byte(value))
+	}},
+	{"PASSWORD_HASHER", "password-hasher", "algorithm new passwords are hashed with (argon2id, bcrypt)", func(cfg *Config, value string) error {
+		cfg.Password.Hasher = value
+		return nil
+	}},
+	{"ARGON2_MEMORY", "argon2-memory", "memory in KiB used to hash a password with argon2id", func(cfg *Config, value string) error {
+		return setInt(&cfg.Password.Memory, value)
+	}},
+	{"ARGON2_ITERATIONS", "argon2-iterations", "passes over the memory when hashing a password with argon2id", func(cfg *Config, value string) error {
+		return setInt(&cfg.Password.Iterations, value)
+	}},
+	{"ARGON2_PARALLELISM", "argon2-parallelism", "threads used to hash a password with argon2id", func(cfg *Config, value string) error {
+		return setInt(&cfg.Password.Parallelism, value)
+	}},
+	{"BCRYPT_COST", "bcrypt-cost", "cost of bcrypt password hashes", func(cfg *Config, value string) error {
+		return setInt(&cfg.Password.BcryptCost, value)
+	}},
+	{"PASSWORD_MIN_LENGTH", "password-min-length", "minimum number of characters of new passwords", func(cfg *Config, value string) error {
+		return setInt(&cfg.Password.MinLength, value)
+	}},
+	{"PASSWORD_MAX_LENGTH", "password-max-length", "maximum number of characters of new passwords", func(cfg *Config, value string) error {
+		return setInt(&cfg.Password.MaxLength, value)
+	}},
+	{"PASSWORD_BREACHED_LIST", "password-breached-list", "file of breached passwords or their sha1 that new passwords can not be", func(cfg *Config, value string) error {
+		cfg.Password.BreachedList = value
+		return nil
+	}},
+	{"OIDC_ISSUER", "oidc-issuer", "issuer url of the identity provider admins log in with, empty disables it", func(cfg *Config, value string) error {
+		cfg.OIDC.Issuer = value
+		return nil
+	}},
+	{"OIDC_CLIENT_ID", "oidc-client-id", "client id registered with the identity provider", func(cfg *Config, value string) error {
+		cfg.OIDC.ClientID = value
+		return nil
+	}},
+	{"OIDC_CLIENT_SECRET", "oidc-client-secret", "client secret registered with the identity provider", func(cfg *Config, value string) error {
+		cfg.OIDC.ClientSecret = value
+		return nil
+	}},
+	{"OIDC_REDIRECT_URL", "oidc-redirect-url", "callback url registered with the identity provider", func(cfg *Config, value string) error {
+		cfg.OIDC.RedirectURL = value
+		return nil
+	}},
+	{"OIDC_SCOPES", "oidc-scopes", "comma separated list of scopes requested from the identity provider", func(cfg *Config, value string) error {
+		cfg.OIDC.Scopes = splitList(value)
+		return nil
+	}},
+	{"OIDC_ROLE", "oidc-role", "role of the accounts identities log in as", func(cfg *Config, value string) error {
+		cfg.OIDC.Role = value
+		return nil
+	}},
+	{"BOOTSTRAP_EMAIL", "bootstrap-email", "email of the super admin created when there is none, empty disables it", func(cfg *Config, value string) error {
+		cfg.Bootstrap.Email = value
+		return nil
+	}},
+	{"BOOTSTRAP_NAME", "bootstrap-name", "name of the bootstrap super admin", func(cfg *Config, value string) error {
+		cfg.Bootstrap.Name = value
+		return nil
+	}},
+	{"BOOTSTRAP_PASSWORD", "bootstrap-password", "password of the bootstrap super admin", func(cfg *Config, value string) error {
+		cfg.Bootstrap.Password = value
+		return nil
+	}},
+}
+
+// Load parses the configuration and validates every setting the server needs
+func Load(args []string) (*Config, error) {
+	return load(args, os.LookupEnv)
+}
+
+// Parse builds the configuration from the defaults, the file named by the -config flag or the
+// CONFIG_FILE environment variable, the environment and the given command line arguments,
+// the result is not validated
+func Parse(args []string) (*Config, error) {
+	return parse(args, os.LookupEnv)
+}
+
+func load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg, err := parse(args, lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	err = cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func parse(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	flags := flag.NewFlagSet("resman", flag.ContinueOnError)
+	configFile := flags.String("config", "", "path of a yaml or toml config file")
+	values := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		values[s.flag] = flags.String(s.flag, "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("%v: %s", ErrUnexpectedArgs, strings.Join(flags.Args(), " "))
+	}
+
+	cfg := Default()
+	path := *configFile
+	if path == "" {
+		path, _ = lookupEnv("CONFIG_FILE")
+	}
+	if path != "" {
+		err = cfg.LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range settings {
+		value, ok := lookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		err = s.set(cfg, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %v", s.env, err)
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if err == nil && s.flag == f.Name {
+				if setErr := s.set(cfg, *values[s.flag]); setErr != nil {
+					err = fmt.Errorf("invalid value of -%s: %v", s.flag, setErr)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadFile overrides the configuration with the values present in a yaml or toml file
+func (cfg *Config) LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, cfg)
+	case ".toml":
+		var md toml.MetaData
+		md, err = toml.Decode(string(data), cfg)
+		// like yaml, keys that match no setting are refused instead of ignored
+		if err == nil && len(md.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown keys %v", md.Undecoded())
+		}
+	default:
+		return ErrFileFormat
+	}
+	if err != nil {
+		return fmt.Errorf("can not parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate reports the first setting that would prevent the server from starting
+func (cfg *Config) Validate() error {
+	port, err := strconv.Atoi(cfg.Port)
+	if err != nil || port < 1 || port > 65535 {
+		return ErrInvalidPort
+	}
+	_, err = logrus.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return ErrInvalidLogLevel
+	}
+	if cfg.ShutdownTimeout.Duration <= 0 {
+		return ErrInvalidShutdown
+	}
+	err = cfg.Database.Validate()
+	if err != nil {
+		return err
+	}
+	err = cfg.Auth.validateKeys()
+	if err != nil {
+		return err
+	}
+	if cfg.Auth.TokenLifetime.Duration <= 0 || cfg.Auth.RefreshTokenLifetime.Duration < cfg.Auth.TokenLifetime.Duration {
+		return ErrInvalidLifetime
+	}
+	if cfg.Auth.PurgeInterval.Duration <= 0 {
+		return ErrInvalidPurge
+	}
+	if cfg.Auth.DeletedAccountRetention.Duration < 0 {
+		return ErrInvalidRetention
+	}
+	if cfg.Auth.ResetTokenLifetime.Duration <= 0 || cfg.Auth.VerificationTokenLifetime.Duration <= 0 || cfg.Auth.ChallengeLifetime.Duration <= 0 ||
+		cfg.Auth.InvitationLifetime.Duration <= 0 || cfg.Auth.ImpersonationLifetime.Duration <= 0 {
+		return ErrInvalidLifetime
+	}
+	err = cfg.Mail.Validate()
+	if err != nil {
+		return err
+	}
+	err = cfg.Lockout.Validate()
+	if err != nil {
+		return err
+	}
+	err = cfg.Password.Validate()
+	if err != nil {
+		return err
+	}
+	err = cfg.OIDC.Validate()
+	if err != nil {
+		return err
+	}
+	err = cfg.Bootstrap.Validate()
+	if err != nil {
+		return err
+	}
+	if len(cfg.Metrics.Buckets) == 0 {
+		return ErrInvalidBuckets
+	}
+	for i, bucket := range cfg.Metrics.Buckets {
+		if bucket <= 0 || (i > 0 && bucket <= cfg.Metrics.Buckets[i-1]) {
+			return ErrInvalidBuckets
+		}
+	}
+	return nil
+}
+
+// Validate reports settings that would prevent connecting to the database
+func (db *Database) Validate() error {
+	if db.URL == "" {
+		return ErrNoDatabaseURL
+	}
+	if db.MaxOpenConns < 0 || db.MaxIdleConns < 0 || db.ConnMaxLifetime.Duration < 0 {
+		return ErrInvalidPool
+	}
+	return nil
+}
+
+// Validate reports settings that would make the lockout refuse every login or none
+func (lockout *Lockout) Validate() error {
+	if lockout.AccountThreshold < 0 || lockout.IPThreshold < 0 || lockout.BaseDuration.Duration <= 0 ||
+		lockout.MaxDuration.Duration < lockout.BaseDuration.Duration || lockout.ResetAfter.Duration <= 0 {
+		return ErrInvalidLockout
+	}
+	return nil
+}
+
+// Validate reports hasher parameters out of range and length limits no password can meet
+func (password *Password) Validate() error {
+	if password.MinLength < 1 || password.MaxLength < password.MinLength {
+		return ErrInvalidPassword
+	}
+	switch password.Hasher {
+	case "argon2id":
+		if password.Memory < 8*password.Parallelism || password.Iterations < 1 || password.Parallelism < 1 || password.Parallelism > 255 {
+			return ErrInvalidPassword
+		}
+	case "bcrypt":
+		if password.BcryptCost < 4 || password.BcryptCost > 31 {
+			return ErrInvalidPassword
+		}
+	default:
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// Validate reports settings missing to log in with the identity provider, it accepts a disabled provider
+func (oidc *OIDC) Validate() error {
+	if oidc.Issuer == "" {
+		return nil
+	}
+	if oidc.ClientID == "" || oidc.RedirectURL == "" || oidc.Role == "" || oidc.StateLifetime.Duration <= 0 {
+		return ErrInvalidOIDC
+	}
+	return nil
+}
+
+// Validate reports a bootstrap super admin missing a value, it accepts a disabled bootstrap
+func (boot *Bootstrap) Validate() error {
+	if boot.Email == "" {
+		return nil
+	}
+	if boot.Name == "" || boot.Password == "" {
+		return ErrInvalidBoot
+	}
+	return nil
+}
+
+// Validate reports settings that would prevent sending emails
+func (mail *Mail) Validate() error {
+	if mail.From == "" {
+		return ErrInvalidMail
+	}
+	switch mail.Driver {
+	case "log":
+		return nil
+	case "file":
+		if mail.Dir == "" {
+			return ErrInvalidMail
+		}
+		return nil
+	case "smtp":
+		if mail.SMTP.Host == "" || mail.SMTP.Port < 1 || mail.SMTP.Port > 65535 {
+			return ErrInvalidMail
+		}
+		return nil
+	}
+	return ErrInvalidMail
+}
+
+func (auth *Auth) validateKeys() error {
+	if len(auth.Keys) == 0 || auth.Secret != "" {
+		if len(auth.Secret) < minSecretLength {
+			return ErrShortSecret
+		}
+	}
+	if len(auth.Keys) == 0 {
+		if auth.SigningKey != "" {
+			return ErrInvalidKeys
+		}
+		return nil
+	}
+	ids := map[string]bool{}
+	for _, key := range auth.Keys {
+		if key.ID == "" || key.File == "" || ids[key.ID] {
+			return ErrInvalidKeys
+		}
+		ids[key.ID] = true
+	}
+	if auth.SigningKey == "" || !ids[auth.SigningKey] {
+		return ErrInvalidKeys
+	}
+	return nil
+}
+
+// Level returns the logrus level of a validated configuration
+func (cfg *Config) Level() logrus.Level {
+	level, err := logrus.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return logrus.InfoLevel
+	}
+	return level
+}
+
+func setInt(target *int, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*target = n
+	return nil
+}
+
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
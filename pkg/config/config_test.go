@@ -0,0 +1,231 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef"
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "resman-config")
+	if err != nil {
+		t.Fatalf("can not create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, name)
+	err = ioutil.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatalf("can not write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := load(nil, env(map[string]string{"DBURL": "memory://", "JWT_SECRET": testSecret}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Default()
+	want.Database.URL = "memory://"
+	want.Auth.Secret = testSecret
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got %+v want %+v", cfg, want)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := writeFile(t, "resman.yaml", `
+port: "6000"
+logLevel: debug
+database:
+  url: "memory://"
+  maxOpenConns: 10
+auth:
+  secret: "from-the-yaml-file"
+  tokenLifetime: 30m
+cors:
+  allowOrigin: "https://example.com"
+metrics:
+  buckets: [1, 5, 25]
+`)
+	tomlFile := writeFile(t, "resman.toml", `
+port = "6000"
+logLevel = "debug"
+
+[database]
+url = "memory://"
+maxOpenConns = 10
+
+[auth]
+secret = "from-the-toml-file"
+tokenLifetime = "30m"
+
+[cors]
+allowOrigin = "https://example.com"
+
+[metrics]
+buckets = [1.0, 5.0, 25.0]
+`)
+	for _, path := range []string{yamlFile, tomlFile} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			cfg, err := load(
+				[]string{"-config", path, "-port", "7000"},
+				env(map[string]string{"PORT": "6500", "TOKEN_LIFETIME": "1h", "CORS_ALLOW_METHODS": "GET, POST"}),
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.Port != "7000" {
+				t.Errorf("flag should override env and file, got port %s", cfg.Port)
+			}
+			if cfg.Auth.TokenLifetime.Duration != time.Hour {
+				t.Errorf("env should override file, got lifetime %v", cfg.Auth.TokenLifetime)
+			}
+			if cfg.LogLevel != "debug" || cfg.Database.MaxOpenConns != 10 || cfg.CORS.AllowOrigin != "https://example.com" {
+				t.Errorf("file values not applied: %+v", cfg)
+			}
+			if !reflect.DeepEqual(cfg.CORS.AllowMethods, []string{"GET", "POST"}) {
+				t.Errorf("got allowed methods %v", cfg.CORS.AllowMethods)
+			}
+			if !reflect.DeepEqual(cfg.CORS.AllowHeaders, Default().CORS.AllowHeaders) {
+				t.Errorf("defaults should be kept for unset values, got %v", cfg.CORS.AllowHeaders)
+			}
+			if !reflect.DeepEqual(cfg.Metrics.Buckets, []float64{1, 5, 25}) {
+				t.Errorf("got buckets %v", cfg.Metrics.Buckets)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	path := writeFile(t, "resman.yml", "database:\n  url: \"memory://\"\nauth:\n  secret: \""+testSecret+"\"\n")
+	cfg, err := load(nil, env(map[string]string{"CONFIG_FILE": path}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Database.URL != "memory://" {
+		t.Errorf("got database url %q", cfg.Database.URL)
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	cfg, err := load([]string{"-jwt-signing-key", "new"}, env(map[string]string{"DBURL": "memory://", "JWT_KEYS": "old=/keys/old.pem, new=/keys/new.pem"}))
+	if err != nil {
+		t.Fatalf("keys should replace the secret: %v", err)
+	}
+	want := []Key{{ID: "old", File: "/keys/old.pem"}, {ID: "new", File: "/keys/new.pem"}}
+	if !reflect.DeepEqual(cfg.Auth.Keys, want) || cfg.Auth.SigningKey != "new" {
+		t.Errorf("got keys %v signing with %q", cfg.Auth.Keys, cfg.Auth.SigningKey)
+	}
+	_, err = load(nil, env(map[string]string{"DBURL": "memory://", "JWT_KEYS": "a=a.pem", "JWT_SIGNING_KEY": "a", "JWT_SECRET": "short"}))
+	if err != ErrShortSecret {
+		t.Errorf("a secret kept next to keys must still be long enough, got %v", err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	valid := map[string]string{"DBURL": "memory://", "JWT_SECRET": testSecret}
+	with := func(key, value string) map[string]string {
+		values := map[string]string{}
+		for k, v := range valid {
+			values[k] = v
+		}
+		values[key] = value
+		return values
+	}
+	withKeys := func(keys, signingKey string) map[string]string {
+		values := with("JWT_KEYS", keys)
+		values["JWT_SIGNING_KEY"] = signingKey
+		return values
+	}
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		err  error
+	}{
+		{"no database", nil, with("DBURL", ""), ErrNoDatabaseURL},
+		{"short secret", nil, with("JWT_SECRET", "SecretKey"), ErrShortSecret},
+		{"bad port", []string{"-port", "http"}, valid, ErrInvalidPort},
+		{"bad log level", nil, with("LOG_LEVEL", "loud"), ErrInvalidLogLevel},
+		{"negative lifetime", nil, with("TOKEN_LIFETIME", "-1m"), ErrInvalidLifetime},
+		{"refresh shorter than access", nil, with("REFRESH_TOKEN_LIFETIME", "5m"), ErrInvalidLifetime},
+		{"no purge interval", nil, with("TOKEN_PURGE_INTERVAL", "0s"), ErrInvalidPurge},
+		{"negative account retention", nil, with("DELETED_ACCOUNT_RETENTION", "-1h"), ErrInvalidRetention},
+		{"no shutdown timeout", nil, with("SHUTDOWN_TIMEOUT", "0s"), ErrInvalidShutdown},
+		{"negative pool", nil, with("DB_MAX_IDLE_CONNS", "-1"), ErrInvalidPool},
+		{"unordered buckets", nil, with("METRICS_BUCKETS", "4,2"), ErrInvalidBuckets},
+		{"no buckets", nil, with("METRICS_BUCKETS", ""), ErrInvalidBuckets},
+		{"keys without signing key", nil, with("JWT_KEYS", "a=a.pem"), ErrInvalidKeys},
+		{"unknown signing key", nil, withKeys("a=a.pem", "b"), ErrInvalidKeys},
+		{"duplicate key id", nil, withKeys("a=a.pem,a=b.pem", "a"), ErrInvalidKeys},
+		{"no reset token lifetime", nil, with("RESET_TOKEN_LIFETIME", "0s"), ErrInvalidLifetime},
+		{"no verification token lifetime", nil, with("VERIFICATION_TOKEN_LIFETIME", "0s"), ErrInvalidLifetime},
+		{"no challenge lifetime", nil, with("CHALLENGE_TOKEN_LIFETIME", "0s"), ErrInvalidLifetime},
+		{"unknown mail driver", nil, with("MAIL_DRIVER", "pigeon"), ErrInvalidMail},
+		{"smtp without host", nil, with("MAIL_DRIVER", "smtp"), ErrInvalidMail},
+		{"file mailer without dir", nil, with("MAIL_DRIVER", "file"), ErrInvalidMail},
+		{"no sender", nil, with("MAIL_FROM", ""), ErrInvalidMail},
+		{"negative lockout threshold", nil, with("LOCKOUT_IP_THRESHOLD", "-1"), ErrInvalidLockout},
+		{"lockout max below base", nil, with("LOCKOUT_MAX_DURATION", "30s"), ErrInvalidLockout},
+		{"oidc without client", nil, with("OIDC_ISSUER", "https://idp.example.com"), ErrInvalidOIDC},
+		{"bootstrap without password", nil, with("BOOTSTRAP_EMAIL", "super@example.com"), ErrInvalidBoot},
+		{"zero invitation lifetime", nil, with("INVITATION_LIFETIME", "0s"), ErrInvalidLifetime},
+		{"zero impersonation lifetime", nil, with("IMPERSONATION_LIFETIME", "0s"), ErrInvalidLifetime},
+		{"unknown password hasher", nil, with("PASSWORD_HASHER", "md5"), ErrInvalidPassword},
+		{"no argon2 iterations", nil, with("ARGON2_ITERATIONS", "0"), ErrInvalidPassword},
+		{"password max below min", nil, with("PASSWORD_MAX_LENGTH", "6"), ErrInvalidPassword},
+		{"unknown file format", []string{"-config", "resman.json"}, valid, ErrFileFormat},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.err == ErrFileFormat {
+				test.args[1] = writeFile(t, "resman.json", "{}")
+			}
+			_, err := load(test.args, env(test.env))
+			if err != test.err {
+				t.Errorf("got error %v want %v", err, test.err)
+			}
+		})
+	}
+
+	_, err := load(nil, env(with("TOKEN_LIFETIME", "two hours")))
+	if err == nil {
+		t.Errorf("expected an error for an unparsable duration")
+	}
+	_, err = load(nil, env(withKeys("a.pem", "a")))
+	if err == nil {
+		t.Errorf("expected an error for a key without id")
+	}
+	_, err = load(nil, env(with("DB_SKIP_MIGRATE", "sometimes")))
+	if err == nil {
+		t.Errorf("expected an error for an unparsable boolean")
+	}
+	_, err = load([]string{"-port", "7000", "serve"}, env(valid))
+	if err == nil {
+		t.Errorf("expected an error for a positional argument")
+	}
+	path := writeFile(t, "resman.yaml", "database:\n  uri: \"memory://\"\n")
+	_, err = load([]string{"-config", path}, env(valid))
+	if err == nil {
+		t.Errorf("expected an error for an unknown yaml key")
+	}
+	path = writeFile(t, "resman.toml", "[database]\nuri = \"memory://\"\n")
+	_, err = load([]string{"-config", path}, env(valid))
+	if err == nil {
+		t.Errorf("expected an error for an unknown toml key")
+	}
+}
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/rbac"
+	"net/http"
+	"time"
+)
+
+// apiKeyPrefixLength is how much of a key is kept in clear to tell the keys of a user apart
+const apiKeyPrefixLength = 10
+
+var ErrAPIKeyManagesKeys = errors.New("api keys can not manage api keys, log in to do it")
+
+type apiKeyRequest struct {
+	Name        string   `json:"name" binding:"required,max=50"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+type APIKeyController struct {
+	database.Database
+	policy *rbac.Policy
+}
+
+func NewAPIKeyController(db database.Database, policy *rbac.Policy) *APIKeyController {
+	ac := new(APIKeyController)
+	ac.Database = db
+	ac.policy = policy
+	return ac
+}
+
+// Create issues an api key acting as the logged in user with the requested permissions, which have to
+// be granted to the role of the user. The key is only returned by this request
+func (a *APIKeyController) Create(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	userAuth, ok := a.loggedInUser(c)
+	if !ok {
+		return
+	}
+	var req apiKeyRequest
+	logger.LogDebug(reqId, reqUrl, "parsing request body")
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing request body: %v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	permissions, err := rbac.Expand(req.Permissions)
+	if err == nil {
+		for _, permission := range permissions {
+			if !a.policy.Can(userAuth.Role, permission) {
+				err = fmt.Errorf("%s is not allowed to %s", userAuth.Role, permission)
+				break
+			}
+		}
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("invalid api key permissions: %v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	plain, err := encryption.NewOpaqueToken()
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not generate api key: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	plain = models.APIKeyPrefix + plain
+	key := &models.APIKey{
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		Hash:        encryption.HashOpaqueToken(plain),
+		Prefix:      plain[:apiKeyPrefixLength],
+		UserID:      userAuth.ID,
+		Role:        userAuth.Role,
+		Permissions: permissions,
+		CreatedAt:   time.Now(),
+	}
+	err = a.CreateAPIKey(c.Request.Context(), key)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not store api key: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "api key created", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"key":    plain,
+		"apiKey": key,
+		"msg":    "Keep the key in a safe place, it can not be shown again",
+		"status": Success,
+	})
+}
+
+// List returns the api keys of the logged in user without the keys themselves
+func (a *APIKeyController) List(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	userAuth, ok := a.loggedInUser(c)
+	if !ok {
+		return
+	}
+	keys, err := a.ShowAPIKeys(c.Request.Context(), userAuth.ID, userAuth.Role)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not show api keys: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "api keys listed", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"apiKeys": keys,
+	})
+}
+
+// Revoke deletes an api key of the logged in user, requests made with it are refused from then on
+func (a *APIKeyController) Revoke(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	userAuth, ok := a.loggedInUser(c)
+	if !ok {
+		return
+	}
+	err := a.RevokeAPIKey(c.Request.Context(), userAuth.ID, userAuth.Role, c.Param("keyID"))
+	if err == database.ErrAPIKeyNotFound {
+		logger.LogError(reqId, reqUrl, err.Error(), http.StatusNotFound)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not revoke api key: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "api key revoked", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"msg":    "api key revoked",
+		"status": Success,
+	})
+}
+
+// loggedInUser returns the user set by AuthMiddleware, it refuses requests made with an api key so
+// a leaked key can not be used to mint more keys or to revoke the ones of the user
+func (a *APIKeyController) loggedInUser(c *gin.Context) (*models.UserAuth, bool) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	if userAuth.APIKey != nil {
+		logger.LogError(reqId, reqUrl, ErrAPIKeyManagesKeys.Error(), http.StatusForbidden)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": ErrAPIKeyManagesKeys.Error(),
+		})
+		return nil, false
+	}
+	return userAuth, true
+}
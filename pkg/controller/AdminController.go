@@ -1,7 +1,6 @@
 package controller
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/vds/go-resman/pkg/database"
@@ -23,26 +22,26 @@ func NewAdminController(db database.Database) *AdminController {
 
 func (a *AdminController) GetAdmins(c *gin.Context) {
 	reqId,reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
-	jsonData := &[]models.UserOutput{}
-	var stringData string
-	var err error
+	logger.LogDebug(reqId, reqUrl, "parsing list query parameters")
+	opts, err := getUserListOptions(c)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing query parameters:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 	logger.LogDebug(reqId, reqUrl, "getting admins from db")
-	stringData, err = a.ShowAdmins(c.Request.Context())
+	admins, total, err := a.ShowAdmins(c.Request.Context(), opts)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in retrieving admins from db:%v", err), http.StatusInternalServerError)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
+		return
 	}
-	if stringData != "" {
-		_ = json.Unmarshal([]byte(stringData), jsonData)
-		logger.LogInfo(reqId, reqUrl, "admins retrieved  successful", http.StatusOK)
-		c.JSON(http.StatusOK, jsonData)
-
-	} else {
-		logger.LogInfo(reqId, reqUrl, "no admins to show", http.StatusOK)
-		c.JSON(http.StatusOK, []models.UserOutput{})
-	}
+	logger.LogInfo(reqId, reqUrl, "admins retrieved  successful", http.StatusOK)
+	c.JSON(http.StatusOK, newPage(admins, total, opts))
 }
 
 func (a *AdminController) EditAdmin(c *gin.Context) {
@@ -60,19 +59,27 @@ func (a *AdminController) EditAdmin(c *gin.Context) {
 		})
 		return
 	}
-	logger.LogDebug(reqId, reqUrl, "checking requested admin id")
-	err = a.CheckAdmin(c.Request.Context(), admin.ID)
-	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("requested admin id does not exist: %v", err), http.StatusBadRequest)
+	var checkErr error
+	var updatedAdmin *models.UserOutput
+	err = a.WithTx(c.Request.Context(), func(tx database.Database) error {
+		logger.LogDebug(reqId, reqUrl, "checking requested admin id")
+		checkErr = tx.CheckAdmin(c.Request.Context(), admin.ID)
+		if checkErr != nil {
+			return checkErr
+		}
+		logger.LogDebug(reqId, reqUrl, "updating requested admin")
+		updatedAdmin, err = tx.UpdateAdmin(c.Request.Context(), &admin)
+		return err
+	})
+	if checkErr != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("requested admin id does not exist: %v", checkErr), http.StatusBadRequest)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Admin does not exist",
 		})
 		return
 	}
-	logger.LogDebug(reqId, reqUrl, "updating requested admin")
-	adminString, err := a.UpdateAdmin(c.Request.Context(), &admin)
 	if err != nil {
-		if strings.Contains(err.Error(),"1062"){
+		if err == database.ErrDupEmail || strings.Contains(err.Error(),"1062"){
 			logger.LogError(reqId, reqUrl, fmt.Sprintf("duplicate email : %v", err), http.StatusBadRequest)
 			c.JSON(http.StatusBadRequest,gin.H{
 				"error": "duplicate email try with a different one",
@@ -83,10 +90,8 @@ func (a *AdminController) EditAdmin(c *gin.Context) {
 		c.Writer.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	jsonData := &models.UserOutput{}
-	_ = json.Unmarshal([]byte(adminString), jsonData)
 	logger.LogInfo(reqId, reqUrl, "admin updated successfully", http.StatusOK)
-	c.JSON(http.StatusOK, jsonData)
+	c.JSON(http.StatusOK, updatedAdmin)
 }
 
 func (a *AdminController) DeleteAdmins(c *gin.Context) {
@@ -114,7 +119,9 @@ func (a *AdminController) DeleteAdmins(c *gin.Context) {
 	//	return
 	//}
 	logger.LogDebug(reqId, reqUrl, "deleting requested admins")
-	err := a.RemoveAdmins(c.Request.Context(), idArr...)
+	err := runBulk(c.Request.Context(), a.Database, func(tx database.Database) error {
+		return tx.RemoveAdmins(c.Request.Context(), idArr...)
+	})
 	if err != nil {
 		if err != database.ErrInternal {
 			logger.LogError(reqId, reqUrl, fmt.Sprintf("admin does not exist:%v", err), http.StatusBadRequest)
@@ -131,3 +138,77 @@ func (a *AdminController) DeleteAdmins(c *gin.Context) {
 		"msg": "Admins deleted successfully",
 	})
 }
+
+// SuspendAdmin suspends the account of an admin and ends its sessions, the admin can not log in until a
+// super admin reactivates the account
+func (a *AdminController) SuspendAdmin(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	adminID := c.Param("adminID")
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	var checkErr error
+	err := a.WithTx(c.Request.Context(), func(tx database.Database) error {
+		logger.LogDebug(reqId, reqUrl, "checking requested admin id")
+		checkErr = tx.CheckAdmin(c.Request.Context(), adminID)
+		if checkErr != nil {
+			return checkErr
+		}
+		logger.LogDebug(reqId, reqUrl, "suspending requested admin")
+		return tx.SuspendUser(c.Request.Context(), adminID)
+	})
+	if checkErr != nil || err == database.ErrUserNotFound {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("requested admin id does not exist: %v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Admin does not exist",
+		})
+		return
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not suspend admin: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogAudit(reqId, reqUrl, "account suspended", http.StatusOK, userAuth.Role+" "+userAuth.ID, adminID)
+	c.JSON(http.StatusOK, gin.H{
+		"msg": "Admin suspended successfully",
+	})
+}
+
+// Reactivate makes a suspended or deleted account active again, deleted accounts can only be reactivated
+// until they are purged and while no other account uses their email
+func (a *AdminController) Reactivate(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	userID := c.Param("userID")
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	logger.LogDebug(reqId, reqUrl, "reactivating requested user")
+	user, err := a.ReactivateUser(c.Request.Context(), userID)
+	if err == database.ErrUserNotFound {
+		logger.LogError(reqId, reqUrl, err.Error(), http.StatusNotFound)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err == database.ErrDupEmail {
+		// the email of the deleted account was taken by a new one
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not reactivate user: %v", err), http.StatusConflict)
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not reactivate user: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogAudit(reqId, reqUrl, "account reactivated", http.StatusOK, userAuth.Role+" "+userAuth.ID, user.Role+" "+user.ID)
+	c.JSON(http.StatusOK, user)
+}
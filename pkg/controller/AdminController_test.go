@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/vds/go-resman/pkg/database/mysql"
 	"github.com/vds/go-resman/pkg/server"
+	"github.com/vds/go-resman/pkg/testhelpers"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -12,19 +13,19 @@ import (
 )
 
 func TestAdminController(t *testing.T) {
-	var DB, _ = mysql.NewMySqlDB("restaurant_test")
+	DB := mySqlDB(t)
 	defer DB.Close()
 	defer CleanDB(DB)
-	svr, err := server.NewServer(DB)
+	svr, err := server.NewServer(DB, testhelpers.Config("restaurant_test"))
 	router, _ := svr.Start()
 	if err != nil {
 		panic(err)
 	}
-	token := GetSuperToken(router)
+	token := GetSuperToken(router.Engine)
 	t.Run("get admins with a valid token", func(t *testing.T) {
 		request := NewGetAdminRequest(token)
 		response := httptest.NewRecorder()
-		router.ServeHTTP(response, request)
+		router.Engine.ServeHTTP(response, request)
 		assertStatus(t, response.Code, http.StatusOK)
 	})
 
@@ -49,7 +50,7 @@ func TestAdminController(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewUpdateAdminRequest(token, test.adminID, test.userName, test.email)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
@@ -72,7 +73,7 @@ func TestAdminController(t *testing.T) {
 			idToDelete := test.idArr
 			request := NewDeleteAdminRequest(token, idToDelete)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/logger"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// readinessTimeout bounds the database checks done for a readiness probe
+const readinessTimeout = 2 * time.Second
+
+type HealthController struct {
+	database.Database
+	draining int32
+}
+
+func NewHealthController(db database.Database) *HealthController {
+	hc := new(HealthController)
+	hc.Database = db
+	return hc
+}
+
+// Drain makes readiness fail so that no new traffic is routed to a server that is shutting down
+func (h *HealthController) Drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+// Liveness reports that the process is able to serve requests
+func (h *HealthController) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+	})
+}
+
+// Readiness reports whether the server is not shutting down, the database is reachable and its migrations are complete
+func (h *HealthController) Readiness(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+	if atomic.LoadInt32(&h.draining) == 1 {
+		logger.LogInfo(reqId, reqUrl, "server is shutting down", http.StatusServiceUnavailable)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "shutting down",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+	logger.LogDebug(reqId, reqUrl, "checking database readiness")
+	status, err := h.MigrationStatus(ctx)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("database is not reachable: %v", err), http.StatusServiceUnavailable)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":   "unavailable",
+			"database": "unreachable",
+		})
+		return
+	}
+	if !status.Complete() {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("database migrations are not complete: %+v", status), http.StatusServiceUnavailable)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":     "unavailable",
+			"database":   "ok",
+			"migrations": status,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "ready",
+		"database":   "ok",
+		"migrations": status,
+	})
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/rbac"
+	"net/http"
+	"time"
+)
+
+var ErrNestedImpersonation = errors.New("impersonation has to be started with your own login")
+
+type impersonationRequest struct {
+	Role  string `json:"role" binding:"required"`
+	Email string `json:"email" binding:"required"`
+}
+
+type ImpersonationController struct {
+	database.Database
+	keys   *encryption.KeySet
+	auth   *config.Auth
+	policy *rbac.Policy
+}
+
+func NewImpersonationController(db database.Database, keys *encryption.KeySet, auth *config.Auth, policy *rbac.Policy) *ImpersonationController {
+	ic := new(ImpersonationController)
+	ic.Database = db
+	ic.keys = keys
+	ic.auth = auth
+	ic.policy = policy
+	return ic
+}
+
+// Impersonate issues a token acting as the user with the given role and email, requests made with it
+// see what that user sees and are audited with both identities. The token carries the caller in its act
+// claim, it can not be refreshed and super admins can not be impersonated
+func (i *ImpersonationController) Impersonate(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	if userAuth.APIKey != nil || userAuth.Actor != nil {
+		logger.LogError(reqId, reqUrl, ErrNestedImpersonation.Error(), http.StatusForbidden)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  ErrNestedImpersonation.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	var req impersonationRequest
+	logger.LogDebug(reqId, reqUrl, "parsing request body")
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing request body:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	if !i.policy.IsRole(req.Role) || req.Role == middleware.SuperAdmin {
+		logger.LogError(reqId, reqUrl, "invalid role", http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  fmt.Sprintf("%s can not be impersonated", req.Role),
+			"status": Fail,
+		})
+		return
+	}
+	userID, err := i.FindUserID(c.Request.Context(), req.Role, req.Email)
+	if err == database.ErrUserNotFound {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not impersonate user: %v", err), http.StatusNotFound)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not find user: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	actor := &models.Actor{ID: userAuth.ID, Role: userAuth.Role}
+	token, err := encryption.CreateImpersonationToken(c.Request.Context(), &models.Claims{ID: userID, Role: req.Role}, actor, i.keys)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not create impersonation token: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogAudit(reqId, reqUrl, "impersonation started", http.StatusOK, userAuth.Role+" "+userAuth.ID, req.Role+" "+userID)
+	c.JSON(http.StatusOK, gin.H{
+		"token":     token,
+		"expiresAt": time.Now().Add(i.auth.ImpersonationLifetime.Duration),
+		"impersonating": gin.H{
+			"id":    userID,
+			"role":  req.Role,
+			"email": req.Email,
+		},
+		"readOnly": i.auth.ImpersonationReadOnly,
+		"msg":      "Impersonation Started",
+		"status":   Success,
+	})
+}
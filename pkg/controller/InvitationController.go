@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/mail"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/rbac"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrInvalidInvitation = errors.New("invitation is invalid or expired")
+	ErrAccountExists     = errors.New("an account of this role already uses the email")
+)
+
+type invitationRequest struct {
+	Role  string `json:"role" binding:"required"`
+	Email string `json:"email" binding:"required,email"`
+}
+
+type acceptInvitationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type InvitationController struct {
+	database.Database
+	mailer mail.Mailer
+	keys   *encryption.KeySet
+	auth   *config.Auth
+	policy *rbac.Policy
+	// passwords checks the passwords chosen by the invited users
+	passwords *encryption.PasswordPolicy
+}
+
+func NewInvitationController(db database.Database, mailer mail.Mailer, keys *encryption.KeySet, auth *config.Auth, policy *rbac.Policy, passwords *encryption.PasswordPolicy) *InvitationController {
+	ic := new(InvitationController)
+	ic.Database = db
+	ic.mailer = mailer
+	ic.keys = keys
+	ic.auth = auth
+	ic.policy = policy
+	ic.passwords = passwords
+	return ic
+}
+
+// Invite emails a signed invitation to create an account of the requested role. Owners are invited with
+// the owner:create permission and the users of the admin roles with admin:create, super admins are never invited.
+// The invitation link is also returned so it can be handed over another way
+func (i *InvitationController) Invite(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	var req invitationRequest
+	logger.LogDebug(reqId, reqUrl, "parsing request body")
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing request body:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "checking the invited role")
+	if !i.policy.IsRole(req.Role) || req.Role == middleware.SuperAdmin {
+		logger.LogError(reqId, reqUrl, "invalid role", http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  fmt.Sprintf("%s can not be invited", req.Role),
+			"status": Fail,
+		})
+		return
+	}
+	permission := rbac.OwnerCreate
+	if database.IsAdminRole(req.Role) {
+		permission = rbac.AdminCreate
+	}
+	if !i.policy.Can(userAuth.Role, permission) || (userAuth.APIKey != nil && !userAuth.APIKey.Allows(permission)) {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("%s is not allowed to invite %s", userAuth.Role, req.Role), http.StatusForbidden)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  fmt.Sprintf("%s is not allowed to invite %s", userAuth.Role, req.Role),
+			"status": Fail,
+		})
+		return
+	}
+	_, err = i.FindUserID(c.Request.Context(), req.Role, req.Email)
+	if err == nil {
+		logger.LogError(reqId, reqUrl, ErrAccountExists.Error(), http.StatusConflict)
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  ErrAccountExists.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	if err != database.ErrUserNotFound {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not find user: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	token, err := encryption.CreateInvitationToken(c.Request.Context(), &models.Claims{ID: userAuth.ID, Role: req.Role, Email: req.Email, InviterRole: userAuth.Role}, i.keys)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not create invitation token: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "sending invitation email")
+	action, link := tokenLink(i.auth.InvitationURL, token)
+	err = i.mailer.Send(c.Request.Context(), &mail.Message{
+		To:      req.Email,
+		Subject: "You are invited to resman",
+		Body: fmt.Sprintf("You are invited to join resman as %s. %s to choose your name and password, it expires in %s:\n\n%s\n",
+			req.Role, action, i.auth.InvitationLifetime.Duration, link),
+	})
+	if err != nil {
+		// the invitation is valid, the inviter can hand the returned link over
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not send invitation email: %v", err), 0)
+	}
+	logger.LogInfo(reqId, reqUrl, "invitation created", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"invitation": link,
+		"expiresAt":  time.Now().Add(i.auth.InvitationLifetime.Duration),
+		"emailSent":  err == nil,
+		"msg":        "Invitation Created",
+		"status":     Success,
+	})
+}
+
+// Accept creates the account an invitation was sent for with the chosen name and password. The email
+// received the invitation so the account starts verified. Invitations are used once, even when the
+// account is later deleted, and only while their inviter is active
+func (i *InvitationController) Accept(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	var req acceptInvitationRequest
+	logger.LogDebug(reqId, reqUrl, "parsing request body")
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing request body:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	claims, err := encryption.ParseToken(req.Token, i.keys)
+	if err != nil || claims.Purpose != models.PurposeInvitation || claims.Email == "" || !i.policy.IsRole(claims.Role) || claims.InviterRole == "" {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("invalid invitation: %v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  ErrInvalidInvitation.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	if !checkPassword(c, i.passwords, req.Password) {
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "creating the invited user")
+	ctx := c.Request.Context()
+	err = i.WithTx(ctx, func(tx database.Database) error {
+		revoked, err := tx.IsTokenRevoked(ctx, claims.Id)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrInvalidInvitation
+		}
+		status, err := tx.GetUserStatus(ctx, claims.ID, claims.InviterRole)
+		if err == database.ErrUserNotFound || (err == nil && status != models.StatusActive) {
+			return ErrInvalidInvitation
+		}
+		if err != nil {
+			return err
+		}
+		if claims.Role == middleware.Owner {
+			_, err = tx.CreateOwner(ctx, claims.ID, &models.OwnerReg{Email: claims.Email, Name: req.Name, Password: req.Password, Verified: true})
+		} else {
+			_, err = tx.CreateUser(ctx, &models.UserReg{Role: claims.Role, Email: claims.Email, Name: req.Name, Password: req.Password, Verified: true})
+		}
+		if err != nil {
+			return err
+		}
+		// the email is freed once the account is purged, the invitation must not create it again
+		return tx.RevokeToken(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0))
+	})
+	if err == database.ErrDupEmail || err == ErrInvalidInvitation {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not accept invitation: %v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  ErrInvalidInvitation.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not create user: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "invitation accepted", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"role":   claims.Role,
+		"email":  claims.Email,
+		"msg":    "Invitation Accepted, you can log in",
+		"status": Success,
+	})
+}
@@ -1,14 +1,17 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/config"
 	"github.com/vds/go-resman/pkg/database"
 	"github.com/vds/go-resman/pkg/encryption"
 	"github.com/vds/go-resman/pkg/logger"
 	"github.com/vds/go-resman/pkg/middleware"
 	"github.com/vds/go-resman/pkg/models"
 	"github.com/vds/go-resman/pkg/prometheus"
+	"github.com/vds/go-resman/pkg/rbac"
 	"net/http"
 )
 
@@ -17,13 +20,26 @@ const (
 	Fail    = "Fail"
 )
 
+// unlockRequest names either a user or a source ip to unlock
+type unlockRequest struct {
+	Role  string `json:"role"`
+	Email string `json:"email"`
+	IP    string `json:"ip"`
+}
+
 type LogInController struct {
 	database.Database
+	keys   *encryption.KeySet
+	guard  *loginGuard
+	policy *rbac.Policy
 }
 
-func NewLogInController(db database.Database) *LogInController {
+func NewLogInController(db database.Database, keys *encryption.KeySet, lockout *config.Lockout, policy *rbac.Policy) *LogInController {
 	lc := new(LogInController)
 	lc.Database = db
+	lc.keys = keys
+	lc.guard = &loginGuard{db: db, cfg: lockout}
+	lc.policy = policy
 	return lc
 }
 func (l *LogInController) LogIn(c *gin.Context) {
@@ -40,14 +56,45 @@ func (l *LogInController) LogIn(c *gin.Context) {
 		return
 	}
 	logger.LogDebug(reqId, reqUrl, "checking for valid user type")
-	isValid := middleware.IsValidUserType(cred.Role)
+	isValid := l.policy.IsRole(cred.Role)
 	if !isValid {
 		logger.LogError(reqId, reqUrl, "invalid user type", http.StatusBadRequest)
 		c.Status(http.StatusBadRequest)
 		return
 	}
+	logger.LogDebug(reqId, reqUrl, "checking for login lock")
+	guardKey := accountKey(cred.Role, cred.Email)
+	if l.guard.refuseLocked(c, cred.Role, guardKey, ipKey(c.ClientIP())) {
+		return
+	}
 	logger.LogDebug(reqId, reqUrl, "authenticating user from db")
 	userID, err := l.LogInUser(c.Request.Context(), &cred)
+	if err == database.ErrInvalidCredentials {
+		l.guard.failAll(c, cred.Role, reasonInvalidCredentials, guardKey)
+	}
+	if err == nil {
+		// the password is right, failing to forget the earlier failures must not refuse the login
+		clearErr := l.ClearLoginFailures(c.Request.Context(), guardKey)
+		if clearErr != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("can not clear failed logins: %v", clearErr), 0)
+		}
+	}
+	if err == database.ErrAccountSuspended {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("suspended user: %v", err), http.StatusForbidden)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	if err == database.ErrUnverifiedEmail {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("unverified user: %v", err), http.StatusForbidden)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("unauthenticated user: %v", err), http.StatusUnauthorized)
 		c.JSON(http.StatusUnauthorized, gin.H{
@@ -56,12 +103,38 @@ func (l *LogInController) LogIn(c *gin.Context) {
 		})
 		return
 	}
-	claims := &models.Claims{
-		ID:   userID,
-		Role: cred.Role,
+	logger.LogDebug(reqId, reqUrl, "checking for two-factor authentication")
+	purpose, err := twoFactorChallenge(c.Request.Context(), l.Database, l.policy, userID, cred.Role)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not check two-factor authentication: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
 	}
-	logger.LogDebug(reqId, reqUrl, "creating token for user")
-	token, err := encryption.CreateToken(c.Request.Context(), claims)
+	if purpose != "" {
+		challenge, err := encryption.CreateChallengeToken(c.Request.Context(), &models.Claims{ID: userID, Role: cred.Role}, purpose, l.keys)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in challenge generation:%v", err), http.StatusInternalServerError)
+			c.Writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		msg := "Enter the code of your authenticator app"
+		if purpose == models.PurposeTwoFactorEnrol {
+			msg = "Two-factor authentication is required, enrol an authenticator app to log in"
+		}
+		logger.LogInfo(reqId, reqUrl, "password verified, waiting for two-factor code", http.StatusOK)
+		c.JSON(http.StatusOK, gin.H{
+			"challenge": challenge,
+			"purpose":   purpose,
+			"role":      cred.Role,
+			"msg":       msg,
+			"status":    Success,
+		})
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "creating tokens for user")
+	token, refreshToken, err := startSession(c, l.Database, l.keys, userID, cred.Role)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in token generation:%v", err), http.StatusInternalServerError)
 		c.Writer.WriteHeader(http.StatusInternalServerError)
@@ -70,10 +143,11 @@ func (l *LogInController) LogIn(c *gin.Context) {
 	logger.LogInfo(reqId, reqUrl, "User logged in successfully", http.StatusOK)
 	prometheus.Global().GetCounterVec(logins).WithLabelValues(cred.Role).Inc()
 	c.JSON(http.StatusOK, gin.H{
-		"token":  token,
-		"role":   cred.Role,
-		"msg":    "Login Successful",
-		"status": Success,
+		"token":        token,
+		"refreshToken": refreshToken,
+		"role":         cred.Role,
+		"msg":          "Login Successful",
+		"status":       Success,
 	})
 }
 
@@ -89,10 +163,25 @@ func (l *LogInController) LogOut(c *gin.Context) {
 		})
 		return
 	}
-	logger.LogDebug(reqId, reqUrl, "storing token in db")
-	err := l.StoreToken(c.Request.Context(), tokenStr)
+	claims, err := encryption.ParseToken(tokenStr, l.keys)
 	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not store token in db:%v", err), http.StatusInternalServerError)
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("invalid token: %v", err), middleware.StatusTokenInvalid)
+		c.JSON(middleware.StatusTokenInvalid, gin.H{
+			"error": "invalid token",
+		})
+		return
+	}
+	if claims.Purpose != "" {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("%s challenge token used to log out", claims.Purpose), middleware.StatusTokenInvalid)
+		c.JSON(middleware.StatusTokenInvalid, gin.H{
+			"error": "challenge tokens can only be used to complete a login",
+		})
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "revoking token and its refresh tokens")
+	err = revokeSession(c.Request.Context(), l.Database, claims)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not revoke token in db:%v", err), http.StatusInternalServerError)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Internal Server Error",
 		})
@@ -105,3 +194,85 @@ func (l *LogInController) LogOut(c *gin.Context) {
 		"status": Success,
 	})
 }
+
+// Unlock clears the failed logins of a user or, with the login:unlock-ip permission, of a source ip.
+// Users other than owners need the admin:update permission, and users of the created scope can only
+// unlock the owners they created
+func (l *LogInController) Unlock(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	var req unlockRequest
+	logger.LogDebug(reqId, reqUrl, "parsing request body")
+	err := c.ShouldBindJSON(&req)
+	if err == nil && (req.IP == "") == (req.Email == "") {
+		err = errors.New("either an email or an ip is required")
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing request body:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	var keys []string
+	if req.IP != "" {
+		if !l.policy.Can(userAuth.Role, rbac.LoginUnlockIP) {
+			logger.LogError(reqId, reqUrl, "role is not allowed to unlock an ip", http.StatusForbidden)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":  "not allowed to unlock an ip",
+				"status": Fail,
+			})
+			return
+		}
+		keys = append(keys, ipKey(req.IP))
+	} else {
+		logger.LogDebug(reqId, reqUrl, "checking for valid user type")
+		if !l.policy.IsRole(req.Role) {
+			logger.LogError(reqId, reqUrl, "invalid user type", http.StatusBadRequest)
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		userID, err := findManagedUser(c.Request.Context(), l.Database, l.policy, userAuth, req.Role, req.Email)
+		switch err {
+		case nil:
+			keys = append(keys, accountKey(req.Role, req.Email), twoFactorKey(req.Role, userID))
+		case errRoleNotManaged:
+			logger.LogError(reqId, reqUrl, "role can only unlock owners", http.StatusForbidden)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":  "only owners can be unlocked",
+				"status": Fail,
+			})
+			return
+		case database.ErrUserNotFound:
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("can not unlock user: %v", err), http.StatusNotFound)
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":  err.Error(),
+				"status": Fail,
+			})
+			return
+		default:
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("can not find user: %v", err), http.StatusInternalServerError)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "internal server error",
+			})
+			return
+		}
+	}
+	logger.LogDebug(reqId, reqUrl, "clearing failed logins")
+	err = l.ClearLoginFailures(c.Request.Context(), keys...)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not clear failed logins: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "login unlocked", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"msg":    "Login Unlocked",
+		"status": Success,
+	})
+}
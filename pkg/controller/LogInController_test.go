@@ -2,9 +2,9 @@ package controller_test
 
 import (
 	"encoding/json"
-	"github.com/vds/go-resman/pkg/database/mysql"
 	"github.com/vds/go-resman/pkg/models"
 	"github.com/vds/go-resman/pkg/server"
+	"github.com/vds/go-resman/pkg/testhelpers"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -12,15 +12,15 @@ import (
 	_ "testing"
 )
 
-var dummyAdmin = models.UserReg{"admin", "dummyAdmin@gmail.com", "dummyAdmin", "dummyPass"}
-var dummySuperAdmin = models.UserReg{"superAdmin", "dummySuperAdmin@gmail.com", "dummySuperAdmin", "dummySuperPass"}
-var dummyOwner = models.OwnerReg{"dummySuperOwner@gmail.com", "dummySuperOwner", "dummyOwnerPass"}
+var dummyAdmin = models.UserReg{Role: "admin", Email: "dummyAdmin@gmail.com", Name: "dummyAdmin", Password: "dummyPass"}
+var dummySuperAdmin = models.UserReg{Role: "superAdmin", Email: "dummySuperAdmin@gmail.com", Name: "dummySuperAdmin", Password: "dummySuperPass"}
+var dummyOwner = models.OwnerReg{Email: "dummySuperOwner@gmail.com", Name: "dummySuperOwner", Password: "dummyOwnerPass"}
 
 func TestLogInController(t *testing.T) {
-	var DB, _ = mysql.NewMySqlDB("restaurant_test")
+	DB := mySqlDB(t)
 	defer DB.Close()
 	defer CleanDB(DB)
-	svr, err := server.NewServer(DB)
+	svr, err := server.NewServer(DB, testhelpers.Config("restaurant_test"))
 	router, _ := svr.Start()
 	if err != nil {
 		panic(err)
@@ -42,11 +42,11 @@ func TestLogInController(t *testing.T) {
 		t.Run(test.Name, func(t *testing.T) {
 			request := NewLogInRequest(test.Role, test.Email, test.Password)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
-	token := GetSuperToken(router)
+	token := GetSuperToken(router.Engine)
 	///tests for logout
 	testLogout := []struct {
 		name       string
@@ -60,7 +60,7 @@ func TestLogInController(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewLogOutRequest(test.token)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
@@ -1,7 +1,6 @@
 package controller
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/vds/go-resman/pkg/database"
@@ -28,25 +27,26 @@ func (m *MenuController) GetMenu(c *gin.Context) {
 	logger.LogDebug(reqId, reqUrl, "retrieving restaurant id from url and parsing the body")
 	res, _ := c.Get("restaurantID")
 	resID := res.(int)
-	jsonData := &[]models.DishOutput{}
-	var stringData string
-	logger.LogDebug(reqId, reqUrl, "retrieving dishes from db")
-	stringData, err := m.ShowMenu(c.Request.Context(), resID)
+	logger.LogDebug(reqId, reqUrl, "parsing list query parameters")
+	opts, err := getListOptions(c, false)
 	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting restaurant dishes:%v", err), http.StatusBadRequest)
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing query parameters:%v", err), http.StatusBadRequest)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
-	if stringData == "" {
-		logger.LogInfo(reqId, reqUrl, "no dishes for requested restaurant", http.StatusOK)
-		c.JSON(http.StatusOK, []models.DishOutput{})
+	logger.LogDebug(reqId, reqUrl, "retrieving dishes from db")
+	dishes, total, err := m.ShowMenu(c.Request.Context(), resID, opts)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting restaurant dishes:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
 		return
 	}
-	_ = json.Unmarshal([]byte(stringData), jsonData)
 	logger.LogInfo(reqId, reqUrl, "dishes retrieved successfully", http.StatusOK)
-	c.JSON(http.StatusOK, jsonData)
+	c.JSON(http.StatusOK, newPage(dishes, total, opts))
 }
 
 func (m *MenuController) AddDishes(c *gin.Context) {
@@ -96,24 +96,32 @@ func (m *MenuController) EditDish(c *gin.Context) {
 		})
 		return
 	}
-	logger.LogDebug(reqId, reqUrl, "checking that request dish update exist in the resturant")
-	err = m.CheckRestaurantDish(c.Request.Context(), resID, dish.ID)
-	if err != nil {
-		if err != database.ErrInternal {
-			logger.LogError(reqId, reqUrl, fmt.Sprintf("requested dish does not exist:%v", err), http.StatusBadRequest)
+	var checkErr error
+	var updatedDish *models.DishOutput
+	err = m.WithTx(c.Request.Context(), func(tx database.Database) error {
+		logger.LogDebug(reqId, reqUrl, "checking that request dish update exist in the resturant")
+		checkErr = tx.CheckRestaurantDish(c.Request.Context(), resID, dish.ID)
+		if checkErr != nil {
+			return checkErr
+		}
+		logger.LogDebug(reqId, reqUrl, "updating the dish")
+		updatedDish, err = tx.UpdateDish(c.Request.Context(), &dish)
+		return err
+	})
+	if checkErr != nil {
+		if checkErr != database.ErrInternal {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("requested dish does not exist:%v", checkErr), http.StatusBadRequest)
 			c.JSON(http.StatusBadRequest, gin.H{
-				"error": err.Error(),
+				"error": checkErr.Error(),
 			})
 			return
 		}
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in checking request dish:%v", err), http.StatusInternalServerError)
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in checking request dish:%v", checkErr), http.StatusInternalServerError)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Internal server error",
 		})
 		return
 	}
-	logger.LogDebug(reqId, reqUrl, "updating the dish")
-	updatedDish, err := m.UpdateDish(c.Request.Context(), &dish)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in updating the dish:%v", err), http.StatusInternalServerError)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -162,7 +170,9 @@ func (m *MenuController) DeleteDishes(c *gin.Context) {
 	//	return
 	//}
 	logger.LogDebug(reqId, reqUrl, "deleting dishes...")
-	err := m.RemoveDishes(c.Request.Context(), idArrInt...)
+	err := runBulk(c.Request.Context(), m.Database, func(tx database.Database) error {
+		return tx.RemoveDishes(c.Request.Context(), idArrInt...)
+	})
 	if err != nil {
 		if err != database.ErrInternal {
 			logger.LogError(reqId, reqUrl, fmt.Sprintf("can not delete dishes:%v", err), http.StatusBadRequest)
@@ -171,6 +181,11 @@ func (m *MenuController) DeleteDishes(c *gin.Context) {
 			})
 			return
 		}
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not delete dishes:%v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Internal server error",
+		})
+		return
 	}
 	logger.LogInfo(reqId, reqUrl, "dish deleted successfully", http.StatusOK)
 	c.JSON(http.StatusOK, gin.H{
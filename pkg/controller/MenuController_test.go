@@ -6,6 +6,7 @@ import (
 	"github.com/vds/go-resman/pkg/database/mysql"
 	"github.com/vds/go-resman/pkg/models"
 	"github.com/vds/go-resman/pkg/server"
+	"github.com/vds/go-resman/pkg/testhelpers"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -13,15 +14,15 @@ import (
 )
 
 func TestMenuController(t *testing.T) {
-	var DB, _ = mysql.NewMySqlDB("restaurant_test")
+	DB := mySqlDB(t)
 	defer DB.Close()
 	defer CleanDB(DB)
-	svr, err := server.NewServer(DB)
+	svr, err := server.NewServer(DB, testhelpers.Config("restaurant_test"))
 	router, _ := svr.Start()
 	if err != nil {
 		panic(err)
 	}
-	token := GetSuperToken(router)
+	token := GetSuperToken(router.Engine)
 
 	//tests for deleting dishes
 	CreateDishes(DB)
@@ -40,12 +41,12 @@ func TestMenuController(t *testing.T) {
 			idToDelete := test.idArr
 			request := NewDeleteDishRequest(token, test.resID, idToDelete)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
 
-	//tokenAdmin:=GetAdminToken(router)
+	//tokenAdmin:=GetAdminToken(router.Engine)
 	///test to add dishes to a restaurant
 	testAddDishes := []struct {
 		name       string
@@ -53,14 +54,14 @@ func TestMenuController(t *testing.T) {
 		dishes     []models.Dish
 		wantStatus int
 	}{
-		{"Add dishes successfully", 3, []models.Dish{{"dish1", 100.0}, {"dish2", 200.0}}, http.StatusOK},
-		{"Adding dishes for a non existing restaurant", 10, []models.Dish{{"dish1", 100.0}, {"dish2", 200.0}}, http.StatusBadRequest},
+		{"Add dishes successfully", 3, []models.Dish{{Name: "dish1", Price: 100.0}, {Name: "dish2", Price: 200.0}}, http.StatusOK},
+		{"Adding dishes for a non existing restaurant", 10, []models.Dish{{Name: "dish1", Price: 100.0}, {Name: "dish2", Price: 200.0}}, http.StatusBadRequest},
 	}
 	for _, test := range testAddDishes {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewAddDishesRequest(token, test.resID, test.dishes)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
@@ -80,7 +81,7 @@ func TestMenuController(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewGetMenuRequest(token, test.resID)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
@@ -103,7 +104,7 @@ func TestMenuController(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewUpdateDishRequest(token, test.resID, test.dishID, test.dishName, test.dishPrice)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/oidc"
+	"github.com/vds/go-resman/pkg/prometheus"
+	"net/http"
+	"strings"
+)
+
+// oidcCookie keeps the state, nonce and PKCE verifier of a login while the user is at the identity provider
+const (
+	oidcCookie     = "oidc_login"
+	oidcCookiePath = "/login/oidc"
+)
+
+var (
+	ErrInvalidLoginState  = errors.New("login state is invalid or expired, start the login again")
+	ErrUnverifiedIdentity = errors.New("the identity provider has not verified the email of this identity")
+	ErrIdentityProvider   = errors.New("identity provider is not available")
+)
+
+type OIDCController struct {
+	database.Database
+	keys     *encryption.KeySet
+	provider *oidc.Provider
+	cfg      *config.OIDC
+}
+
+func NewOIDCController(db database.Database, keys *encryption.KeySet, provider *oidc.Provider, cfg *config.OIDC) *OIDCController {
+	oc := new(OIDCController)
+	oc.Database = db
+	oc.keys = keys
+	oc.provider = provider
+	oc.cfg = cfg
+	return oc
+}
+
+// Start redirects the user to the identity provider, the values the callback checks are kept in a cookie
+func (o *OIDCController) Start(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	values := make([]string, 3)
+	for i := range values {
+		value, err := oidc.NewVerifier()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("can not generate login state: %v", err), http.StatusInternalServerError)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "internal server error",
+			})
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+	authURL, err := o.provider.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not start oidc login: %v", err), http.StatusBadGateway)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": ErrIdentityProvider.Error(),
+		})
+		return
+	}
+	o.setCookie(c, strings.Join(values, "."), int(o.cfg.StateLifetime.Seconds()))
+	logger.LogInfo(reqId, reqUrl, "redirecting to the identity provider", http.StatusFound)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes the login the identity provider sent the user back from. The verified email of
+// the identity selects the account of the configured role and the usual tokens are issued for it,
+// the provider is trusted to have applied its own second factor
+func (o *OIDCController) Callback(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+	role := o.cfg.Role
+
+	cookie, _ := c.Cookie(oidcCookie)
+	o.setCookie(c, "", -1)
+	if providerErr := c.Query("error"); providerErr != "" {
+		err := fmt.Sprintf("identity provider refused the login: %s %s", providerErr, c.Query("error_description"))
+		logger.LogError(reqId, reqUrl, err, http.StatusUnauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":  err,
+			"status": Fail,
+		})
+		return
+	}
+	values := strings.Split(cookie, ".")
+	if len(values) != 3 || c.Query("code") == "" || subtle.ConstantTimeCompare([]byte(values[0]), []byte(c.Query("state"))) != 1 {
+		logger.LogError(reqId, reqUrl, ErrInvalidLoginState.Error(), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  ErrInvalidLoginState.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	nonce, verifier := values[1], values[2]
+	logger.LogDebug(reqId, reqUrl, "exchanging the authorization code")
+	identity, err := o.provider.Exchange(c.Request.Context(), c.Query("code"), verifier, nonce)
+	if err != nil {
+		if !strings.HasPrefix(err.Error(), oidc.ErrExchange.Error()) && !strings.HasPrefix(err.Error(), oidc.ErrInvalidIDToken.Error()) {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("can not complete oidc login: %v", err), http.StatusBadGateway)
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": ErrIdentityProvider.Error(),
+			})
+			return
+		}
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("oidc login refused: %v", err), http.StatusUnauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	if !identity.EmailVerified || identity.Email == "" {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("unverified email of identity %s", identity.Subject), http.StatusForbidden)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  ErrUnverifiedIdentity.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "finding the account of the identity")
+	userID, err := o.FindUserID(c.Request.Context(), role, identity.Email)
+	if err == database.ErrUserNotFound {
+		prometheus.Global().GetCounterVec(failedLogins).WithLabelValues(role, reasonUnknownIdentity).Inc()
+		err := fmt.Sprintf("no %s account matches this identity", role)
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("%s: %s", err, identity.Email), http.StatusForbidden)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  err,
+			"status": Fail,
+		})
+		return
+	}
+	var status string
+	if err == nil {
+		status, err = o.GetUserStatus(c.Request.Context(), userID, role)
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not find user: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	if status == models.StatusSuspended {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("suspended user: %s", identity.Email), http.StatusForbidden)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  database.ErrAccountSuspended.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "creating tokens for user")
+	token, refreshToken, err := startSession(c, o.Database, o.keys, userID, role)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in token generation:%v", err), http.StatusInternalServerError)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "User logged in with the identity provider successfully", http.StatusOK)
+	prometheus.Global().GetCounterVec(logins).WithLabelValues(role).Inc()
+	c.JSON(http.StatusOK, gin.H{
+		"token":        token,
+		"refreshToken": refreshToken,
+		"role":         role,
+		"msg":          "Login Successful",
+		"status":       Success,
+	})
+}
+
+// setCookie sets the login cookie, it is only sent back over https when the callback is served over https
+func (o *OIDCController) setCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    value,
+		Path:     oidcCookiePath,
+		MaxAge:   maxAge,
+		Secure:   strings.HasPrefix(o.cfg.RedirectURL, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
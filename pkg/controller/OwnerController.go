@@ -1,11 +1,13 @@
 package controller
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/config"
 	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
 	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/mail"
 	"github.com/vds/go-resman/pkg/middleware"
 	"github.com/vds/go-resman/pkg/models"
 	"net/http"
@@ -14,11 +16,17 @@ import (
 
 type OwnerController struct {
 	database.Database
+	mailer    mail.Mailer
+	auth      *config.Auth
+	passwords *encryption.PasswordPolicy
 }
 
-func NewOwnerController(db database.Database) *OwnerController {
+func NewOwnerController(db database.Database, mailer mail.Mailer, auth *config.Auth, passwords *encryption.PasswordPolicy) *OwnerController {
 	ownerController := new(OwnerController)
 	ownerController.Database = db
+	ownerController.mailer = mailer
+	ownerController.auth = auth
+	ownerController.passwords = passwords
 	return ownerController
 }
 func (o *OwnerController) GetOwners(c *gin.Context) {
@@ -26,11 +34,17 @@ func (o *OwnerController) GetOwners(c *gin.Context) {
 
 	value, _ := c.Get("userAuth")
 	userAuth := value.(*models.UserAuth)
-	jsonData := &[]models.UserOutput{}
-	var stringData string
-	var err error
+	logger.LogDebug(reqId, reqUrl, "parsing list query parameters")
+	opts, err := getUserListOptions(c)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing query parameters:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 	logger.LogDebug(reqId, reqUrl, "retrieving owners from db")
-	stringData, err = o.ShowOwners(c.Request.Context(), userAuth)
+	owners, total, err := o.ShowOwners(c.Request.Context(), userAuth, opts)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not get owners: %v", err), http.StatusInternalServerError)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -38,14 +52,8 @@ func (o *OwnerController) GetOwners(c *gin.Context) {
 		})
 		return
 	}
-	if stringData == "" {
-		logger.LogInfo(reqId, reqUrl, "empty owner list", http.StatusOK)
-		c.JSON(http.StatusOK, []models.UserOutput{})
-		return
-	}
-	_ = json.Unmarshal([]byte(stringData), jsonData)
 	logger.LogInfo(reqId, reqUrl, "owners retrieved successfully", http.StatusOK)
-	c.JSON(http.StatusOK, jsonData)
+	c.JSON(http.StatusOK, newPage(owners, total, opts))
 }
 
 func (o *OwnerController) AddOwner(c *gin.Context) {
@@ -63,6 +71,9 @@ func (o *OwnerController) AddOwner(c *gin.Context) {
 		})
 		return
 	}
+	if !checkPassword(c, o.passwords, owner.Password) {
+		return
+	}
 	logger.LogDebug(reqId, reqUrl, "creating owner")
 	createdOwner, err := o.CreateOwner(c.Request.Context(), userAuth.ID, &owner)
 	if err != nil {
@@ -80,6 +91,12 @@ func (o *OwnerController) AddOwner(c *gin.Context) {
 		})
 		return
 	}
+	logger.LogDebug(reqId, reqUrl, "sending verification to owner")
+	err = sendVerification(c.Request.Context(), o.Database, o.mailer, o.auth, createdOwner.ID, middleware.Owner, createdOwner.Email)
+	if err != nil {
+		// the owner stays pending, the verification can be resent from /manage/verification
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not send verification email: %v", err), 0)
+	}
 	logger.LogInfo(reqId, reqUrl, "owner added successfully", http.StatusOK)
 	c.JSON(http.StatusOK, createdOwner)
 }
@@ -101,26 +118,34 @@ func (o *OwnerController) EditOwner(c *gin.Context) {
 		})
 		return
 	}
-	if userAuth.Role == middleware.Admin {
-		logger.LogDebug(reqId, reqUrl, "checking owner creator")
-		err = o.CheckOwnerCreator(c.Request.Context(), userAuth.ID, owner.ID)
-		if err != nil {
-			if err != database.ErrInternal {
-				logger.LogError(reqId, reqUrl, fmt.Sprintf("invalid creator:%v", err), http.StatusUnauthorized)
-				c.JSON(http.StatusUnauthorized, gin.H{
-					"error": err.Error(),
-				})
-				return
+	var checkErr error
+	var updatedOwner *models.UserOutput
+	err = o.WithTx(c.Request.Context(), func(tx database.Database) error {
+		if userAuth.Scope == models.ScopeCreated {
+			logger.LogDebug(reqId, reqUrl, "checking owner creator")
+			checkErr = tx.CheckOwnerCreator(c.Request.Context(), userAuth.ID, owner.ID)
+			if checkErr != nil {
+				return checkErr
 			}
-			logger.LogError(reqId, reqUrl, fmt.Sprintf("invalid creator:%v", err), http.StatusInternalServerError)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "internal server error",
+		}
+		logger.LogDebug(reqId, reqUrl, "updating owner")
+		updatedOwner, err = tx.UpdateOwner(c.Request.Context(), &owner)
+		return err
+	})
+	if checkErr != nil {
+		if checkErr != database.ErrInternal {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("invalid creator:%v", checkErr), http.StatusUnauthorized)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": checkErr.Error(),
 			})
 			return
 		}
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("invalid creator:%v", checkErr), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
 	}
-	logger.LogDebug(reqId, reqUrl, "updating owner")
-	ownerString, err := o.UpdateOwner(c.Request.Context(), &owner)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in updating owner:%v", err), http.StatusBadRequest)
 		if err != database.ErrInternal {
@@ -135,10 +160,8 @@ func (o *OwnerController) EditOwner(c *gin.Context) {
 		})
 		return
 	}
-	jsonData := &models.UserOutput{}
-	_ = json.Unmarshal([]byte(ownerString), jsonData)
 	logger.LogInfo(reqId, reqUrl, "owner updated successfully", http.StatusOK)
-	c.JSON(http.StatusOK, jsonData)
+	c.JSON(http.StatusOK, updatedOwner)
 }
 
 func (o *OwnerController) DeleteOwners(c *gin.Context) {
@@ -168,7 +191,9 @@ func (o *OwnerController) DeleteOwners(c *gin.Context) {
 	//	return
 	//}
 	logger.LogDebug(reqId, reqUrl, "deleting owners")
-	err := o.RemoveOwners(c.Request.Context(), userAuth, idArr...)
+	err := runBulk(c.Request.Context(), o.Database, func(tx database.Database) error {
+		return tx.RemoveOwners(c.Request.Context(), userAuth, idArr...)
+	})
 	if err != nil {
 		if err != database.ErrInternal {
 			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in deleting owner:%v", err), http.StatusBadRequest)
@@ -188,3 +213,46 @@ func (o *OwnerController) DeleteOwners(c *gin.Context) {
 		"msg": "owner deleted successfully",
 	})
 }
+
+// SuspendOwner suspends the account of an owner and ends its sessions, the owner can not log in until a
+// super admin reactivates the account
+func (o *OwnerController) SuspendOwner(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	ownerID := c.Param("ownerID")
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	var checkErr error
+	err := o.WithTx(c.Request.Context(), func(tx database.Database) error {
+		if userAuth.Scope == models.ScopeCreated {
+			logger.LogDebug(reqId, reqUrl, "checking owner creator")
+			checkErr = tx.CheckOwnerCreator(c.Request.Context(), userAuth.ID, ownerID)
+		}
+		if checkErr == nil {
+			_, checkErr = tx.GetUserStatus(c.Request.Context(), ownerID, middleware.Owner)
+		}
+		if checkErr != nil {
+			return checkErr
+		}
+		logger.LogDebug(reqId, reqUrl, "suspending owner")
+		return tx.SuspendUser(c.Request.Context(), ownerID)
+	})
+	if err == database.ErrInvalidOwner || err == database.ErrInvalidOwnerCreator || err == database.ErrUserNotFound {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not suspend owner: %v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "owner does not exist please refresh",
+		})
+		return
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not suspend owner: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogAudit(reqId, reqUrl, "account suspended", http.StatusOK, userAuth.Role+" "+userAuth.ID, middleware.Owner+" "+ownerID)
+	c.JSON(http.StatusOK, gin.H{
+		"msg": "owner suspended successfully",
+	})
+}
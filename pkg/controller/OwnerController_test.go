@@ -6,6 +6,7 @@ import (
 	"github.com/vds/go-resman/pkg/database/mysql"
 	"github.com/vds/go-resman/pkg/models"
 	"github.com/vds/go-resman/pkg/server"
+	"github.com/vds/go-resman/pkg/testhelpers"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -13,17 +14,17 @@ import (
 )
 
 func TestOwnerController(t *testing.T) {
-	var DB, _ = mysql.NewMySqlDB("restaurant_test")
+	DB := mySqlDB(t)
 	defer DB.Close()
 	defer CleanDB(DB)
-	svr, err := server.NewServer(DB)
+	svr, err := server.NewServer(DB, testhelpers.Config("restaurant_test"))
 	router, _ := svr.Start()
 	if err != nil {
 		panic(err)
 	}
 	//test get admins
-	token := GetSuperToken(router)
-	tokenAdmin := GetAdminToken(router)
+	token := GetSuperToken(router.Engine)
+	tokenAdmin := GetAdminToken(router.Engine)
 
 	testGetOwners := []struct {
 		name  string
@@ -36,7 +37,7 @@ func TestOwnerController(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewGetOwnerRequest(test.token)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, http.StatusOK)
 		})
 	}
@@ -63,7 +64,7 @@ func TestOwnerController(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewUpdateOwnerRequest(test.token, test.ownerID, test.ownerEmail, test.ownerName)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
@@ -82,7 +83,7 @@ func TestOwnerController(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewCreateOwnerRequest(token, "email", "name", test.ownerPass)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
@@ -103,7 +104,7 @@ func TestOwnerController(t *testing.T) {
 			idToDelete := test.idArr
 			request := NewDeleteOwnerRequest(token, idToDelete)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
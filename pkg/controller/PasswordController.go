@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/mail"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/rbac"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// forgotMessage is the answer to every valid forgot request so it does not tell which emails are registered
+const forgotMessage = "if the account exists a password reset email has been sent"
+
+type forgotPasswordRequest struct {
+	Role  string `json:"role" binding:"required"`
+	Email string `json:"email" binding:"required"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type PasswordController struct {
+	database.Database
+	mailer mail.Mailer
+	auth   *config.Auth
+	policy *rbac.Policy
+	// passwords checks the new passwords
+	passwords *encryption.PasswordPolicy
+}
+
+func NewPasswordController(db database.Database, mailer mail.Mailer, auth *config.Auth, policy *rbac.Policy, passwords *encryption.PasswordPolicy) *PasswordController {
+	pc := new(PasswordController)
+	pc.Database = db
+	pc.mailer = mailer
+	pc.auth = auth
+	pc.policy = policy
+	pc.passwords = passwords
+	return pc
+}
+
+// Forgot emails a single use password reset token to the user with the given role and email
+func (p *PasswordController) Forgot(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	var req forgotPasswordRequest
+	logger.LogDebug(reqId, reqUrl, "parsing request body")
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing request body:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "checking for valid user type")
+	if !p.policy.IsRole(req.Role) {
+		logger.LogError(reqId, reqUrl, "invalid user type", http.StatusBadRequest)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	userID, err := p.FindUserID(c.Request.Context(), req.Role, req.Email)
+	if err == database.ErrUserNotFound {
+		logger.LogInfo(reqId, reqUrl, "password reset requested for unknown user", http.StatusOK)
+		c.JSON(http.StatusOK, gin.H{
+			"msg":    forgotMessage,
+			"status": Success,
+		})
+		return
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not find user: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "creating password reset token")
+	token, err := encryption.NewOpaqueToken()
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in token generation:%v", err), http.StatusInternalServerError)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = p.StorePasswordResetToken(c.Request.Context(), &models.PasswordResetToken{
+		Hash:      encryption.HashOpaqueToken(token),
+		UserID:    userID,
+		Role:      req.Role,
+		ExpiresAt: time.Now().Add(p.auth.ResetTokenLifetime.Duration),
+	})
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not store reset token: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "sending password reset email")
+	err = p.mailer.Send(c.Request.Context(), &mail.Message{
+		To:      req.Email,
+		Subject: "Reset your password",
+		Body:    p.resetBody(token),
+	})
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not send reset email: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "can not send email",
+		})
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "password reset email sent", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"msg":    forgotMessage,
+		"status": Success,
+	})
+}
+
+// Reset sets a new password with a token sent by Forgot, the refresh tokens of the user are revoked
+// so other sessions end when their access token expires
+func (p *PasswordController) Reset(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	var req resetPasswordRequest
+	logger.LogDebug(reqId, reqUrl, "parsing request body")
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing request body:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	if !checkPassword(c, p.passwords, req.Password) {
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "resetting password")
+	err = p.ResetPassword(c.Request.Context(), encryption.HashOpaqueToken(req.Token), req.Password, time.Now())
+	if err != nil {
+		if err == database.ErrInvalidResetToken {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("can not reset password: %v", err), http.StatusBadRequest)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  err.Error(),
+				"status": Fail,
+			})
+			return
+		}
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not reset password: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "password reset successfully", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"msg":    "Password Reset Successful",
+		"status": Success,
+	})
+}
+
+// resetBody links to the configured reset page with token, or contains token alone without a page
+func (p *PasswordController) resetBody(token string) string {
+	action, secret := tokenLink(p.auth.PasswordResetURL, token)
+	return fmt.Sprintf("%s to reset your password, it expires in %s:\n\n%s\n\nIf you did not ask for a password reset you can ignore this email.\n",
+		action, p.auth.ResetTokenLifetime.Duration, secret)
+}
+
+// tokenLink returns the instruction and the text of an email carrying token, a link to page when it is
+// set and the bare token otherwise
+func tokenLink(page, token string) (action string, secret string) {
+	if page != "" {
+		link, err := url.Parse(page)
+		if err == nil {
+			query := link.Query()
+			query.Set("token", token)
+			link.RawQuery = query.Encode()
+			return "Open this link", link.String()
+		}
+	}
+	return "Use this token", token
+}
+
+// checkPassword responds with the reason passwords refuses password, it reports whether password can be used
+func checkPassword(c *gin.Context, passwords *encryption.PasswordPolicy, password string) bool {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+	logger.LogDebug(reqId, reqUrl, "checking password policy")
+	err := passwords.Check(password)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("password refused: %v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/mail"
+	"github.com/vds/go-resman/pkg/models"
+	"net/http"
+)
+
+var (
+	ErrAPIKeyChangesProfile = errors.New("api keys can not change the profile, log in to do it")
+	ErrIncorrectPassword    = errors.New("current password is incorrect")
+	ErrPasswordNotChanged   = errors.New("new password has to differ from the current one")
+)
+
+type profileRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Name  string `json:"name" binding:"required"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	Password        string `json:"password" binding:"required"`
+}
+
+type ProfileController struct {
+	database.Database
+	mailer mail.Mailer
+	auth   *config.Auth
+	guard  *loginGuard
+	// passwords checks the new passwords
+	passwords *encryption.PasswordPolicy
+}
+
+func NewProfileController(db database.Database, mailer mail.Mailer, auth *config.Auth, lockout *config.Lockout, passwords *encryption.PasswordPolicy) *ProfileController {
+	pc := new(ProfileController)
+	pc.Database = db
+	pc.mailer = mailer
+	pc.auth = auth
+	pc.guard = &loginGuard{db: db, cfg: lockout}
+	pc.passwords = passwords
+	return pc
+}
+
+// passwordChangeKey is the lockout key of the current passwords entered by a logged in user
+func passwordChangeKey(role, userID string) string {
+	return "password:" + role + ":" + userID
+}
+
+// Get returns the profile of the logged in user
+func (p *ProfileController) Get(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	logger.LogDebug(reqId, reqUrl, "getting profile")
+	user, err := p.GetUser(c.Request.Context(), userAuth.ID, userAuth.Role)
+	if err == database.ErrUserNotFound {
+		logger.LogError(reqId, reqUrl, err.Error(), http.StatusNotFound)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not get profile: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "profile retrieved", http.StatusOK)
+	c.JSON(http.StatusOK, user)
+}
+
+// Update sets the email and name of the logged in user. A new email is sent a verification token, the
+// user can not log in again until it is verified
+func (p *ProfileController) Update(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	userAuth, ok := p.loggedInUser(c)
+	if !ok {
+		return
+	}
+	var req profileRequest
+	logger.LogDebug(reqId, reqUrl, "parsing request body")
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing request body:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "getting profile")
+	user, err := p.GetUser(c.Request.Context(), userAuth.ID, userAuth.Role)
+	var email string
+	if err == nil {
+		email = user.Email
+		logger.LogDebug(reqId, reqUrl, "updating profile")
+		user, err = p.UpdateProfile(c.Request.Context(), &models.UserOutput{ID: userAuth.ID, Role: userAuth.Role, Email: req.Email, Name: req.Name})
+	}
+	if err == database.ErrDupEmail {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("duplicate email : %v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err == database.ErrUserNotFound {
+		logger.LogError(reqId, reqUrl, err.Error(), http.StatusNotFound)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not update profile: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	if user.Email != email {
+		err = sendVerification(c.Request.Context(), p.Database, p.mailer, p.auth, userAuth.ID, userAuth.Role, user.Email)
+		if err != nil {
+			// the email is changed, an admin can resend the verification
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("can not send verification email: %v", err), http.StatusInternalServerError)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "profile updated but the verification email could not be sent",
+			})
+			return
+		}
+	}
+	logger.LogInfo(reqId, reqUrl, "profile updated", http.StatusOK)
+	c.JSON(http.StatusOK, user)
+}
+
+// ChangePassword sets the password of the logged in user after checking the current one. The other
+// sessions of the user end, the token of the request keeps working
+func (p *ProfileController) ChangePassword(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	userAuth, ok := p.loggedInUser(c)
+	if !ok {
+		return
+	}
+	var req changePasswordRequest
+	logger.LogDebug(reqId, reqUrl, "parsing request body")
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing request body:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	if req.Password == req.CurrentPassword {
+		logger.LogError(reqId, reqUrl, ErrPasswordNotChanged.Error(), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  ErrPasswordNotChanged.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	if !checkPassword(c, p.passwords, req.Password) {
+		return
+	}
+	guardKey := passwordChangeKey(userAuth.Role, userAuth.ID)
+	if p.guard.refuseLocked(c, userAuth.Role, guardKey) {
+		return
+	}
+	var sessionID string
+	if value, ok := c.Get("claims"); ok {
+		sessionID = value.(*models.Claims).SessionID
+	}
+	logger.LogDebug(reqId, reqUrl, "changing password")
+	revoked, err := p.Database.ChangePassword(c.Request.Context(), userAuth.ID, userAuth.Role, req.CurrentPassword, req.Password, sessionID)
+	if err == database.ErrInvalidCredentials {
+		p.guard.failAll(c, userAuth.Role, reasonInvalidCredentials, guardKey)
+		logger.LogError(reqId, reqUrl, ErrIncorrectPassword.Error(), http.StatusForbidden)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  ErrIncorrectPassword.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	if err == nil {
+		err = p.ClearLoginFailures(c.Request.Context(), guardKey)
+	}
+	if err == database.ErrUserNotFound {
+		logger.LogError(reqId, reqUrl, err.Error(), http.StatusNotFound)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not change password: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("password changed, %d other sessions revoked", revoked), http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"msg":     "Password Changed",
+		"revoked": revoked,
+		"status":  Success,
+	})
+}
+
+// loggedInUser returns the user set by AuthMiddleware, it refuses requests made with an api key since
+// their permissions do not cover the credentials of the user
+func (p *ProfileController) loggedInUser(c *gin.Context) (*models.UserAuth, bool) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	if userAuth.APIKey != nil {
+		logger.LogError(reqId, reqUrl, ErrAPIKeyChangesProfile.Error(), http.StatusForbidden)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": ErrAPIKeyChangesProfile.Error(),
+		})
+		return nil, false
+	}
+	return userAuth, true
+}
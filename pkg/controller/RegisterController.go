@@ -1,26 +1,45 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/config"
 	"github.com/vds/go-resman/pkg/database"
 	"github.com/vds/go-resman/pkg/encryption"
 	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/mail"
 	"github.com/vds/go-resman/pkg/middleware"
 	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/rbac"
 	"net/http"
 )
 
 type RegisterController struct {
 	database.Database
+	mailer    mail.Mailer
+	auth      *config.Auth
+	bootstrap *config.Bootstrap
+	policy    *rbac.Policy
+	passwords *encryption.PasswordPolicy
 }
 
-func NewRegisterController(db database.Database) *RegisterController {
+func NewRegisterController(db database.Database, mailer mail.Mailer, auth *config.Auth, bootstrap *config.Bootstrap, policy *rbac.Policy, passwords *encryption.PasswordPolicy) *RegisterController {
 	regController := new(RegisterController)
 	regController.Database = db
+	regController.mailer = mailer
+	regController.auth = auth
+	regController.bootstrap = bootstrap
+	regController.policy = policy
+	regController.passwords = passwords
 	return regController
 }
 
+var ErrRegistrationClosed = errors.New("registration is closed, ask for an invitation")
+
+// Register creates the pending account of the first super admin and emails it a verification token, the
+// user can log in once the email is verified. Registration is closed once a super admin exists or when
+// the server bootstraps it, the other users are invited
 func (r *RegisterController) Register(c *gin.Context) {
 	 reqId,reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
 
@@ -36,14 +55,43 @@ func (r *RegisterController) Register(c *gin.Context) {
 		return
 	}
 	logger.LogDebug(reqId, reqUrl, "validating user role")
-	if user.Role != middleware.Admin && user.Role != middleware.SuperAdmin {
+	if !r.policy.IsRole(user.Role) {
 		logger.LogError(reqId, reqUrl, "invalid role ", http.StatusNotFound)
 		c.Status(http.StatusNotFound)
 		return
 	}
+	if !checkPassword(c, r.passwords, user.Password) {
+		return
+	}
 	logger.LogDebug(reqId, reqUrl, "creating user")
-	userId, err := r.CreateUser(c.Request.Context(), &user)
+	var userId string
+	err = r.WithTx(c.Request.Context(), func(tx database.Database) error {
+		if user.Role != middleware.SuperAdmin || r.bootstrap.Email != "" {
+			return ErrRegistrationClosed
+		}
+		err := tx.LockUsers(c.Request.Context(), middleware.SuperAdmin)
+		if err != nil {
+			return err
+		}
+		count, err := tx.CountUsers(c.Request.Context(), middleware.SuperAdmin)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrRegistrationClosed
+		}
+		userId, err = tx.CreateUser(c.Request.Context(), &user)
+		return err
+	})
 	if err != nil {
+		if err == ErrRegistrationClosed {
+			logger.LogError(reqId, reqUrl, err.Error(), http.StatusForbidden)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":  err.Error(),
+				"status": Fail,
+			})
+			return
+		}
 		if err == database.ErrDupEmail {
 			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in creating user:%v", err), http.StatusBadRequest)
 			c.JSON(http.StatusBadRequest, gin.H{
@@ -59,21 +107,19 @@ func (r *RegisterController) Register(c *gin.Context) {
 		return
 	}
 
-	claims := &models.Claims{
-		ID:   userId,
-		Role: user.Role,
-	}
-	logger.LogDebug(reqId, reqUrl, "creating owner")
-	token, err := encryption.CreateToken(c.Request.Context(), claims)
+	err = sendVerification(c.Request.Context(), r.Database, r.mailer, r.auth, userId, user.Role, user.Email)
 	if err != nil {
-		c.Writer.WriteHeader(http.StatusInternalServerError)
+		// the account exists, an admin can resend the verification
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not send verification email: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "registered but the verification email could not be sent",
+		})
 		return
 	}
 	logger.LogInfo(reqId, reqUrl, "user registration successful", http.StatusOK)
 	c.JSON(http.StatusOK, gin.H{
 		"role":   user.Role,
-		"token":  token,
-		"msg":    "Registration Successful",
+		"msg":    "Registration Successful, check your email to verify it",
 		"status": Success,
 	})
 }
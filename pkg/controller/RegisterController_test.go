@@ -4,18 +4,20 @@ import (
 	"encoding/json"
 	"github.com/vds/go-resman/pkg/database/mysql"
 	"github.com/vds/go-resman/pkg/server"
+	"github.com/vds/go-resman/pkg/testhelpers"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 	_ "testing"
 )
 
 func TestRegisterController(t *testing.T) {
-	var DB, _ = mysql.NewMySqlDB("restaurant_test")
+	DB := mySqlDB(t)
 	defer DB.Close()
 	defer CleanDB(DB)
-	svr, err := server.NewServer(DB)
+	svr, err := server.NewServer(DB, testhelpers.Config("restaurant_test"))
 	router, _ := svr.Start()
 	if err != nil {
 		panic(err)
@@ -28,24 +30,22 @@ func TestRegisterController(t *testing.T) {
 		password   string
 		wantStatus int
 	}{
-		{"When an admin is successfully created", "admin", "admin1@gmail.com", "admin1", "pass1", http.StatusOK},
-		{"When a superadmin is successfully created", "superAdmin", "superadmin@gmail.com", "superadmin1", "superpass1", http.StatusOK},
-		{"duplicate mail for admin", "admin", "admin1@gmail.com", "admin1", "pass1", http.StatusBadRequest},
-		{"duplicate mail for super admin", "superAdmin", "superadmin@gmail.com", "superadmin1", "superpass1", http.StatusBadRequest},
+		{"admins are invited", "admin", "admin1@gmail.com", "admin1", "pass1", http.StatusForbidden},
+		{"registration is closed once a superadmin exists", "superAdmin", "superadmin@gmail.com", "superadmin1", "superpass1", http.StatusForbidden},
 		{"Empty Require Field", "", "admin1@gmail.com", "admin1", "pass1", http.StatusBadRequest},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewRegisterRequest(test.role, test.userName, test.email, test.password)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
 	t.Run("For invalid role", func(t *testing.T) {
-		request := NewRegisterRequest("AnyOtherRole", "name", "mail", "pass")
+		request := NewRegisterRequest("AnyOtherRole", "name", "mail@gmail.com", "pass")
 		response := httptest.NewRecorder()
-		router.ServeHTTP(response, request)
+		router.Engine.ServeHTTP(response, request)
 		assertStatus(t, response.Code, http.StatusNotFound)
 	})
 }
@@ -66,15 +66,30 @@ func NewRegisterRequest(Role string, UserName string, Email string, Password str
 	req.Header.Add("Content-Type", "application/json")
 	return req
 }
+// mySqlDB opens the database of MYSQL_URL, the controller tests are skipped without one
+func mySqlDB(t *testing.T) *mysql.MySqlDB {
+	t.Helper()
+	dbUrl := os.Getenv("MYSQL_URL")
+	if dbUrl == "" {
+		t.Skip("MYSQL_URL not set")
+	}
+	db, err := mysql.NewMySqlDB(&testhelpers.Config(dbUrl).Database)
+	if err != nil {
+		t.Fatalf("can not get db instance: %v", err)
+	}
+	return db
+}
+
 func CleanDB(db *mysql.MySqlDB) {
 	_, _ = db.Query("delete from admins where email_id<>?", dummyAdmin.Email)
-	_, _ = db.Query("delete from super_admins where email_id<>?", dummySuperAdmin.Email)
+	_, _ = db.Query("delete from users where role=? and email_id<>?", dummySuperAdmin.Role, dummySuperAdmin.Email)
 	_, _ = db.Query("delete from restaurants where id<>? and id<>?", 3, 4)
 	_, _ = db.Query("alter table restaurants AUTO_INCREMENT=5")
 	_, _ = db.Query("delete from dishes where id<>1")
 	_, _ = db.Query("alter table dishes AUTO_INCREMENT=2")
 	_, _ = db.Query("delete from owners where email_id<>? and id<>? ", dummyOwner.Email, dummyOwnerID)
-	_, _ = db.Query("delete from invalid_tokens")
+	_, _ = db.Query("delete from revoked_tokens")
+	_, _ = db.Query("delete from refresh_tokens")
 }
 func assertStatus(t *testing.T, got int, want int) {
 	t.Helper()
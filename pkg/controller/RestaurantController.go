@@ -1,7 +1,6 @@
 package controller
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/vds/go-resman/pkg/database"
@@ -36,17 +35,22 @@ func (r *RestaurantController) GetNearBy(c *gin.Context) {
 		})
 		return
 	}
-	var jsonData []models.RestaurantOutput
 	logger.LogDebug(reqId, reqUrl, "getting nearby restaurants")
-	stringData, err := r.ShowNearBy(c.Request.Context(), &location)
-	if stringData == "" {
+	restaurants, err := r.ShowNearBy(c.Request.Context(), &location)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in retreving near by restaurants:%v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	if len(restaurants) == 0 {
 		logger.LogInfo(reqId, reqUrl, "no restaurants to show", http.StatusOK)
 		c.JSON(http.StatusOK, []models.RestaurantOutput{})
 		return
 	}
-	_ = json.Unmarshal([]byte(stringData), &jsonData)
 	logger.LogInfo(reqId, reqUrl, "retrieved near by restaurants successfully", http.StatusOK)
-	c.JSON(http.StatusOK, jsonData)
+	c.JSON(http.StatusOK, restaurants)
 }
 
 func (r *RestaurantController) GetRestaurants(c *gin.Context) {
@@ -54,11 +58,17 @@ func (r *RestaurantController) GetRestaurants(c *gin.Context) {
 
 	value, _ := c.Get("userAuth")
 	userAuth := value.(*models.UserAuth)
-	jsonData := &[]models.RestaurantOutput{}
-	var stringData string
-	var err error
+	logger.LogDebug(reqId, reqUrl, "parsing list query parameters")
+	opts, err := getListOptions(c, true)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing query parameters:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 	logger.LogDebug(reqId, reqUrl, "retriving restaurants from db")
-	stringData, err = r.ShowRestaurants(c.Request.Context(), userAuth)
+	restaurants, total, err := r.ShowRestaurants(c.Request.Context(), userAuth, opts)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in retreving restaurants:%v", err), http.StatusBadRequest)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -66,14 +76,8 @@ func (r *RestaurantController) GetRestaurants(c *gin.Context) {
 		})
 		return
 	}
-	if stringData == "" {
-		logger.LogInfo(reqId, reqUrl, "no restaurants to show", http.StatusOK)
-		c.JSON(http.StatusOK, []models.RestaurantOutput{})
-		return
-	}
-	_ = json.Unmarshal([]byte(stringData), jsonData)
 	logger.LogInfo(reqId, reqUrl, "restaurants retrieved successfully", http.StatusOK)
-	c.JSON(http.StatusOK, jsonData)
+	c.JSON(http.StatusOK, newPage(restaurants, total, opts))
 }
 
 func (r *RestaurantController) AddRestaurant(c *gin.Context) {
@@ -106,14 +110,6 @@ func (r *RestaurantController) AddRestaurant(c *gin.Context) {
 func (r *RestaurantController) EditRestaurant(c *gin.Context) {
 	 reqId,reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
 
-	value, _ := c.Get("userAuth")
-	userAuth := value.(*models.UserAuth)
-	logger.LogDebug(reqId, reqUrl, "verifying user role")
-	if userAuth.Role != middleware.Admin && userAuth.Role != middleware.SuperAdmin {
-		logger.LogError(reqId, reqUrl, "invalid user role", http.StatusUnauthorized)
-		c.Status(http.StatusUnauthorized)
-		return
-	}
 	logger.LogDebug(reqId, reqUrl, "getting restaurant id and parsing request body")
 	res, _ := c.Get("restaurantID")
 	resID := res.(int)
@@ -178,15 +174,22 @@ func (r *RestaurantController) DeleteRestaurants(c *gin.Context) {
 	//	return
 	//}
 	logger.LogDebug(reqId, reqUrl, "deleting restaurants")
-	err := r.RemoveRestaurants(c.Request.Context(), userAuth, idArrInt...)
+	err := runBulk(c.Request.Context(), r.Database, func(tx database.Database) error {
+		return tx.RemoveRestaurants(c.Request.Context(), userAuth, idArrInt...)
+	})
 	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in deleting restaurants:%v", err), http.StatusBadRequest)
 		if err != database.ErrInternal {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in deleting restaurants:%v", err), http.StatusBadRequest)
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": err.Error(),
 			})
 			return
 		}
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in deleting restaurants:%v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
 	}
 	logger.LogInfo(reqId, reqUrl, "restaurant deleted successfully", http.StatusOK)
 	c.JSON(http.StatusOK, gin.H{
@@ -200,7 +203,7 @@ func (r *RestaurantController) GetOwnerRestaurants(c *gin.Context) {
 	value, _ := c.Get("userAuth")
 	userAuth := value.(*models.UserAuth)
 	var err error
-	if userAuth.Role == middleware.Admin {
+	if userAuth.Scope == models.ScopeCreated {
 		logger.LogDebug(reqId, reqUrl, "checking owner creator")
 		err = r.CheckOwnerCreator(c.Request.Context(), userAuth.ID, ownerID)
 		if err != nil {
@@ -218,14 +221,22 @@ func (r *RestaurantController) GetOwnerRestaurants(c *gin.Context) {
 			return
 		}
 	}
-	jsonData := &[]models.RestaurantOutput{}
 	ownerAuth := models.UserAuth{
-		ID:   ownerID,
-		Role: middleware.Owner,
+		ID:    ownerID,
+		Role:  middleware.Owner,
+		Scope: models.ScopeOwned,
+	}
+	logger.LogDebug(reqId, reqUrl, "parsing list query parameters")
+	opts, err := getListOptions(c, false)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing query parameters:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
-	var stringData string
 	logger.LogDebug(reqId, reqUrl, "retrieving owner restaurants")
-	stringData, err = r.ShowRestaurants(c.Request.Context(), &ownerAuth)
+	restaurants, total, err := r.ShowRestaurants(c.Request.Context(), &ownerAuth, opts)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting owner restaurants:%v", err), http.StatusInternalServerError)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -233,14 +244,8 @@ func (r *RestaurantController) GetOwnerRestaurants(c *gin.Context) {
 		})
 		return
 	}
-	if stringData == "" {
-		logger.LogInfo(reqId, reqUrl, "no owner restaurants to show", http.StatusOK)
-		c.JSON(http.StatusOK, []models.RestaurantOutput{})
-		return
-	}
-	_ = json.Unmarshal([]byte(stringData), jsonData)
 	logger.LogInfo(reqId, reqUrl, "owner restaurants retrieved successfully", http.StatusOK)
-	c.JSON(http.StatusOK, jsonData)
+	c.JSON(http.StatusOK, newPage(restaurants, total, opts))
 }
 
 func (r *RestaurantController) GetAvailableRestaurants(c *gin.Context) {
@@ -248,9 +253,8 @@ func (r *RestaurantController) GetAvailableRestaurants(c *gin.Context) {
 
 	value, _ := c.Get("userAuth")
 	userAuth := value.(*models.UserAuth)
-	jsonData := &[]models.RestaurantOutput{}
 	logger.LogDebug(reqId, reqUrl, "retrieving available restaurants")
-	stringData, err := r.ShowAvailableRestaurants(c.Request.Context(), userAuth)
+	restaurants, err := r.ShowAvailableRestaurants(c.Request.Context(), userAuth)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting available restaurants:%v", err), http.StatusInternalServerError)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -258,14 +262,13 @@ func (r *RestaurantController) GetAvailableRestaurants(c *gin.Context) {
 		})
 		return
 	}
-	if stringData == "" {
+	if len(restaurants) == 0 {
 		logger.LogInfo(reqId, reqUrl, "no available restaurants to show", http.StatusOK)
 		c.JSON(http.StatusOK, []models.RestaurantOutput{})
 		return
 	}
-	_ = json.Unmarshal([]byte(stringData), jsonData)
 	logger.LogInfo(reqId, reqUrl, "available restaurants retrieved successfully", http.StatusOK)
-	c.JSON(http.StatusOK, jsonData)
+	c.JSON(http.StatusOK, restaurants)
 }
 
 func (r *RestaurantController) AddOwnerForRestaurants(c *gin.Context) {
@@ -275,7 +278,7 @@ func (r *RestaurantController) AddOwnerForRestaurants(c *gin.Context) {
 	value, _ := c.Get("userAuth")
 	userAuth := value.(*models.UserAuth)
 	var err error
-	if userAuth.Role == middleware.Admin {
+	if userAuth.Scope == models.ScopeCreated {
 		logger.LogDebug(reqId, reqUrl, "checking owner creator")
 		err = r.CheckOwnerCreator(c.Request.Context(), userAuth.ID, ownerID)
 		if err != nil {
@@ -307,35 +310,36 @@ func (r *RestaurantController) AddOwnerForRestaurants(c *gin.Context) {
 		return
 	}
 	var thrownError string
-	logger.LogDebug(reqId, reqUrl, "adding the restaurants to owner")
-	err = r.InsertOwnerForRestaurants(c.Request.Context(), userAuth, ownerID, resID.Assign...)
-	if err != nil {
-		if err != database.ErrInternal {
+	err = r.WithTx(c.Request.Context(), func(tx database.Database) error {
+		logger.LogDebug(reqId, reqUrl, "adding the restaurants to owner")
+		err := tx.InsertOwnerForRestaurants(c.Request.Context(), userAuth, ownerID, resID.Assign...)
+		if err != nil {
+			if err == database.ErrInternal {
+				logger.LogError(reqId, reqUrl, fmt.Sprintf("error in adding owner for restaurants:%v", err), http.StatusInternalServerError)
+				return err
+			}
 			thrownError = err.Error()
-		} else {
-			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in adding owner for restaurants:%v", err), http.StatusInternalServerError)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
-			return
 		}
-	}
-	logger.LogDebug(reqId, reqUrl, "removing owner restaurants")
-	err = r.RemoveOwnerForRestaurants(c.Request.Context(), userAuth, ownerID, resID.DeAssign...)
-	if err != nil {
-		if err != database.ErrInternal {
+		logger.LogDebug(reqId, reqUrl, "removing owner restaurants")
+		err = tx.RemoveOwnerForRestaurants(c.Request.Context(), userAuth, ownerID, resID.DeAssign...)
+		if err != nil {
+			if err == database.ErrInternal {
+				logger.LogError(reqId, reqUrl, fmt.Sprintf("error in removing owner for restaurants:%v", err), http.StatusInternalServerError)
+				return err
+			}
 			thrownError = thrownError + err.Error()
-		} else {
-			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in removing owner for restaurants:%v", err), http.StatusInternalServerError)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
-			return
 		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
 
 	if thrownError != "" {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in updating the list:%v", err), http.StatusBadRequest)
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in updating the list:%v", thrownError), http.StatusBadRequest)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": thrownError,
 		})
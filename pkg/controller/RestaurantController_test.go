@@ -6,6 +6,7 @@ import (
 	"github.com/vds/go-resman/pkg/database/mysql"
 	"github.com/vds/go-resman/pkg/models"
 	"github.com/vds/go-resman/pkg/server"
+	"github.com/vds/go-resman/pkg/testhelpers"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -17,16 +18,16 @@ const dummySuperOwnerID = "32758fde-4dd5-4635-9bf7-a4d46d6f0629" //created by su
 const dummyOwnerID = "451367e3-9b74-4bb6-9157-ac9a2c34da8d"      //created by admin
 
 func TestRestaurantController(t *testing.T) {
-	var DB, _ = mysql.NewMySqlDB("restaurant_test")
+	DB := mySqlDB(t)
 	defer DB.Close()
 	defer CleanDB(DB)
-	svr, err := server.NewServer(DB)
+	svr, err := server.NewServer(DB, testhelpers.Config("restaurant_test"))
 	router, _ := svr.Start()
 	if err != nil {
 		panic(err)
 	}
-	token := GetSuperToken(router)
-	tokenAdmin := GetAdminToken(router)
+	token := GetSuperToken(router.Engine)
+	tokenAdmin := GetAdminToken(router.Engine)
 	testGetRestaurants := []struct {
 		name  string
 		token string
@@ -38,7 +39,7 @@ func TestRestaurantController(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewGetRestaurantRequest(test.token)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, http.StatusOK)
 		})
 	}
@@ -58,7 +59,7 @@ func TestRestaurantController(t *testing.T) {
 			idToDelete := test.idArr
 			request := NewDeleteRestaurantRequest(token, idToDelete)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
@@ -76,13 +77,13 @@ func TestRestaurantController(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewCreateRestaurantRequest(token, test.resName, 1.2, 5.0)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
 
 	// updating restaurants
-	tokenOwner := GetOwnerToken(router)
+	tokenOwner := GetOwnerToken(router.Engine)
 	testUpdateRestaurant := []struct {
 		name       string
 		resID      int
@@ -99,7 +100,7 @@ func TestRestaurantController(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewUpdateRestaurantRequest(test.token, test.resID, test.resName, 0.1, 0.2)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
@@ -119,7 +120,7 @@ func TestRestaurantController(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewGetOwnerRestaurantRequest(test.token, test.ownerID)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
@@ -141,7 +142,7 @@ func TestRestaurantController(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewAddOwnerRestaurantRequest(test.token, test.ownerID, test.resID)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
@@ -159,7 +160,7 @@ func TestRestaurantController(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewGetRestaurantAvailableRequest(test.token)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
@@ -179,7 +180,7 @@ func TestRestaurantController(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			request := NewGetNearByRestaurants(test.lat, test.lng)
 			response := httptest.NewRecorder()
-			router.ServeHTTP(response, request)
+			router.Engine.ServeHTTP(response, request)
 			assertStatus(t, response.Code, test.wantStatus)
 		})
 	}
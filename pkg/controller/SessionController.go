@@ -0,0 +1,249 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/rbac"
+	"net/http"
+	"time"
+)
+
+var ErrAPIKeyManagesSessions = errors.New("api keys can not manage sessions, log in to do it")
+
+type forceLogoutRequest struct {
+	Role  string `json:"role" binding:"required"`
+	Email string `json:"email"`
+}
+
+type SessionController struct {
+	database.Database
+	policy *rbac.Policy
+}
+
+func NewSessionController(db database.Database, policy *rbac.Policy) *SessionController {
+	sc := new(SessionController)
+	sc.Database = db
+	sc.policy = policy
+	return sc
+}
+
+// List returns the active sessions of the logged in user, the session of the request is marked current
+func (s *SessionController) List(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	userAuth, current, ok := s.loggedInSession(c)
+	if !ok {
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "getting sessions")
+	sessions, err := s.ShowSessions(c.Request.Context(), userAuth.ID, userAuth.Role, time.Now())
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not get sessions: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	logger.LogInfo(reqId, reqUrl, "sessions listed", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": sessions,
+		"status":   Success,
+	})
+}
+
+// Revoke ends one session of the logged in user, the access and refresh tokens of the session are
+// refused from then on
+func (s *SessionController) Revoke(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	userAuth, _, ok := s.loggedInSession(c)
+	if !ok {
+		return
+	}
+	err := s.RevokeSession(c.Request.Context(), userAuth.ID, userAuth.Role, c.Param("sessionID"))
+	if err == database.ErrSessionNotFound {
+		logger.LogError(reqId, reqUrl, err.Error(), http.StatusNotFound)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not revoke session: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "session revoked", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"msg":    "session revoked",
+		"status": Success,
+	})
+}
+
+// RevokeOthers ends every session of the logged in user but the one of the request
+func (s *SessionController) RevokeOthers(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	userAuth, current, ok := s.loggedInSession(c)
+	if !ok {
+		return
+	}
+	revoked, err := s.RevokeSessions(c.Request.Context(), userAuth.ID, userAuth.Role, current)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not revoke sessions: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("%d sessions revoked", revoked), http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"revoked": revoked,
+		"msg":     "other sessions revoked",
+		"status":  Success,
+	})
+}
+
+// ForceLogout ends the sessions of the user with the given role and email or, without an email, of every
+// user of the role the caller manages. Users other than owners need the admin:update permission, users
+// of the created scope only reach the owners they created and super admins are logged out one at a time
+func (s *SessionController) ForceLogout(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	var req forceLogoutRequest
+	logger.LogDebug(reqId, reqUrl, "parsing request body")
+	err := c.ShouldBindJSON(&req)
+	if err == nil && req.Email == "" && req.Role == middleware.SuperAdmin {
+		err = errors.New("an email is required to log out a super admin")
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing request body:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "checking for valid user type")
+	if !s.policy.IsRole(req.Role) {
+		logger.LogError(reqId, reqUrl, "invalid user type", http.StatusBadRequest)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	userIDs, err := s.managedUsers(c, userAuth, req.Role, req.Email)
+	if err == errRoleNotManaged {
+		logger.LogError(reqId, reqUrl, "role can only log out owners", http.StatusForbidden)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  "only owners can be logged out",
+			"status": Fail,
+		})
+		return
+	}
+	if err == database.ErrUserNotFound {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not log out user: %v", err), http.StatusNotFound)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not find users: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "revoking sessions")
+	var revoked int64
+	err = s.WithTx(c.Request.Context(), func(tx database.Database) error {
+		for _, userID := range userIDs {
+			n, err := tx.RevokeSessions(c.Request.Context(), userID, req.Role, "")
+			if err != nil {
+				return err
+			}
+			revoked += n
+		}
+		return nil
+	})
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not revoke sessions: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("%d sessions of %d users revoked", revoked, len(userIDs)), http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"users":   len(userIDs),
+		"revoked": revoked,
+		"msg":     "Logged Out Successfully",
+		"status":  Success,
+	})
+}
+
+// managedUsers returns the id of the user with role and email or, when email is empty, the ids of
+// every user of role that userAuth manages, see findManagedUser
+func (s *SessionController) managedUsers(c *gin.Context, userAuth *models.UserAuth, role string, email string) ([]string, error) {
+	ctx := c.Request.Context()
+	if email != "" {
+		userID, err := findManagedUser(ctx, s.Database, s.policy, userAuth, role, email)
+		if err != nil {
+			return nil, err
+		}
+		return []string{userID}, nil
+	}
+	if !canManageRole(s.policy, userAuth, role) {
+		return nil, errRoleNotManaged
+	}
+	var users []models.UserOutput
+	var err error
+	if role == middleware.Owner {
+		users, _, err = s.ShowOwners(ctx, userAuth, nil)
+	} else {
+		users, _, err = s.ShowAdmins(ctx, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	userIDs := []string{}
+	for _, user := range users {
+		if role == middleware.Owner || user.Role == role {
+			userIDs = append(userIDs, user.ID)
+		}
+	}
+	return userIDs, nil
+}
+
+// loggedInSession returns the user set by AuthMiddleware and the session of its token, it refuses
+// requests made with an api key since they do not belong to a session
+func (s *SessionController) loggedInSession(c *gin.Context) (*models.UserAuth, string, bool) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	if userAuth.APIKey != nil {
+		logger.LogError(reqId, reqUrl, ErrAPIKeyManagesSessions.Error(), http.StatusForbidden)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": ErrAPIKeyManagesSessions.Error(),
+		})
+		return nil, "", false
+	}
+	value, _ = c.Get("claims")
+	claims, _ := value.(*models.Claims)
+	if claims == nil {
+		return userAuth, "", true
+	}
+	return userAuth, claims.SessionID, true
+}
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/models"
+	"net/http"
+	"time"
+)
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+type TokenController struct {
+	database.Database
+	keys *encryption.KeySet
+}
+
+func NewTokenController(db database.Database, keys *encryption.KeySet) *TokenController {
+	tc := new(TokenController)
+	tc.Database = db
+	tc.keys = keys
+	return tc
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token of the same
+// family. Presenting a refresh token a second time revokes its family and requires a new login
+func (t *TokenController) Refresh(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	var req refreshRequest
+	logger.LogDebug(reqId, reqUrl, "parsing request body")
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing request body:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "using refresh token")
+	old, err := t.UseRefreshToken(c.Request.Context(), encryption.HashOpaqueToken(req.RefreshToken), time.Now())
+	if err != nil {
+		if err == database.ErrInvalidRefreshToken || err == database.ErrRefreshTokenReused {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("can not refresh token: %v", err), http.StatusUnauthorized)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":  err.Error(),
+				"status": Fail,
+			})
+			return
+		}
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not refresh token: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	now := time.Now()
+	err = t.TouchSession(c.Request.Context(), old.FamilyID, now, now.Add(t.keys.Auth().RefreshTokenLifetime.Duration))
+	if err == database.ErrSessionNotFound {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not refresh token: %v", err), http.StatusUnauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not refresh session: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	token, refreshToken, err := issueTokens(c.Request.Context(), t.Database, t.keys, old.UserID, old.Role, old.FamilyID)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in token generation:%v", err), http.StatusInternalServerError)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "token refreshed successfully", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"token":        token,
+		"refreshToken": refreshToken,
+		"role":         old.Role,
+		"status":       Success,
+	})
+}
+
+// JWKS publishes the public keys access tokens are verified with
+func (t *TokenController) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, t.keys.JWKS())
+}
+
+// maxDeviceLength is the size of the device column of sessions
+const maxDeviceLength = 255
+
+// startSession records a new session of the user on the client of c and issues its first tokens
+func startSession(c *gin.Context, db database.Database, keys *encryption.KeySet, userID, role string) (string, string, error) {
+	now := time.Now()
+	device := c.Request.UserAgent()
+	if len(device) > maxDeviceLength {
+		device = device[:maxDeviceLength]
+	}
+	session := &models.Session{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		Role:       role,
+		Device:     device,
+		IP:         c.ClientIP(),
+		IssuedAt:   now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(keys.Auth().RefreshTokenLifetime.Duration),
+	}
+	err := db.CreateSession(c.Request.Context(), session)
+	if err != nil {
+		return "", "", err
+	}
+	return issueTokens(c.Request.Context(), db, keys, userID, role, session.ID)
+}
+
+// issueTokens creates an access token and a refresh token for the user in the session familyID, the
+// refresh token is of the family of the session
+func issueTokens(ctx context.Context, db database.Database, keys *encryption.KeySet, userID, role, familyID string) (string, string, error) {
+	token, err := encryption.CreateToken(ctx, &models.Claims{ID: userID, Role: role, SessionID: familyID}, keys)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := encryption.NewOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	err = db.StoreRefreshToken(ctx, &models.RefreshToken{
+		Hash:      encryption.HashOpaqueToken(refreshToken),
+		FamilyID:  familyID,
+		UserID:    userID,
+		Role:      role,
+		ExpiresAt: time.Now().Add(keys.Auth().RefreshTokenLifetime.Duration),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
+// revokeSession revokes the access token of claims and the refresh tokens issued with it
+func revokeSession(ctx context.Context, db database.Database, claims *models.Claims) error {
+	if claims.Id != "" {
+		err := db.RevokeToken(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0))
+		if err != nil {
+			return err
+		}
+	}
+	if claims.SessionID != "" {
+		return db.RevokeRefreshTokens(ctx, claims.SessionID)
+	}
+	return nil
+}
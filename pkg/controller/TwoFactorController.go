@@ -0,0 +1,427 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/rbac"
+	"github.com/vds/go-resman/pkg/prometheus"
+	"net/http"
+	"time"
+)
+
+// recoveryCodeCount is how many recovery codes are issued at once
+const recoveryCodeCount = 10
+
+var (
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrInvalidChallenge     = errors.New("login challenge is invalid or expired, log in again")
+	ErrTwoFactorMandatory   = errors.New("two-factor authentication is required and can not be disabled")
+)
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type challengeRequest struct {
+	Challenge string `json:"challenge" binding:"required"`
+}
+
+type challengeCodeRequest struct {
+	Challenge string `json:"challenge" binding:"required"`
+	Code      string `json:"code" binding:"required"`
+}
+
+type twoFactorPolicyRequest struct {
+	Required *bool `json:"required" binding:"required"`
+}
+
+type TwoFactorController struct {
+	database.Database
+	keys   *encryption.KeySet
+	guard  *loginGuard
+	policy *rbac.Policy
+}
+
+func NewTwoFactorController(db database.Database, keys *encryption.KeySet, lockout *config.Lockout, policy *rbac.Policy) *TwoFactorController {
+	tc := new(TwoFactorController)
+	tc.Database = db
+	tc.keys = keys
+	tc.guard = &loginGuard{db: db, cfg: lockout}
+	tc.policy = policy
+	return tc
+}
+
+// Enrol starts the enrolment of the logged in user and returns the secret to add to an authenticator app
+func (t *TwoFactorController) Enrol(c *gin.Context) {
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	t.enrol(c, userAuth.ID, userAuth.Role)
+}
+
+// Confirm enables two-factor authentication with a code of the enrolled secret and returns the recovery codes
+func (t *TwoFactorController) Confirm(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	var req twoFactorCodeRequest
+	if !bindTwoFactorRequest(c, &req) {
+		return
+	}
+	codes, err := t.confirm(c.Request.Context(), userAuth.ID, userAuth.Role, req.Code)
+	if err != nil {
+		t.abortWithTwoFactorError(c, err)
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "two-factor authentication enabled", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"recoveryCodes": codes,
+		"msg":           "Two-factor authentication enabled, keep the recovery codes in a safe place",
+		"status":        Success,
+	})
+}
+
+// RecoveryCodes replaces the remaining recovery codes of the logged in user, it needs a current code
+func (t *TwoFactorController) RecoveryCodes(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	var req twoFactorCodeRequest
+	if !bindTwoFactorRequest(c, &req) {
+		return
+	}
+	err := t.checkCode(c.Request.Context(), userAuth.ID, userAuth.Role, req.Code)
+	if err != nil {
+		t.abortWithTwoFactorError(c, err)
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err == nil {
+		err = t.ReplaceRecoveryCodes(c.Request.Context(), userAuth.ID, userAuth.Role, hashes)
+	}
+	if err != nil {
+		t.abortWithTwoFactorError(c, err)
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "recovery codes replaced", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"recoveryCodes": codes,
+		"status":        Success,
+	})
+}
+
+// Disable turns two-factor authentication off for the logged in user, unless super admins require it
+func (t *TwoFactorController) Disable(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	var req twoFactorCodeRequest
+	if !bindTwoFactorRequest(c, &req) {
+		return
+	}
+	required, err := t.IsTwoFactorRequired(c.Request.Context())
+	if err == nil && required {
+		err = ErrTwoFactorMandatory
+	}
+	if err == nil {
+		err = t.checkCode(c.Request.Context(), userAuth.ID, userAuth.Role, req.Code)
+	}
+	if err == nil {
+		err = t.DisableTwoFactor(c.Request.Context(), userAuth.ID, userAuth.Role)
+	}
+	if err != nil {
+		t.abortWithTwoFactorError(c, err)
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "two-factor authentication disabled", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"msg":    "Two-factor authentication disabled",
+		"status": Success,
+	})
+}
+
+// SetPolicy sets whether admins and super admins must use two-factor authentication to log in
+func (t *TwoFactorController) SetPolicy(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	var req twoFactorPolicyRequest
+	if !bindTwoFactorRequest(c, &req) {
+		return
+	}
+	err := t.SetTwoFactorRequired(c.Request.Context(), *req.Required)
+	if err != nil {
+		t.abortWithTwoFactorError(c, err)
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("two-factor requirement set to %t", *req.Required), http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"required": *req.Required,
+		"status":   Success,
+	})
+}
+
+// LogInEnrol starts the enrolment of a user who has to enrol before logging in, it takes the
+// challenge returned by LogIn in place of an access token
+func (t *TwoFactorController) LogInEnrol(c *gin.Context) {
+	var req challengeRequest
+	if !bindTwoFactorRequest(c, &req) {
+		return
+	}
+	claims, err := t.parseChallenge(c.Request.Context(), req.Challenge)
+	if err == nil && claims.Purpose != models.PurposeTwoFactorEnrol {
+		err = ErrInvalidChallenge
+	}
+	if err != nil {
+		t.abortWithTwoFactorError(c, err)
+		return
+	}
+	t.enrol(c, claims.ID, claims.Role)
+}
+
+// LogInCode completes a login with the challenge returned by LogIn and a code of the authenticator
+// app or a recovery code. A challenge to enrol is completed with the first code of the new secret,
+// which enables two-factor authentication and returns the recovery codes with the tokens
+func (t *TwoFactorController) LogInCode(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	var req challengeCodeRequest
+	if !bindTwoFactorRequest(c, &req) {
+		return
+	}
+	ctx := c.Request.Context()
+	claims, err := t.parseChallenge(ctx, req.Challenge)
+	if err != nil {
+		t.abortWithTwoFactorError(c, err)
+		return
+	}
+	guardKey := twoFactorKey(claims.Role, claims.ID)
+	if t.guard.refuseLocked(c, claims.Role, guardKey, ipKey(c.ClientIP())) {
+		return
+	}
+	var codes []string
+	tf, err := t.GetTwoFactor(ctx, claims.ID, claims.Role)
+	if err == nil {
+		if !tf.Enabled && claims.Purpose == models.PurposeTwoFactorEnrol {
+			codes, err = t.confirm(ctx, claims.ID, claims.Role, req.Code)
+		} else {
+			err = t.checkCode(ctx, claims.ID, claims.Role, req.Code)
+		}
+	}
+	if err == nil {
+		// the challenge is single use, a second login needs the password again
+		err = t.RevokeToken(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0))
+	}
+	if err == ErrInvalidTwoFactorCode || err == database.ErrTwoFactorCodeUsed {
+		t.guard.failAll(c, claims.Role, reasonInvalidCode, guardKey)
+	}
+	if err == nil {
+		err = t.ClearLoginFailures(ctx, guardKey)
+	}
+	if err != nil {
+		t.abortWithTwoFactorError(c, err)
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "creating tokens for user")
+	token, refreshToken, err := startSession(c, t.Database, t.keys, claims.ID, claims.Role)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in token generation:%v", err), http.StatusInternalServerError)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "User logged in successfully with two-factor authentication", http.StatusOK)
+	prometheus.Global().GetCounterVec(logins).WithLabelValues(claims.Role).Inc()
+	response := gin.H{
+		"token":        token,
+		"refreshToken": refreshToken,
+		"role":         claims.Role,
+		"msg":          "Login Successful",
+		"status":       Success,
+	}
+	if codes != nil {
+		response["recoveryCodes"] = codes
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// enrol stores a new secret for the user and responds with it and its otpauth uri
+func (t *TwoFactorController) enrol(c *gin.Context, userID, role string) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	if !t.policy.Can(role, rbac.TwoFactorEnrol) {
+		logger.LogError(reqId, reqUrl, "role can not enrol two-factor authentication", http.StatusForbidden)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  "two-factor authentication is not available to " + role,
+			"status": Fail,
+		})
+		return
+	}
+	user, err := t.GetUser(c.Request.Context(), userID, role)
+	if err != nil {
+		t.abortWithTwoFactorError(c, err)
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "creating totp secret")
+	secret, err := encryption.NewTOTPSecret()
+	if err == nil {
+		err = t.StoreTwoFactorSecret(c.Request.Context(), userID, role, secret)
+	}
+	if err != nil {
+		t.abortWithTwoFactorError(c, err)
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "two-factor enrolment started", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"secret": secret,
+		"uri":    encryption.TOTPURI(t.keys.Auth().TOTPIssuer, user.Email, secret),
+		"msg":    "Add the secret to an authenticator app and confirm with a code",
+		"status": Success,
+	})
+}
+
+// confirm enables the started enrolment of the user with code and returns new recovery codes
+func (t *TwoFactorController) confirm(ctx context.Context, userID, role, code string) ([]string, error) {
+	tf, err := t.GetTwoFactor(ctx, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	if tf.Enabled || tf.Secret == "" {
+		return nil, database.ErrTwoFactorNotPending
+	}
+	step, ok := encryption.ValidateTOTP(tf.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = t.EnableTwoFactor(ctx, userID, role, step, hashes)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// checkCode accepts a code of the enabled secret of the user or one of their recovery codes
+func (t *TwoFactorController) checkCode(ctx context.Context, userID, role, code string) error {
+	tf, err := t.GetTwoFactor(ctx, userID, role)
+	if err != nil {
+		return err
+	}
+	if !tf.Enabled {
+		return database.ErrTwoFactorNotPending
+	}
+	step, ok := encryption.ValidateTOTP(tf.Secret, code, time.Now())
+	if ok {
+		return t.UseTwoFactorStep(ctx, userID, role, step)
+	}
+	err = t.UseRecoveryCode(ctx, userID, role, encryption.HashRecoveryCode(code))
+	if err == database.ErrInvalidRecoveryCode {
+		return ErrInvalidTwoFactorCode
+	}
+	return err
+}
+
+// parseChallenge returns the claims of a challenge token that was not used yet
+func (t *TwoFactorController) parseChallenge(ctx context.Context, challenge string) (*models.Claims, error) {
+	claims, err := encryption.ParseToken(challenge, t.keys)
+	if err != nil || (claims.Purpose != models.PurposeTwoFactor && claims.Purpose != models.PurposeTwoFactorEnrol) {
+		return nil, ErrInvalidChallenge
+	}
+	revoked, err := t.IsTokenRevoked(ctx, claims.Id)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidChallenge
+	}
+	return claims, nil
+}
+
+// abortWithTwoFactorError responds with the status matching err
+func (t *TwoFactorController) abortWithTwoFactorError(c *gin.Context, err error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+	status := http.StatusInternalServerError
+	switch err {
+	case ErrInvalidTwoFactorCode, ErrInvalidChallenge, database.ErrTwoFactorCodeUsed:
+		status = http.StatusUnauthorized
+	case ErrTwoFactorMandatory:
+		status = http.StatusForbidden
+	case database.ErrTwoFactorEnabled, database.ErrTwoFactorNotPending:
+		status = http.StatusConflict
+	case database.ErrUserNotFound:
+		status = http.StatusNotFound
+	}
+	logger.LogError(reqId, reqUrl, fmt.Sprintf("two-factor request failed: %v", err), status)
+	if status == http.StatusInternalServerError {
+		c.JSON(status, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	c.JSON(status, gin.H{
+		"error":  err.Error(),
+		"status": Fail,
+	})
+}
+
+// twoFactorChallenge returns the purpose of the challenge the user has to answer after their
+// password, it is empty when the password is enough or the role can not enrol a second factor
+func twoFactorChallenge(ctx context.Context, db database.Database, policy *rbac.Policy, userID, role string) (string, error) {
+	if !policy.Can(role, rbac.TwoFactorEnrol) {
+		return "", nil
+	}
+	tf, err := db.GetTwoFactor(ctx, userID, role)
+	if err != nil {
+		return "", err
+	}
+	if tf.Enabled {
+		return models.PurposeTwoFactor, nil
+	}
+	required, err := db.IsTwoFactorRequired(ctx)
+	if err != nil {
+		return "", err
+	}
+	if required {
+		return models.PurposeTwoFactorEnrol, nil
+	}
+	return "", nil
+}
+
+// newRecoveryCodes returns fresh recovery codes and the hashes to store for them
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := encryption.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = encryption.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// bindTwoFactorRequest parses the json body into req and responds with 400 when it is not valid
+func bindTwoFactorRequest(c *gin.Context, req interface{}) bool {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+	logger.LogDebug(reqId, reqUrl, "parsing request body")
+	err := c.ShouldBindJSON(req)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing request body:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return false
+	}
+	return true
+}
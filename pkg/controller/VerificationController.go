@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/mail"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/rbac"
+	"net/http"
+	"time"
+)
+
+type verifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type resendVerificationRequest struct {
+	Role  string `json:"role" binding:"required"`
+	Email string `json:"email" binding:"required"`
+}
+
+type VerificationController struct {
+	database.Database
+	mailer mail.Mailer
+	auth   *config.Auth
+	policy *rbac.Policy
+}
+
+func NewVerificationController(db database.Database, mailer mail.Mailer, auth *config.Auth, policy *rbac.Policy) *VerificationController {
+	vc := new(VerificationController)
+	vc.Database = db
+	vc.mailer = mailer
+	vc.auth = auth
+	vc.policy = policy
+	return vc
+}
+
+// Verify activates the account of a token sent by sendVerification
+func (v *VerificationController) Verify(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	var req verifyEmailRequest
+	logger.LogDebug(reqId, reqUrl, "parsing request body")
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing request body:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "verifying email")
+	err = v.VerifyEmail(c.Request.Context(), encryption.HashOpaqueToken(req.Token), time.Now())
+	if err != nil {
+		if err == database.ErrInvalidVerificationToken {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("can not verify email: %v", err), http.StatusBadRequest)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  err.Error(),
+				"status": Fail,
+			})
+			return
+		}
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not verify email: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "email verified successfully", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"msg":    "Email Verified",
+		"status": Success,
+	})
+}
+
+// Resend emails a new verification token to a pending account, replacing the earlier ones.
+// Users other than owners need the admin:update permission, and users of the created scope can only
+// resend to the owners they created
+func (v *VerificationController) Resend(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	var req resendVerificationRequest
+	logger.LogDebug(reqId, reqUrl, "parsing request body")
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in parsing request body:%v", err), http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": Fail,
+		})
+		return
+	}
+	logger.LogDebug(reqId, reqUrl, "checking for valid user type")
+	if !v.policy.IsRole(req.Role) {
+		logger.LogError(reqId, reqUrl, "invalid user type", http.StatusBadRequest)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	userID, err := findManagedUser(c.Request.Context(), v.Database, v.policy, userAuth, req.Role, req.Email)
+	if err == nil {
+		err = sendVerification(c.Request.Context(), v.Database, v.mailer, v.auth, userID, req.Role, req.Email)
+	}
+	if err != nil {
+		switch err {
+		case errRoleNotManaged:
+			logger.LogError(reqId, reqUrl, "role can only resend verification to owners", http.StatusForbidden)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":  "verification can only be resent to owners",
+				"status": Fail,
+			})
+		case database.ErrUserNotFound:
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("can not resend verification: %v", err), http.StatusNotFound)
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":  err.Error(),
+				"status": Fail,
+			})
+		case database.ErrAlreadyVerified:
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("can not resend verification: %v", err), http.StatusConflict)
+			c.JSON(http.StatusConflict, gin.H{
+				"error":  err.Error(),
+				"status": Fail,
+			})
+		default:
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("can not resend verification: %v", err), http.StatusInternalServerError)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "internal server error",
+			})
+		}
+		return
+	}
+	logger.LogInfo(reqId, reqUrl, "verification email sent", http.StatusOK)
+	c.JSON(http.StatusOK, gin.H{
+		"msg":    "Verification Email Sent",
+		"status": Success,
+	})
+}
+
+// sendVerification stores a new verification token of the user and emails it to them
+func sendVerification(ctx context.Context, db database.Database, mailer mail.Mailer, auth *config.Auth, userID, role, email string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+
+	logger.LogDebug(reqId, reqUrl, "creating email verification token")
+	token, err := encryption.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	err = db.StoreVerificationToken(ctx, &models.VerificationToken{
+		Hash:      encryption.HashOpaqueToken(token),
+		UserID:    userID,
+		Role:      role,
+		ExpiresAt: time.Now().Add(auth.VerificationTokenLifetime.Duration),
+	})
+	if err != nil {
+		return err
+	}
+	logger.LogDebug(reqId, reqUrl, "sending verification email")
+	action, secret := tokenLink(auth.EmailVerificationURL, token)
+	return mailer.Send(ctx, &mail.Message{
+		To:      email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("%s to verify your email and activate your account, it expires in %s:\n\n%s\n",
+			action, auth.VerificationTokenLifetime.Duration, secret),
+	})
+}
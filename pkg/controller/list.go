@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/models"
+	"strconv"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 100
+)
+
+var (
+	ErrInvalidLimit    = errors.New("limit must be a number between 1 and " + strconv.Itoa(MaxPageLimit))
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrInvalidSort     = errors.New("sort must be one of id, -id, name, -name")
+	ErrInvalidAssigned = errors.New("assigned must be true or false")
+	ErrInvalidStatus   = errors.New("status must be one of active, suspended, deleted")
+)
+
+// getListOptions reads the limit, cursor, sort and name query parameters of list endpoints,
+// assigned is only read when filtering on the owner of restaurants is possible
+func getListOptions(c *gin.Context, withAssigned bool) (*models.ListOptions, error) {
+	opts := &models.ListOptions{
+		Limit:      DefaultPageLimit,
+		Sort:       c.Query("sort"),
+		NamePrefix: c.Query("name"),
+	}
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > MaxPageLimit {
+			return nil, ErrInvalidLimit
+		}
+		opts.Limit = value
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		offset, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		opts.Offset = offset
+	}
+	if !database.ValidSort(opts.Sort) {
+		return nil, ErrInvalidSort
+	}
+	if assigned := c.Query("assigned"); withAssigned && assigned != "" {
+		value, err := strconv.ParseBool(assigned)
+		if err != nil {
+			return nil, ErrInvalidAssigned
+		}
+		opts.Assigned = &value
+	}
+	return opts, nil
+}
+
+// getUserListOptions reads the query parameters of getListOptions and the status parameter of the user
+// list endpoints, deleted users are only listed when status asks for them
+func getUserListOptions(c *gin.Context) (*models.ListOptions, error) {
+	opts, err := getListOptions(c, false)
+	if err != nil {
+		return nil, err
+	}
+	switch status := c.Query("status"); status {
+	case "", models.StatusActive, models.StatusSuspended, models.StatusDeleted:
+		opts.Status = status
+	default:
+		return nil, ErrInvalidStatus
+	}
+	return opts, nil
+}
+
+// newPage wraps a page of data in the list envelope, the next cursor is left empty on the last page
+func newPage(data interface{}, total int, opts *models.ListOptions) *models.Page {
+	page := &models.Page{Data: data, Total: total}
+	if next := opts.Offset + opts.Limit; next < total {
+		page.NextCursor = encodeCursor(next)
+	}
+	return page
+}
+
+// cursors are opaque to clients, they hold the offset of the next page
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.Atoi(string(data))
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/prometheus"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reasons of the failed logins counter
+const (
+	reasonInvalidCredentials = "invalid_credentials"
+	reasonInvalidCode        = "invalid_code"
+	reasonLocked             = "locked"
+	// reasonUnknownIdentity counts identity provider logins matching no account
+	reasonUnknownIdentity = "unknown_identity"
+)
+
+// loginGuard applies the lockout policy to the failed logins of users and source ips
+type loginGuard struct {
+	db  database.Database
+	cfg *config.Lockout
+}
+
+// accountKey is the lockout key of the user logging in with role and email, it does not depend
+// on the user existing so locks do not tell which emails are registered
+func accountKey(role, email string) string {
+	return "account:" + role + ":" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// twoFactorKey is the lockout key of the second step of the login of a user
+func twoFactorKey(role, userID string) string {
+	return database.TwoFactorLockKey(role, userID)
+}
+
+// refuseLocked responds with 429 and returns true when one of keys is locked
+func (g *loginGuard) refuseLocked(c *gin.Context, role string, keys ...string) bool {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+	now := time.Now()
+	lockedUntil, err := g.db.GetLoginLock(c.Request.Context(), now, keys...)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not check login lock: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return true
+	}
+	if lockedUntil.IsZero() {
+		return false
+	}
+	retryAfter := int(math.Ceil(lockedUntil.Sub(now).Seconds()))
+	logger.LogError(reqId, reqUrl, fmt.Sprintf("login locked for %ds", retryAfter), http.StatusTooManyRequests)
+	prometheus.Global().GetCounterVec(failedLogins).WithLabelValues(role, reasonLocked).Inc()
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":  "too many failed logins, try again later",
+		"status": Fail,
+	})
+	return true
+}
+
+// fail records a failed login for key and locks it once its failures reach threshold
+func (g *loginGuard) fail(ctx context.Context, key string, threshold int) error {
+	if threshold == 0 {
+		return nil
+	}
+	now := time.Now()
+	failures, err := g.db.RecordLoginFailure(ctx, key, now, now.Add(g.cfg.ResetAfter.Duration))
+	if err != nil || failures < threshold {
+		return err
+	}
+	return g.db.LockLogin(ctx, key, now.Add(g.lockDuration(failures-threshold)))
+}
+
+// failAll records a failed login for the user key and the source ip of c
+func (g *loginGuard) failAll(c *gin.Context, role, reason, userKey string) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+	prometheus.Global().GetCounterVec(failedLogins).WithLabelValues(role, reason).Inc()
+	err := g.fail(c.Request.Context(), userKey, g.cfg.AccountThreshold)
+	if err == nil {
+		err = g.fail(c.Request.Context(), ipKey(c.ClientIP()), g.cfg.IPThreshold)
+	}
+	if err != nil {
+		// the login fails anyway, a missed record only weakens the limit
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not record login failure: %v", err), 0)
+	}
+}
+
+// lockDuration doubles the base duration for each failure past the threshold
+func (g *loginGuard) lockDuration(extraFailures int) time.Duration {
+	duration := g.cfg.BaseDuration.Duration
+	for i := 0; i < extraFailures && duration < g.cfg.MaxDuration.Duration; i++ {
+		duration *= 2
+	}
+	if duration > g.cfg.MaxDuration.Duration {
+		duration = g.cfg.MaxDuration.Duration
+	}
+	return duration
+}
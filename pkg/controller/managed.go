@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/rbac"
+)
+
+// errRoleNotManaged is returned when a user only allowed to manage owners acts on another role
+var errRoleNotManaged = errors.New("role is not managed by the user")
+
+// canManageRole reports whether userAuth acts on users of role, roles other than owner need
+// the admin update permission from both the role and the api key of the request
+func canManageRole(policy *rbac.Policy, userAuth *models.UserAuth, role string) bool {
+	if role == middleware.Owner {
+		return true
+	}
+	if !policy.Can(userAuth.Role, rbac.AdminUpdate) {
+		return false
+	}
+	return userAuth.APIKey == nil || userAuth.APIKey.Allows(rbac.AdminUpdate)
+}
+
+// findManagedUser returns the id of the user with role and email that userAuth manages, owners
+// of other admins are reported like unknown ones
+func findManagedUser(ctx context.Context, db database.Database, policy *rbac.Policy, userAuth *models.UserAuth, role, email string) (string, error) {
+	if !canManageRole(policy, userAuth, role) {
+		return "", errRoleNotManaged
+	}
+	userID, err := db.FindUserID(ctx, role, email)
+	if err == nil && role == middleware.Owner && userAuth.Scope == models.ScopeCreated {
+		err = db.CheckOwnerCreator(ctx, userAuth.ID, userID)
+		if err == database.ErrInvalidOwnerCreator {
+			err = database.ErrUserNotFound
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return userID, nil
+}
@@ -7,6 +7,7 @@ import (
 
 const(
 	logins         = "total_logins"
+	failedLogins   = "failed_logins"
 )
 
 func init(){
@@ -22,5 +23,12 @@ var(
 			},
 			Labels: []string{"role"},
 		},
+		{
+			Opts: prometheus2.CounterOpts{
+				Name: failedLogins,
+				Help: "failed logins by reason: invalid_credentials, invalid_code, locked or unknown_identity",
+			},
+			Labels: []string{"role", "reason"},
+		},
 	}
 )
@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"context"
+	"github.com/vds/go-resman/pkg/database"
+)
+
+// runBulk runs fn in a single transaction. An internal error rolls the whole batch back, any other
+// error reports the invalid entries that were skipped and the valid ones are still committed
+func runBulk(ctx context.Context, db database.Database, fn func(tx database.Database) error) error {
+	var skipped error
+	err := db.WithTx(ctx, func(tx database.Database) error {
+		err := fn(tx)
+		if err != nil && err != database.ErrInternal {
+			skipped = err
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return skipped
+}
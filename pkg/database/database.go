@@ -3,7 +3,10 @@ package database
 import (
 	"context"
 	"errors"
+	"github.com/vds/go-resman/pkg/encryption"
 	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/rbac"
+	"time"
 )
 
 var (
@@ -17,28 +20,86 @@ var (
 	ErrInvalidRestaurantOwner   = errors.New("can not update restaurant owned by others")
 	ErrInvalidDish              = errors.New("dish does not exist")
 	ErrInvalidRestaurantDish    = errors.New("can not update dish of other restaurant")
+	ErrInvalidRefreshToken      = errors.New("invalid refresh token")
+	ErrRefreshTokenReused       = errors.New("refresh token already used please login again")
+	ErrUserNotFound             = errors.New("user does not exist")
+	ErrInvalidResetToken        = errors.New("password reset token is invalid or expired")
+	ErrUnverifiedEmail          = errors.New("email is not verified, use the link sent to it")
+	ErrAlreadyVerified          = errors.New("email is already verified")
+	ErrInvalidVerificationToken = errors.New("email verification token is invalid or expired")
+	ErrTwoFactorEnabled         = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotPending      = errors.New("two-factor enrolment was not started")
+	ErrTwoFactorCodeUsed        = errors.New("two-factor code was already used, wait for the next one")
+	ErrInvalidRecoveryCode      = errors.New("recovery code is invalid or already used")
+	ErrInvalidAPIKey            = errors.New("invalid api key")
+	ErrAPIKeyNotFound           = errors.New("api key does not exist")
+	ErrSessionNotFound          = errors.New("session does not exist or has ended")
+	ErrAccountSuspended         = errors.New("account is suspended, contact an administrator")
 )
 
+// AdminsCondition selects the users listed and managed as admins, users of custom roles are managed
+// like admins so every role but the super admin and owner ones is selected
+const AdminsCondition = "role not in ('" + rbac.SuperAdmin + "','" + rbac.Owner + "')"
+
+// NotDeletedCondition selects the users whose account was not deleted, deleted accounts stay in the users
+// table until they are purged
+const NotDeletedCondition = "status<>'" + models.StatusDeleted + "'"
+
+// TwoFactorLockKey is the lockout key of the second login step of a user, unlike the lockout keys of
+// emails and ips it belongs to the account and is purged with it
+func TwoFactorLockKey(role, userID string) string {
+	return "2fa:" + role + ":" + userID
+}
+
+// StatusCondition returns the condition selecting the users listed with opts along with its args
+func StatusCondition(opts *models.ListOptions) (string, []interface{}) {
+	if opts == nil || opts.Status == "" {
+		return NotDeletedCondition, nil
+	}
+	return "status=?", []interface{}{opts.Status}
+}
+
+// IsAdminRole reports whether users of role are selected by AdminsCondition
+func IsAdminRole(role string) bool {
+	return role != rbac.SuperAdmin && role != rbac.Owner
+}
+
+// SettingTwoFactorRequired names the setting holding whether admins must enrol a second factor
+const SettingTwoFactorRequired = "two_factor_required"
+
+// UsersLockSetting names the setting row that LockUsers locks for role
+func UsersLockSetting(role string) string {
+	return "lock_users_" + role
+}
+
 type Database interface {
-	ShowNearBy(ctx context.Context, location *models.Location) (string, error)
+	ShowNearBy(ctx context.Context, location *models.Location) ([]models.RestaurantOutput, error)
 
+	// SetPasswordHasher makes hasher hash the passwords stored from now on, it is called before the
+	// database is used and hashes of other hashers keep verifying
+	SetPasswordHasher(hasher encryption.PasswordHasher)
 	CreateUser(ctx context.Context, user *models.UserReg) (string, error)
+	// LogInUser returns the id of the user matching cred, ErrUnverifiedEmail when the password
+	// matches but the email of the user is not verified yet
 	LogInUser(ctx context.Context, cred *models.Credentials) (string, error)
-	ShowAdmins(ctx context.Context, ) (string, error)
-	UpdateAdmin(ctx context.Context, admin *models.UserOutput) (string, error)
+	ShowAdmins(ctx context.Context, opts *models.ListOptions) ([]models.UserOutput, int, error)
+	UpdateAdmin(ctx context.Context, admin *models.UserOutput) (*models.UserOutput, error)
+	// RemoveAdmins marks the accounts of the admins deleted and ends their sessions, the accounts are
+	// kept until PurgeDeletedUsers
 	RemoveAdmins(ctx context.Context, adminIDs ...string) error
 
-	ShowOwners(ctx context.Context, userAuth *models.UserAuth) (string, error)
+	ShowOwners(ctx context.Context, userAuth *models.UserAuth, opts *models.ListOptions) ([]models.UserOutput, int, error)
 	CreateOwner(ctx context.Context, creatorID string, owner *models.OwnerReg) (*models.UserOutput, error)
 
 	CheckOwnerCreator(ctx context.Context, creatorID string, ownerID string) error
-	UpdateOwner(ctx context.Context, owner *models.UserOutput) (string, error)
+	UpdateOwner(ctx context.Context, owner *models.UserOutput) (*models.UserOutput, error)
+	// RemoveOwners marks the accounts of the owners deleted like RemoveAdmins, their restaurants are left without owner
 	RemoveOwners(ctx context.Context, userAuth *models.UserAuth, ownerIDs ...string) error
 
 	CheckAdmin(ctx context.Context, adminID string) error
-	ShowRestaurants(ctx context.Context, userAuth *models.UserAuth) (string, error)
+	ShowRestaurants(ctx context.Context, userAuth *models.UserAuth, opts *models.ListOptions) ([]models.RestaurantOutput, int, error)
 	InsertRestaurant(ctx context.Context, restaurant *models.Restaurant) (*models.RestaurantOutput, error)
-	ShowAvailableRestaurants(ctx context.Context, userAuth *models.UserAuth) (string, error)
+	ShowAvailableRestaurants(ctx context.Context, userAuth *models.UserAuth) ([]models.RestaurantOutput, error)
 	InsertOwnerForRestaurants(ctx context.Context, userAuth *models.UserAuth, ownerID string, resIDs ...int) error
 	RemoveOwnerForRestaurants(ctx context.Context, userAuth *models.UserAuth, ownerID string, resIDs ...int) error
 
@@ -47,7 +108,7 @@ type Database interface {
 
 	RemoveRestaurants(ctx context.Context, userAuth *models.UserAuth, resIDs ...int) error
 
-	ShowMenu(ctx context.Context, resID int) (string, error)
+	ShowMenu(ctx context.Context, resID int, opts *models.ListOptions) ([]models.DishOutput, int, error)
 	CheckRestaurantOwner(ctx context.Context, ownerID string, resID int) error
 	InsertDishes(ctx context.Context, dishes models.Dish, resID int) (*models.DishOutput, error)
 	UpdateDish(ctx context.Context, dish *models.DishOutput) (*models.DishOutput, error)
@@ -55,6 +116,126 @@ type Database interface {
 
 	RemoveDishes(ctx context.Context, dishIDs ...int) error
 
-	StoreToken(ctx context.Context, token string) error
-	VerifyToken(ctx context.Context, token string) bool
+	// RevokeToken records the jti of an access token as revoked until the token expires
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+
+	StoreRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	// UseRefreshToken marks the refresh token with the given hash as used and returns it.
+	// Unknown and expired tokens give ErrInvalidRefreshToken, a token that was already used gives
+	// ErrRefreshTokenReused and the whole family of the token is revoked, so it must not be
+	// called inside WithTx where returning the error would roll the revocation back
+	UseRefreshToken(ctx context.Context, hash string, now time.Time) (*models.RefreshToken, error)
+	// RevokeRefreshTokens deletes the refresh tokens of a family and ends the session of the family
+	RevokeRefreshTokens(ctx context.Context, familyID string) error
+	// FindUserID returns the id of the user with the given role and email, ErrUserNotFound when there is none
+	FindUserID(ctx context.Context, role string, email string) (string, error)
+	// CountUsers returns how many users have the given role
+	CountUsers(ctx context.Context, role string) (int, error)
+	// LockUsers makes the other transactions calling it for role wait until the end of the transaction,
+	// so that a transaction counting the users of role before creating one does not race with another
+	LockUsers(ctx context.Context, role string) error
+	// GetUser returns the user with the given role and id, ErrUserNotFound when there is none
+	GetUser(ctx context.Context, userID string, role string) (*models.UserOutput, error)
+	// GetUserStatus returns the account status of the user with the given role and id, deleted accounts
+	// included. It gives ErrUserNotFound when there is none
+	GetUserStatus(ctx context.Context, userID string, role string) (string, error)
+	// SuspendUser suspends the account of the user with the given id and ends its sessions, it gives
+	// ErrUserNotFound when there is no such user or its account was deleted
+	SuspendUser(ctx context.Context, userID string) error
+	// ReactivateUser makes the suspended or deleted account of the user with the given id active again and
+	// returns the user, ErrUserNotFound when there is no such user and ErrDupEmail when the email of a
+	// deleted account was taken by another account of its role since
+	ReactivateUser(ctx context.Context, userID string) (*models.UserOutput, error)
+	// PurgeDeletedUsers deletes the accounts deleted before the given time along with their tokens, sessions,
+	// api keys, second factors and second factor lockouts, clears the creator of the restaurants and users
+	// they created and returns how many accounts were deleted
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error)
+	// StorePasswordResetToken stores token in place of the earlier reset tokens of its user
+	StorePasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error
+	// ResetPassword consumes the reset token with the given hash, sets the password of its user and
+	// revokes the refresh tokens of the user. Unknown, used and expired tokens give ErrInvalidResetToken
+	ResetPassword(ctx context.Context, hash string, password string, now time.Time) error
+	// UpdateProfile sets the email and name of the user with the id and role of user and returns it, it gives
+	// ErrUserNotFound when there is no such user and ErrDupEmail when another user of the role has the email.
+	// A new email has to be verified again before the user can log in
+	UpdateProfile(ctx context.Context, user *models.UserOutput) (*models.UserOutput, error)
+	// ChangePassword sets the password of the user when current matches the stored one, ErrInvalidCredentials
+	// otherwise and ErrUserNotFound when there is no such user. The reset tokens of the user are deleted and every session but the one with id keepID is
+	// ended, it returns how many were ended
+	ChangePassword(ctx context.Context, userID string, role string, current string, password string, keepID string) (int64, error)
+
+	// StoreVerificationToken stores token in place of the earlier verification tokens of its user, it gives
+	// ErrUserNotFound when the user does not exist and ErrAlreadyVerified when its email is verified
+	StoreVerificationToken(ctx context.Context, token *models.VerificationToken) error
+	// VerifyEmail consumes the verification token with the given hash and marks the email of its user
+	// as verified. Unknown, used and expired tokens give ErrInvalidVerificationToken
+	VerifyEmail(ctx context.Context, hash string, now time.Time) error
+
+	// GetTwoFactor returns the TOTP enrolment of the user, an empty one when the user never enrolled
+	GetTwoFactor(ctx context.Context, userID string, role string) (*models.TwoFactor, error)
+	// StoreTwoFactorSecret starts an enrolment with secret in place of an unconfirmed earlier one,
+	// it gives ErrTwoFactorEnabled when two-factor authentication is enabled
+	StoreTwoFactorSecret(ctx context.Context, userID string, role string, secret string) error
+	// EnableTwoFactor confirms the started enrolment with the time step of a valid code and stores the
+	// hashes of the recovery codes. It gives ErrTwoFactorNotPending when no unconfirmed enrolment exists
+	EnableTwoFactor(ctx context.Context, userID string, role string, step int64, recoveryHashes []string) error
+	// UseTwoFactorStep records step as the last accepted code, ErrTwoFactorCodeUsed when a code of
+	// that step or a later one was already accepted
+	UseTwoFactorStep(ctx context.Context, userID string, role string, step int64) error
+	// UseRecoveryCode consumes the recovery code with the given hash, ErrInvalidRecoveryCode when it is not one of the user
+	UseRecoveryCode(ctx context.Context, userID string, role string, hash string) error
+	// ReplaceRecoveryCodes stores hashes in place of the remaining recovery codes of the user
+	ReplaceRecoveryCodes(ctx context.Context, userID string, role string, hashes []string) error
+	// DisableTwoFactor deletes the enrolment and recovery codes of the user
+	DisableTwoFactor(ctx context.Context, userID string, role string) error
+	// SetTwoFactorRequired sets whether admins and super admins must enrol before they can log in
+	SetTwoFactorRequired(ctx context.Context, required bool) error
+	IsTwoFactorRequired(ctx context.Context) (bool, error)
+
+	// RecordLoginFailure counts a failed login for key, such as a user or a source ip, and returns the
+	// failures counted since the record of key expired. The record is kept until expiresAt or the end of its lock
+	RecordLoginFailure(ctx context.Context, key string, now time.Time, expiresAt time.Time) (int, error)
+	// LockLogin refuses logins for the recorded key until the given time
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	// GetLoginLock returns the latest lock of keys that has not ended at now, the zero time when none is locked
+	GetLoginLock(ctx context.Context, now time.Time, keys ...string) (time.Time, error)
+	// ClearLoginFailures forgets the failures and locks of keys
+	ClearLoginFailures(ctx context.Context, keys ...string) error
+
+	// CreateAPIKey stores key, its id and hash are set by the caller
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	// ShowAPIKeys returns the api keys of the user, the oldest first
+	ShowAPIKeys(ctx context.Context, userID string, role string) ([]models.APIKey, error)
+	// RevokeAPIKey deletes the api key of the user with the given id, ErrAPIKeyNotFound when the user has none
+	RevokeAPIKey(ctx context.Context, userID string, role string, keyID string) error
+	// UseAPIKey returns the api key with the given hash and records now as its last use. It gives
+	// ErrInvalidAPIKey when no key has the hash or the user of the key does not exist anymore
+	UseAPIKey(ctx context.Context, hash string, now time.Time) (*models.APIKey, error)
+
+	// CreateSession stores session, its id is the family of the refresh tokens issued with it
+	CreateSession(ctx context.Context, session *models.Session) error
+	// TouchSession records now as the last time the session was seen and extends it to expiresAt when that
+	// is later than its expiry. It gives ErrSessionNotFound when the session was revoked or has expired
+	TouchSession(ctx context.Context, sessionID string, now time.Time, expiresAt time.Time) error
+	// ShowSessions returns the sessions of the user that have not expired at now, the latest seen first
+	ShowSessions(ctx context.Context, userID string, role string, now time.Time) ([]models.Session, error)
+	// RevokeSession ends the session of the user with the given id and deletes its refresh tokens,
+	// ErrSessionNotFound when the user has no such session
+	RevokeSession(ctx context.Context, userID string, role string, sessionID string) error
+	// RevokeSessions ends every session of the user but the one with id keepID, which can be empty,
+	// and returns how many were ended
+	RevokeSessions(ctx context.Context, userID string, role string, keepID string) (int64, error)
+
+	// PurgeExpiredTokens deletes the revocations, refresh, reset and verification tokens, the sessions and the login
+	// failures that expired before now and returns how many were deleted
+	PurgeExpiredTokens(ctx context.Context, now time.Time) (int64, error)
+
+	// WithTx runs fn with a Database whose operations are applied atomically, they are committed
+	// when fn returns nil and discarded otherwise. fn must only use tx, calls made inside fn
+	// on the outer Database may block until the transaction ends
+	WithTx(ctx context.Context, fn func(tx Database) error) error
+
+	// MigrationStatus checks the database is reachable and returns the schema version applied to it
+	MigrationStatus(ctx context.Context) (*models.MigrationStatus, error)
 }
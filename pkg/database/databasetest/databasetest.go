@@ -0,0 +1,1029 @@
+// Package databasetest holds the behavioural tests every database.Database implementation has to pass
+package databasetest
+
+import (
+	"context"
+	"errors"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Context returns a context carrying the request fields the database implementations log with
+func Context() context.Context {
+	ctx := context.WithValue(context.Background(), "reqId", "databasetest")
+	return context.WithValue(ctx, "reqUrl", "databasetest")
+}
+
+// RunTests runs the behavioural tests against db, db is expected to be empty
+func RunTests(t *testing.T, db database.Database) {
+	ctx := Context()
+	superAdminID := mustCreateUser(t, db, &models.UserReg{Role: middleware.SuperAdmin, Email: "super@test.com", Name: "super", Password: "superPass", Verified: true})
+	adminID := mustCreateUser(t, db, &models.UserReg{Role: middleware.Admin, Email: "admin@test.com", Name: "admin", Password: "adminPass", Verified: true})
+	otherAdminID := mustCreateUser(t, db, &models.UserReg{Role: middleware.Admin, Email: "other@test.com", Name: "other", Password: "otherPass"})
+	superAuth := &models.UserAuth{ID: superAdminID, Role: middleware.SuperAdmin, Scope: models.ScopeAll}
+	adminAuth := &models.UserAuth{ID: adminID, Role: middleware.Admin, Scope: models.ScopeCreated}
+	otherAdminAuth := &models.UserAuth{ID: otherAdminID, Role: middleware.Admin, Scope: models.ScopeCreated}
+
+	t.Run("users", func(t *testing.T) {
+		_, err := db.CreateUser(ctx, &models.UserReg{Role: middleware.Admin, Email: "admin@test.com", Name: "dup", Password: "pass"})
+		assertError(t, err, database.ErrDupEmail)
+
+		id, err := db.LogInUser(ctx, &models.Credentials{Role: middleware.Admin, Email: "admin@test.com", Password: "adminPass"})
+		assertError(t, err, nil)
+		if id != adminID {
+			t.Fatalf("got id %v want %v", id, adminID)
+		}
+		_, err = db.LogInUser(ctx, &models.Credentials{Role: middleware.Admin, Email: "admin@test.com", Password: "wrong"})
+		assertError(t, err, database.ErrInvalidCredentials)
+		_, err = db.LogInUser(ctx, &models.Credentials{Role: middleware.SuperAdmin, Email: "admin@test.com", Password: "adminPass"})
+		assertError(t, err, database.ErrInvalidCredentials)
+
+		assertError(t, db.CheckAdmin(ctx, adminID), nil)
+		assertError(t, db.CheckAdmin(ctx, "invalid"), database.ErrInternal)
+
+		admins, _, err := db.ShowAdmins(ctx, nil)
+		assertError(t, err, nil)
+		if len(admins) != 2 {
+			t.Fatalf("got %d admins want 2", len(admins))
+		}
+		for role, want := range map[string]int{middleware.SuperAdmin: 1, middleware.Admin: 2, "unknown": 0} {
+			count, err := db.CountUsers(ctx, role)
+			assertError(t, err, nil)
+			if count != want {
+				t.Fatalf("got %d users of role %s want %d", count, role, want)
+			}
+		}
+		err = db.WithTx(ctx, func(tx database.Database) error {
+			// locking again in the same transaction must not wait for itself
+			err := tx.LockUsers(ctx, middleware.SuperAdmin)
+			if err == nil {
+				err = tx.LockUsers(ctx, middleware.SuperAdmin)
+			}
+			return err
+		})
+		assertError(t, err, nil)
+
+		_, err = db.UpdateAdmin(ctx, &models.UserOutput{ID: otherAdminID, Email: "admin@test.com", Name: "other"})
+		if err == nil {
+			t.Fatalf("wanted an error for duplicate email")
+		}
+		updated, err := db.UpdateAdmin(ctx, &models.UserOutput{ID: otherAdminID, Email: "other1@test.com", Name: "other1"})
+		assertError(t, err, nil)
+		if updated.Name != "other1" || updated.Email != "other1@test.com" {
+			t.Fatalf("admin not updated got %v", updated)
+		}
+
+		toDelete := mustCreateUser(t, db, &models.UserReg{Role: middleware.Admin, Email: "delete@test.com", Name: "delete", Password: "pass"})
+		err = db.RemoveAdmins(ctx, toDelete, "invalid")
+		if err == nil {
+			t.Fatalf("wanted an error for invalid admin id")
+		}
+		assertError(t, db.CheckAdmin(ctx, toDelete), database.ErrInternal)
+	})
+
+	var ownerID string
+	t.Run("owners", func(t *testing.T) {
+		owner, err := db.CreateOwner(ctx, adminID, &models.OwnerReg{Email: "owner@test.com", Name: "owner", Password: "ownerPass", Verified: true})
+		assertError(t, err, nil)
+		ownerID = owner.ID
+		_, err = db.CreateOwner(ctx, otherAdminID, &models.OwnerReg{Email: "owner@test.com", Name: "dup", Password: "pass"})
+		assertError(t, err, database.ErrDupEmail)
+		otherOwner, err := db.CreateOwner(ctx, otherAdminID, &models.OwnerReg{Email: "owner2@test.com", Name: "owner2", Password: "pass"})
+		assertError(t, err, nil)
+
+		_, err = db.LogInUser(ctx, &models.Credentials{Role: middleware.Owner, Email: "owner@test.com", Password: "ownerPass"})
+		assertError(t, err, nil)
+
+		owners, _, err := db.ShowOwners(ctx, adminAuth, nil)
+		assertError(t, err, nil)
+		if len(owners) != 1 || owners[0].ID != ownerID {
+			t.Fatalf("admin should only see own owners got %v", owners)
+		}
+		owners, _, err = db.ShowOwners(ctx, superAuth, nil)
+		assertError(t, err, nil)
+		if len(owners) != 2 {
+			t.Fatalf("superAdmin should see all owners got %v", owners)
+		}
+
+		assertError(t, db.CheckOwnerCreator(ctx, adminID, ownerID), nil)
+		assertError(t, db.CheckOwnerCreator(ctx, otherAdminID, ownerID), database.ErrInvalidOwnerCreator)
+		assertError(t, db.CheckOwnerCreator(ctx, adminID, "invalid"), database.ErrInvalidOwner)
+
+		_, err = db.UpdateOwner(ctx, &models.UserOutput{ID: "invalid", Email: "x@test.com", Name: "x"})
+		assertError(t, err, database.ErrInvalidOwner)
+		_, err = db.UpdateOwner(ctx, &models.UserOutput{ID: otherOwner.ID, Email: "owner@test.com", Name: "x"})
+		assertError(t, err, database.ErrDupEmail)
+		updated, err := db.UpdateOwner(ctx, &models.UserOutput{ID: otherOwner.ID, Email: "owner3@test.com", Name: "owner3"})
+		assertError(t, err, nil)
+		if updated.ID != otherOwner.ID || updated.Name != "owner3" {
+			t.Fatalf("owner not updated got %v", updated)
+		}
+
+		if err = db.RemoveOwners(ctx, adminAuth, otherOwner.ID); err == nil {
+			t.Fatalf("admin should not delete owner created by other admin")
+		}
+		assertError(t, db.RemoveOwners(ctx, otherAdminAuth, otherOwner.ID), nil)
+		assertError(t, db.CheckOwnerCreator(ctx, otherAdminID, otherOwner.ID), database.ErrInvalidOwner)
+	})
+
+	var resID, otherResID int
+	t.Run("restaurants", func(t *testing.T) {
+		res, err := db.InsertRestaurant(ctx, &models.Restaurant{Name: "res", Lat: 28.6139, Lng: 77.2090, CreatorID: adminID})
+		assertError(t, err, nil)
+		resID = res.ID
+		otherRes, err := db.InsertRestaurant(ctx, &models.Restaurant{Name: "otherRes", Lat: 19.0760, Lng: 72.8777, CreatorID: otherAdminID})
+		assertError(t, err, nil)
+		otherResID = otherRes.ID
+		if res.Name != "res" || otherResID == resID {
+			t.Fatalf("unexpected restaurants %v %v", res, otherRes)
+		}
+
+		assertError(t, db.CheckRestaurantCreator(ctx, adminID, resID), nil)
+		assertError(t, db.CheckRestaurantCreator(ctx, otherAdminID, resID), database.ErrInvalidRestaurantCreator)
+		assertError(t, db.CheckRestaurantCreator(ctx, adminID, -1), database.ErrNonExistingRestaurant)
+
+		restaurants, _, err := db.ShowRestaurants(ctx, adminAuth, nil)
+		assertError(t, err, nil)
+		if len(restaurants) != 1 || restaurants[0].ID != resID {
+			t.Fatalf("admin should only see own restaurants got %v", restaurants)
+		}
+		restaurants, _, err = db.ShowRestaurants(ctx, superAuth, nil)
+		assertError(t, err, nil)
+		if len(restaurants) != 2 {
+			t.Fatalf("superAdmin should see all restaurants got %v", restaurants)
+		}
+
+		if err = db.InsertOwnerForRestaurants(ctx, adminAuth, ownerID, resID, otherResID); err == nil {
+			t.Fatalf("admin should not assign restaurant created by other admin")
+		}
+		assertError(t, db.InsertOwnerForRestaurants(ctx, adminAuth, "invalid", resID), database.ErrInvalidOwner)
+		assertError(t, db.CheckRestaurantOwner(ctx, ownerID, resID), nil)
+		assertError(t, db.CheckRestaurantOwner(ctx, "invalid", resID), database.ErrInvalidRestaurantOwner)
+		assertError(t, db.CheckRestaurantOwner(ctx, ownerID, otherResID), database.ErrNonExistingRestaurant)
+
+		restaurants, _, err = db.ShowRestaurants(ctx, &models.UserAuth{ID: ownerID, Role: middleware.Owner, Scope: models.ScopeOwned}, nil)
+		assertError(t, err, nil)
+		if len(restaurants) != 1 || restaurants[0].ID != resID {
+			t.Fatalf("owner should only see owned restaurants got %v", restaurants)
+		}
+		restaurants, err = db.ShowAvailableRestaurants(ctx, superAuth)
+		assertError(t, err, nil)
+		if len(restaurants) != 1 || restaurants[0].ID != otherResID {
+			t.Fatalf("only restaurants without owner should be available got %v", restaurants)
+		}
+
+		assertError(t, db.RemoveOwnerForRestaurants(ctx, adminAuth, ownerID, resID), nil)
+		assertError(t, db.CheckRestaurantOwner(ctx, ownerID, resID), database.ErrNonExistingRestaurant)
+
+		_, err = db.UpdateRestaurant(ctx, &models.RestaurantOutput{ID: -1, Name: "x"})
+		assertError(t, err, database.ErrNonExistingRestaurant)
+		updated, err := db.UpdateRestaurant(ctx, &models.RestaurantOutput{ID: resID, Name: "resUpdated", Lat: 28.6139, Lng: 77.2090})
+		assertError(t, err, nil)
+		if updated.Name != "resUpdated" {
+			t.Fatalf("restaurant not updated got %v", updated)
+		}
+
+		restaurants, err = db.ShowNearBy(ctx, &models.Location{Lat: 28.62, Lng: 77.21})
+		assertError(t, err, nil)
+		if len(restaurants) != 1 || restaurants[0].ID != resID {
+			t.Fatalf("wanted only the restaurant within range got %v", restaurants)
+		}
+	})
+
+	t.Run("menu", func(t *testing.T) {
+		_, err := db.InsertDishes(ctx, models.Dish{Name: "dish", Price: 10}, -1)
+		assertError(t, err, database.ErrNonExistingRestaurant)
+		dish, err := db.InsertDishes(ctx, models.Dish{Name: "dish", Price: 10}, resID)
+		assertError(t, err, nil)
+		otherDish, err := db.InsertDishes(ctx, models.Dish{Name: "otherDish", Price: 20}, otherResID)
+		assertError(t, err, nil)
+
+		_, _, err = db.ShowMenu(ctx, -1, nil)
+		assertError(t, err, database.ErrNonExistingRestaurant)
+		dishes, _, err := db.ShowMenu(ctx, resID, nil)
+		assertError(t, err, nil)
+		if len(dishes) != 1 || dishes[0].ID != dish.ID {
+			t.Fatalf("wanted only the dishes of the restaurant got %v", dishes)
+		}
+
+		assertError(t, db.CheckRestaurantDish(ctx, resID, dish.ID), nil)
+		assertError(t, db.CheckRestaurantDish(ctx, resID, otherDish.ID), database.ErrInvalidRestaurantDish)
+		assertError(t, db.CheckRestaurantDish(ctx, resID, -1), database.ErrInvalidDish)
+
+		updated, err := db.UpdateDish(ctx, &models.DishOutput{ID: dish.ID, Name: "dishUpdated", Price: 15})
+		assertError(t, err, nil)
+		if updated.Name != "dishUpdated" || updated.Price != 15 {
+			t.Fatalf("dish not updated got %v", updated)
+		}
+
+		if err = db.RemoveDishes(ctx, dish.ID, -1); err == nil {
+			t.Fatalf("wanted an error for invalid dish id")
+		}
+		assertError(t, db.CheckRestaurantDish(ctx, resID, dish.ID), database.ErrInvalidDish)
+
+		if err = db.RemoveRestaurants(ctx, adminAuth, otherResID); err == nil {
+			t.Fatalf("admin should not delete restaurant created by other admin")
+		}
+		assertError(t, db.RemoveRestaurants(ctx, superAuth, otherResID), nil)
+		assertError(t, db.CheckRestaurantDish(ctx, otherResID, otherDish.ID), database.ErrInvalidDish)
+	})
+
+	t.Run("lists", func(t *testing.T) {
+		var ids []int
+		for _, name := range []string{"gamma", "alpha", "beta"} {
+			res, err := db.InsertRestaurant(ctx, &models.Restaurant{Name: name, CreatorID: adminID})
+			assertError(t, err, nil)
+			ids = append(ids, res.ID)
+		}
+		assertError(t, db.InsertOwnerForRestaurants(ctx, adminAuth, ownerID, ids[0]), nil)
+
+		restaurants, total, err := db.ShowRestaurants(ctx, adminAuth, &models.ListOptions{Limit: 2, Sort: database.SortByName})
+		assertError(t, err, nil)
+		assertNames(t, total, 4, restaurantNames(restaurants), "alpha", "beta")
+		restaurants, total, err = db.ShowRestaurants(ctx, adminAuth, &models.ListOptions{Limit: 2, Offset: 2, Sort: database.SortByName})
+		assertError(t, err, nil)
+		assertNames(t, total, 4, restaurantNames(restaurants), "gamma", "resUpdated")
+		restaurants, total, err = db.ShowRestaurants(ctx, adminAuth, &models.ListOptions{Limit: 1, Sort: database.SortByIDDesc})
+		assertError(t, err, nil)
+		assertNames(t, total, 4, restaurantNames(restaurants), "beta")
+		restaurants, total, err = db.ShowRestaurants(ctx, adminAuth, &models.ListOptions{NamePrefix: "AL"})
+		assertError(t, err, nil)
+		assertNames(t, total, 1, restaurantNames(restaurants), "alpha")
+		assigned := true
+		restaurants, total, err = db.ShowRestaurants(ctx, adminAuth, &models.ListOptions{Assigned: &assigned})
+		assertError(t, err, nil)
+		assertNames(t, total, 1, restaurantNames(restaurants), "gamma")
+		assigned = false
+		restaurants, total, err = db.ShowRestaurants(ctx, adminAuth, &models.ListOptions{Assigned: &assigned, Sort: database.SortByNameDesc})
+		assertError(t, err, nil)
+		assertNames(t, total, 3, restaurantNames(restaurants), "resUpdated", "beta", "alpha")
+
+		for _, name := range []string{"soup", "bread", "salad"} {
+			_, err = db.InsertDishes(ctx, models.Dish{Name: name, Price: 1}, ids[1])
+			assertError(t, err, nil)
+		}
+		dishes, total, err := db.ShowMenu(ctx, ids[1], &models.ListOptions{Limit: 1, Sort: database.SortByIDDesc})
+		assertError(t, err, nil)
+		if total != 3 || len(dishes) != 1 || dishes[0].Name != "salad" {
+			t.Fatalf("got %v of %d dishes want salad of 3", dishes, total)
+		}
+		dishes, total, err = db.ShowMenu(ctx, ids[1], &models.ListOptions{NamePrefix: "s", Sort: database.SortByName})
+		assertError(t, err, nil)
+		if total != 2 || len(dishes) != 2 || dishes[0].Name != "salad" {
+			t.Fatalf("got %v of %d dishes want salad and soup", dishes, total)
+		}
+
+		admins, total, err := db.ShowAdmins(ctx, &models.ListOptions{Limit: 1, Sort: database.SortByNameDesc})
+		assertError(t, err, nil)
+		assertNames(t, total, 2, userNames(admins), "other1")
+		owners, total, err := db.ShowOwners(ctx, superAuth, &models.ListOptions{NamePrefix: "own"})
+		assertError(t, err, nil)
+		assertNames(t, total, 1, userNames(owners), "owner")
+	})
+
+	t.Run("revoked tokens", func(t *testing.T) {
+		now := time.Now()
+		revoked, err := db.IsTokenRevoked(ctx, "jti-1")
+		assertError(t, err, nil)
+		if revoked {
+			t.Fatalf("token should be valid before logout")
+		}
+		assertError(t, db.RevokeToken(ctx, "jti-1", now.Add(time.Hour)), nil)
+		assertError(t, db.RevokeToken(ctx, "jti-1", now.Add(time.Hour)), nil)
+		assertError(t, db.RevokeToken(ctx, "jti-2", now.Add(-time.Minute)), nil)
+		revoked, err = db.IsTokenRevoked(ctx, "jti-1")
+		assertError(t, err, nil)
+		if !revoked {
+			t.Fatalf("token should be revoked after logout")
+		}
+		purged, err := db.PurgeExpiredTokens(ctx, now)
+		assertError(t, err, nil)
+		if purged != 1 {
+			t.Errorf("got %d purged tokens want 1", purged)
+		}
+		revoked, _ = db.IsTokenRevoked(ctx, "jti-1")
+		if !revoked {
+			t.Errorf("unexpired revocation should be kept")
+		}
+	})
+
+	t.Run("refresh tokens", func(t *testing.T) {
+		now := time.Now()
+		store := func(hash, family string, expiresAt time.Time) {
+			t.Helper()
+			assertError(t, db.StoreRefreshToken(ctx, &models.RefreshToken{
+				Hash: hash, FamilyID: family, UserID: adminID, Role: middleware.Admin, ExpiresAt: expiresAt,
+			}), nil)
+		}
+		store("hash-1", "family-1", now.Add(time.Hour))
+		store("hash-2", "family-1", now.Add(time.Hour))
+		store("hash-3", "family-2", now.Add(time.Hour))
+		store("hash-4", "family-3", now.Add(-time.Minute))
+
+		token, err := db.UseRefreshToken(ctx, "hash-1", now)
+		assertError(t, err, nil)
+		if token.FamilyID != "family-1" || token.UserID != adminID || token.Role != middleware.Admin || !token.Used ||
+			token.ExpiresAt.Unix() != now.Add(time.Hour).Unix() {
+			t.Fatalf("got refresh token %+v", token)
+		}
+		_, err = db.UseRefreshToken(ctx, "unknown", now)
+		assertError(t, err, database.ErrInvalidRefreshToken)
+		_, err = db.UseRefreshToken(ctx, "hash-4", now)
+		assertError(t, err, database.ErrInvalidRefreshToken)
+
+		_, err = db.UseRefreshToken(ctx, "hash-1", now)
+		assertError(t, err, database.ErrRefreshTokenReused)
+		_, err = db.UseRefreshToken(ctx, "hash-2", now)
+		assertError(t, err, database.ErrInvalidRefreshToken)
+
+		assertError(t, db.RevokeRefreshTokens(ctx, "family-2"), nil)
+		_, err = db.UseRefreshToken(ctx, "hash-3", now)
+		assertError(t, err, database.ErrInvalidRefreshToken)
+
+		store("hash-5", "family-4", now.Add(-time.Minute))
+		purged, err := db.PurgeExpiredTokens(ctx, now)
+		assertError(t, err, nil)
+		if purged != 2 {
+			t.Errorf("got %d purged tokens want 2", purged)
+		}
+	})
+
+	t.Run("password reset", func(t *testing.T) {
+		now := time.Now()
+		userID := mustCreateUser(t, db, &models.UserReg{Role: middleware.Admin, Email: "reset@test.com", Name: "reset", Password: "oldPass", Verified: true})
+		id, err := db.FindUserID(ctx, middleware.Admin, "reset@test.com")
+		assertError(t, err, nil)
+		if id != userID {
+			t.Fatalf("got id %v want %v", id, userID)
+		}
+		_, err = db.FindUserID(ctx, middleware.Owner, "reset@test.com")
+		assertError(t, err, database.ErrUserNotFound)
+		_, err = db.FindUserID(ctx, "unknown", "reset@test.com")
+		assertError(t, err, database.ErrUserNotFound)
+
+		store := func(hash string, expiresAt time.Time) {
+			t.Helper()
+			assertError(t, db.StorePasswordResetToken(ctx, &models.PasswordResetToken{
+				Hash: hash, UserID: userID, Role: middleware.Admin, ExpiresAt: expiresAt,
+			}), nil)
+		}
+		store("reset-1", now.Add(time.Hour))
+		store("reset-2", now.Add(-time.Minute))
+		assertError(t, db.ResetPassword(ctx, "reset-1", "newPass", now), database.ErrInvalidResetToken)
+		assertError(t, db.ResetPassword(ctx, "reset-2", "newPass", now), database.ErrInvalidResetToken)
+		assertError(t, db.ResetPassword(ctx, "unknown", "newPass", now), database.ErrInvalidResetToken)
+
+		assertError(t, db.StoreRefreshToken(ctx, &models.RefreshToken{
+			Hash: "reset-refresh", FamilyID: "reset-family", UserID: userID, Role: middleware.Admin, ExpiresAt: now.Add(time.Hour),
+		}), nil)
+		store("reset-3", now.Add(time.Hour))
+		assertError(t, db.ResetPassword(ctx, "reset-3", "newPass", now), nil)
+		assertError(t, db.ResetPassword(ctx, "reset-3", "otherPass", now), database.ErrInvalidResetToken)
+		_, err = db.LogInUser(ctx, &models.Credentials{Role: middleware.Admin, Email: "reset@test.com", Password: "oldPass"})
+		assertError(t, err, database.ErrInvalidCredentials)
+		_, err = db.LogInUser(ctx, &models.Credentials{Role: middleware.Admin, Email: "reset@test.com", Password: "newPass"})
+		assertError(t, err, nil)
+		_, err = db.UseRefreshToken(ctx, "reset-refresh", now)
+		assertError(t, err, database.ErrInvalidRefreshToken)
+
+		store("reset-4", now.Add(-time.Minute))
+		purged, err := db.PurgeExpiredTokens(ctx, now)
+		assertError(t, err, nil)
+		if purged != 1 {
+			t.Errorf("got %d purged tokens want 1", purged)
+		}
+		assertError(t, db.RemoveAdmins(ctx, userID), nil)
+	})
+
+	t.Run("password rehash", func(t *testing.T) {
+		defer db.SetPasswordHasher(encryption.DefaultPasswordHasher())
+		db.SetPasswordHasher(encryption.NewBcryptHasher(4))
+		userID := mustCreateUser(t, db, &models.UserReg{Role: middleware.Admin, Email: "rehash@test.com", Name: "rehash", Password: "rehashPass", Verified: true})
+		hasher := &CountingHasher{PasswordHasher: encryption.NewArgon2idHasher(1024, 1, 1)}
+		db.SetPasswordHasher(hasher)
+
+		_, err := db.LogInUser(ctx, &models.Credentials{Role: middleware.Admin, Email: "rehash@test.com", Password: "wrong"})
+		assertError(t, err, database.ErrInvalidCredentials)
+		if hasher.Hashes != 0 {
+			t.Fatalf("got %d rehashes after a failed login want 0", hasher.Hashes)
+		}
+		for i := 0; i < 2; i++ {
+			id, err := db.LogInUser(ctx, &models.Credentials{Role: middleware.Admin, Email: "rehash@test.com", Password: "rehashPass"})
+			assertError(t, err, nil)
+			if id != userID {
+				t.Fatalf("got id %v want %v", id, userID)
+			}
+		}
+		// the first login replaced the bcrypt hash and the second one found it current
+		if hasher.Hashes != 1 {
+			t.Fatalf("got %d rehashes want 1", hasher.Hashes)
+		}
+		assertError(t, db.RemoveAdmins(ctx, userID), nil)
+	})
+
+	t.Run("long password hash", func(t *testing.T) {
+		defer db.SetPasswordHasher(encryption.DefaultPasswordHasher())
+		db.SetPasswordHasher(paddedHasher{encryption.NewBcryptHasher(4)})
+		userID := mustCreateUser(t, db, &models.UserReg{Role: middleware.Admin, Email: "long@test.com", Name: "long", Password: "longPass", Verified: true})
+		id, err := db.LogInUser(ctx, &models.Credentials{Role: middleware.Admin, Email: "long@test.com", Password: "longPass"})
+		assertError(t, err, nil)
+		if id != userID {
+			t.Fatalf("got id %v want %v", id, userID)
+		}
+		assertError(t, db.RemoveAdmins(ctx, userID), nil)
+	})
+
+	t.Run("email verification", func(t *testing.T) {
+		now := time.Now()
+		pendingID := mustCreateUser(t, db, &models.UserReg{Role: middleware.Admin, Email: "pending@test.com", Name: "pending", Password: "pendingPass"})
+		_, err := db.LogInUser(ctx, &models.Credentials{Role: middleware.Admin, Email: "pending@test.com", Password: "wrong"})
+		assertError(t, err, database.ErrInvalidCredentials)
+		_, err = db.LogInUser(ctx, &models.Credentials{Role: middleware.Admin, Email: "pending@test.com", Password: "pendingPass"})
+		assertError(t, err, database.ErrUnverifiedEmail)
+
+		store := func(hash, userID, role string, expiresAt time.Time) error {
+			return db.StoreVerificationToken(ctx, &models.VerificationToken{Hash: hash, UserID: userID, Role: role, ExpiresAt: expiresAt})
+		}
+		assertError(t, store("verify-1", adminID, middleware.Admin, now.Add(time.Hour)), database.ErrAlreadyVerified)
+		assertError(t, store("verify-1", "invalid", middleware.Admin, now.Add(time.Hour)), database.ErrUserNotFound)
+		assertError(t, store("verify-1", pendingID, middleware.Owner, now.Add(time.Hour)), database.ErrUserNotFound)
+		assertError(t, store("verify-1", pendingID, middleware.Admin, now.Add(time.Hour)), nil)
+		assertError(t, store("verify-2", pendingID, middleware.Admin, now.Add(-time.Minute)), nil)
+		assertError(t, db.VerifyEmail(ctx, "verify-1", now), database.ErrInvalidVerificationToken)
+		assertError(t, db.VerifyEmail(ctx, "verify-2", now), database.ErrInvalidVerificationToken)
+		assertError(t, store("verify-3", pendingID, middleware.Admin, now.Add(time.Hour)), nil)
+		assertError(t, db.VerifyEmail(ctx, "verify-3", now), nil)
+		assertError(t, db.VerifyEmail(ctx, "verify-3", now), database.ErrInvalidVerificationToken)
+		id, err := db.LogInUser(ctx, &models.Credentials{Role: middleware.Admin, Email: "pending@test.com", Password: "pendingPass"})
+		assertError(t, err, nil)
+		if id != pendingID {
+			t.Fatalf("got id %v want %v", id, pendingID)
+		}
+		assertError(t, store("verify-4", pendingID, middleware.Admin, now.Add(time.Hour)), database.ErrAlreadyVerified)
+
+		owner, err := db.CreateOwner(ctx, adminID, &models.OwnerReg{Email: "verified-owner@test.com", Name: "verified", Password: "pass", Verified: true})
+		assertError(t, err, nil)
+		_, err = db.LogInUser(ctx, &models.Credentials{Role: middleware.Owner, Email: "verified-owner@test.com", Password: "pass"})
+		assertError(t, err, nil)
+		assertError(t, db.RemoveOwners(ctx, superAuth, owner.ID), nil)
+		assertError(t, db.RemoveAdmins(ctx, pendingID), nil)
+	})
+
+	t.Run("two-factor", func(t *testing.T) {
+		user, err := db.GetUser(ctx, adminID, middleware.Admin)
+		assertError(t, err, nil)
+		if user.ID != adminID || user.Email != "admin@test.com" {
+			t.Fatalf("got user %v want admin@test.com", user)
+		}
+		_, err = db.GetUser(ctx, adminID, middleware.Owner)
+		assertError(t, err, database.ErrUserNotFound)
+
+		tf, err := db.GetTwoFactor(ctx, adminID, middleware.Admin)
+		assertError(t, err, nil)
+		if tf.Enabled || tf.Secret != "" {
+			t.Fatalf("got enrolment %v want none", tf)
+		}
+		assertError(t, db.EnableTwoFactor(ctx, adminID, middleware.Admin, 10, nil), database.ErrTwoFactorNotPending)
+		assertError(t, db.StoreTwoFactorSecret(ctx, adminID, middleware.Admin, "FIRSTSECRET"), nil)
+		assertError(t, db.StoreTwoFactorSecret(ctx, adminID, middleware.Admin, "SECRET"), nil)
+		assertError(t, db.UseTwoFactorStep(ctx, adminID, middleware.Admin, 10), database.ErrTwoFactorCodeUsed)
+		assertError(t, db.EnableTwoFactor(ctx, adminID, middleware.Admin, 10, []string{"code-1", "code-2"}), nil)
+		assertError(t, db.EnableTwoFactor(ctx, adminID, middleware.Admin, 11, nil), database.ErrTwoFactorNotPending)
+		assertError(t, db.StoreTwoFactorSecret(ctx, adminID, middleware.Admin, "OTHER"), database.ErrTwoFactorEnabled)
+		tf, err = db.GetTwoFactor(ctx, adminID, middleware.Admin)
+		assertError(t, err, nil)
+		if !tf.Enabled || tf.Secret != "SECRET" || tf.LastStep != 10 {
+			t.Fatalf("got enrolment %v want enabled SECRET at step 10", tf)
+		}
+
+		assertError(t, db.UseTwoFactorStep(ctx, adminID, middleware.Admin, 10), database.ErrTwoFactorCodeUsed)
+		assertError(t, db.UseTwoFactorStep(ctx, adminID, middleware.Admin, 12), nil)
+		assertError(t, db.UseTwoFactorStep(ctx, adminID, middleware.Admin, 11), database.ErrTwoFactorCodeUsed)
+
+		assertError(t, db.UseRecoveryCode(ctx, superAdminID, middleware.SuperAdmin, "code-1"), database.ErrInvalidRecoveryCode)
+		assertError(t, db.UseRecoveryCode(ctx, adminID, middleware.Admin, "code-1"), nil)
+		assertError(t, db.UseRecoveryCode(ctx, adminID, middleware.Admin, "code-1"), database.ErrInvalidRecoveryCode)
+		assertError(t, db.ReplaceRecoveryCodes(ctx, adminID, middleware.Admin, []string{"code-3"}), nil)
+		assertError(t, db.UseRecoveryCode(ctx, adminID, middleware.Admin, "code-2"), database.ErrInvalidRecoveryCode)
+		assertError(t, db.UseRecoveryCode(ctx, adminID, middleware.Admin, "code-3"), nil)
+
+		assertError(t, db.DisableTwoFactor(ctx, adminID, middleware.Admin), nil)
+		tf, err = db.GetTwoFactor(ctx, adminID, middleware.Admin)
+		assertError(t, err, nil)
+		if tf.Enabled || tf.Secret != "" {
+			t.Fatalf("got enrolment %v want none after disabling", tf)
+		}
+
+		required, err := db.IsTwoFactorRequired(ctx)
+		assertError(t, err, nil)
+		if required {
+			t.Fatalf("two-factor should not be required by default")
+		}
+		assertError(t, db.SetTwoFactorRequired(ctx, true), nil)
+		assertError(t, db.SetTwoFactorRequired(ctx, true), nil)
+		required, err = db.IsTwoFactorRequired(ctx)
+		assertError(t, err, nil)
+		if !required {
+			t.Fatalf("two-factor should be required")
+		}
+		assertError(t, db.SetTwoFactorRequired(ctx, false), nil)
+	})
+
+	t.Run("login failures", func(t *testing.T) {
+		// the sql backends keep seconds
+		now := time.Unix(time.Now().Unix(), 0)
+		for i := 1; i <= 3; i++ {
+			failures, err := db.RecordLoginFailure(ctx, "account-1", now, now.Add(time.Hour))
+			assertError(t, err, nil)
+			if failures != i {
+				t.Fatalf("got %d failures want %d", failures, i)
+			}
+		}
+		lockedUntil, err := db.GetLoginLock(ctx, now, "account-1", "ip-1")
+		assertError(t, err, nil)
+		if !lockedUntil.IsZero() {
+			t.Fatalf("got lock until %v want none", lockedUntil)
+		}
+		assertError(t, db.LockLogin(ctx, "account-1", now.Add(time.Minute)), nil)
+		_, err = db.RecordLoginFailure(ctx, "ip-1", now, now.Add(time.Hour))
+		assertError(t, err, nil)
+		assertError(t, db.LockLogin(ctx, "ip-1", now.Add(2*time.Hour)), nil)
+		lockedUntil, err = db.GetLoginLock(ctx, now, "account-1", "ip-1")
+		assertError(t, err, nil)
+		if !lockedUntil.Equal(now.Add(2 * time.Hour)) {
+			t.Fatalf("got lock until %v want the latest lock %v", lockedUntil, now.Add(2*time.Hour))
+		}
+		lockedUntil, err = db.GetLoginLock(ctx, now.Add(time.Minute), "account-1")
+		assertError(t, err, nil)
+		if !lockedUntil.IsZero() {
+			t.Fatalf("got lock until %v want the lock to have ended", lockedUntil)
+		}
+
+		// an expired record starts counting again
+		failures, err := db.RecordLoginFailure(ctx, "account-1", now.Add(2*time.Hour), now.Add(3*time.Hour))
+		assertError(t, err, nil)
+		if failures != 1 {
+			t.Fatalf("got %d failures want a new count", failures)
+		}
+		assertError(t, db.ClearLoginFailures(ctx, "account-1", "unknown"), nil)
+		failures, err = db.RecordLoginFailure(ctx, "account-1", now, now.Add(-time.Second))
+		assertError(t, err, nil)
+		if failures != 1 {
+			t.Fatalf("got %d failures after clearing want 1", failures)
+		}
+
+		purged, err := db.PurgeExpiredTokens(ctx, now)
+		assertError(t, err, nil)
+		if purged != 1 {
+			t.Errorf("got %d purged records want 1", purged)
+		}
+		lockedUntil, err = db.GetLoginLock(ctx, now, "ip-1")
+		assertError(t, err, nil)
+		if lockedUntil.IsZero() {
+			t.Fatalf("locked ip should be kept by the purge")
+		}
+		assertError(t, db.ClearLoginFailures(ctx, "ip-1"), nil)
+	})
+
+	t.Run("api keys", func(t *testing.T) {
+		// the sql backends keep seconds
+		now := time.Unix(time.Now().Unix(), 0)
+		owner, err := db.CreateOwner(ctx, adminID, &models.OwnerReg{Email: "keys@test.com", Name: "keys", Password: "ownerPass"})
+		assertError(t, err, nil)
+		ownerID := owner.ID
+		for _, key := range []*models.APIKey{
+			{ID: "key-2", Name: "deploy", Hash: "hash-2", Prefix: "rk_2", UserID: adminID, Role: middleware.Admin, Permissions: []string{"menu:read", "menu:update"}, CreatedAt: now.Add(time.Minute)},
+			{ID: "key-1", Name: "ci", Hash: "hash-1", Prefix: "rk_1", UserID: adminID, Role: middleware.Admin, Permissions: []string{}, CreatedAt: now},
+			{ID: "key-3", Name: "pos", Hash: "hash-3", Prefix: "rk_3", UserID: ownerID, Role: middleware.Owner, Permissions: []string{"menu:read"}, CreatedAt: now},
+		} {
+			assertError(t, db.CreateAPIKey(ctx, key), nil)
+		}
+		keys, err := db.ShowAPIKeys(ctx, adminID, middleware.Admin)
+		assertError(t, err, nil)
+		if len(keys) != 2 || keys[0].ID != "key-1" || keys[1].ID != "key-2" || keys[1].LastUsedAt != nil {
+			t.Fatalf("got keys %v want key-1 and key-2 never used", keys)
+		}
+		if len(keys[0].Permissions) != 0 || len(keys[1].Permissions) != 2 || keys[1].Permissions[1] != "menu:update" {
+			t.Fatalf("got permissions %v and %v want none and menu:read,menu:update", keys[0].Permissions, keys[1].Permissions)
+		}
+
+		key, err := db.UseAPIKey(ctx, "hash-2", now.Add(time.Hour))
+		assertError(t, err, nil)
+		if key.ID != "key-2" || key.UserID != adminID || key.Role != middleware.Admin || len(key.Permissions) != 2 {
+			t.Fatalf("got key %v want key-2 of the admin", key)
+		}
+		keys, err = db.ShowAPIKeys(ctx, adminID, middleware.Admin)
+		assertError(t, err, nil)
+		if keys[1].LastUsedAt == nil || !keys[1].LastUsedAt.Equal(now.Add(time.Hour)) {
+			t.Fatalf("got last use %v want %v", keys[1].LastUsedAt, now.Add(time.Hour))
+		}
+		_, err = db.UseAPIKey(ctx, "unknown", now)
+		assertError(t, err, database.ErrInvalidAPIKey)
+
+		assertError(t, db.RevokeAPIKey(ctx, ownerID, middleware.Owner, "key-1"), database.ErrAPIKeyNotFound)
+		assertError(t, db.RevokeAPIKey(ctx, adminID, middleware.Admin, "key-1"), nil)
+		assertError(t, db.RevokeAPIKey(ctx, adminID, middleware.Admin, "key-1"), database.ErrAPIKeyNotFound)
+		_, err = db.UseAPIKey(ctx, "hash-1", now)
+		assertError(t, err, database.ErrInvalidAPIKey)
+
+		// keys stop working with their user
+		_, err = db.UseAPIKey(ctx, "hash-3", now)
+		assertError(t, err, nil)
+		assertError(t, db.RemoveOwners(ctx, superAuth, ownerID), nil)
+		_, err = db.UseAPIKey(ctx, "hash-3", now)
+		assertError(t, err, database.ErrInvalidAPIKey)
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		now := time.Now()
+		create := func(id, userID string, lastSeenAt, expiresAt time.Time) {
+			t.Helper()
+			assertError(t, db.CreateSession(ctx, &models.Session{
+				ID: id, UserID: userID, Role: middleware.Admin, Device: "curl/7.68.0", IP: "192.0.2.1",
+				IssuedAt: now.Add(-time.Hour), LastSeenAt: lastSeenAt, ExpiresAt: expiresAt,
+			}), nil)
+			assertError(t, db.StoreRefreshToken(ctx, &models.RefreshToken{
+				Hash: "refresh-" + id, FamilyID: id, UserID: userID, Role: middleware.Admin, ExpiresAt: now.Add(time.Hour),
+			}), nil)
+		}
+		sessionIDs := func(userID string, want ...string) []models.Session {
+			t.Helper()
+			sessions, err := db.ShowSessions(ctx, userID, middleware.Admin, now)
+			assertError(t, err, nil)
+			got := []string{}
+			for _, session := range sessions {
+				got = append(got, session.ID)
+			}
+			assertNames(t, len(got), len(want), got, want...)
+			return sessions
+		}
+		create("session-1", adminID, now.Add(-2*time.Minute), now.Add(time.Hour))
+		create("session-2", adminID, now.Add(-time.Minute), now.Add(time.Hour))
+		create("session-3", adminID, now.Add(-time.Minute), now.Add(-time.Minute))
+		create("session-4", otherAdminID, now, now.Add(time.Hour))
+		sessions := sessionIDs(adminID, "session-2", "session-1")
+		if sessions[0].Device != "curl/7.68.0" || sessions[0].IP != "192.0.2.1" || sessions[0].IssuedAt.Unix() != now.Add(-time.Hour).Unix() {
+			t.Fatalf("got session %+v", sessions[0])
+		}
+
+		assertError(t, db.TouchSession(ctx, "session-1", now, now.Add(2*time.Hour)), nil)
+		sessions = sessionIDs(adminID, "session-1", "session-2")
+		if sessions[0].LastSeenAt.Unix() != now.Unix() || sessions[0].ExpiresAt.Unix() != now.Add(2*time.Hour).Unix() {
+			t.Fatalf("got touched session %+v", sessions[0])
+		}
+		assertError(t, db.TouchSession(ctx, "session-3", now, now), database.ErrSessionNotFound)
+		assertError(t, db.TouchSession(ctx, "unknown", now, now), database.ErrSessionNotFound)
+
+		assertError(t, db.RevokeSession(ctx, otherAdminID, middleware.Admin, "session-1"), database.ErrSessionNotFound)
+		assertError(t, db.RevokeSession(ctx, adminID, middleware.Admin, "session-1"), nil)
+		assertError(t, db.TouchSession(ctx, "session-1", now, now), database.ErrSessionNotFound)
+		_, err := db.UseRefreshToken(ctx, "refresh-session-1", now)
+		assertError(t, err, database.ErrInvalidRefreshToken)
+
+		create("session-5", adminID, now, now.Add(time.Hour))
+		revoked, err := db.RevokeSessions(ctx, adminID, middleware.Admin, "session-5")
+		assertError(t, err, nil)
+		if revoked != 2 {
+			t.Errorf("got %d revoked sessions want 2", revoked)
+		}
+		_, err = db.UseRefreshToken(ctx, "refresh-session-2", now)
+		assertError(t, err, database.ErrInvalidRefreshToken)
+		sessionIDs(adminID, "session-5")
+		sessionIDs(otherAdminID, "session-4")
+
+		assertError(t, db.RevokeRefreshTokens(ctx, "session-5"), nil)
+		assertError(t, db.TouchSession(ctx, "session-5", now, now), database.ErrSessionNotFound)
+		_, err = db.RevokeSessions(ctx, otherAdminID, middleware.Admin, "")
+		assertError(t, err, nil)
+		sessionIDs(otherAdminID)
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		now := time.Now()
+		updated, err := db.UpdateProfile(ctx, &models.UserOutput{ID: superAdminID, Role: middleware.SuperAdmin, Email: "super1@test.com", Name: "super1"})
+		assertError(t, err, nil)
+		if updated.ID != superAdminID || updated.Role != middleware.SuperAdmin || updated.Email != "super1@test.com" || updated.Name != "super1" {
+			t.Fatalf("profile not updated got %v", updated)
+		}
+		_, err = db.UpdateProfile(ctx, &models.UserOutput{ID: superAdminID, Role: middleware.Admin, Email: "super2@test.com", Name: "super2"})
+		assertError(t, err, database.ErrUserNotFound)
+		_, err = db.UpdateProfile(ctx, &models.UserOutput{ID: adminID, Role: middleware.Admin, Email: "other1@test.com", Name: "admin"})
+		assertError(t, err, database.ErrDupEmail)
+		// emails are unique within a role
+		_, err = db.UpdateProfile(ctx, &models.UserOutput{ID: superAdminID, Role: middleware.SuperAdmin, Email: "admin@test.com", Name: "super1"})
+		assertError(t, err, nil)
+		_, err = db.UpdateProfile(ctx, &models.UserOutput{ID: superAdminID, Role: middleware.SuperAdmin, Email: "super@test.com", Name: "super"})
+		assertError(t, err, nil)
+
+		// a new email has to be verified again, keeping it does not
+		reverifyID := mustCreateUser(t, db, &models.UserReg{Role: middleware.Admin, Email: "reverify@test.com", Name: "reverify", Password: "reverifyPass", Verified: true})
+		_, err = db.UpdateProfile(ctx, &models.UserOutput{ID: reverifyID, Role: middleware.Admin, Email: "reverify@test.com", Name: "renamed"})
+		assertError(t, err, nil)
+		_, err = db.LogInUser(ctx, &models.Credentials{Role: middleware.Admin, Email: "reverify@test.com", Password: "reverifyPass"})
+		assertError(t, err, nil)
+		_, err = db.UpdateProfile(ctx, &models.UserOutput{ID: reverifyID, Role: middleware.Admin, Email: "reverified@test.com", Name: "renamed"})
+		assertError(t, err, nil)
+		_, err = db.LogInUser(ctx, &models.Credentials{Role: middleware.Admin, Email: "reverified@test.com", Password: "reverifyPass"})
+		assertError(t, err, database.ErrUnverifiedEmail)
+		assertError(t, db.RemoveAdmins(ctx, reverifyID), nil)
+
+		userID := mustCreateUser(t, db, &models.UserReg{Role: middleware.Admin, Email: "change@test.com", Name: "change", Password: "oldPass", Verified: true})
+		for _, id := range []string{"change-1", "change-2"} {
+			assertError(t, db.CreateSession(ctx, &models.Session{
+				ID: id, UserID: userID, Role: middleware.Admin, IssuedAt: now, LastSeenAt: now, ExpiresAt: now.Add(time.Hour),
+			}), nil)
+			assertError(t, db.StoreRefreshToken(ctx, &models.RefreshToken{
+				Hash: "refresh-" + id, FamilyID: id, UserID: userID, Role: middleware.Admin, ExpiresAt: now.Add(time.Hour),
+			}), nil)
+		}
+		assertError(t, db.StorePasswordResetToken(ctx, &models.PasswordResetToken{
+			Hash: "change-reset", UserID: userID, Role: middleware.Admin, ExpiresAt: now.Add(time.Hour),
+		}), nil)
+		_, err = db.ChangePassword(ctx, userID, middleware.Admin, "wrong", "newPass", "change-1")
+		assertError(t, err, database.ErrInvalidCredentials)
+		_, err = db.ChangePassword(ctx, userID, middleware.Owner, "oldPass", "newPass", "change-1")
+		assertError(t, err, database.ErrUserNotFound)
+		revoked, err := db.ChangePassword(ctx, userID, middleware.Admin, "oldPass", "newPass", "change-1")
+		assertError(t, err, nil)
+		if revoked != 1 {
+			t.Errorf("got %d revoked sessions want 1", revoked)
+		}
+		_, err = db.LogInUser(ctx, &models.Credentials{Role: middleware.Admin, Email: "change@test.com", Password: "oldPass"})
+		assertError(t, err, database.ErrInvalidCredentials)
+		_, err = db.LogInUser(ctx, &models.Credentials{Role: middleware.Admin, Email: "change@test.com", Password: "newPass"})
+		assertError(t, err, nil)
+		assertError(t, db.TouchSession(ctx, "change-1", now, now), nil)
+		assertError(t, db.TouchSession(ctx, "change-2", now, now), database.ErrSessionNotFound)
+		_, err = db.UseRefreshToken(ctx, "refresh-change-2", now)
+		assertError(t, err, database.ErrInvalidRefreshToken)
+		_, err = db.UseRefreshToken(ctx, "refresh-change-1", now)
+		assertError(t, err, nil)
+		assertError(t, db.ResetPassword(ctx, "change-reset", "resetPass", now), database.ErrInvalidResetToken)
+		assertError(t, db.RemoveAdmins(ctx, userID), nil)
+	})
+
+	t.Run("account status", func(t *testing.T) {
+		now := time.Now()
+		userID := mustCreateUser(t, db, &models.UserReg{Role: middleware.Admin, Email: "status@test.com", Name: "status", Password: "statusPass", Verified: true})
+		login := func(password string, want error) {
+			t.Helper()
+			_, err := db.LogInUser(ctx, &models.Credentials{Role: middleware.Admin, Email: "status@test.com", Password: password})
+			assertError(t, err, want)
+		}
+		listed := func(status string, want bool) {
+			t.Helper()
+			admins, _, err := db.ShowAdmins(ctx, &models.ListOptions{Status: status})
+			assertError(t, err, nil)
+			for _, admin := range admins {
+				if admin.ID == userID {
+					if !want {
+						t.Fatalf("admin listed with status %q", status)
+					}
+					return
+				}
+			}
+			if want {
+				t.Fatalf("admin not listed with status %q", status)
+			}
+		}
+		assertStatus := func(want string) {
+			t.Helper()
+			status, err := db.GetUserStatus(ctx, userID, middleware.Admin)
+			assertError(t, err, nil)
+			if status != want {
+				t.Fatalf("got status %q want %q", status, want)
+			}
+		}
+		assertError(t, db.CreateSession(ctx, &models.Session{
+			ID: "status-1", UserID: userID, Role: middleware.Admin, IssuedAt: now, LastSeenAt: now, ExpiresAt: now.Add(time.Hour),
+		}), nil)
+		assertError(t, db.StoreRefreshToken(ctx, &models.RefreshToken{
+			Hash: "refresh-status-1", FamilyID: "status-1", UserID: userID, Role: middleware.Admin, ExpiresAt: now.Add(time.Hour),
+		}), nil)
+		assertError(t, db.CreateAPIKey(ctx, &models.APIKey{
+			ID: "status-key", Name: "status", Hash: "hash-status", Prefix: "rk_s", UserID: userID, Role: middleware.Admin, Permissions: []string{}, CreatedAt: now,
+		}), nil)
+		assertStatus(models.StatusActive)
+		_, err := db.GetUserStatus(ctx, userID, middleware.Owner)
+		assertError(t, err, database.ErrUserNotFound)
+
+		// suspended users keep their account but can not use it
+		assertError(t, db.SuspendUser(ctx, userID), nil)
+		assertError(t, db.SuspendUser(ctx, "unknown"), database.ErrUserNotFound)
+		assertStatus(models.StatusSuspended)
+		login("wrong", database.ErrInvalidCredentials)
+		login("statusPass", database.ErrAccountSuspended)
+		assertError(t, db.TouchSession(ctx, "status-1", now, now), database.ErrSessionNotFound)
+		_, err = db.UseRefreshToken(ctx, "refresh-status-1", now)
+		assertError(t, err, database.ErrInvalidRefreshToken)
+		_, err = db.UseAPIKey(ctx, "hash-status", now)
+		assertError(t, err, database.ErrInvalidAPIKey)
+		assertError(t, db.CheckAdmin(ctx, userID), nil)
+		listed("", true)
+		listed(models.StatusSuspended, true)
+		listed(models.StatusActive, false)
+
+		reactivated, err := db.ReactivateUser(ctx, userID)
+		assertError(t, err, nil)
+		if reactivated.ID != userID || reactivated.Email != "status@test.com" || reactivated.Status != models.StatusActive {
+			t.Fatalf("got reactivated user %v", reactivated)
+		}
+		_, err = db.ReactivateUser(ctx, "unknown")
+		assertError(t, err, database.ErrUserNotFound)
+		login("statusPass", nil)
+		_, err = db.UseAPIKey(ctx, "hash-status", now)
+		assertError(t, err, nil)
+
+		// deleted users free their email at once, their account can not take it back while it is used
+		created, err := db.CreateOwner(ctx, userID, &models.OwnerReg{Email: "status-owner@test.com", Name: "status", Password: "ownerPass"})
+		assertError(t, err, nil)
+		restaurant, err := db.InsertRestaurant(ctx, &models.Restaurant{Name: "status", CreatorID: userID})
+		assertError(t, err, nil)
+		assertError(t, db.RemoveAdmins(ctx, userID), nil)
+		if err = db.RemoveAdmins(ctx, userID); err == nil {
+			t.Fatalf("wanted an error for deleted admin")
+		}
+		assertStatus(models.StatusDeleted)
+		login("statusPass", database.ErrInvalidCredentials)
+		assertError(t, db.CheckAdmin(ctx, userID), database.ErrInternal)
+		assertError(t, db.SuspendUser(ctx, userID), database.ErrUserNotFound)
+		_, err = db.GetUser(ctx, userID, middleware.Admin)
+		assertError(t, err, database.ErrUserNotFound)
+		_, err = db.FindUserID(ctx, middleware.Admin, "status@test.com")
+		assertError(t, err, database.ErrUserNotFound)
+		newID := mustCreateUser(t, db, &models.UserReg{Role: middleware.Admin, Email: "status@test.com", Name: "status", Password: "statusPass"})
+		_, err = db.ReactivateUser(ctx, userID)
+		assertError(t, err, database.ErrDupEmail)
+		assertStatus(models.StatusDeleted)
+		assertError(t, db.RemoveAdmins(ctx, newID), nil)
+		listed("", false)
+		listed(models.StatusDeleted, true)
+
+		// the purge removes what is left of the account
+		assertError(t, db.CreateSession(ctx, &models.Session{
+			ID: "status-2", UserID: userID, Role: middleware.Admin, IssuedAt: now, LastSeenAt: now, ExpiresAt: now.Add(time.Hour),
+		}), nil)
+		assertError(t, db.StoreRefreshToken(ctx, &models.RefreshToken{
+			Hash: "refresh-status-2", FamilyID: "status-2", UserID: userID, Role: middleware.Admin, ExpiresAt: now.Add(time.Hour),
+		}), nil)
+		lockKey := database.TwoFactorLockKey(middleware.Admin, userID)
+		_, err = db.RecordLoginFailure(ctx, lockKey, now, now.Add(time.Hour))
+		assertError(t, err, nil)
+		assertError(t, db.LockLogin(ctx, lockKey, now.Add(time.Hour)), nil)
+
+		purged, err := db.PurgeDeletedUsers(ctx, now.Add(-time.Hour))
+		assertError(t, err, nil)
+		if purged != 0 {
+			t.Fatalf("got %d purged users want none deleted an hour ago", purged)
+		}
+		assertStatus(models.StatusDeleted)
+		purged, err = db.PurgeDeletedUsers(ctx, time.Now().Add(time.Minute))
+		assertError(t, err, nil)
+		if purged == 0 {
+			t.Fatalf("got no purged users")
+		}
+		_, err = db.GetUserStatus(ctx, userID, middleware.Admin)
+		assertError(t, err, database.ErrUserNotFound)
+		_, err = db.ReactivateUser(ctx, userID)
+		assertError(t, err, database.ErrUserNotFound)
+		assertError(t, db.TouchSession(ctx, "status-2", now, now), database.ErrSessionNotFound)
+		_, err = db.UseRefreshToken(ctx, "refresh-status-2", now)
+		assertError(t, err, database.ErrInvalidRefreshToken)
+		until, err := db.GetLoginLock(ctx, now, lockKey)
+		assertError(t, err, nil)
+		if !until.IsZero() {
+			t.Fatalf("got second factor lock until %v of a purged user", until)
+		}
+		assertError(t, db.CheckOwnerCreator(ctx, userID, created.ID), database.ErrInvalidOwnerCreator)
+		assertError(t, db.RemoveOwners(ctx, superAuth, created.ID), nil)
+		assertError(t, db.RemoveRestaurants(ctx, superAuth, restaurant.ID), nil)
+		mustCreateUser(t, db, &models.UserReg{Role: middleware.Admin, Email: "status@test.com", Name: "status", Password: "statusPass"})
+	})
+
+	t.Run("transactions", func(t *testing.T) {
+		_, before, err := db.ShowRestaurants(ctx, superAuth, nil)
+		assertError(t, err, nil)
+		errAbort := errors.New("abort")
+		err = db.WithTx(ctx, func(tx database.Database) error {
+			_, err := tx.InsertRestaurant(ctx, &models.Restaurant{Name: "discarded", CreatorID: adminID})
+			assertError(t, err, nil)
+			_, inside, err := tx.ShowRestaurants(ctx, superAuth, nil)
+			assertError(t, err, nil)
+			if inside != before+1 {
+				t.Fatalf("transaction should see its own writes, got %d restaurants want %d", inside, before+1)
+			}
+			return errAbort
+		})
+		assertError(t, err, errAbort)
+		_, after, err := db.ShowRestaurants(ctx, superAuth, nil)
+		assertError(t, err, nil)
+		if after != before {
+			t.Fatalf("rolled back insert is visible, got %d restaurants want %d", after, before)
+		}
+
+		var committed *models.RestaurantOutput
+		err = db.WithTx(ctx, func(tx database.Database) error {
+			committed, err = tx.InsertRestaurant(ctx, &models.Restaurant{Name: "committed", CreatorID: adminID})
+			if err != nil {
+				return err
+			}
+			return tx.InsertOwnerForRestaurants(ctx, adminAuth, ownerID, committed.ID)
+		})
+		assertError(t, err, nil)
+		restaurants, _, err := db.ShowRestaurants(ctx, &models.UserAuth{ID: ownerID, Role: middleware.Owner, Scope: models.ScopeOwned}, nil)
+		assertError(t, err, nil)
+		if len(restaurants) == 0 || restaurants[len(restaurants)-1].ID != committed.ID {
+			t.Fatalf("committed restaurant should be owned by owner, got %v", restaurants)
+		}
+		assertError(t, db.RemoveRestaurants(ctx, superAuth, committed.ID), nil)
+	})
+
+	t.Run("migrations", func(t *testing.T) {
+		status, err := db.MigrationStatus(ctx)
+		assertError(t, err, nil)
+		if !status.Complete() {
+			t.Fatalf("migrations should be complete, got %+v", status)
+		}
+	})
+}
+
+// CountingHasher counts the passwords hashed by the hasher it wraps
+type CountingHasher struct {
+	encryption.PasswordHasher
+	Hashes int
+}
+
+func (h *CountingHasher) Hash(password string) (string, error) {
+	h.Hashes++
+	return h.PasswordHasher.Hash(password)
+}
+
+// paddedHasher makes hashes longer than 100 characters, like argon2id does with large parameters
+type paddedHasher struct {
+	encryption.PasswordHasher
+}
+
+func (h paddedHasher) Hash(password string) (string, error) {
+	hash, err := h.PasswordHasher.Hash(password)
+	return strings.Repeat("#", 150) + hash, err
+}
+
+func (h paddedHasher) Verify(hash string, password string) (bool, error) {
+	return h.PasswordHasher.Verify(strings.TrimLeft(hash, "#"), password)
+}
+
+func (h paddedHasher) NeedsRehash(hash string) bool {
+	return false
+}
+
+func mustCreateUser(t *testing.T, db database.Database, user *models.UserReg) string {
+	t.Helper()
+	id, err := db.CreateUser(Context(), user)
+	if err != nil {
+		t.Fatalf("can not create user %v: %v", user.Email, err)
+	}
+	return id
+}
+
+func assertError(t *testing.T, got error, want error) {
+	t.Helper()
+	if got != want {
+		t.Fatalf("got error %v want %v", got, want)
+	}
+}
+
+func assertNames(t *testing.T, gotTotal int, wantTotal int, got []string, want ...string) {
+	t.Helper()
+	if gotTotal != wantTotal {
+		t.Fatalf("got total %d want %d", gotTotal, wantTotal)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %v want %v", got, want)
+		}
+	}
+}
+
+func restaurantNames(restaurants []models.RestaurantOutput) []string {
+	var names []string
+	for _, res := range restaurants {
+		names = append(names, res.Name)
+	}
+	return names
+}
+
+func userNames(users []models.UserOutput) []string {
+	var names []string
+	for _, user := range users {
+		names = append(names, user.Name)
+	}
+	return names
+}
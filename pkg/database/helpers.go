@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/models"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// NearByRadius is the distance in kilometres within which a restaurant is considered near by
+	NearByRadius = 10
+	earthRadius  = 6370.986
+)
+
+// SendErrorMessage builds the error returned by bulk operations when some of the requested entries
+// could not be processed, entries are reported by their position(1 based) in the request
+func SendErrorMessage(ctx context.Context, ErrEntries []int, length int, data string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogInfo(reqId, reqUrl, "generating error message", 0)
+	errMsg := data + " Deleted Except entry no. "
+	for i, j := range ErrEntries {
+		if i == length-1 {
+			errMsg = errMsg + fmt.Sprintf(" %v", j+1)
+			break
+		}
+		errMsg = errMsg + fmt.Sprintf(" %v,", j+1)
+	}
+	logger.LogInfo(reqId, reqUrl, "error message generated successfully", 0)
+	return errors.New(errMsg)
+}
+
+// ConfigurePool applies the configured connection pool limits, zero values keep the driver defaults
+func ConfigurePool(db *sql.DB, cfg *config.Database) {
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetime.Duration > 0 {
+		db.SetConnMaxLifetime(cfg.ConnMaxLifetime.Duration)
+	}
+}
+
+// Distance returns the great circle distance in kilometres between two points using the haversine formula
+func Distance(lat1, lng1, lat2, lng2 float64) float64 {
+	toRadian := func(deg float64) float64 {
+		return deg * math.Pi / 180
+	}
+	dLat := toRadian(lat2 - lat1)
+	dLng := toRadian(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadian(lat1))*math.Cos(toRadian(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// ScanUsers reads rows selecting id, email, name, role and status into users
+func ScanUsers(rows *sql.Rows) ([]models.UserOutput, error) {
+	users := []models.UserOutput{}
+	for rows.Next() {
+		var user models.UserOutput
+		err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.Role, &user.Status)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// ScanRestaurants reads rows selecting id, name, lat and lng into restaurants
+func ScanRestaurants(rows *sql.Rows) ([]models.RestaurantOutput, error) {
+	restaurants := []models.RestaurantOutput{}
+	for rows.Next() {
+		var restaurant models.RestaurantOutput
+		err := rows.Scan(&restaurant.ID, &restaurant.Name, &restaurant.Lat, &restaurant.Lng)
+		if err != nil {
+			return nil, err
+		}
+		restaurants = append(restaurants, restaurant)
+	}
+	return restaurants, rows.Err()
+}
+
+// ScanDishes reads rows selecting id, name and price into dishes
+func ScanDishes(rows *sql.Rows) ([]models.DishOutput, error) {
+	dishes := []models.DishOutput{}
+	for rows.Next() {
+		var dish models.DishOutput
+		err := rows.Scan(&dish.ID, &dish.Name, &dish.Price)
+		if err != nil {
+			return nil, err
+		}
+		dishes = append(dishes, dish)
+	}
+	return dishes, rows.Err()
+}
+
+// APIKeyColumns are the columns of api_keys read by ScanAPIKeys and ScanAPIKey
+const APIKeyColumns = "id,name,prefix,user_id,role,permissions,created_at,last_used_at"
+
+// ScanAPIKeys reads rows selecting APIKeyColumns into api keys
+func ScanAPIKeys(rows *sql.Rows) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// ScanAPIKey reads row selecting APIKeyColumns into an api key
+func ScanAPIKey(row *sql.Row) (*models.APIKey, error) {
+	return scanAPIKey(row.Scan)
+}
+
+func scanAPIKey(scan func(dest ...interface{}) error) (*models.APIKey, error) {
+	var key models.APIKey
+	var permissions string
+	var createdAt int64
+	var lastUsedAt sql.NullInt64
+	err := scan(&key.ID, &key.Name, &key.Prefix, &key.UserID, &key.Role, &permissions, &createdAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.Permissions = []string{}
+	if permissions != "" {
+		key.Permissions = strings.Split(permissions, ",")
+	}
+	key.CreatedAt = time.Unix(createdAt, 0)
+	if lastUsedAt.Valid {
+		lastUsed := time.Unix(lastUsedAt.Int64, 0)
+		key.LastUsedAt = &lastUsed
+	}
+	return &key, nil
+}
+
+// SessionColumns are the columns of sessions read by ScanSessions
+const SessionColumns = "id,user_id,role,device,ip,issued_at,last_seen_at,expires_at"
+
+// ScanSessions reads rows selecting SessionColumns into sessions
+func ScanSessions(rows *sql.Rows) ([]models.Session, error) {
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		var issuedAt, lastSeenAt, expiresAt int64
+		err := rows.Scan(&session.ID, &session.UserID, &session.Role, &session.Device, &session.IP, &issuedAt, &lastSeenAt, &expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		session.IssuedAt = time.Unix(issuedAt, 0)
+		session.LastSeenAt = time.Unix(lastSeenAt, 0)
+		session.ExpiresAt = time.Unix(expiresAt, 0)
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
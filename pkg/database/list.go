@@ -0,0 +1,109 @@
+package database
+
+import (
+	"github.com/vds/go-resman/pkg/models"
+	"strings"
+)
+
+// sort options accepted by list queries, a leading - sorts in descending order
+const (
+	SortByID       = "id"
+	SortByIDDesc   = "-id"
+	SortByName     = "name"
+	SortByNameDesc = "-name"
+)
+
+// ValidSort reports whether sort is accepted by list queries, an empty sort orders by id
+func ValidSort(sort string) bool {
+	switch sort {
+	case "", SortByID, SortByIDDesc, SortByName, SortByNameDesc:
+		return true
+	}
+	return false
+}
+
+// ListQueries builds the query selecting a page of columns from table and the query counting every matching row,
+// conditions are joined with and and take args, both queries use ? placeholders
+func ListQueries(columns string, table string, conditions []string, args []interface{}, opts *models.ListOptions) (string, string, []interface{}, []interface{}) {
+	if opts == nil {
+		opts = &models.ListOptions{}
+	}
+	args = append([]interface{}{}, args...)
+	if opts.NamePrefix != "" {
+		conditions = append(conditions, "lower(name) like ? escape '!'")
+		args = append(args, strings.ToLower(escapeLike(opts.NamePrefix))+"%")
+	}
+	if opts.Assigned != nil {
+		if *opts.Assigned {
+			conditions = append(conditions, "owner_id is not null")
+		} else {
+			conditions = append(conditions, "owner_id is null")
+		}
+	}
+	where := ""
+	if len(conditions) != 0 {
+		where = " where " + strings.Join(conditions, " and ")
+	}
+	countQuery := "select count(*) from " + table + where
+	query := "select " + columns + " from " + table + where + " order by " + orderBy(opts.Sort)
+	queryArgs := args
+	if opts.Limit > 0 {
+		query = query + " limit ? offset ?"
+		queryArgs = append(append([]interface{}{}, args...), opts.Limit, opts.Offset)
+	}
+	return query, countQuery, queryArgs, args
+}
+
+// Paginate returns the page of a list of length total selected by opts as slice bounds
+func Paginate(total int, opts *models.ListOptions) (int, int) {
+	if opts == nil || opts.Limit <= 0 {
+		return 0, total
+	}
+	start := opts.Offset
+	if start > total {
+		start = total
+	}
+	end := start + opts.Limit
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// ListLess returns the less function ordering a list the way list queries order by sortBy,
+// idLess and name describe the entries at the given positions
+func ListLess(sortBy string, idLess func(i, j int) bool, name func(i int) string) func(i, j int) bool {
+	return func(i, j int) bool {
+		switch sortBy {
+		case SortByName, SortByNameDesc:
+			if name(i) != name(j) {
+				return (name(i) < name(j)) == (sortBy == SortByName)
+			}
+		}
+		if sortBy == SortByIDDesc || sortBy == SortByNameDesc {
+			return idLess(j, i)
+		}
+		return idLess(i, j)
+	}
+}
+
+// MatchesNamePrefix reports whether name starts with prefix ignoring case
+func MatchesNamePrefix(name string, prefix string) bool {
+	return strings.HasPrefix(strings.ToLower(name), strings.ToLower(prefix))
+}
+
+func orderBy(sort string) string {
+	switch sort {
+	case SortByIDDesc:
+		return "id desc"
+	case SortByName:
+		return "name asc, id asc"
+	case SortByNameDesc:
+		return "name desc, id desc"
+	}
+	return "id asc"
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
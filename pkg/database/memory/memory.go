@@ -0,0 +1,1577 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+type user struct {
+	ID        string
+	Role      string
+	Email     string
+	Name      string
+	Password  string
+	CreatorID string
+	Verified  bool
+	Status    string
+	// StatusChangedAt is when the account was last suspended, deleted or reactivated
+	StatusChangedAt time.Time
+}
+
+// recoveryCode is the owner of a stored recovery code hash
+type recoveryCode struct {
+	UserID string
+	Role   string
+}
+
+// loginFailures counts the failed logins of a key
+type loginFailures struct {
+	Failures    int
+	LockedUntil time.Time
+	ExpiresAt   time.Time
+}
+
+type restaurant struct {
+	ID        int
+	Name      string
+	Lat       float64
+	Lng       float64
+	CreatorID string
+	OwnerID   string
+}
+
+type dish struct {
+	ID    int
+	Name  string
+	Price float32
+	ResID int
+}
+
+// MemoryDB keeps all the data in process memory, it is meant for tests and local development
+type MemoryDB struct {
+	mu            sync.RWMutex
+	users         map[string]*user
+	restaurants   map[int]*restaurant
+	dishes        map[int]*dish
+	revokedTokens map[string]time.Time
+	refreshTokens map[string]*models.RefreshToken
+	resetTokens   map[string]*models.PasswordResetToken
+	verifyTokens  map[string]*models.VerificationToken
+	// twoFactor is keyed by twoFactorKey
+	twoFactor         map[string]*models.TwoFactor
+	recoveryCodes     map[string]*recoveryCode
+	twoFactorRequired bool
+	loginFailures     map[string]*loginFailures
+	// apiKeys is keyed by the hash of the key
+	apiKeys    map[string]*models.APIKey
+	sessions   map[string]*models.Session
+	lastResID  int
+	lastDishID int
+	hasher     encryption.PasswordHasher
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		users:         make(map[string]*user),
+		restaurants:   make(map[int]*restaurant),
+		dishes:        make(map[int]*dish),
+		revokedTokens: make(map[string]time.Time),
+		refreshTokens: make(map[string]*models.RefreshToken),
+		resetTokens:   make(map[string]*models.PasswordResetToken),
+		verifyTokens:  make(map[string]*models.VerificationToken),
+		twoFactor:     make(map[string]*models.TwoFactor),
+		recoveryCodes: make(map[string]*recoveryCode),
+		loginFailures: make(map[string]*loginFailures),
+		apiKeys:       make(map[string]*models.APIKey),
+		sessions:      make(map[string]*models.Session),
+		hasher:        encryption.DefaultPasswordHasher(),
+	}
+}
+
+func (db *MemoryDB) SetPasswordHasher(hasher encryption.PasswordHasher) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.hasher = hasher
+}
+
+func (db *MemoryDB) ShowNearBy(ctx context.Context, location *models.Location) ([]models.RestaurantOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "finding near by restaurants")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	result := db.filterRestaurants(func(res *restaurant) bool {
+		return database.Distance(float64(location.Lat), float64(location.Lng), res.Lat, res.Lng) < database.NearByRadius
+	})
+	logger.LogInfo(reqId, reqUrl, "getNearBy restaurant from db successful", 0)
+	return result, nil
+}
+
+func (db *MemoryDB) CreateUser(ctx context.Context, user *models.UserReg) (string, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "creating user")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	// owners are created with their creator by CreateOwner
+	if user.Role == "" || user.Role == middleware.Owner {
+		return "", database.ErrInternal
+	}
+	if db.emailExists(user.Role, user.Email, "") {
+		logger.LogError(reqId, reqUrl, "email already exists", 0)
+		return "", database.ErrDupEmail
+	}
+	logger.LogDebug(reqId, reqUrl, "generating password hash")
+	pass, err := encryption.GenerateHash(db.hasher, user.Password)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in generating password hash: %v", err), 0)
+		return "", database.ErrInternal
+	}
+	id := uuid.New().String()
+	db.users[id] = newUser(id, user.Role, user.Email, user.Name, pass, "")
+	db.users[id].Verified = user.Verified
+	logger.LogInfo(reqId, reqUrl, "createUser in db successful", 0)
+	return id, nil
+}
+
+func (db *MemoryDB) LogInUser(ctx context.Context, cred *models.Credentials) (string, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "logging in user")
+	db.mu.RLock()
+	var found *user
+	for _, u := range db.userTable(cred.Role) {
+		if u.Email == cred.Email {
+			userCopy := *u
+			found = &userCopy
+			break
+		}
+	}
+	db.mu.RUnlock()
+	if found == nil {
+		logger.LogError(reqId, reqUrl, "user does not exist", 0)
+		return "", database.ErrInvalidCredentials
+	}
+	logger.LogDebug(reqId, reqUrl, "comparing passwords")
+	isValid := encryption.ComparePasswords(ctx, db.hasher, found.Password, cred.Password)
+	if !isValid {
+		return "", database.ErrInvalidCredentials
+	}
+	if found.Status == models.StatusSuspended {
+		logger.LogError(reqId, reqUrl, "account of user is suspended", 0)
+		return "", database.ErrAccountSuspended
+	}
+	if !found.Verified {
+		logger.LogError(reqId, reqUrl, "email of user is not verified", 0)
+		return "", database.ErrUnverifiedEmail
+	}
+	if db.hasher.NeedsRehash(found.Password) {
+		db.rehashPassword(ctx, found, cred.Password)
+	}
+	logger.LogInfo(reqId, reqUrl, "login credentials verified from db", 0)
+	return found.ID, nil
+}
+
+// rehashPassword replaces the hash of a user who just logged in with a hash of the current hasher,
+// unless the password changed in the meantime
+func (db *MemoryDB) rehashPassword(ctx context.Context, found *user, password string) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "rehashing password of user")
+	hash, err := encryption.GenerateHash(db.hasher, password)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not rehash password: %v", err), 0)
+		return
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	u, ok := db.users[found.ID]
+	if ok && u.Password == found.Password {
+		u.Password = hash
+	}
+}
+
+func (db *MemoryDB) ShowAdmins(ctx context.Context, opts *models.ListOptions) ([]models.UserOutput, int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "getting admins")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	result, total := listUsers(db.allUsersWhere(func(u *user) bool { return database.IsAdminRole(u.Role) }), func(*user) bool { return true }, opts)
+	logger.LogInfo(reqId, reqUrl, "get admins from db successful", 0)
+	return result, total, nil
+}
+
+func (db *MemoryDB) UpdateAdmin(ctx context.Context, admin *models.UserOutput) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "updating an admin")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.updateUser(ctx, db.adminTable(), admin)
+}
+
+func (db *MemoryDB) RemoveAdmins(ctx context.Context, adminIDs ...string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "deleting admins")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	admins := db.adminTable()
+	var ErrEntries []int
+	for i, id := range adminIDs {
+		admin, ok := admins[id]
+		if !ok {
+			ErrEntries = append(ErrEntries, i)
+			continue
+		}
+		db.setStatus(admin, models.StatusDeleted)
+	}
+	length := len(ErrEntries)
+	if length != 0 {
+		return database.SendErrorMessage(ctx, ErrEntries, length, "Admins")
+	}
+	logger.LogInfo(reqId, reqUrl, "admin deleted in db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) ShowOwners(ctx context.Context, userAuth *models.UserAuth, opts *models.ListOptions) ([]models.UserOutput, int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "getting owners according to scope")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var result []models.UserOutput
+	var total int
+	owners := db.allUsersWhere(func(u *user) bool { return u.Role == middleware.Owner })
+	switch userAuth.Scope {
+	case models.ScopeAll:
+		result, total = listUsers(owners, func(*user) bool { return true }, opts)
+	case models.ScopeCreated:
+		result, total = listUsers(owners, func(u *user) bool { return u.CreatorID == userAuth.ID }, opts)
+	default:
+		return nil, 0, database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "owners retrieved from db successfully", 0)
+	return result, total, nil
+}
+
+func (db *MemoryDB) CreateOwner(ctx context.Context, creatorID string, owner *models.OwnerReg) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "creating an owner")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.emailExists(middleware.Owner, owner.Email, "") {
+		logger.LogError(reqId, reqUrl, "email already exists", 0)
+		return nil, database.ErrDupEmail
+	}
+	logger.LogDebug(reqId, reqUrl, "generating password hash")
+	pass, err := encryption.GenerateHash(db.hasher, owner.Password)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in generating hash of password: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	id := uuid.New().String()
+	db.users[id] = newUser(id, middleware.Owner, owner.Email, owner.Name, pass, creatorID)
+	db.users[id].Verified = owner.Verified
+	logger.LogInfo(reqId, reqUrl, "owner created in db successful", 0)
+	return db.users[id].output(), nil
+}
+
+func (db *MemoryDB) CheckOwnerCreator(ctx context.Context, creatorID string, ownerID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "verifying owner creator")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	owner, ok := db.userTable(middleware.Owner)[ownerID]
+	if !ok {
+		return database.ErrInvalidOwner
+	}
+	if owner.CreatorID != creatorID {
+		return database.ErrInvalidOwnerCreator
+	}
+	logger.LogInfo(reqId, reqUrl, "owner creator verified from db", 0)
+	return nil
+}
+
+func (db *MemoryDB) UpdateOwner(ctx context.Context, owner *models.UserOutput) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "updating owner")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	owners := db.userTable(middleware.Owner)
+	if _, ok := owners[owner.ID]; !ok {
+		return nil, database.ErrInvalidOwner
+	}
+	return db.updateUser(ctx, owners, owner)
+}
+
+func (db *MemoryDB) RemoveOwners(ctx context.Context, userAuth *models.UserAuth, ownerIDs ...string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "deleting owners according to scope")
+	if userAuth.Scope != models.ScopeAll && userAuth.Scope != models.ScopeCreated {
+		return database.ErrInternal
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	owners := db.userTable(middleware.Owner)
+	var ErrEntries []int
+	for i, id := range ownerIDs {
+		owner, ok := owners[id]
+		if !ok || (userAuth.Scope == models.ScopeCreated && owner.CreatorID != userAuth.ID) {
+			ErrEntries = append(ErrEntries, i)
+			continue
+		}
+		db.setStatus(owner, models.StatusDeleted)
+		for _, res := range db.restaurants {
+			if res.OwnerID == id {
+				res.OwnerID = ""
+			}
+		}
+	}
+	length := len(ErrEntries)
+	if length != 0 {
+		return database.SendErrorMessage(ctx, ErrEntries, length, "Owners")
+	}
+	logger.LogInfo(reqId, reqUrl, "owners deleted from db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) CheckAdmin(ctx context.Context, adminID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "checking if admin exist")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if _, ok := db.adminTable()[adminID]; !ok {
+		return database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "admin id verified from db", 0)
+	return nil
+}
+
+//restaurants
+
+func (db *MemoryDB) ShowRestaurants(ctx context.Context, userAuth *models.UserAuth, opts *models.ListOptions) ([]models.RestaurantOutput, int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "getting restaurants according to scope")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var keep func(*restaurant) bool
+	switch userAuth.Scope {
+	case models.ScopeAll:
+		keep = func(*restaurant) bool { return true }
+	case models.ScopeCreated:
+		keep = func(res *restaurant) bool { return res.CreatorID == userAuth.ID }
+	case models.ScopeOwned:
+		keep = func(res *restaurant) bool { return res.OwnerID == userAuth.ID }
+	default:
+		return nil, 0, database.ErrInternal
+	}
+	result, total := db.listRestaurants(keep, opts)
+	logger.LogInfo(reqId, reqUrl, "restaurants retrieved from db successfully", 0)
+	return result, total, nil
+}
+
+func (db *MemoryDB) InsertRestaurant(ctx context.Context, restaurant *models.Restaurant) (*models.RestaurantOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "adding a restaurant")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.lastResID++
+	res := newRestaurant(db.lastResID, restaurant)
+	db.restaurants[res.ID] = res
+	logger.LogInfo(reqId, reqUrl, "restaurant added successfully in db", 0)
+	return res.output(), nil
+}
+
+func (db *MemoryDB) ShowAvailableRestaurants(ctx context.Context, userAuth *models.UserAuth) ([]models.RestaurantOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "getting available restaurants according to scope")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var result []models.RestaurantOutput
+	switch userAuth.Scope {
+	case models.ScopeAll:
+		result = db.filterRestaurants(func(res *restaurant) bool { return res.OwnerID == "" })
+	case models.ScopeCreated:
+		result = db.filterRestaurants(func(res *restaurant) bool {
+			return res.OwnerID == "" && res.CreatorID == userAuth.ID
+		})
+	default:
+		return nil, database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "available restaurants retrieved from db successfully", 0)
+	return result, nil
+}
+
+func (db *MemoryDB) InsertOwnerForRestaurants(ctx context.Context, userAuth *models.UserAuth, ownerID string, resIDs ...int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "adding owner to restaurants")
+	return db.setRestaurantsOwner(ctx, userAuth, ownerID, ownerID, resIDs...)
+}
+
+func (db *MemoryDB) RemoveOwnerForRestaurants(ctx context.Context, userAuth *models.UserAuth, ownerID string, resIDs ...int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "removing owner of restaurants")
+	return db.setRestaurantsOwner(ctx, userAuth, ownerID, "", resIDs...)
+}
+
+func (db *MemoryDB) CheckRestaurantCreator(ctx context.Context, creatorID string, resID int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "checking restaurant creator")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	res, ok := db.restaurants[resID]
+	if !ok || res.CreatorID == "" {
+		return database.ErrNonExistingRestaurant
+	}
+	if res.CreatorID != creatorID {
+		logger.LogError(reqId, reqUrl, "error invalid creator", 0)
+		return database.ErrInvalidRestaurantCreator
+	}
+	logger.LogInfo(reqId, reqUrl, "restaurant creator verified", 0)
+	return nil
+}
+
+func (db *MemoryDB) UpdateRestaurant(ctx context.Context, restaurant *models.RestaurantOutput) (*models.RestaurantOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "updating a restaurant")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	res, ok := db.restaurants[restaurant.ID]
+	if !ok {
+		return nil, database.ErrNonExistingRestaurant
+	}
+	res.Name = restaurant.Name
+	res.Lat = restaurant.Lat
+	res.Lng = restaurant.Lng
+	logger.LogInfo(reqId, reqUrl, "restaurant updated in db successfully", 0)
+	return res.output(), nil
+}
+
+func (db *MemoryDB) RemoveRestaurants(ctx context.Context, userAuth *models.UserAuth, resIDs ...int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "deleting restaurants according to scope")
+	if userAuth.Scope != models.ScopeAll && userAuth.Scope != models.ScopeCreated {
+		return database.ErrInternal
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var ErrEntries []int
+	for i, id := range resIDs {
+		res, ok := db.restaurants[id]
+		if !ok || (userAuth.Scope == models.ScopeCreated && res.CreatorID != userAuth.ID) {
+			ErrEntries = append(ErrEntries, i)
+			continue
+		}
+		delete(db.restaurants, id)
+		for dishID, d := range db.dishes {
+			if d.ResID == id {
+				delete(db.dishes, dishID)
+			}
+		}
+	}
+	length := len(ErrEntries)
+	if length != 0 {
+		return database.SendErrorMessage(ctx, ErrEntries, length, "Restaurants")
+	}
+	logger.LogInfo(reqId, reqUrl, "restaurants deleted from db successfully", 0)
+	return nil
+}
+
+//menu
+
+func (db *MemoryDB) ShowMenu(ctx context.Context, resID int, opts *models.ListOptions) ([]models.DishOutput, int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "getting menu")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if _, ok := db.restaurants[resID]; !ok {
+		return nil, 0, database.ErrNonExistingRestaurant
+	}
+	if opts == nil {
+		opts = &models.ListOptions{}
+	}
+	result := []models.DishOutput{}
+	for _, d := range db.dishes {
+		if d.ResID == resID && database.MatchesNamePrefix(d.Name, opts.NamePrefix) {
+			result = append(result, *d.output())
+		}
+	}
+	sort.Slice(result, database.ListLess(opts.Sort,
+		func(i, j int) bool { return result[i].ID < result[j].ID },
+		func(i int) string { return result[i].Name }))
+	start, end := database.Paginate(len(result), opts)
+	logger.LogInfo(reqId, reqUrl, "menu retrieved from db successfully", 0)
+	return result[start:end], len(result), nil
+}
+
+func (db *MemoryDB) CheckRestaurantOwner(ctx context.Context, ownerID string, resID int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "verifying restaurant owner")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	res, ok := db.restaurants[resID]
+	if !ok || res.OwnerID == "" {
+		return database.ErrNonExistingRestaurant
+	}
+	if res.OwnerID != ownerID {
+		logger.LogError(reqId, reqUrl, "error invalid restaurant owner", 0)
+		return database.ErrInvalidRestaurantOwner
+	}
+	logger.LogInfo(reqId, reqUrl, "restaurant owner validated from db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) InsertDishes(ctx context.Context, dishes models.Dish, resID int) (*models.DishOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "inserting dish")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.restaurants[resID]; !ok {
+		return nil, database.ErrNonExistingRestaurant
+	}
+	db.lastDishID++
+	d := &dish{ID: db.lastDishID, Name: dishes.Name, Price: dishes.Price, ResID: resID}
+	db.dishes[d.ID] = d
+	logger.LogInfo(reqId, reqUrl, "dish added in db successfully", 0)
+	return d.output(), nil
+}
+
+func (db *MemoryDB) UpdateDish(ctx context.Context, dishIn *models.DishOutput) (*models.DishOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "updating dish")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	d, ok := db.dishes[dishIn.ID]
+	if !ok {
+		return nil, database.ErrInternal
+	}
+	d.Name = dishIn.Name
+	d.Price = dishIn.Price
+	logger.LogInfo(reqId, reqUrl, "dish updated in db successfully", 0)
+	return d.output(), nil
+}
+
+func (db *MemoryDB) CheckRestaurantDish(ctx context.Context, resID int, dishID int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "checking the requested dish in the restaurant")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	d, ok := db.dishes[dishID]
+	if !ok {
+		return database.ErrInvalidDish
+	}
+	if d.ResID != resID {
+		logger.LogError(reqId, reqUrl, "requested dish is of some other restaurant", 0)
+		return database.ErrInvalidRestaurantDish
+	}
+	logger.LogInfo(reqId, reqUrl, "checking of the requested dish in the restaurant successful", 0)
+	return nil
+}
+
+func (db *MemoryDB) RemoveDishes(ctx context.Context, dishIDs ...int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "deleting dishes")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var ErrEntries []int
+	for i, id := range dishIDs {
+		if _, ok := db.dishes[id]; !ok {
+			ErrEntries = append(ErrEntries, i)
+			continue
+		}
+		delete(db.dishes, id)
+	}
+	length := len(ErrEntries)
+	if length != 0 {
+		return database.SendErrorMessage(ctx, ErrEntries, length, "Dishes")
+	}
+	logger.LogInfo(reqId, reqUrl, "dish deleted in db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "storing revoked token")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.revokedTokens[jti] = expiresAt
+	logger.LogInfo(reqId, reqUrl, "revoked token stored in db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "checking if token is revoked")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	_, revoked := db.revokedTokens[jti]
+	return revoked, nil
+}
+
+func (db *MemoryDB) StoreRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "storing refresh token")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	tokenCopy := *token
+	db.refreshTokens[token.Hash] = &tokenCopy
+	logger.LogInfo(reqId, reqUrl, "refresh token stored in db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) UseRefreshToken(ctx context.Context, hash string, now time.Time) (*models.RefreshToken, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "using refresh token")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	token, ok := db.refreshTokens[hash]
+	if !ok {
+		return nil, database.ErrInvalidRefreshToken
+	}
+	if token.Used {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("refresh token reused, revoking family %s", token.FamilyID), 0)
+		db.revokeRefreshTokens(token.FamilyID)
+		return nil, database.ErrRefreshTokenReused
+	}
+	if !token.ExpiresAt.After(now) {
+		return nil, database.ErrInvalidRefreshToken
+	}
+	token.Used = true
+	result := *token
+	logger.LogInfo(reqId, reqUrl, "refresh token used successfully", 0)
+	return &result, nil
+}
+
+func (db *MemoryDB) RevokeRefreshTokens(ctx context.Context, familyID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "revoking refresh token family")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.revokeRefreshTokens(familyID)
+	return nil
+}
+
+func (db *MemoryDB) FindUserID(ctx context.Context, role string, email string) (string, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "finding user by email")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for id, u := range db.userTable(role) {
+		if u.Email == email {
+			return id, nil
+		}
+	}
+	return "", database.ErrUserNotFound
+}
+
+func (db *MemoryDB) CountUsers(ctx context.Context, role string) (int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "counting users")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.userTable(role)), nil
+}
+
+// LockUsers has nothing to lock, WithTx holds the lock of the whole database
+func (db *MemoryDB) LockUsers(ctx context.Context, role string) error {
+	return nil
+}
+
+func (db *MemoryDB) GetUser(ctx context.Context, userID string, role string) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "getting user")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	u, ok := db.userTable(role)[userID]
+	if !ok {
+		return nil, database.ErrUserNotFound
+	}
+	return u.output(), nil
+}
+
+func (db *MemoryDB) GetUserStatus(ctx context.Context, userID string, role string) (string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	u, ok := db.users[userID]
+	if !ok || u.Role != role {
+		return "", database.ErrUserNotFound
+	}
+	return u.Status, nil
+}
+
+func (db *MemoryDB) SuspendUser(ctx context.Context, userID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "suspending user")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	u, ok := db.users[userID]
+	if !ok || u.Status == models.StatusDeleted {
+		return database.ErrUserNotFound
+	}
+	db.setStatus(u, models.StatusSuspended)
+	logger.LogInfo(reqId, reqUrl, "user suspended in db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) ReactivateUser(ctx context.Context, userID string) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "reactivating user")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	u, ok := db.users[userID]
+	if !ok {
+		return nil, database.ErrUserNotFound
+	}
+	if u.Status == models.StatusDeleted && db.emailExists(u.Role, u.Email, u.ID) {
+		return nil, database.ErrDupEmail
+	}
+	if u.Status != models.StatusActive {
+		db.setStatus(u, models.StatusActive)
+	}
+	logger.LogInfo(reqId, reqUrl, "user reactivated in db successfully", 0)
+	return u.output(), nil
+}
+
+func (db *MemoryDB) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "purging deleted users")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var purged int64
+	for id, u := range db.users {
+		if u.Status != models.StatusDeleted || u.StatusChangedAt.After(deletedBefore) {
+			continue
+		}
+		db.revokeSessions(id, u.Role, "")
+		for hash, token := range db.refreshTokens {
+			if token.UserID == id {
+				delete(db.refreshTokens, hash)
+			}
+		}
+		delete(db.loginFailures, database.TwoFactorLockKey(u.Role, id))
+		db.removeResetTokens(id, u.Role)
+		db.removeVerificationTokens(id, u.Role)
+		db.replaceRecoveryCodes(id, u.Role, nil)
+		delete(db.twoFactor, twoFactorKey(id, u.Role))
+		for hash, key := range db.apiKeys {
+			if key.UserID == id && key.Role == u.Role {
+				delete(db.apiKeys, hash)
+			}
+		}
+		delete(db.users, id)
+		for _, res := range db.restaurants {
+			if res.CreatorID == id {
+				res.CreatorID = ""
+			}
+		}
+		for _, owner := range db.users {
+			if owner.CreatorID == id {
+				owner.CreatorID = ""
+			}
+		}
+		purged++
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("%d deleted users purged", purged), 0)
+	return purged, nil
+}
+
+func (db *MemoryDB) StorePasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "storing password reset token")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.removeResetTokens(token.UserID, token.Role)
+	tokenCopy := *token
+	db.resetTokens[token.Hash] = &tokenCopy
+	logger.LogInfo(reqId, reqUrl, "password reset token stored in db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) ResetPassword(ctx context.Context, hash string, password string, now time.Time) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "resetting password")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	token, ok := db.resetTokens[hash]
+	if !ok || !token.ExpiresAt.After(now) {
+		return database.ErrInvalidResetToken
+	}
+	u, ok := db.userTable(token.Role)[token.UserID]
+	if !ok {
+		delete(db.resetTokens, hash)
+		return database.ErrInvalidResetToken
+	}
+	logger.LogDebug(reqId, reqUrl, "generating password hash")
+	pass, err := encryption.GenerateHash(db.hasher, password)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in generating password hash: %v", err), 0)
+		return database.ErrInternal
+	}
+	u.Password = pass
+	db.removeResetTokens(token.UserID, token.Role)
+	for refreshHash, refreshToken := range db.refreshTokens {
+		if refreshToken.UserID == token.UserID && refreshToken.Role == token.Role {
+			delete(db.refreshTokens, refreshHash)
+		}
+	}
+	db.revokeSessions(token.UserID, token.Role, "")
+	logger.LogInfo(reqId, reqUrl, "password reset in db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) UpdateProfile(ctx context.Context, user *models.UserOutput) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "updating profile of user")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	users := db.userTable(user.Role)
+	u, ok := users[user.ID]
+	if !ok {
+		return nil, database.ErrUserNotFound
+	}
+	email := u.Email
+	result, err := db.updateUser(ctx, users, user)
+	if err == nil && user.Email != email {
+		u.Verified = false
+	}
+	return result, err
+}
+
+func (db *MemoryDB) ChangePassword(ctx context.Context, userID string, role string, current string, password string, keepID string) (int64, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "changing password")
+	db.mu.RLock()
+	u, ok := db.userTable(role)[userID]
+	var oldHash string
+	if ok {
+		oldHash = u.Password
+	}
+	db.mu.RUnlock()
+	if !ok {
+		return 0, database.ErrUserNotFound
+	}
+	logger.LogDebug(reqId, reqUrl, "comparing passwords")
+	if !encryption.ComparePasswords(ctx, db.hasher, oldHash, current) {
+		return 0, database.ErrInvalidCredentials
+	}
+	logger.LogDebug(reqId, reqUrl, "generating password hash")
+	pass, err := encryption.GenerateHash(db.hasher, password)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in generating password hash: %v", err), 0)
+		return 0, database.ErrInternal
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	u, ok = db.userTable(role)[userID]
+	// the password may have changed while the hashes were computed
+	if !ok || u.Password != oldHash {
+		return 0, database.ErrInvalidCredentials
+	}
+	u.Password = pass
+	db.removeResetTokens(userID, role)
+	revoked := db.revokeSessions(userID, role, keepID)
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("password changed in db successfully, %d sessions revoked", revoked), 0)
+	return revoked, nil
+}
+
+func (db *MemoryDB) StoreVerificationToken(ctx context.Context, token *models.VerificationToken) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "storing email verification token")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	u, ok := db.userTable(token.Role)[token.UserID]
+	if !ok {
+		return database.ErrUserNotFound
+	}
+	if u.Verified {
+		return database.ErrAlreadyVerified
+	}
+	db.removeVerificationTokens(token.UserID, token.Role)
+	tokenCopy := *token
+	db.verifyTokens[token.Hash] = &tokenCopy
+	logger.LogInfo(reqId, reqUrl, "email verification token stored in db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) VerifyEmail(ctx context.Context, hash string, now time.Time) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "verifying email")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	token, ok := db.verifyTokens[hash]
+	if !ok || !token.ExpiresAt.After(now) {
+		return database.ErrInvalidVerificationToken
+	}
+	db.removeVerificationTokens(token.UserID, token.Role)
+	u, ok := db.userTable(token.Role)[token.UserID]
+	if !ok {
+		return database.ErrInvalidVerificationToken
+	}
+	u.Verified = true
+	logger.LogInfo(reqId, reqUrl, "email verified in db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) GetTwoFactor(ctx context.Context, userID string, role string) (*models.TwoFactor, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "getting two-factor enrolment")
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	tf, ok := db.twoFactor[twoFactorKey(userID, role)]
+	if !ok {
+		return &models.TwoFactor{UserID: userID, Role: role}, nil
+	}
+	result := *tf
+	return &result, nil
+}
+
+func (db *MemoryDB) StoreTwoFactorSecret(ctx context.Context, userID string, role string, secret string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "storing two-factor secret")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	key := twoFactorKey(userID, role)
+	if tf, ok := db.twoFactor[key]; ok && tf.Enabled {
+		return database.ErrTwoFactorEnabled
+	}
+	db.twoFactor[key] = &models.TwoFactor{UserID: userID, Role: role, Secret: secret}
+	logger.LogInfo(reqId, reqUrl, "two-factor secret stored in db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) EnableTwoFactor(ctx context.Context, userID string, role string, step int64, recoveryHashes []string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "enabling two-factor authentication")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	tf, ok := db.twoFactor[twoFactorKey(userID, role)]
+	if !ok || tf.Enabled {
+		return database.ErrTwoFactorNotPending
+	}
+	tf.Enabled = true
+	tf.LastStep = step
+	db.replaceRecoveryCodes(userID, role, recoveryHashes)
+	logger.LogInfo(reqId, reqUrl, "two-factor authentication enabled in db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) UseTwoFactorStep(ctx context.Context, userID string, role string, step int64) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "using two-factor code")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	tf, ok := db.twoFactor[twoFactorKey(userID, role)]
+	if !ok || !tf.Enabled || tf.LastStep >= step {
+		return database.ErrTwoFactorCodeUsed
+	}
+	tf.LastStep = step
+	return nil
+}
+
+func (db *MemoryDB) UseRecoveryCode(ctx context.Context, userID string, role string, hash string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "using recovery code")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	code, ok := db.recoveryCodes[hash]
+	if !ok || code.UserID != userID || code.Role != role {
+		return database.ErrInvalidRecoveryCode
+	}
+	delete(db.recoveryCodes, hash)
+	logger.LogInfo(reqId, reqUrl, "recovery code used successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) ReplaceRecoveryCodes(ctx context.Context, userID string, role string, hashes []string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "replacing recovery codes")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.replaceRecoveryCodes(userID, role, hashes)
+	return nil
+}
+
+func (db *MemoryDB) DisableTwoFactor(ctx context.Context, userID string, role string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "disabling two-factor authentication")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.twoFactor, twoFactorKey(userID, role))
+	db.replaceRecoveryCodes(userID, role, nil)
+	logger.LogInfo(reqId, reqUrl, "two-factor authentication disabled in db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) SetTwoFactorRequired(ctx context.Context, required bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.twoFactorRequired = required
+	return nil
+}
+
+func (db *MemoryDB) IsTwoFactorRequired(ctx context.Context) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.twoFactorRequired, nil
+}
+
+func (db *MemoryDB) RecordLoginFailure(ctx context.Context, key string, now time.Time, expiresAt time.Time) (int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "recording login failure")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	record, ok := db.loginFailures[key]
+	if !ok || !record.ExpiresAt.After(now) {
+		record = &loginFailures{}
+		db.loginFailures[key] = record
+	}
+	record.Failures++
+	record.ExpiresAt = expiresAt
+	if record.LockedUntil.After(expiresAt) {
+		record.ExpiresAt = record.LockedUntil
+	}
+	return record.Failures, nil
+}
+
+func (db *MemoryDB) LockLogin(ctx context.Context, key string, until time.Time) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "locking login")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	record, ok := db.loginFailures[key]
+	if !ok {
+		return nil
+	}
+	record.LockedUntil = until
+	if until.After(record.ExpiresAt) {
+		record.ExpiresAt = until
+	}
+	return nil
+}
+
+func (db *MemoryDB) GetLoginLock(ctx context.Context, now time.Time, keys ...string) (time.Time, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var latest time.Time
+	for _, key := range keys {
+		record, ok := db.loginFailures[key]
+		if ok && record.LockedUntil.After(now) && record.LockedUntil.After(latest) {
+			latest = record.LockedUntil
+		}
+	}
+	return latest, nil
+}
+
+func (db *MemoryDB) ClearLoginFailures(ctx context.Context, keys ...string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, key := range keys {
+		delete(db.loginFailures, key)
+	}
+	return nil
+}
+
+func (db *MemoryDB) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "creating api key")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.apiKeys[key.Hash] = copyAPIKey(key)
+	logger.LogInfo(reqId, reqUrl, "api key created in db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) ShowAPIKeys(ctx context.Context, userID string, role string) ([]models.APIKey, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	keys := []models.APIKey{}
+	for _, key := range db.apiKeys {
+		if key.UserID == userID && key.Role == role {
+			keys = append(keys, *copyAPIKey(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (db *MemoryDB) RevokeAPIKey(ctx context.Context, userID string, role string, keyID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "revoking api key")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for hash, key := range db.apiKeys {
+		if key.ID == keyID && key.UserID == userID && key.Role == role {
+			delete(db.apiKeys, hash)
+			logger.LogInfo(reqId, reqUrl, "api key revoked successfully", 0)
+			return nil
+		}
+	}
+	return database.ErrAPIKeyNotFound
+}
+
+func (db *MemoryDB) UseAPIKey(ctx context.Context, hash string, now time.Time) (*models.APIKey, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	key, ok := db.apiKeys[hash]
+	if !ok {
+		return nil, database.ErrInvalidAPIKey
+	}
+	u, ok := db.users[key.UserID]
+	if !ok || u.Role != key.Role || u.Status != models.StatusActive {
+		return nil, database.ErrInvalidAPIKey
+	}
+	key.LastUsedAt = &now
+	return copyAPIKey(key), nil
+}
+
+func (db *MemoryDB) CreateSession(ctx context.Context, session *models.Session) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "creating session")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	sessionCopy := *session
+	db.sessions[session.ID] = &sessionCopy
+	logger.LogInfo(reqId, reqUrl, "session created in db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) TouchSession(ctx context.Context, sessionID string, now time.Time, expiresAt time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	session, ok := db.sessions[sessionID]
+	if !ok || !session.ExpiresAt.After(now) {
+		return database.ErrSessionNotFound
+	}
+	session.LastSeenAt = now
+	if expiresAt.After(session.ExpiresAt) {
+		session.ExpiresAt = expiresAt
+	}
+	return nil
+}
+
+func (db *MemoryDB) ShowSessions(ctx context.Context, userID string, role string, now time.Time) ([]models.Session, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	sessions := []models.Session{}
+	for _, session := range db.sessions {
+		if session.UserID == userID && session.Role == role && session.ExpiresAt.After(now) {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].LastSeenAt.Equal(sessions[j].LastSeenAt) {
+			return sessions[i].ID < sessions[j].ID
+		}
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (db *MemoryDB) RevokeSession(ctx context.Context, userID string, role string, sessionID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "revoking session")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	session, ok := db.sessions[sessionID]
+	if !ok || session.UserID != userID || session.Role != role {
+		return database.ErrSessionNotFound
+	}
+	db.revokeRefreshTokens(sessionID)
+	logger.LogInfo(reqId, reqUrl, "session revoked successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) RevokeSessions(ctx context.Context, userID string, role string, keepID string) (int64, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "revoking sessions of user")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	revoked := db.revokeSessions(userID, role, keepID)
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("%d sessions revoked", revoked), 0)
+	return revoked, nil
+}
+
+func (db *MemoryDB) PurgeExpiredTokens(ctx context.Context, now time.Time) (int64, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "purging expired tokens")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var purged int64
+	for jti, expiresAt := range db.revokedTokens {
+		if !expiresAt.After(now) {
+			delete(db.revokedTokens, jti)
+			purged++
+		}
+	}
+	for hash, token := range db.refreshTokens {
+		if !token.ExpiresAt.After(now) {
+			delete(db.refreshTokens, hash)
+			purged++
+		}
+	}
+	for hash, token := range db.resetTokens {
+		if !token.ExpiresAt.After(now) {
+			delete(db.resetTokens, hash)
+			purged++
+		}
+	}
+	for hash, token := range db.verifyTokens {
+		if !token.ExpiresAt.After(now) {
+			delete(db.verifyTokens, hash)
+			purged++
+		}
+	}
+	for key, record := range db.loginFailures {
+		if !record.ExpiresAt.After(now) {
+			delete(db.loginFailures, key)
+			purged++
+		}
+	}
+	for id, session := range db.sessions {
+		if !session.ExpiresAt.After(now) {
+			delete(db.sessions, id)
+			purged++
+		}
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("%d expired tokens purged", purged), 0)
+	return purged, nil
+}
+
+// WithTx runs fn against a copy of the data while holding the write lock, the copy replaces the
+// data only when fn returns nil so a failing fn leaves the database unchanged
+func (db *MemoryDB) WithTx(ctx context.Context, fn func(tx database.Database) error) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	tx := db.clone()
+	err := fn(tx)
+	if err != nil {
+		logger.LogDebug(reqId, reqUrl, "discarding transaction")
+		return err
+	}
+	db.users = tx.users
+	db.restaurants = tx.restaurants
+	db.dishes = tx.dishes
+	db.revokedTokens = tx.revokedTokens
+	db.refreshTokens = tx.refreshTokens
+	db.resetTokens = tx.resetTokens
+	db.verifyTokens = tx.verifyTokens
+	db.twoFactor = tx.twoFactor
+	db.recoveryCodes = tx.recoveryCodes
+	db.twoFactorRequired = tx.twoFactorRequired
+	db.loginFailures = tx.loginFailures
+	db.apiKeys = tx.apiKeys
+	db.sessions = tx.sessions
+	db.lastResID = tx.lastResID
+	db.lastDishID = tx.lastDishID
+	logger.LogDebug(reqId, reqUrl, "transaction committed")
+	return nil
+}
+
+// MigrationStatus always reports a complete schema, the memory database has no migrations
+func (db *MemoryDB) MigrationStatus(ctx context.Context) (*models.MigrationStatus, error) {
+	return &models.MigrationStatus{}, nil
+}
+
+//helpers
+
+// clone returns a deep copy of the data, the caller must hold the lock
+func (db *MemoryDB) clone() *MemoryDB {
+	tx := NewMemoryDB()
+	for id, u := range db.users {
+		userCopy := *u
+		tx.users[id] = &userCopy
+	}
+	for id, res := range db.restaurants {
+		resCopy := *res
+		tx.restaurants[id] = &resCopy
+	}
+	for id, d := range db.dishes {
+		dishCopy := *d
+		tx.dishes[id] = &dishCopy
+	}
+	for jti, expiresAt := range db.revokedTokens {
+		tx.revokedTokens[jti] = expiresAt
+	}
+	for hash, token := range db.refreshTokens {
+		tokenCopy := *token
+		tx.refreshTokens[hash] = &tokenCopy
+	}
+	for hash, token := range db.resetTokens {
+		tokenCopy := *token
+		tx.resetTokens[hash] = &tokenCopy
+	}
+	for hash, token := range db.verifyTokens {
+		tokenCopy := *token
+		tx.verifyTokens[hash] = &tokenCopy
+	}
+	for key, tf := range db.twoFactor {
+		tfCopy := *tf
+		tx.twoFactor[key] = &tfCopy
+	}
+	for hash, code := range db.recoveryCodes {
+		codeCopy := *code
+		tx.recoveryCodes[hash] = &codeCopy
+	}
+	tx.twoFactorRequired = db.twoFactorRequired
+	for key, record := range db.loginFailures {
+		recordCopy := *record
+		tx.loginFailures[key] = &recordCopy
+	}
+	for hash, key := range db.apiKeys {
+		tx.apiKeys[hash] = copyAPIKey(key)
+	}
+	for id, session := range db.sessions {
+		sessionCopy := *session
+		tx.sessions[id] = &sessionCopy
+	}
+	tx.lastResID = db.lastResID
+	tx.lastDishID = db.lastDishID
+	tx.hasher = db.hasher
+	return tx
+}
+
+// copyAPIKey returns a copy of key sharing no memory with it
+func copyAPIKey(key *models.APIKey) *models.APIKey {
+	keyCopy := *key
+	keyCopy.Permissions = append([]string{}, key.Permissions...)
+	if key.LastUsedAt != nil {
+		lastUsed := *key.LastUsedAt
+		keyCopy.LastUsedAt = &lastUsed
+	}
+	return &keyCopy
+}
+
+// revokeRefreshTokens deletes the refresh tokens of a family and its session, the caller must hold the lock
+func (db *MemoryDB) revokeRefreshTokens(familyID string) {
+	for hash, token := range db.refreshTokens {
+		if token.FamilyID == familyID {
+			delete(db.refreshTokens, hash)
+		}
+	}
+	delete(db.sessions, familyID)
+}
+
+// revokeSessions ends the sessions of the user but keepID and returns how many ended, the caller must hold the lock
+func (db *MemoryDB) revokeSessions(userID, role, keepID string) int64 {
+	var revoked int64
+	for id, session := range db.sessions {
+		if session.UserID == userID && session.Role == role && id != keepID {
+			db.revokeRefreshTokens(id)
+			revoked++
+		}
+	}
+	return revoked
+}
+
+func (db *MemoryDB) removeResetTokens(userID, role string) {
+	for hash, token := range db.resetTokens {
+		if token.UserID == userID && token.Role == role {
+			delete(db.resetTokens, hash)
+		}
+	}
+}
+
+func (db *MemoryDB) removeVerificationTokens(userID, role string) {
+	for hash, token := range db.verifyTokens {
+		if token.UserID == userID && token.Role == role {
+			delete(db.verifyTokens, hash)
+		}
+	}
+}
+
+func (db *MemoryDB) replaceRecoveryCodes(userID, role string, hashes []string) {
+	for hash, code := range db.recoveryCodes {
+		if code.UserID == userID && code.Role == role {
+			delete(db.recoveryCodes, hash)
+		}
+	}
+	for _, hash := range hashes {
+		db.recoveryCodes[hash] = &recoveryCode{UserID: userID, Role: role}
+	}
+}
+
+func twoFactorKey(userID, role string) string {
+	return role + "/" + userID
+}
+
+// setStatus changes the account status of u, the sessions of users who are no longer active end. The caller
+// must hold the lock
+func (db *MemoryDB) setStatus(u *user, status string) {
+	u.Status = status
+	u.StatusChangedAt = time.Now()
+	if status == models.StatusActive {
+		return
+	}
+	for hash, token := range db.refreshTokens {
+		if token.UserID == u.ID && token.Role == u.Role {
+			delete(db.refreshTokens, hash)
+		}
+	}
+	db.revokeSessions(u.ID, u.Role, "")
+}
+
+// userTable returns the users of role keyed by id, the caller must hold the lock
+func (db *MemoryDB) userTable(role string) map[string]*user {
+	return db.usersWhere(func(u *user) bool { return u.Role == role })
+}
+
+// adminTable returns the users managed as admins keyed by id, the caller must hold the lock
+func (db *MemoryDB) adminTable() map[string]*user {
+	return db.usersWhere(func(u *user) bool { return database.IsAdminRole(u.Role) })
+}
+
+// usersWhere returns the users kept by keep whose account was not deleted
+func (db *MemoryDB) usersWhere(keep func(*user) bool) map[string]*user {
+	return db.allUsersWhere(func(u *user) bool { return u.Status != models.StatusDeleted && keep(u) })
+}
+
+func (db *MemoryDB) allUsersWhere(keep func(*user) bool) map[string]*user {
+	table := make(map[string]*user)
+	for id, u := range db.users {
+		if keep(u) {
+			table[id] = u
+		}
+	}
+	return table
+}
+
+func (db *MemoryDB) filterRestaurants(keep func(*restaurant) bool) []models.RestaurantOutput {
+	result := []models.RestaurantOutput{}
+	for _, res := range db.restaurants {
+		if keep(res) {
+			result = append(result, *res.output())
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// listRestaurants returns the page selected by opts of the restaurants kept by keep along with their count
+func (db *MemoryDB) listRestaurants(keep func(*restaurant) bool, opts *models.ListOptions) ([]models.RestaurantOutput, int) {
+	if opts == nil {
+		opts = &models.ListOptions{}
+	}
+	result := db.filterRestaurants(func(res *restaurant) bool {
+		if opts.Assigned != nil && *opts.Assigned != (res.OwnerID != "") {
+			return false
+		}
+		return keep(res) && database.MatchesNamePrefix(res.Name, opts.NamePrefix)
+	})
+	sort.Slice(result, database.ListLess(opts.Sort,
+		func(i, j int) bool { return result[i].ID < result[j].ID },
+		func(i int) string { return result[i].Name }))
+	start, end := database.Paginate(len(result), opts)
+	return result[start:end], len(result)
+}
+
+func (db *MemoryDB) setRestaurantsOwner(ctx context.Context, userAuth *models.UserAuth, ownerID string, newOwnerID string, resIDs ...int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.userTable(middleware.Owner)[ownerID]; !ok {
+		return database.ErrInvalidOwner
+	}
+	var ErrEntries []int
+	for i, id := range resIDs {
+		res, ok := db.restaurants[id]
+		if userAuth.Scope != models.ScopeAll && (!ok || res.CreatorID != userAuth.ID) {
+			ErrEntries = append(ErrEntries, i)
+			continue
+		}
+		if ok {
+			res.OwnerID = newOwnerID
+		}
+	}
+	length := len(ErrEntries)
+	if length != 0 {
+		return database.SendErrorMessage(ctx, ErrEntries, length, "Restaurants")
+	}
+	logger.LogInfo(reqId, reqUrl, "owner of the requested restaurants updated in db successfully", 0)
+	return nil
+}
+
+func (db *MemoryDB) updateUser(ctx context.Context, table map[string]*user, in *models.UserOutput) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	u, ok := table[in.ID]
+	if !ok {
+		return nil, database.ErrInternal
+	}
+	if db.emailExists(u.Role, in.Email, in.ID) {
+		logger.LogError(reqId, reqUrl, "email already exists", 0)
+		return nil, database.ErrDupEmail
+	}
+	u.Email = in.Email
+	u.Name = in.Name
+	logger.LogInfo(reqId, reqUrl, "user updated in db successfully", 0)
+	return u.output(), nil
+}
+
+// listUsers returns the page selected by opts of the users in table kept by keep along with their count,
+// deleted users are only listed when opts selects them
+func listUsers(table map[string]*user, keep func(*user) bool, opts *models.ListOptions) ([]models.UserOutput, int) {
+	if opts == nil {
+		opts = &models.ListOptions{}
+	}
+	result := filterUsers(table, func(u *user) bool {
+		if opts.Status == "" && u.Status == models.StatusDeleted || opts.Status != "" && u.Status != opts.Status {
+			return false
+		}
+		return keep(u) && database.MatchesNamePrefix(u.Name, opts.NamePrefix)
+	})
+	sort.Slice(result, database.ListLess(opts.Sort,
+		func(i, j int) bool { return result[i].ID < result[j].ID },
+		func(i int) string { return result[i].Name }))
+	start, end := database.Paginate(len(result), opts)
+	return result[start:end], len(result)
+}
+
+func filterUsers(table map[string]*user, keep func(*user) bool) []models.UserOutput {
+	result := []models.UserOutput{}
+	for _, u := range table {
+		if keep(u) {
+			result = append(result, *u.output())
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// emailExists reports whether an account of role other than exceptID that was not deleted uses email.
+// The caller must hold the lock
+func (db *MemoryDB) emailExists(role string, email string, exceptID string) bool {
+	for id, u := range db.users {
+		if u.Role == role && u.Email == email && id != exceptID && u.Status != models.StatusDeleted {
+			return true
+		}
+	}
+	return false
+}
+
+func newUser(id, role, email, name, password, creatorID string) *user {
+	return &user{ID: id, Role: role, Email: email, Name: name, Password: password, CreatorID: creatorID, Status: models.StatusActive}
+}
+
+func (u *user) output() *models.UserOutput {
+	return &models.UserOutput{ID: u.ID, Email: u.Email, Name: u.Name, Role: u.Role, Status: u.Status}
+}
+
+func newRestaurant(id int, in *models.Restaurant) *restaurant {
+	return &restaurant{ID: id, Name: in.Name, Lat: in.Lat, Lng: in.Lng, CreatorID: in.CreatorID}
+}
+
+func (r *restaurant) output() *models.RestaurantOutput {
+	return &models.RestaurantOutput{ID: r.ID, Name: r.Name, Lat: r.Lat, Lng: r.Lng}
+}
+
+func (d *dish) output() *models.DishOutput {
+	return &models.DishOutput{ID: d.ID, Name: d.Name, Price: d.Price}
+}
@@ -0,0 +1,152 @@
+package memory_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"github.com/vds/go-resman/pkg/database/databasetest"
+	"github.com/vds/go-resman/pkg/database/memory"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/server"
+	"github.com/vds/go-resman/pkg/testhelpers"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func init() {
+	logger.InitLogger(logrus.ErrorLevel)
+}
+
+func TestMemoryDB(t *testing.T) {
+	databasetest.RunTests(t, memory.NewMemoryDB())
+}
+
+func TestServerWithMemoryDB(t *testing.T) {
+	db := memory.NewMemoryDB()
+	_, err := db.CreateUser(databasetest.Context(), &models.UserReg{
+		Role: middleware.SuperAdmin, Email: "super@test.com", Name: "super", Password: "superPass", Verified: true,
+	})
+	if err != nil {
+		t.Fatalf("can not create superAdmin: %v", err)
+	}
+	svr, err := server.NewServer(db, testhelpers.Config("memory://"))
+	if err != nil {
+		t.Fatalf("can not create new server instance: %v", err)
+	}
+	router, err := svr.Start()
+	if err != nil {
+		t.Fatalf("can not create router: %v", err)
+	}
+
+	data, _ := json.Marshal(&models.Credentials{Role: middleware.SuperAdmin, Email: "super@test.com", Password: "superPass"})
+	request := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(data))
+	request.Header.Add("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+	router.Engine.ServeHTTP(response, request)
+	testhelpers.AssertStatus(t, response.Code, http.StatusOK)
+	var body map[string]string
+	err = json.NewDecoder(response.Body).Decode(&body)
+	if err != nil {
+		t.Fatalf("response is not in appropriate format: %v", err)
+	}
+
+	for _, name := range []string{"carol", "alice", "bob"} {
+		_, err = db.CreateUser(databasetest.Context(), &models.UserReg{
+			Role: middleware.Admin, Email: name + "@test.com", Name: name, Password: "pass",
+		})
+		if err != nil {
+			t.Fatalf("can not create admin: %v", err)
+		}
+	}
+	getAdmins := func(query string) (int, []models.UserOutput, *models.Page) {
+		request := httptest.NewRequest(http.MethodGet, "/manage/admins"+query, nil)
+		request.Header.Add("token", body["token"])
+		response := httptest.NewRecorder()
+		router.Engine.ServeHTTP(response, request)
+		var admins []models.UserOutput
+		page := &models.Page{Data: &admins}
+		_ = json.NewDecoder(response.Body).Decode(page)
+		return response.Code, admins, page
+	}
+
+	status, admins, page := getAdmins("?limit=2&sort=name")
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if page.Total != 3 || len(admins) != 2 || admins[0].Name != "alice" || page.NextCursor == "" {
+		t.Fatalf("unexpected first page %v of %d with cursor %q", admins, page.Total, page.NextCursor)
+	}
+	status, admins, page = getAdmins("?limit=2&sort=name&cursor=" + page.NextCursor)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if page.Total != 3 || len(admins) != 1 || admins[0].Name != "carol" || page.NextCursor != "" {
+		t.Fatalf("unexpected last page %v of %d with cursor %q", admins, page.Total, page.NextCursor)
+	}
+	status, _, _ = getAdmins("?limit=0")
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	status, _, _ = getAdmins("?sort=email")
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+}
+
+func TestRefreshAndRevokeWithMemoryDB(t *testing.T) {
+	db := memory.NewMemoryDB()
+	_, err := db.CreateUser(databasetest.Context(), &models.UserReg{
+		Role: middleware.SuperAdmin, Email: "super@test.com", Name: "super", Password: "superPass", Verified: true,
+	})
+	if err != nil {
+		t.Fatalf("can not create superAdmin: %v", err)
+	}
+	svr, err := server.NewServer(db, testhelpers.Config("memory://"))
+	if err != nil {
+		t.Fatalf("can not create new server instance: %v", err)
+	}
+	router, err := svr.Start()
+	if err != nil {
+		t.Fatalf("can not create router: %v", err)
+	}
+	post := func(path string, in interface{}) (int, map[string]string) {
+		data, _ := json.Marshal(in)
+		request := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(data))
+		request.Header.Add("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		router.Engine.ServeHTTP(response, request)
+		var body map[string]string
+		_ = json.NewDecoder(response.Body).Decode(&body)
+		return response.Code, body
+	}
+	get := func(path, token string) int {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Header.Add("token", token)
+		response := httptest.NewRecorder()
+		router.Engine.ServeHTTP(response, request)
+		return response.Code
+	}
+
+	status, login := post("/login", &models.Credentials{Role: middleware.SuperAdmin, Email: "super@test.com", Password: "superPass"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if login["refreshToken"] == "" {
+		t.Fatalf("login should return a refresh token, got %v", login)
+	}
+	status, refreshed := post("/token/refresh", map[string]string{"refreshToken": login["refreshToken"]})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if refreshed["token"] == "" || refreshed["refreshToken"] == "" || refreshed["refreshToken"] == login["refreshToken"] {
+		t.Fatalf("refresh should rotate the tokens, got %v", refreshed)
+	}
+	testhelpers.AssertStatus(t, get("/manage/admins", refreshed["token"]), http.StatusOK)
+
+	// presenting the first refresh token again ends the whole family
+	status, _ = post("/token/refresh", map[string]string{"refreshToken": login["refreshToken"]})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	status, _ = post("/token/refresh", map[string]string{"refreshToken": refreshed["refreshToken"]})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	status, _ = post("/token/refresh", map[string]string{})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+
+	status, second := post("/login", &models.Credentials{Role: middleware.SuperAdmin, Email: "super@test.com", Password: "superPass"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	testhelpers.AssertStatus(t, get("/logout", second["token"]), http.StatusOK)
+	testhelpers.AssertStatus(t, get("/manage/admins", second["token"]), middleware.StatusTokenInvalid)
+	status, _ = post("/token/refresh", map[string]string{"refreshToken": second["refreshToken"]})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	testhelpers.AssertStatus(t, get("/logout", ""), http.StatusBadRequest)
+}
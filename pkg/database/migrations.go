@@ -0,0 +1,31 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"github.com/vds/go-resman/pkg/models"
+)
+
+// MigrationsTable is the table in which the applied schema version is recorded
+const MigrationsTable = "schema_migrations"
+
+// QueryMigrationStatus pings db and reads the schema version applied to it
+func QueryMigrationStatus(ctx context.Context, db *sql.DB, latest uint) (*models.MigrationStatus, error) {
+	err := db.PingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := &models.MigrationStatus{Latest: latest}
+	var version int64
+	err = db.QueryRowContext(ctx, "select version, dirty from "+MigrationsTable+" limit 1").Scan(&version, &status.Dirty)
+	if err == sql.ErrNoRows {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if version > 0 {
+		status.Version = uint(version)
+	}
+	return status, nil
+}
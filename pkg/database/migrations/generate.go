@@ -0,0 +1,51 @@
+// +build ignore
+
+// generate writes assets.go, which compiles the sql files of every backend directory into the binary.
+// Run it with go generate after adding or changing a migration.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	files, err := filepath.Glob("*/*.sql")
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Strings(files)
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by generate.go; DO NOT EDIT.\n\npackage migrations\n\n")
+	out.WriteString("// assets maps backend/file names to the contents of the migration files\n")
+	out.WriteString("var assets = map[string]string{\n")
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		literal := strconv.Quote(string(content))
+		if !strings.Contains(string(content), "`") {
+			literal = "`" + string(content) + "`"
+		}
+		fmt.Fprintf(&out, "\t%q: %s,\n", filepath.ToSlash(file), literal)
+	}
+	out.WriteString("}\n")
+
+	source, err := format.Source(out.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = ioutil.WriteFile("assets.go", source, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,131 @@
+// Package migrations holds the schema migrations of the sql backends.
+//
+// Every schema change is a pair of numbered files, <version>_<title>.up.sql and
+// <version>_<title>.down.sql, in the directory of each backend. The files are compiled
+// into the binary so the server does not depend on its working directory.
+package migrations
+
+//go:generate go run generate.go
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/golang-migrate/migrate"
+	migratedb "github.com/golang-migrate/migrate/database"
+	"github.com/golang-migrate/migrate/database/mysql"
+	"github.com/golang-migrate/migrate/database/postgres"
+	"github.com/golang-migrate/migrate/database/sqlite3"
+	"github.com/golang-migrate/migrate/source"
+	"github.com/golang-migrate/migrate/source/go_bindata"
+	"github.com/vds/go-resman/pkg/models"
+	"os"
+	"sort"
+	"strings"
+)
+
+// backends with migrations
+const (
+	MySQL    = "mysql"
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+var ErrUnknownBackend = errors.New("no migrations for this database backend")
+
+// Names returns the migration file names of backend in order
+func Names(backend string) []string {
+	names := []string{}
+	for name := range assets {
+		if strings.HasPrefix(name, backend+"/") {
+			names = append(names, strings.TrimPrefix(name, backend+"/"))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Source returns a migration source reading the embedded files of backend
+func Source(backend string) (source.Driver, error) {
+	names := Names(backend)
+	if len(names) == 0 {
+		return nil, ErrUnknownBackend
+	}
+	return bindata.WithInstance(bindata.Resource(names, func(name string) ([]byte, error) {
+		content, ok := assets[backend+"/"+name]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(content), nil
+	}))
+}
+
+// Latest returns the highest version among the migrations of backend
+func Latest(backend string) (uint, error) {
+	src, err := Source(backend)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	version, err := src.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := src.Next(version)
+		if os.IsNotExist(err) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+// New returns a migrate instance applying the migrations of backend to db, closing it closes db
+func New(backend string, db *sql.DB) (*migrate.Migrate, error) {
+	src, err := Source(backend)
+	if err != nil {
+		return nil, err
+	}
+	var driver migratedb.Driver
+	switch backend {
+	case MySQL:
+		driver, err = mysql.WithInstance(db, &mysql.Config{})
+	case Postgres:
+		driver, err = postgres.WithInstance(db, &postgres.Config{})
+	case SQLite:
+		driver, err = sqlite3.WithInstance(db, &sqlite3.Config{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	migration, err := migrate.NewWithInstance("go-bindata", src, "restaurant", driver)
+	if err != nil {
+		return nil, err
+	}
+	migration.Log = &models.MigrationLogger{}
+	return migration, nil
+}
+
+// Up applies the pending migrations of backend to db
+func Up(backend string, db *sql.DB) error {
+	migration, err := New(backend, db)
+	if err != nil {
+		return err
+	}
+
+	migration.Log.Printf("Applying database migrations")
+	err = migration.Up()
+	if err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+
+	version, _, err := migration.Version()
+	if err != nil {
+		return err
+	}
+
+	migration.Log.Printf("Active database version: %d", version)
+	return nil
+}
@@ -0,0 +1,95 @@
+package migrations
+
+import (
+	"database/sql"
+	"github.com/golang-migrate/migrate"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssetsUpToDate(t *testing.T) {
+	files, err := filepath.Glob("*/*.sql")
+	if err != nil {
+		t.Fatalf("can not list migration files: %v", err)
+	}
+	if len(files) != len(assets) {
+		t.Fatalf("got %d embedded migrations for %d files, run go generate", len(assets), len(files))
+	}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("can not read %s: %v", file, err)
+		}
+		if assets[filepath.ToSlash(file)] != string(content) {
+			t.Fatalf("embedded %s is out of date, run go generate", file)
+		}
+	}
+}
+
+func TestEveryUpHasADown(t *testing.T) {
+	var latest []uint
+	for _, backend := range []string{MySQL, Postgres, SQLite} {
+		names := Names(backend)
+		for _, name := range names {
+			if strings.HasSuffix(name, ".up.sql") {
+				down := strings.TrimSuffix(name, ".up.sql") + ".down.sql"
+				if assets[backend+"/"+down] == "" {
+					t.Errorf("%s/%s has no down migration", backend, name)
+				}
+			}
+		}
+		version, err := Latest(backend)
+		if err != nil {
+			t.Fatalf("can not get latest %s migration: %v", backend, err)
+		}
+		latest = append(latest, version)
+	}
+	for _, version := range latest {
+		if version != latest[0] {
+			t.Fatalf("backends should share the schema version, got %v", latest)
+		}
+	}
+}
+
+func TestSqliteUpAndDown(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("can not open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	migration, err := New(SQLite, db)
+	if err != nil {
+		t.Fatalf("can not create migration: %v", err)
+	}
+	latest, _ := Latest(SQLite)
+
+	for _, step := range []func() error{migration.Up, migration.Down, migration.Up} {
+		err = step()
+		if err != nil && err != migrate.ErrNoChange {
+			t.Fatalf("migration failed: %v", err)
+		}
+	}
+	version, dirty, err := migration.Version()
+	if err != nil || dirty || version != latest {
+		t.Fatalf("got version %d dirty %v err %v want version %d", version, dirty, err, latest)
+	}
+	// owners whose creator was purged and deleted accounts sharing an email with a new one roll back
+	_, err = db.Exec("insert into users(id,role,email_id,name,password,status) values" +
+		"('owner','owner','owner@test.com','owner','pass','active')," +
+		"('gone','admin','admin@test.com','gone','pass','deleted')," +
+		"('admin','admin','admin@test.com','admin','pass','active')")
+	if err != nil {
+		t.Fatalf("can not insert users: %v", err)
+	}
+	err = migration.Steps(-int(latest))
+	if err != nil {
+		t.Fatalf("can not roll back every migration: %v", err)
+	}
+	_, _, err = migration.Version()
+	if err != migrate.ErrNilVersion {
+		t.Fatalf("every migration should be rolled back, got %v", err)
+	}
+}
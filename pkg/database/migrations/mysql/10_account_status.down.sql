@@ -0,0 +1,6 @@
+DELETE FROM users WHERE status='deleted';
+ALTER TABLE users DROP KEY role_active_email_id, ADD UNIQUE KEY role_email_id (role, email_id);
+ALTER TABLE users DROP COLUMN active_email_id;
+ALTER TABLE users DROP KEY idx_users_status;
+ALTER TABLE users DROP COLUMN status_changed_at;
+ALTER TABLE users DROP COLUMN status;
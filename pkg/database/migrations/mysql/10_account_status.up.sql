@@ -0,0 +1,8 @@
+-- deleted accounts are kept until they are purged so their restaurants keep a creator, their emails
+-- can be used again right away. mysql has no partial index, the unique key is on a column that is
+-- null for deleted accounts
+ALTER TABLE users ADD COLUMN status varchar(20) NOT NULL DEFAULT 'active';
+ALTER TABLE users ADD COLUMN status_changed_at bigint DEFAULT NULL;
+ALTER TABLE users ADD KEY idx_users_status (status, status_changed_at);
+ALTER TABLE users ADD COLUMN active_email_id varchar(30) GENERATED ALWAYS AS (IF(status='deleted', NULL, email_id)) VIRTUAL;
+ALTER TABLE users DROP KEY role_email_id, ADD UNIQUE KEY role_active_email_id (role, active_email_id);
@@ -0,0 +1,2 @@
+-- argon2id hashes with large parameters are longer than 100 characters
+ALTER TABLE users MODIFY password varchar(255) NOT NULL;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS invalid_tokens;
+DROP TABLE IF EXISTS dishes;
+DROP TABLE IF EXISTS restaurants;
+DROP TABLE IF EXISTS owners;
+DROP TABLE IF EXISTS admins;
+DROP TABLE IF EXISTS super_admins;
@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS super_admins (
+  id varchar(50) NOT NULL,
+  email_id varchar(30) NOT NULL,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY email_id (email_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS admins (
+  id varchar(50) NOT NULL,
+  email_id varchar(30) NOT NULL,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY email_id (email_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS owners (
+  id varchar(50) NOT NULL,
+  email_id varchar(30) DEFAULT NULL,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  creator_id varchar(50) NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY email_id (email_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS restaurants (
+  id int(11) NOT NULL AUTO_INCREMENT,
+  name varchar(50) NOT NULL,
+  lat float(10,6) NOT NULL,
+  lng float(10,6) NOT NULL,
+  creator_id varchar(50) DEFAULT NULL,
+  owner_id varchar(50) DEFAULT NULL,
+  PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS dishes (
+  id int(11) NOT NULL AUTO_INCREMENT,
+  name varchar(30) NOT NULL,
+  price float(7,2) NOT NULL,
+  res_id int(11) NOT NULL,
+  PRIMARY KEY (id),
+  KEY fk_restaurant (res_id),
+  CONSTRAINT fk_restaurant FOREIGN KEY (res_id) REFERENCES restaurants (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS invalid_tokens (
+  token varchar(200) DEFAULT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
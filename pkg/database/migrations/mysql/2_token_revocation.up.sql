@@ -0,0 +1,20 @@
+DROP TABLE IF EXISTS invalid_tokens;
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+  jti varchar(36) NOT NULL,
+  expires_at bigint NOT NULL,
+  PRIMARY KEY (jti),
+  KEY idx_revoked_tokens_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+  id char(64) NOT NULL,
+  family_id varchar(36) NOT NULL,
+  user_id varchar(36) NOT NULL,
+  role varchar(20) NOT NULL,
+  expires_at bigint NOT NULL,
+  used tinyint(1) NOT NULL DEFAULT 0,
+  PRIMARY KEY (id),
+  KEY idx_refresh_tokens_family_id (family_id),
+  KEY idx_refresh_tokens_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
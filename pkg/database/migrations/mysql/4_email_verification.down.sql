@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS email_verification_tokens;
+
+ALTER TABLE super_admins DROP COLUMN verified;
+ALTER TABLE admins DROP COLUMN verified;
+ALTER TABLE owners DROP COLUMN verified;
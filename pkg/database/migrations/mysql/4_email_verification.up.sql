@@ -0,0 +1,17 @@
+-- accounts created before verification existed are trusted
+ALTER TABLE super_admins ADD COLUMN verified tinyint(1) NOT NULL DEFAULT 0;
+ALTER TABLE admins ADD COLUMN verified tinyint(1) NOT NULL DEFAULT 0;
+ALTER TABLE owners ADD COLUMN verified tinyint(1) NOT NULL DEFAULT 0;
+UPDATE super_admins SET verified=1;
+UPDATE admins SET verified=1;
+UPDATE owners SET verified=1;
+
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+  id char(64) NOT NULL,
+  user_id varchar(50) NOT NULL,
+  role varchar(20) NOT NULL,
+  expires_at bigint NOT NULL,
+  PRIMARY KEY (id),
+  KEY idx_email_verification_tokens_user (user_id, role),
+  KEY idx_email_verification_tokens_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS two_factor (
+  user_id varchar(50) NOT NULL,
+  role varchar(20) NOT NULL,
+  secret varchar(64) NOT NULL,
+  enabled tinyint(1) NOT NULL DEFAULT 0,
+  last_step bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (user_id, role)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  id char(64) NOT NULL,
+  user_id varchar(50) NOT NULL,
+  role varchar(20) NOT NULL,
+  PRIMARY KEY (id),
+  KEY idx_recovery_codes_user (user_id, role)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS settings (
+  name varchar(50) NOT NULL,
+  value varchar(255) NOT NULL,
+  PRIMARY KEY (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS login_failures (
+  id varchar(255) NOT NULL,
+  failures int NOT NULL,
+  locked_until bigint NOT NULL DEFAULT 0,
+  expires_at bigint NOT NULL,
+  PRIMARY KEY (id),
+  KEY idx_login_failures_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,38 @@
+-- users of custom roles have no table to go back to and are dropped, owners whose creator was purged
+-- keep a null creator
+CREATE TABLE IF NOT EXISTS super_admins (
+  id varchar(50) NOT NULL,
+  email_id varchar(30) NOT NULL,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  verified tinyint(1) NOT NULL DEFAULT 0,
+  PRIMARY KEY (id),
+  UNIQUE KEY email_id (email_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS admins (
+  id varchar(50) NOT NULL,
+  email_id varchar(30) NOT NULL,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  verified tinyint(1) NOT NULL DEFAULT 0,
+  PRIMARY KEY (id),
+  UNIQUE KEY email_id (email_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS owners (
+  id varchar(50) NOT NULL,
+  email_id varchar(30) DEFAULT NULL,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  creator_id varchar(50) DEFAULT NULL,
+  verified tinyint(1) NOT NULL DEFAULT 0,
+  PRIMARY KEY (id),
+  UNIQUE KEY email_id (email_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+INSERT INTO super_admins SELECT id,email_id,name,password,verified FROM users WHERE role='superAdmin';
+INSERT INTO admins SELECT id,email_id,name,password,verified FROM users WHERE role='admin';
+INSERT INTO owners SELECT id,email_id,name,password,creator_id,verified FROM users WHERE role='owner';
+
+DROP TABLE users;
@@ -0,0 +1,21 @@
+-- the users of every role share one table, custom roles need no schema change
+CREATE TABLE IF NOT EXISTS users (
+  id varchar(50) NOT NULL,
+  role varchar(20) NOT NULL,
+  email_id varchar(30) NOT NULL,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  verified tinyint(1) NOT NULL DEFAULT 0,
+  creator_id varchar(50) DEFAULT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY role_email_id (role, email_id),
+  KEY idx_users_creator_id (creator_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+INSERT INTO users(id,role,email_id,name,password,verified) SELECT id,'superAdmin',email_id,name,password,verified FROM super_admins;
+INSERT INTO users(id,role,email_id,name,password,verified) SELECT id,'admin',email_id,name,password,verified FROM admins;
+INSERT INTO users(id,role,email_id,name,password,verified,creator_id) SELECT id,'owner',email_id,name,password,verified,creator_id FROM owners;
+
+DROP TABLE super_admins;
+DROP TABLE admins;
+DROP TABLE owners;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+  id varchar(50) NOT NULL,
+  hash varchar(64) NOT NULL,
+  prefix varchar(20) NOT NULL,
+  name varchar(50) NOT NULL,
+  user_id varchar(50) NOT NULL,
+  role varchar(20) NOT NULL,
+  permissions varchar(500) NOT NULL,
+  created_at bigint NOT NULL,
+  last_used_at bigint NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY idx_api_keys_hash (hash),
+  KEY idx_api_keys_user (user_id, role)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS sessions (
+  id varchar(50) NOT NULL,
+  user_id varchar(50) NOT NULL,
+  role varchar(20) NOT NULL,
+  device varchar(255) NOT NULL,
+  ip varchar(45) NOT NULL,
+  issued_at bigint NOT NULL,
+  last_seen_at bigint NOT NULL,
+  expires_at bigint NOT NULL,
+  PRIMARY KEY (id),
+  KEY idx_sessions_user (user_id, role)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
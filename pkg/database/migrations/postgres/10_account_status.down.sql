@@ -0,0 +1,6 @@
+DELETE FROM users WHERE status='deleted';
+DROP INDEX IF EXISTS idx_users_role_email;
+ALTER TABLE users ADD CONSTRAINT users_role_email_id_key UNIQUE (role, email_id);
+DROP INDEX IF EXISTS idx_users_status;
+ALTER TABLE users DROP COLUMN IF EXISTS status_changed_at;
+ALTER TABLE users DROP COLUMN IF EXISTS status;
@@ -0,0 +1,7 @@
+-- deleted accounts are kept until they are purged so their restaurants keep a creator, their emails
+-- can be used again right away
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status varchar(20) NOT NULL DEFAULT 'active';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_changed_at bigint DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS idx_users_status ON users (status, status_changed_at);
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_email_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_role_email ON users (role, email_id) WHERE status<>'deleted';
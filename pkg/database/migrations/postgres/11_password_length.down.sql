@@ -0,0 +1,2 @@
+-- fails while a stored hash is longer than 100 characters, those passwords have to be reset first
+ALTER TABLE users ALTER COLUMN password TYPE varchar(100);
@@ -0,0 +1,53 @@
+CREATE EXTENSION IF NOT EXISTS cube;
+CREATE EXTENSION IF NOT EXISTS earthdistance;
+
+CREATE TABLE IF NOT EXISTS super_admins (
+  id varchar(50) NOT NULL,
+  email_id varchar(30) NOT NULL,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE (email_id)
+);
+
+CREATE TABLE IF NOT EXISTS admins (
+  id varchar(50) NOT NULL,
+  email_id varchar(30) NOT NULL,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE (email_id)
+);
+
+CREATE TABLE IF NOT EXISTS owners (
+  id varchar(50) NOT NULL,
+  email_id varchar(30) DEFAULT NULL,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  creator_id varchar(50) NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE (email_id)
+);
+
+CREATE TABLE IF NOT EXISTS restaurants (
+  id serial NOT NULL,
+  name varchar(50) NOT NULL,
+  lat double precision NOT NULL,
+  lng double precision NOT NULL,
+  creator_id varchar(50) DEFAULT NULL,
+  owner_id varchar(50) DEFAULT NULL,
+  PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS dishes (
+  id serial NOT NULL,
+  name varchar(30) NOT NULL,
+  price real NOT NULL,
+  res_id integer NOT NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT fk_restaurant FOREIGN KEY (res_id) REFERENCES restaurants (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS invalid_tokens (
+  token varchar(200) DEFAULT NULL
+);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS revoked_tokens;
+
+CREATE TABLE IF NOT EXISTS invalid_tokens (
+  token varchar(200) DEFAULT NULL
+);
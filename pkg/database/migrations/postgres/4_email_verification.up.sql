@@ -0,0 +1,16 @@
+-- accounts created before verification existed are trusted
+ALTER TABLE super_admins ADD COLUMN IF NOT EXISTS verified boolean NOT NULL DEFAULT false;
+ALTER TABLE admins ADD COLUMN IF NOT EXISTS verified boolean NOT NULL DEFAULT false;
+ALTER TABLE owners ADD COLUMN IF NOT EXISTS verified boolean NOT NULL DEFAULT false;
+UPDATE super_admins SET verified=true;
+UPDATE admins SET verified=true;
+UPDATE owners SET verified=true;
+
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+  id char(64) PRIMARY KEY,
+  user_id varchar(50) NOT NULL,
+  role varchar(20) NOT NULL,
+  expires_at bigint NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_email_verification_tokens_user ON email_verification_tokens (user_id, role);
+CREATE INDEX IF NOT EXISTS idx_email_verification_tokens_expires_at ON email_verification_tokens (expires_at);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS two_factor (
+  user_id varchar(50) NOT NULL,
+  role varchar(20) NOT NULL,
+  secret varchar(64) NOT NULL,
+  enabled boolean NOT NULL DEFAULT false,
+  last_step bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (user_id, role)
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  id char(64) PRIMARY KEY,
+  user_id varchar(50) NOT NULL,
+  role varchar(20) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes (user_id, role);
+
+CREATE TABLE IF NOT EXISTS settings (
+  name varchar(50) PRIMARY KEY,
+  value varchar(255) NOT NULL
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS login_failures (
+  id varchar(255) PRIMARY KEY,
+  failures int NOT NULL,
+  locked_until bigint NOT NULL DEFAULT 0,
+  expires_at bigint NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_login_failures_expires_at ON login_failures (expires_at);
@@ -0,0 +1,38 @@
+-- users of custom roles have no table to go back to and are dropped, owners whose creator was purged
+-- keep a null creator
+CREATE TABLE IF NOT EXISTS super_admins (
+  id varchar(50) NOT NULL,
+  email_id varchar(30) NOT NULL,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  verified boolean NOT NULL DEFAULT false,
+  PRIMARY KEY (id),
+  UNIQUE (email_id)
+);
+
+CREATE TABLE IF NOT EXISTS admins (
+  id varchar(50) NOT NULL,
+  email_id varchar(30) NOT NULL,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  verified boolean NOT NULL DEFAULT false,
+  PRIMARY KEY (id),
+  UNIQUE (email_id)
+);
+
+CREATE TABLE IF NOT EXISTS owners (
+  id varchar(50) NOT NULL,
+  email_id varchar(30) DEFAULT NULL,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  creator_id varchar(50) DEFAULT NULL,
+  verified boolean NOT NULL DEFAULT false,
+  PRIMARY KEY (id),
+  UNIQUE (email_id)
+);
+
+INSERT INTO super_admins SELECT id,email_id,name,password,verified FROM users WHERE role='superAdmin';
+INSERT INTO admins SELECT id,email_id,name,password,verified FROM users WHERE role='admin';
+INSERT INTO owners SELECT id,email_id,name,password,creator_id,verified FROM users WHERE role='owner';
+
+DROP TABLE users;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+  id varchar(50) PRIMARY KEY,
+  hash varchar(64) NOT NULL UNIQUE,
+  prefix varchar(20) NOT NULL,
+  name varchar(50) NOT NULL,
+  user_id varchar(50) NOT NULL,
+  role varchar(20) NOT NULL,
+  permissions varchar(500) NOT NULL,
+  created_at bigint NOT NULL,
+  last_used_at bigint NULL
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys (user_id, role);
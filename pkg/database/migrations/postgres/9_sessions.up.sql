@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS sessions (
+  id varchar(50) PRIMARY KEY,
+  user_id varchar(50) NOT NULL,
+  role varchar(20) NOT NULL,
+  device varchar(255) NOT NULL,
+  ip varchar(45) NOT NULL,
+  issued_at bigint NOT NULL,
+  last_seen_at bigint NOT NULL,
+  expires_at bigint NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions (user_id, role);
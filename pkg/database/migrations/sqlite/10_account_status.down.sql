@@ -0,0 +1,17 @@
+-- sqlite can not drop columns, the users table is rebuilt without the status and deleted accounts are dropped
+DROP INDEX IF EXISTS idx_users_role_email;
+DROP INDEX IF EXISTS idx_users_status;
+CREATE TABLE users_old (
+  id varchar(50) NOT NULL PRIMARY KEY,
+  role varchar(20) NOT NULL,
+  email_id varchar(30) NOT NULL,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  verified boolean NOT NULL DEFAULT false,
+  creator_id varchar(50) DEFAULT NULL,
+  UNIQUE (role, email_id)
+);
+INSERT INTO users_old SELECT id,role,email_id,name,password,verified,creator_id FROM users WHERE status<>'deleted';
+DROP TABLE users;
+ALTER TABLE users_old RENAME TO users;
+CREATE INDEX IF NOT EXISTS idx_users_creator_id ON users (creator_id);
@@ -0,0 +1,19 @@
+-- deleted accounts are kept until they are purged so their restaurants keep a creator, their emails
+-- can be used again right away. sqlite can not drop the unique constraint, the users table is rebuilt
+CREATE TABLE users_new (
+  id varchar(50) NOT NULL PRIMARY KEY,
+  role varchar(20) NOT NULL,
+  email_id varchar(30) NOT NULL,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  verified boolean NOT NULL DEFAULT false,
+  creator_id varchar(50) DEFAULT NULL,
+  status varchar(20) NOT NULL DEFAULT 'active',
+  status_changed_at bigint DEFAULT NULL
+);
+INSERT INTO users_new(id,role,email_id,name,password,verified,creator_id) SELECT id,role,email_id,name,password,verified,creator_id FROM users;
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+CREATE INDEX IF NOT EXISTS idx_users_creator_id ON users (creator_id);
+CREATE INDEX IF NOT EXISTS idx_users_status ON users (status, status_changed_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_role_email ON users (role, email_id) WHERE status<>'deleted';
@@ -0,0 +1,2 @@
+-- sqlite does not enforce the length of varchar columns, only the schema version changes
+SELECT 1;
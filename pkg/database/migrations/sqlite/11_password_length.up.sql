@@ -0,0 +1,3 @@
+-- argon2id hashes with large parameters are longer than 100 characters, sqlite does not enforce the
+-- length of varchar columns so only the schema version changes
+SELECT 1;
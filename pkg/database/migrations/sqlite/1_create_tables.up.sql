@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS super_admins (
+  id varchar(50) NOT NULL PRIMARY KEY,
+  email_id varchar(30) NOT NULL UNIQUE,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS admins (
+  id varchar(50) NOT NULL PRIMARY KEY,
+  email_id varchar(30) NOT NULL UNIQUE,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS owners (
+  id varchar(50) NOT NULL PRIMARY KEY,
+  email_id varchar(30) DEFAULT NULL UNIQUE,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  creator_id varchar(50) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS restaurants (
+  id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  name varchar(50) NOT NULL,
+  lat real NOT NULL,
+  lng real NOT NULL,
+  creator_id varchar(50) DEFAULT NULL,
+  owner_id varchar(50) DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS dishes (
+  id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  name varchar(30) NOT NULL,
+  price real NOT NULL,
+  res_id integer NOT NULL REFERENCES restaurants (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS invalid_tokens (
+  token varchar(200) DEFAULT NULL
+);
@@ -0,0 +1,18 @@
+DROP TABLE IF EXISTS invalid_tokens;
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+  jti varchar(36) PRIMARY KEY,
+  expires_at bigint NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+  id char(64) PRIMARY KEY,
+  family_id varchar(36) NOT NULL,
+  user_id varchar(36) NOT NULL,
+  role varchar(20) NOT NULL,
+  expires_at bigint NOT NULL,
+  used boolean NOT NULL DEFAULT false
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires_at ON refresh_tokens (expires_at);
@@ -0,0 +1,33 @@
+DROP TABLE IF EXISTS email_verification_tokens;
+
+-- sqlite can not drop columns, the user tables are rebuilt without verified
+CREATE TABLE super_admins_old (
+  id varchar(50) NOT NULL PRIMARY KEY,
+  email_id varchar(30) NOT NULL UNIQUE,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL
+);
+INSERT INTO super_admins_old SELECT id,email_id,name,password FROM super_admins;
+DROP TABLE super_admins;
+ALTER TABLE super_admins_old RENAME TO super_admins;
+
+CREATE TABLE admins_old (
+  id varchar(50) NOT NULL PRIMARY KEY,
+  email_id varchar(30) NOT NULL UNIQUE,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL
+);
+INSERT INTO admins_old SELECT id,email_id,name,password FROM admins;
+DROP TABLE admins;
+ALTER TABLE admins_old RENAME TO admins;
+
+CREATE TABLE owners_old (
+  id varchar(50) NOT NULL PRIMARY KEY,
+  email_id varchar(30) DEFAULT NULL UNIQUE,
+  name varchar(25) NOT NULL,
+  password varchar(100) NOT NULL,
+  creator_id varchar(50) DEFAULT NULL
+);
+INSERT INTO owners_old SELECT id,email_id,name,password,creator_id FROM owners;
+DROP TABLE owners;
+ALTER TABLE owners_old RENAME TO owners;
@@ -3,113 +3,120 @@ package mysql
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"fmt"
-	_ "github.com/go-sql-driver/mysql"
+	driver "github.com/go-sql-driver/mysql"
 	"github.com/golang-migrate/migrate"
-	"github.com/golang-migrate/migrate/database/mysql"
-	_ "github.com/golang-migrate/migrate/source/file"
 	"github.com/google/uuid"
+	"github.com/vds/go-resman/pkg/config"
 	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/database/migrations"
 	"github.com/vds/go-resman/pkg/encryption"
 	"github.com/vds/go-resman/pkg/logger"
 	"github.com/vds/go-resman/pkg/middleware"
 	"github.com/vds/go-resman/pkg/models"
 	"log"
-	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
-	SuperAdminTable               = "super_admins"
-	AdminTable                    = "admins"
-	OwnerTable                    = "owners"
-	InsertUser                    = "insert into %s(id,email_id,name,password) values(?,?,?,?)"
-	GetUserIDPassword             = "select id,password from %s where email_id=?"
-	GetOwnersForSuperAdmin        = "select JSON_ARRAYAGG(JSON_OBJECT('id',id,'email',email_id,'name', name)) from owners order by id"
-	InsertOwner                   = "insert into owners(id,email_id,name,password,creator_id) values(?,?,?,?,?)"
-	OwnerUpdate                   = "update owners set email_id=?,name=? where id=?"
-	SelectRestaurantsForSuper     = "select JSON_ARRAYAGG(JSON_OBJECT('id',id,'name',name, 'lat',lat,'lng',lng)) from restaurants order by id"
-	SelectRestaurantsForAdmin     = "select JSON_ARRAYAGG(JSON_OBJECT('id',id,'name', name, 'lat',lat,'lng',lng)) from restaurants  where creator_id=? order by id"
-	SelectRestaurantsForOwner     = "select JSON_ARRAYAGG(JSON_OBJECT('id',id,'name', name, 'lat',lat,'lng',lng)) from restaurants  where owner_id=? order by id"
+	UserTable                     = "users"
+	InsertUser                    = "insert into users(id,role,email_id,name,password,verified) values(?,?,?,?,?,?)"
+	GetUserIDPassword             = "select id,password,verified,status from users where role=? and email_id=? and " + database.NotDeletedCondition
+	RehashPassword                = "update users set password=? where id=? and password=?"
+	UserColumns                   = "id,email_id,name,role,status"
+	RestaurantColumns             = "id,name,lat,lng"
+	InsertOwner                   = "insert into users(id,role,email_id,name,password,creator_id,verified) values(?,?,?,?,?,?,?)"
+	OwnerUpdate                   = "update users set email_id=?,name=? where id=? and role=? and " + database.NotDeletedCondition
 	InsertRestaurant              = "insert into restaurants(name,lat,lng,creator_id) values(?,?,?,?)"
 	RestaurantUpdate              = "update restaurants set name=?,lat=?,lng=? where id=?"
 	CheckRestaurantOwner          = "select owner_id from restaurants where id=?"
 	CheckRestaurantCreator        = "select creator_id from restaurants where id=?"
 	CheckRestaurantDish           = "select res_id from dishes where id=?"
-	DeleteOwnerBySuperAdmin       = "delete from owners where id=?"
-	DeleteOwnerByAdmin            = "delete from owners where id=? and creator_id=?"
+	DeleteOwnerBySuperAdmin       = "update users set status='" + models.StatusDeleted + "',status_changed_at=? where id=? and role=? and " + database.NotDeletedCondition
+	DeleteOwnerByAdmin            = "update users set status='" + models.StatusDeleted + "',status_changed_at=? where id=? and role=? and creator_id=? and " + database.NotDeletedCondition
 	DeleteRestaurantsBySuperAdmin = "delete from restaurants where id=?"
 	DeleteRestaurantsByAdmin      = "delete from restaurants where id=? and creator_id=?"
 	DeleteDishes                  = "delete from dishes where id=?"
+	// SelectUsableAPIKey selects the api key with a hash if the account of its user is active
+	SelectUsableAPIKey = "select k.id,k.name,k.prefix,k.user_id,k.role,k.permissions,k.created_at,k.last_used_at from api_keys k " +
+		"join users u on u.id=k.user_id and u.role=k.role where k.hash=? and u.status='" + models.StatusActive + "'"
 )
 
 type MySqlDB struct {
-	*sql.DB
+	database.Conn
+	latestMigration uint
+	hasher          encryption.PasswordHasher
 }
 
-func NewMySqlDB(dbUrl string) (*MySqlDB, error) {
-	////for docker servicename:3306 e.g. database:3306
-	//serverName := "localhost:3306"
-	//user := "root"
-	//password := "password"
-	//connectionString := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&collation=utf8mb4_unicode_ci&parseTime=true&multiStatements=true", user, password, serverName, dbName)
-	db, err := sql.Open("mysql", dbUrl)
+// NewMySqlDB connects to the configured data source name, an optional mysql:// prefix is ignored.
+// Pending migrations are applied unless cfg.SkipMigrate is set
+func NewMySqlDB(cfg *config.Database) (*MySqlDB, error) {
+	db, err := open(cfg)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
-	err = migrateDatabase(db)
+	if !cfg.SkipMigrate {
+		err = migrations.Up(migrations.MySQL, db)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+	}
+	latest, err := migrations.Latest(migrations.MySQL)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
-	mySqlDB := &MySqlDB{DB:db}
+	mySqlDB := &MySqlDB{Conn: database.Conn{DB: db}, latestMigration: latest, hasher: encryption.DefaultPasswordHasher()}
 	return mySqlDB, err
 }
 
-func (db *MySqlDB) ShowNearBy(ctx context.Context, location *models.Location) (string, error) {
+func (db *MySqlDB) SetPasswordHasher(hasher encryption.PasswordHasher) {
+	db.hasher = hasher
+}
+
+func (db *MySqlDB) ShowNearBy(ctx context.Context, location *models.Location) ([]models.RestaurantOutput, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
 	logger.LogDebug(reqId, reqUrl, "executing GetNearByRestaurant query")
-	var result sql.NullString
-	rows, err := db.Query("select JSON_ARRAYAGG(JSON_OBJECT('id',id,'name',name, 'lat',lat,'lng',lng)) from restaurants where ST_Distance_Sphere(point(lat,lng),point(?,?))/1000 < 10", location.Lat, location.Lng)
-	defer rows.Close()
+	rows, err := db.Query("select id,name,lat,lng from restaurants where ST_Distance_Sphere(point(lat,lng),point(?,?))/1000 < ? order by id", location.Lat, location.Lng, database.NearByRadius)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return "", database.ErrInternal
+		return nil, database.ErrInternal
 	}
-	rows.Next()
-	err = rows.Scan(&result)
+	defer rows.Close()
+
+	result, err := database.ScanRestaurants(rows)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
-		return "", database.ErrInternal
+		return nil, database.ErrInternal
 	}
 	logger.LogInfo(reqId, reqUrl, "getNearBy restaurant from db successful", 0)
-	return result.String, nil
+	return result, nil
 }
 
 func (db *MySqlDB) CreateUser(ctx context.Context, user *models.UserReg) (string, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
 	logger.LogDebug(reqId, reqUrl, "executing createUser query")
-	var tableName string
-	switch user.Role {
-	case middleware.Admin:
-		tableName = AdminTable
-	case middleware.SuperAdmin:
-		tableName = SuperAdminTable
+	// owners are created with their creator by CreateOwner
+	if user.Role == "" || user.Role == middleware.Owner {
+		return "", database.ErrInternal
 	}
-	stmt, err := db.Prepare(fmt.Sprintf(InsertUser, tableName))
+	stmt, err := db.Prepare(InsertUser)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
 		return "", database.ErrInternal
 	}
 	logger.LogDebug(reqId, reqUrl, "generating password hash")
-	pass, err := encryption.GenerateHash(user.Password)
+	pass, err := encryption.GenerateHash(db.hasher, user.Password)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in generating password hash: %v", err), 0)
 		return "", database.ErrInternal
 	}
 	id := uuid.New().String()
-	_, err = stmt.Exec(id, user.Email, user.Name, pass)
+	_, err = stmt.Exec(id, user.Role, user.Email, user.Name, pass, user.Verified)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
 		return "", database.ErrDupEmail
@@ -121,48 +128,85 @@ func (db *MySqlDB) CreateUser(ctx context.Context, user *models.UserReg) (string
 func (db *MySqlDB) LogInUser(ctx context.Context, cred *models.Credentials) (string, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
 	logger.LogDebug(reqId, reqUrl, "logging in user")
-	var tableName string
-	switch cred.Role {
-	case middleware.Admin:
-		tableName = AdminTable
-	case middleware.SuperAdmin:
-		tableName = SuperAdminTable
-	case middleware.Owner:
-		tableName = OwnerTable
-	}
 	var id string
 	var pass string
-	rows, err := db.Query(fmt.Sprintf(GetUserIDPassword, tableName), cred.Email)
+	var verified bool
+	var status string
+	rows, err := db.Query(GetUserIDPassword, cred.Role, cred.Email)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
 		return "", database.ErrInternal
 	}
 	defer rows.Close()
 	rows.Next()
-	err = rows.Scan(&id, &pass)
+	err = rows.Scan(&id, &pass, &verified, &status)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
 		return "", database.ErrInvalidCredentials
 	}
 	logger.LogDebug(reqId, reqUrl, "comparing passwords")
-	isValid := encryption.ComparePasswords(ctx, pass, cred.Password)
+	isValid := encryption.ComparePasswords(ctx, db.hasher, pass, cred.Password)
 	if !isValid {
 		return "", database.ErrInvalidCredentials
 	}
+	if status == models.StatusSuspended {
+		logger.LogError(reqId, reqUrl, "account of user is suspended", 0)
+		return "", database.ErrAccountSuspended
+	}
+	if !verified {
+		logger.LogError(reqId, reqUrl, "email of user is not verified", 0)
+		return "", database.ErrUnverifiedEmail
+	}
+	if db.hasher.NeedsRehash(pass) {
+		db.rehashPassword(ctx, id, pass, cred.Password)
+	}
 
 	logger.LogInfo(reqId, reqUrl, "login credentials verified from db", 0)
 	return id, nil
 }
 
-func (db *MySqlDB) ShowOwners(ctx context.Context, userAuth *models.UserAuth) (string, error) {
+// rehashPassword replaces the hash of a user who just logged in with a hash of the current hasher,
+// a failure only leaves the old hash in place
+func (db *MySqlDB) rehashPassword(ctx context.Context, id string, oldHash string, password string) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	logger.LogInfo(reqId, reqUrl, "selecting function to show owners according to role", 0)
-	if userAuth.Role == middleware.SuperAdmin {
-		return showOwnersForSuperAdmin(ctx, db)
-	} else if userAuth.Role == middleware.Admin {
-		return showOwnersForAdmin(ctx, db, userAuth.ID)
+	logger.LogDebug(reqId, reqUrl, "rehashing password of user")
+	hash, err := encryption.GenerateHash(db.hasher, password)
+	if err == nil {
+		_, err = db.ExecContext(ctx, RehashPassword, hash, id, oldHash)
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not rehash password: %v", err), 0)
 	}
-	return "", database.ErrInternal
+}
+
+func (db *MySqlDB) ShowOwners(ctx context.Context, userAuth *models.UserAuth, opts *models.ListOptions) ([]models.UserOutput, int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogInfo(reqId, reqUrl, "selecting owners to show according to scope", 0)
+	conditions := []string{"role=?"}
+	args := []interface{}{middleware.Owner}
+	switch userAuth.Scope {
+	case models.ScopeAll:
+	case models.ScopeCreated:
+		conditions = append(conditions, "creator_id=?")
+		args = append(args, userAuth.ID)
+	default:
+		return nil, 0, database.ErrInternal
+	}
+	statusCondition, statusArgs := database.StatusCondition(opts)
+	conditions = append(conditions, statusCondition)
+	args = append(args, statusArgs...)
+	logger.LogDebug(reqId, reqUrl, "executing query to get owners")
+	query, countQuery, queryArgs, countArgs := database.ListQueries(UserColumns, UserTable, conditions, args, opts)
+	total, err := countRows(ctx, db, countQuery, countArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	result, err := listUsers(ctx, db, query, queryArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	logger.LogInfo(reqId, reqUrl, "owners retrieved from db successfully", 0)
+	return result, total, nil
 }
 
 func (db *MySqlDB) CreateOwner(ctx context.Context, creatorID string, owner *models.OwnerReg) (*models.UserOutput, error) {
@@ -174,20 +218,20 @@ func (db *MySqlDB) CreateOwner(ctx context.Context, creatorID string, owner *mod
 		return nil, database.ErrInternal
 	}
 	logger.LogDebug(reqId, reqUrl, "generating password hash")
-	pass, err := encryption.GenerateHash(owner.Password)
+	pass, err := encryption.GenerateHash(db.hasher, owner.Password)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in generating hash of password: %v", err), 0)
 		return nil, database.ErrInternal
 	}
 	id := uuid.New().String()
-	_, err = stmt.Exec(id, owner.Email, owner.Name, pass, creatorID)
+	_, err = stmt.Exec(id, middleware.Owner, owner.Email, owner.Name, pass, creatorID, owner.Verified)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
 		return nil, database.ErrDupEmail
 	}
 	logger.LogDebug(reqId, reqUrl, "fetching created owner")
 	var result models.UserOutput
-	rows, err := db.Query("select id,name,email_id from owners where email_id=?", owner.Email)
+	rows, err := db.Query("select id,name,email_id,role,status from users where id=?", id)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
 		return nil, database.ErrInternal
@@ -195,7 +239,7 @@ func (db *MySqlDB) CreateOwner(ctx context.Context, creatorID string, owner *mod
 	defer rows.Close()
 
 	rows.Next()
-	err = rows.Scan(&result.ID, &result.Name, &result.Email)
+	err = rows.Scan(&result.ID, &result.Name, &result.Email, &result.Role, &result.Status)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
 		return nil, database.ErrInternal
@@ -204,33 +248,28 @@ func (db *MySqlDB) CreateOwner(ctx context.Context, creatorID string, owner *mod
 	return &result, nil
 }
 
-func (db *MySqlDB) ShowAdmins(ctx context.Context) (string, error) {
+func (db *MySqlDB) ShowAdmins(ctx context.Context, opts *models.ListOptions) ([]models.UserOutput, int, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	var result sql.NullString
 	logger.LogDebug(reqId, reqUrl, "executing query to get admins")
-	rows, err := db.Query("select JSON_ARRAYAGG(JSON_OBJECT('id',id,'email',email_id,'name', name)) from admins")
+	statusCondition, args := database.StatusCondition(opts)
+	query, countQuery, queryArgs, countArgs := database.ListQueries(UserColumns, UserTable, []string{database.AdminsCondition, statusCondition}, args, opts)
+	total, err := countRows(ctx, db, countQuery, countArgs...)
 	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return "", database.ErrInternal
+		return nil, 0, err
 	}
-	defer rows.Close()
-
-	rows.Next()
-	err = rows.Scan(&result)
+	result, err := listUsers(ctx, db, query, queryArgs...)
 	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
-		return "", database.ErrInternal
+		return nil, 0, err
 	}
-
 	logger.LogInfo(reqId, reqUrl, "get admins from db successful", 0)
-	return result.String, nil
+	return result, total, nil
 }
 
 func (db *MySqlDB) CheckAdmin(ctx context.Context, adminID string) error {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
 	var count int
 	logger.LogDebug(reqId, reqUrl, "executing query to check if admin exist")
-	rows, err := db.Query("select count(*) from admins where id=?", adminID)
+	rows, err := db.Query("select count(*) from users where id=? and "+database.AdminsCondition+" and "+database.NotDeletedCondition, adminID)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
 		return database.ErrInternal
@@ -251,48 +290,41 @@ func (db *MySqlDB) CheckAdmin(ctx context.Context, adminID string) error {
 	logger.LogInfo(reqId, reqUrl, "admin id verified from db", 0)
 	return nil
 }
-func (db *MySqlDB) UpdateAdmin(ctx context.Context, admin *models.UserOutput) (string, error) {
+func (db *MySqlDB) UpdateAdmin(ctx context.Context, admin *models.UserOutput) (*models.UserOutput, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
 	logger.LogDebug(reqId, reqUrl, "executing query to update an admin")
-	stmt, err := db.Prepare("update admins set email_id=?,name=? where id=?")
+	stmt, err := db.Prepare("update users set email_id=?,name=? where id=? and " + database.AdminsCondition + " and " + database.NotDeletedCondition)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in preparing query statement: %v", err), 0)
-		return "", err
+		return nil, err
 	}
 	_, err = stmt.Exec(admin.Email, admin.Name, admin.ID)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return "", err
+		return nil, err
 	}
 	logger.LogDebug(reqId, reqUrl, "executing query to fetch updated admin")
-	var result sql.NullString
-	rows, err := db.Query("select JSON_OBJECT('id',id,'email',email_id,'name', name) from admins where id=?", admin.ID)
-	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return "", err
-	}
-	defer rows.Close()
-
-	rows.Next()
-	err = rows.Scan(&result)
+	var result models.UserOutput
+	err = db.QueryRow("select "+UserColumns+" from users where id=? and "+database.AdminsCondition+" and "+database.NotDeletedCondition, admin.ID).Scan(&result.ID, &result.Email, &result.Name, &result.Role, &result.Status)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
-		return "", err
+		return nil, err
 	}
 	logger.LogInfo(reqId, reqUrl, "admin updated in db successfully", 0)
-	return result.String, nil
+	return &result, nil
 }
 func (db *MySqlDB) RemoveAdmins(ctx context.Context, adminIDs ...string) error {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
 	var ErrEntries []int
 	logger.LogDebug(reqId, reqUrl, "executing query to delete admin")
-	stmt, err := db.Prepare("delete from admins where id=?")
+	stmt, err := db.Prepare("update users set status='" + models.StatusDeleted + "',status_changed_at=? where id=? and " + database.AdminsCondition + " and " + database.NotDeletedCondition)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in preparing statement: %v", err), 0)
 		return database.ErrInternal
 	}
+	now := time.Now().Unix()
 	for i, id := range adminIDs {
-		result, err := stmt.Exec(id)
+		result, err := stmt.Exec(now, id)
 		if err != nil {
 			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
 			return database.ErrInternal
@@ -300,11 +332,17 @@ func (db *MySqlDB) RemoveAdmins(ctx context.Context, adminIDs ...string) error {
 		numDeletedRows, _ := result.RowsAffected()
 		if numDeletedRows == 0 {
 			ErrEntries = append(ErrEntries, i)
+			continue
+		}
+		err = endSessions(ctx, db.Conn, id)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
 		}
 	}
 	length := len(ErrEntries)
 	if length != 0 {
-		return sendErrorMessage(ctx, ErrEntries, length, "Admins")
+		return database.SendErrorMessage(ctx, ErrEntries, length, "Admins")
 	}
 	logger.LogInfo(reqId, reqUrl, "admin deleted in db successfully", 0)
 	return nil
@@ -312,9 +350,9 @@ func (db *MySqlDB) RemoveAdmins(ctx context.Context, adminIDs ...string) error {
 
 func (db *MySqlDB) CheckOwnerCreator(ctx context.Context, creatorID string, ownerID string) error {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	var creatorIDOut string
+	var creatorIDOut sql.NullString
 	logger.LogDebug(reqId, reqUrl, "executing query to verify owner creator")
-	rows, err := db.Query("select creator_id from owners where id=?", ownerID)
+	rows, err := db.Query("select creator_id from users where id=? and role=? and "+database.NotDeletedCondition, ownerID, middleware.Owner)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
 		return database.ErrInternal
@@ -327,57 +365,49 @@ func (db *MySqlDB) CheckOwnerCreator(ctx context.Context, creatorID string, owne
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
 		return database.ErrInvalidOwner
 	}
-	if creatorIDOut != creatorID {
+	if creatorIDOut.String != creatorID {
 		return database.ErrInvalidOwnerCreator
 	}
 	logger.LogInfo(reqId, reqUrl, "owner creator verified from db", 0)
 	return nil
 }
 
-func (db *MySqlDB) UpdateOwner(ctx context.Context, owner *models.UserOutput) (string, error) {
+func (db *MySqlDB) UpdateOwner(ctx context.Context, owner *models.UserOutput) (*models.UserOutput, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
 	logger.LogDebug(reqId, reqUrl, "checking that owner exist")
 	isValidOwnerID := CheckOwnerID(ctx, db, owner.ID)
 	if !isValidOwnerID {
-		return "", database.ErrInvalidOwner
+		return nil, database.ErrInvalidOwner
 	}
 	logger.LogDebug(reqId, reqUrl, "executing query to update owner")
 	stmt, err := db.Prepare(OwnerUpdate)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in preparing statement: %v", err), 0)
-		return "", database.ErrInternal
+		return nil, database.ErrInternal
 	}
-	_, err = stmt.Exec(owner.Email, owner.Name, owner.ID)
+	_, err = stmt.Exec(owner.Email, owner.Name, owner.ID, middleware.Owner)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return "", database.ErrDupEmail
+		return nil, database.ErrDupEmail
 	}
 	logger.LogDebug(reqId, reqUrl, "fetching updated owner")
-	var result sql.NullString
-	rows, err := db.Query("select JSON_OBJECT('id',id,'email',email_id,'name', name) from owners where id=?", owner.ID)
-	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return "", database.ErrInternal
-	}
-	defer rows.Close()
-
-	rows.Next()
-	err = rows.Scan(&result)
+	var result models.UserOutput
+	err = db.QueryRow("select "+UserColumns+" from users where id=? and role=? and "+database.NotDeletedCondition, owner.ID, middleware.Owner).Scan(&result.ID, &result.Email, &result.Name, &result.Role, &result.Status)
 	if err != nil {
-		log.Printf("%v", err)
-		return "", database.ErrInternal
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		return nil, database.ErrInternal
 	}
 	logger.LogInfo(reqId, reqUrl, "owner updated in db successfully", 0)
-	return result.String, nil
+	return &result, nil
 }
 
 func (db *MySqlDB) RemoveOwners(ctx context.Context, userAuth *models.UserAuth, ownerIDs ...string) error {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	logger.LogInfo(reqId, reqUrl, "selecting  owner delete function as per role", 0)
-	switch userAuth.Role {
-	case middleware.SuperAdmin:
+	logger.LogInfo(reqId, reqUrl, "selecting  owner delete function as per scope", 0)
+	switch userAuth.Scope {
+	case models.ScopeAll:
 		return removeOwnersBySuperAdmin(ctx, db, ownerIDs...)
-	case middleware.Admin:
+	case models.ScopeCreated:
 		return removeOwnersByAdmin(ctx, db, userAuth.ID, ownerIDs...)
 	}
 	return database.ErrInternal
@@ -385,18 +415,42 @@ func (db *MySqlDB) RemoveOwners(ctx context.Context, userAuth *models.UserAuth,
 
 //restaurants
 
-func (db *MySqlDB) ShowRestaurants(ctx context.Context, userAuth *models.UserAuth) (string, error) {
+func (db *MySqlDB) ShowRestaurants(ctx context.Context, userAuth *models.UserAuth, opts *models.ListOptions) ([]models.RestaurantOutput, int, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	logger.LogInfo(reqId, reqUrl, "selecting  show restaurant function as per role", 0)
-	switch userAuth.Role {
-	case middleware.SuperAdmin:
-		return showRestaurantsForSuper(ctx, db)
-	case middleware.Admin:
-		return showRestaurantsForAdmin(ctx, db, userAuth.ID)
-	case middleware.Owner:
-		return showRestaurantsForOwner(ctx, db, userAuth.ID)
+	logger.LogInfo(reqId, reqUrl, "selecting restaurants to show as per scope", 0)
+	var conditions []string
+	var args []interface{}
+	switch userAuth.Scope {
+	case models.ScopeAll:
+	case models.ScopeCreated:
+		conditions = append(conditions, "creator_id=?")
+		args = append(args, userAuth.ID)
+	case models.ScopeOwned:
+		conditions = append(conditions, "owner_id=?")
+		args = append(args, userAuth.ID)
+	default:
+		return nil, 0, database.ErrInternal
+	}
+	logger.LogDebug(reqId, reqUrl, "executing query to get restaurants")
+	query, countQuery, queryArgs, countArgs := database.ListQueries(RestaurantColumns, "restaurants", conditions, args, opts)
+	total, err := countRows(ctx, db, countQuery, countArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := db.QueryContext(ctx, query, queryArgs...)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, 0, database.ErrInternal
+	}
+	defer rows.Close()
+
+	result, err := database.ScanRestaurants(rows)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		return nil, 0, database.ErrInternal
 	}
-	return "", database.ErrInternal
+	logger.LogInfo(reqId, reqUrl, "restaurants retrieved from db successfully", 0)
+	return result, total, nil
 }
 
 func (db *MySqlDB) InsertRestaurant(ctx context.Context, restaurant *models.Restaurant) (*models.RestaurantOutput, error) {
@@ -433,7 +487,7 @@ func (db *MySqlDB) InsertRestaurant(ctx context.Context, restaurant *models.Rest
 
 func (db *MySqlDB) CheckRestaurantCreator(ctx context.Context, creatorID string, resID int) error {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	var creatorIDOut string
+	var creatorIDOut sql.NullString
 	logger.LogDebug(reqId, reqUrl, "executing query to check restaurant creator")
 	rows, err := db.Query(CheckRestaurantCreator, resID)
 	if err != nil {
@@ -448,7 +502,7 @@ func (db *MySqlDB) CheckRestaurantCreator(ctx context.Context, creatorID string,
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
 		return database.ErrNonExistingRestaurant
 	}
-	if creatorIDOut != creatorID {
+	if creatorIDOut.String != creatorID {
 		logger.LogError(reqId, reqUrl, "error invalid creator", 0)
 		return database.ErrInvalidRestaurantCreator
 	}
@@ -496,26 +550,26 @@ func (db *MySqlDB) UpdateRestaurant(ctx context.Context, restaurant *models.Rest
 
 func (db *MySqlDB) RemoveRestaurants(ctx context.Context, userAuth *models.UserAuth, resIDs ...int) error {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	logger.LogDebug(reqId, reqUrl, "selecting function to delete restaurant according to role")
-	switch userAuth.Role {
-	case middleware.SuperAdmin:
+	logger.LogDebug(reqId, reqUrl, "selecting function to delete restaurant according to scope")
+	switch userAuth.Scope {
+	case models.ScopeAll:
 		return removeRestaurantsBySuperAdmin(ctx, db, resIDs...)
-	case middleware.Admin:
+	case models.ScopeCreated:
 		return removeRestaurantsByAdmin(ctx, db, userAuth.ID, resIDs...)
 	}
 	return database.ErrInternal
 }
 
-func (db *MySqlDB) ShowAvailableRestaurants(ctx context.Context, userAuth *models.UserAuth) (string, error) {
+func (db *MySqlDB) ShowAvailableRestaurants(ctx context.Context, userAuth *models.UserAuth) ([]models.RestaurantOutput, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	logger.LogDebug(reqId, reqUrl, "executing query to show available restaurant according to role")
-	switch userAuth.Role {
-	case middleware.SuperAdmin:
+	logger.LogDebug(reqId, reqUrl, "executing query to show available restaurant according to scope")
+	switch userAuth.Scope {
+	case models.ScopeAll:
 		return showAvailableRestaurantsForSuper(ctx, db)
-	case middleware.Admin:
+	case models.ScopeCreated:
 		return showAvailableRestaurantsForAdmin(ctx, db, userAuth.ID)
 	}
-	return "", database.ErrInternal
+	return nil, database.ErrInternal
 }
 
 func (db *MySqlDB) InsertOwnerForRestaurants(ctx context.Context, userAuth *models.UserAuth, ownerID string, resIDs ...int) error {
@@ -532,7 +586,7 @@ func (db *MySqlDB) InsertOwnerForRestaurants(ctx context.Context, userAuth *mode
 		return database.ErrInternal
 	}
 	for i, id := range resIDs {
-		if userAuth.Role != middleware.SuperAdmin {
+		if userAuth.Scope != models.ScopeAll {
 			err = db.CheckRestaurantCreator(ctx, userAuth.ID, id)
 			if err != nil {
 				ErrEntries = append(ErrEntries, i)
@@ -547,7 +601,7 @@ func (db *MySqlDB) InsertOwnerForRestaurants(ctx context.Context, userAuth *mode
 	}
 	length := len(ErrEntries)
 	if length != 0 {
-		return sendErrorMessage(ctx, ErrEntries, length, "Restaurants")
+		return database.SendErrorMessage(ctx, ErrEntries, length, "Restaurants")
 	}
 	logger.LogInfo(reqId, reqUrl, "owner assigned for the requested restaurants in db successfully", 0)
 	return nil
@@ -567,7 +621,7 @@ func (db *MySqlDB) RemoveOwnerForRestaurants(ctx context.Context, userAuth *mode
 		return database.ErrInternal
 	}
 	for i, id := range resIDs {
-		if userAuth.Role != middleware.SuperAdmin {
+		if userAuth.Scope != models.ScopeAll {
 			err = db.CheckRestaurantCreator(ctx, userAuth.ID, id)
 			if err != nil {
 				ErrEntries = append(ErrEntries, i)
@@ -582,7 +636,7 @@ func (db *MySqlDB) RemoveOwnerForRestaurants(ctx context.Context, userAuth *mode
 	}
 	length := len(ErrEntries)
 	if length != 0 {
-		return sendErrorMessage(ctx, ErrEntries, length, "Restaurants")
+		return database.SendErrorMessage(ctx, ErrEntries, length, "Restaurants")
 	}
 	logger.LogInfo(reqId, reqUrl, "owner removed of the requested restaurants in db successfully", 0)
 	return nil
@@ -613,29 +667,32 @@ func (db *MySqlDB) CheckRestaurantOwner(ctx context.Context, ownerID string, res
 	logger.LogInfo(reqId, reqUrl, "restaurant owner validated from db successfully", 0)
 	return nil
 }
-func (db *MySqlDB) ShowMenu(ctx context.Context, resID int) (string, error) {
+func (db *MySqlDB) ShowMenu(ctx context.Context, resID int, opts *models.ListOptions) ([]models.DishOutput, int, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
 	logger.LogDebug(reqId, reqUrl, "executing query to get menu")
 	isValidRestaurant := CheckRestaurantID(ctx, db, resID)
 	if !isValidRestaurant {
-		return "", database.ErrNonExistingRestaurant
+		return nil, 0, database.ErrNonExistingRestaurant
 	}
-	var result sql.NullString
-	rows, err := db.Query("select JSON_ARRAYAGG(JSON_OBJECT('id',id,'name',name,'price',price)) from dishes where res_id=?", resID)
+	query, countQuery, queryArgs, countArgs := database.ListQueries("id,name,price", "dishes", []string{"res_id=?"}, []interface{}{resID}, opts)
+	total, err := countRows(ctx, db, countQuery, countArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := db.QueryContext(ctx, query, queryArgs...)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return "", database.ErrInternal
+		return nil, 0, database.ErrInternal
 	}
 	defer rows.Close()
 
-	rows.Next()
-	err = rows.Scan(&result)
+	result, err := database.ScanDishes(rows)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
-		return "", database.ErrInternal
+		return nil, 0, database.ErrInternal
 	}
 	logger.LogInfo(reqId, reqUrl, "menu retrieved from db successfully", 0)
-	return result.String, nil
+	return result, total, nil
 }
 func (db *MySqlDB) InsertDishes(ctx context.Context, dish models.Dish, resID int) (*models.DishOutput, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
@@ -744,153 +801,92 @@ func (db *MySqlDB) RemoveDishes(ctx context.Context, dishIDs ...int) error {
 	}
 	length := len(ErrEntries)
 	if length != 0 {
-		return sendErrorMessage(ctx, ErrEntries, length, "Dishes")
+		return database.SendErrorMessage(ctx, ErrEntries, length, "Dishes")
 	}
 	logger.LogInfo(reqId, reqUrl, "dish deleted in db successfully", 0)
 	return nil
 }
 
 //helpers
-func showOwnersForSuperAdmin(ctx context.Context, db *MySqlDB) (string, error) {
-	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	var result sql.NullString
-	logger.LogDebug(reqId, reqUrl, "executing query to get owners for superAdmin")
-	rows, err := db.Query(GetOwnersForSuperAdmin)
-	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return "", database.ErrInternal
-	}
-	defer rows.Close()
 
-	rows.Next()
-	err = rows.Scan(&result)
-	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
-		return "", database.ErrInternal
-	}
-	logger.LogInfo(reqId, reqUrl, "owners retrieved for superAdmin from db successfully", 0)
-	return result.String, nil
-}
-func showOwnersForAdmin(ctx context.Context, db *MySqlDB, creatorID string) (string, error) {
+// replaceRecoveryCodes stores hashes in place of the recovery codes of the user within the transaction of conn
+func replaceRecoveryCodes(ctx context.Context, conn database.Conn, userID, role string, hashes []string) error {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	var result sql.NullString
-	logger.LogDebug(reqId, reqUrl, "executing query to get owners for admin")
-	rows, err := db.Query("select JSON_ARRAYAGG(JSON_OBJECT('id',id,'email',email_id,'name', name)) from owners where creator_id=?", creatorID)
+	_, err := conn.ExecContext(ctx, "delete from recovery_codes where user_id=? and role=?", userID, role)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return "", database.ErrInternal
+		return database.ErrInternal
 	}
-	defer rows.Close()
-
-	rows.Next()
-	err = rows.Scan(&result)
-	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
-		return "", database.ErrInternal
+	for _, hash := range hashes {
+		_, err = conn.ExecContext(ctx, "insert into recovery_codes(id,user_id,role) values(?,?,?)", hash, userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
 	}
-	logger.LogInfo(reqId, reqUrl, "owners retrieved for admin from db successfully", 0)
-	return result.String, nil
+	return nil
 }
 
-func showRestaurantsForSuper(ctx context.Context, db *MySqlDB) (string, error) {
+func listUsers(ctx context.Context, db *MySqlDB, query string, args ...interface{}) ([]models.UserOutput, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	var result sql.NullString
-	logger.LogDebug(reqId, reqUrl, "executing query to get restaurants for superAdmin")
-	rows, err := db.Query(SelectRestaurantsForSuper)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return "", database.ErrInternal
+		return nil, database.ErrInternal
 	}
 	defer rows.Close()
 
-	rows.Next()
-	err = rows.Scan(&result)
+	result, err := database.ScanUsers(rows)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
-		return "", database.ErrInternal
+		return nil, database.ErrInternal
 	}
-	logger.LogInfo(reqId, reqUrl, "restaurants retrieved for superAdmin from db successfully", 0)
-	return result.String, nil
+	return result, nil
 }
-func showRestaurantsForAdmin(ctx context.Context, db *MySqlDB, adminID string) (string, error) {
-	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	var result sql.NullString
-	logger.LogDebug(reqId, reqUrl, "executing query to get restaurants for admin")
-
-	rows, err := db.Query(SelectRestaurantsForAdmin, adminID)
-	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return "", database.ErrInternal
-	}
-	defer rows.Close()
 
-	rows.Next()
-	err = rows.Scan(&result)
-	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
-		return "", database.ErrInternal
-	}
-	logger.LogInfo(reqId, reqUrl, "restaurants retrieved for admin from db successfully", 0)
-	return result.String, nil
-}
-func showRestaurantsForOwner(ctx context.Context, db *MySqlDB, ownerID string) (string, error) {
+func countRows(ctx context.Context, db *MySqlDB, query string, args ...interface{}) (int, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	var result sql.NullString
-	logger.LogDebug(reqId, reqUrl, "executing query to get restaurants for owner")
-
-	rows, err := db.Query(SelectRestaurantsForOwner, ownerID)
-	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return "", database.ErrInternal
-	}
-	defer rows.Close()
-
-	rows.Next()
-	err = rows.Scan(&result)
+	var count int
+	err := db.QueryRowContext(ctx, query, args...).Scan(&count)
 	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
-		return "", database.ErrInternal
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in counting rows: %v", err), 0)
+		return 0, database.ErrInternal
 	}
-	logger.LogInfo(reqId, reqUrl, "restaurants retrieved for owner from db successfully", 0)
-	return result.String, nil
+	return count, nil
 }
 
-func showAvailableRestaurantsForSuper(ctx context.Context, db *MySqlDB) (string, error) {
+func showAvailableRestaurantsForSuper(ctx context.Context, db *MySqlDB) ([]models.RestaurantOutput, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	var result string
 	logger.LogDebug(reqId, reqUrl, "executing query to get available restaurants for superAdmin")
-	rows, err := db.Query("select JSON_ARRAYAGG(JSON_OBJECT('id',id,'name',name, 'lat',lat,'lng',lng)) from restaurants where owner_id IS NULL")
+	rows, err := db.Query("select id,name,lat,lng from restaurants where owner_id IS NULL order by id")
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return "", database.ErrInternal
+		return nil, database.ErrInternal
 	}
 	defer rows.Close()
 
-	rows.Next()
-	err = rows.Scan(&result)
+	result, err := database.ScanRestaurants(rows)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
-		return "", database.ErrInternal
+		return nil, database.ErrInternal
 	}
 	logger.LogInfo(reqId, reqUrl, "available restaurants retrieved for superAdmin from db successfully", 0)
 	return result, nil
 }
-func showAvailableRestaurantsForAdmin(ctx context.Context, db *MySqlDB, creatorID string) (string, error) {
+func showAvailableRestaurantsForAdmin(ctx context.Context, db *MySqlDB, creatorID string) ([]models.RestaurantOutput, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	var result string
-	logger.LogDebug(reqId, reqUrl, "executing query to get available restaurants for superAdmin")
-	rows, err := db.Query("select JSON_ARRAYAGG(JSON_OBJECT('id',id,'name',name, 'lat',lat,'lng',lng)) from restaurants where owner_id IS NULL and creator_id=?", creatorID)
+	logger.LogDebug(reqId, reqUrl, "executing query to get available restaurants for admin")
+	rows, err := db.Query("select id,name,lat,lng from restaurants where owner_id IS NULL and creator_id=? order by id", creatorID)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return "", database.ErrInternal
+		return nil, database.ErrInternal
 	}
 	defer rows.Close()
 
-	rows.Next()
-	err = rows.Scan(&result)
+	result, err := database.ScanRestaurants(rows)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
-		return "", database.ErrInternal
+		return nil, database.ErrInternal
 	}
 	logger.LogInfo(reqId, reqUrl, "available restaurants retrieved for admin from db successfully", 0)
 	return result, nil
@@ -906,8 +902,9 @@ func removeOwnersBySuperAdmin(ctx context.Context, db *MySqlDB, ownerIDs ...stri
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in preparing statement: %v", err), 0)
 		return database.ErrInternal
 	}
+	now := time.Now().Unix()
 	for i, id := range ownerIDs {
-		result, err := stmt.Exec(id)
+		result, err := stmt.Exec(now, id, middleware.Owner)
 		if err != nil {
 			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
 			return database.ErrInternal
@@ -915,13 +912,17 @@ func removeOwnersBySuperAdmin(ctx context.Context, db *MySqlDB, ownerIDs ...stri
 		numDeletedRows, _ := result.RowsAffected()
 		if numDeletedRows == 0 {
 			ErrEntries = append(ErrEntries, i)
-		} else {
-			_, _ = db.Query("Update Restaurants set owner_id=null where owner_id=?", id)
+			continue
+		}
+		err = leaveRestaurants(ctx, db, id)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
 		}
 	}
 	length := len(ErrEntries)
 	if length != 0 {
-		return sendErrorMessage(ctx, ErrEntries, length, "Owners")
+		return database.SendErrorMessage(ctx, ErrEntries, length, "Owners")
 	}
 	logger.LogInfo(reqId, reqUrl, "owner deleted by superAdmin from db successfully", 0)
 	return nil
@@ -936,8 +937,9 @@ func removeOwnersByAdmin(ctx context.Context, db *MySqlDB, creatorID string, own
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in preparing statement: %v", err), 0)
 		return database.ErrInternal
 	}
+	now := time.Now().Unix()
 	for i, id := range ownerIDs {
-		result, err := stmt.Exec(id, creatorID)
+		result, err := stmt.Exec(now, id, middleware.Owner, creatorID)
 		if err != nil {
 			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
 			return database.ErrInternal
@@ -945,36 +947,50 @@ func removeOwnersByAdmin(ctx context.Context, db *MySqlDB, creatorID string, own
 		numDeletedRows, _ := result.RowsAffected()
 		if numDeletedRows == 0 {
 			ErrEntries = append(ErrEntries, i)
-		} else {
-			_, err = db.Exec("Update restaurants set owner_id=null where owner_id=?", id)
-			if err != nil {
-				logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-				return database.ErrInternal
-			}
+			continue
+		}
+		err = leaveRestaurants(ctx, db, id)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
 		}
 	}
 	length := len(ErrEntries)
 	if length != 0 {
-		return sendErrorMessage(ctx, ErrEntries, length, "Owners")
+		return database.SendErrorMessage(ctx, ErrEntries, length, "Owners")
 	}
 	logger.LogInfo(reqId, reqUrl, "owner deleted by admin from db successfully", 0)
 	return nil
 }
-func sendErrorMessage(ctx context.Context, ErrEntries []int, length int, data string) error {
-	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	logger.LogInfo(reqId, reqUrl, "generating error message", 0)
-	errMsg := data + " Deleted Except entry no. "
-	for i, j := range ErrEntries {
-		if i == length-1 {
-			errMsg = errMsg + fmt.Sprintf(" %v", j+1)
-			break
+// leaveRestaurants leaves the restaurants of a deleted owner without owner and ends the sessions of the owner
+func leaveRestaurants(ctx context.Context, db *MySqlDB, ownerID string) error {
+	_, err := db.ExecContext(ctx, "update restaurants set owner_id=null where owner_id=?", ownerID)
+	if err != nil {
+		return err
+	}
+	return endSessions(ctx, db.Conn, ownerID)
+}
+
+// endSessions deletes the sessions and refresh tokens of the user with the given id
+func endSessions(ctx context.Context, conn database.Conn, userID string) error {
+	for _, query := range []string{"delete from refresh_tokens where user_id=?", "delete from sessions where user_id=?"} {
+		_, err := conn.ExecContext(ctx, query, userID)
+		if err != nil {
+			return err
 		}
-		errMsg = errMsg + fmt.Sprintf(" %v,", j+1)
 	}
-	logger.LogInfo(reqId, reqUrl, "error message generated successfully", 0)
-	return errors.New(errMsg)
+	return nil
 }
 
+// duplicateEntry is the mysql error number of unique key violations
+const duplicateEntry = 1062
+
+func toDatabaseError(err error) error {
+	if mysqlErr, ok := err.(*driver.MySQLError); ok && mysqlErr.Number == duplicateEntry {
+		return database.ErrDupEmail
+	}
+	return database.ErrInternal
+}
 func removeRestaurantsBySuperAdmin(ctx context.Context, db *MySqlDB, resIDs ...int) error {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
 	var ErrEntries []int
@@ -998,7 +1014,7 @@ func removeRestaurantsBySuperAdmin(ctx context.Context, db *MySqlDB, resIDs ...i
 	}
 	length := len(ErrEntries)
 	if length != 0 {
-		return sendErrorMessage(ctx, ErrEntries, length, "Restaurants")
+		return database.SendErrorMessage(ctx, ErrEntries, length, "Restaurants")
 	}
 	logger.LogInfo(reqId, reqUrl, "restaurant deleted by superAdmin from db successfully", 0)
 	return nil
@@ -1025,137 +1041,1077 @@ func removeRestaurantsByAdmin(ctx context.Context, db *MySqlDB, creatorID string
 	}
 	length := len(ErrEntries)
 	if length != 0 {
-		return sendErrorMessage(ctx, ErrEntries, length, "Restaurants")
+		return database.SendErrorMessage(ctx, ErrEntries, length, "Restaurants")
 	}
 	logger.LogInfo(reqId, reqUrl, "restaurant deleted by admin from db successfully", 0)
 	return nil
 }
 
-func (db *MySqlDB) StoreToken(ctx context.Context, token string) error {
+func (db *MySqlDB) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	logger.LogDebug(reqId, reqUrl, "executing query to store logged out token")
-	_, err := db.Query("insert into invalid_tokens(token) values(?)", token)
+	logger.LogDebug(reqId, reqUrl, "executing query to store revoked token")
+	_, err := db.ExecContext(ctx, "insert ignore into revoked_tokens(jti,expires_at) values(?,?)", jti, expiresAt.Unix())
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
 		return database.ErrInternal
 	}
-	logger.LogInfo(reqId, reqUrl, "logged out token stored in db  successfully", 0)
+	logger.LogInfo(reqId, reqUrl, "revoked token stored in db successfully", 0)
 	return nil
 }
-func (db *MySqlDB) VerifyToken(ctx context.Context, tokenIn string) bool {
+
+func (db *MySqlDB) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to check revoked token")
 	var count int
-	logger.LogDebug(reqId, reqUrl, "executing query to verify logged out token")
-	rows, err := db.Query("select count(*) from invalid_tokens where token=?", tokenIn)
+	err := db.QueryRowContext(ctx, "select count(*) from revoked_tokens where jti=?", jti).Scan(&count)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return false
+		return false, database.ErrInternal
 	}
-	defer rows.Close()
+	return count != 0, nil
+}
 
-	rows.Next()
-	err = rows.Scan(&count)
-	defer rows.Close()
+func (db *MySqlDB) StoreRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to store refresh token")
+	_, err := db.ExecContext(ctx, "insert into refresh_tokens(id,family_id,user_id,role,expires_at,used) values(?,?,?,?,?,?)",
+		token.Hash, token.FamilyID, token.UserID, token.Role, token.ExpiresAt.Unix(), token.Used)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return false
-	}
-	if count == 0 {
-		logger.LogInfo(reqId, reqUrl, "valid login token", 0)
-		return true
-	} else {
-		logger.LogInfo(reqId, reqUrl, "invalid login token", 0)
-		return false
+		return database.ErrInternal
 	}
+	logger.LogInfo(reqId, reqUrl, "refresh token stored in db successfully", 0)
+	return nil
 }
 
-func CheckOwnerID(ctx context.Context, db *MySqlDB, ownerID string) bool {
+func (db *MySqlDB) UseRefreshToken(ctx context.Context, hash string, now time.Time) (*models.RefreshToken, error) {
 	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	logger.LogDebug(reqId, reqUrl, "executing query to check that owner id exist")
-	var count int
-	rows, err := db.Query("select count(*) from owners where id=?", ownerID)
+	logger.LogDebug(reqId, reqUrl, "executing query to use refresh token")
+	// the conditional update lets a single one of concurrent refreshes with the same token succeed
+	result, err := db.ExecContext(ctx, "update refresh_tokens set used=true where id=? and used=false and expires_at>?", hash, now.Unix())
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return false
+		return nil, database.ErrInternal
 	}
-	defer rows.Close()
-
-	rows.Next()
-	err = rows.Scan(&count)
+	updated, err := result.RowsAffected()
 	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
-		return false
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+		return nil, database.ErrInternal
 	}
-	if count != 1 {
-		return false
+	token := &models.RefreshToken{Hash: hash}
+	var expiresAt int64
+	err = db.QueryRowContext(ctx, "select family_id,user_id,role,expires_at,used from refresh_tokens where id=?", hash).
+		Scan(&token.FamilyID, &token.UserID, &token.Role, &expiresAt, &token.Used)
+	if err == sql.ErrNoRows {
+		return nil, database.ErrInvalidRefreshToken
 	}
-	logger.LogInfo(reqId, reqUrl, "owner id exist in db ", 0)
-	return true
-
-}
-func CheckRestaurantID(ctx context.Context, db *MySqlDB, resID int) bool {
-	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
-	var count int
-	logger.LogDebug(reqId, reqUrl, "executing query to check that restaurant id exist")
-
-	rows, err := db.Query("select count(*) from restaurants where id=?", resID)
 	if err != nil {
 		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
-		return false
+		return nil, database.ErrInternal
 	}
-	defer rows.Close()
-
-	rows.Next()
-	err = rows.Scan(&count)
-	if err != nil {
-		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
-		return false
+	token.ExpiresAt = time.Unix(expiresAt, 0)
+	if updated == 1 {
+		logger.LogInfo(reqId, reqUrl, "refresh token used successfully", 0)
+		return token, nil
 	}
-	if count != 1 {
-		return false
+	if !token.Used {
+		return nil, database.ErrInvalidRefreshToken
 	}
-	logger.LogInfo(reqId, reqUrl, "restaurant id exist in db ", 0)
-	return true
+	logger.LogError(reqId, reqUrl, fmt.Sprintf("refresh token reused, revoking family %s", token.FamilyID), 0)
+	err = db.RevokeRefreshTokens(ctx, token.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	return nil, database.ErrRefreshTokenReused
 }
 
-////////////////////
-//Database migration
-
-func migrateDatabase(db *sql.DB) error {
-	driver, err := mysql.WithInstance(db, &mysql.Config{})
+func (db *MySqlDB) RevokeRefreshTokens(ctx context.Context, familyID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to revoke refresh token family")
+	err := db.RunInTx(ctx, func(conn database.Conn) error {
+		for _, query := range []string{"delete from refresh_tokens where family_id=?", "delete from sessions where id=?"} {
+			_, err := conn.ExecContext(ctx, query, familyID)
+			if err != nil {
+				logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+				return database.ErrInternal
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
+	logger.LogInfo(reqId, reqUrl, "refresh token family revoked successfully", 0)
+	return nil
+}
 
-	dir, err := os.Getwd()
-	if err != nil {
-		log.Fatal(err)
+func (db *MySqlDB) FindUserID(ctx context.Context, role string, email string) (string, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to find user by email")
+	var id string
+	err := db.QueryRowContext(ctx, "select id from users where role=? and email_id=? and "+database.NotDeletedCondition, role, email).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", database.ErrUserNotFound
 	}
-
-	migration, err := migrate.NewWithDatabaseInstance(
-		fmt.Sprintf("file://%s/database", dir),
-		"restaurant",
-		driver,
-	)
 	if err != nil {
-		return err
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return "", database.ErrInternal
 	}
+	return id, nil
+}
 
-	migration.Log = &models.MigrationLogger{}
-
-	migration.Log.Printf("Applying database migrations")
-	err = migration.Up()
-	if err != nil && err != migrate.ErrNoChange {
-		return err
+func (db *MySqlDB) CountUsers(ctx context.Context, role string) (int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to count users")
+	var count int
+	err := db.QueryRowContext(ctx, "select count(*) from users where role=? and "+database.NotDeletedCondition, role).Scan(&count)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return 0, database.ErrInternal
 	}
+	return count, nil
+}
 
-	version, _, err := migration.Version()
+func (db *MySqlDB) LockUsers(ctx context.Context, role string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to lock users")
+	// the duplicate row is locked until the end of the transaction, a concurrent insert waits for it
+	_, err := db.ExecContext(ctx, "insert into settings(name,value) values(?,'') on duplicate key update value=value", database.UsersLockSetting(role))
 	if err != nil {
-		return err
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
 	}
-
-	migration.Log.Printf("Active database version: %d", version)
-
 	return nil
+}
 
+func (db *MySqlDB) GetUser(ctx context.Context, userID string, role string) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to get user")
+	user := &models.UserOutput{ID: userID, Role: role}
+	err := db.QueryRowContext(ctx, "select email_id,name,status from users where id=? and role=? and "+database.NotDeletedCondition, userID, role).
+		Scan(&user.Email, &user.Name, &user.Status)
+	if err == sql.ErrNoRows {
+		return nil, database.ErrUserNotFound
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	return user, nil
+}
+
+func (db *MySqlDB) GetUserStatus(ctx context.Context, userID string, role string) (string, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	var status string
+	err := db.QueryRowContext(ctx, "select status from users where id=? and role=?", userID, role).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", database.ErrUserNotFound
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return "", database.ErrInternal
+	}
+	return status, nil
+}
+
+func (db *MySqlDB) SuspendUser(ctx context.Context, userID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to suspend user")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		result, err := conn.ExecContext(ctx, "update users set status=?,status_changed_at=? where id=? and "+database.NotDeletedCondition,
+			models.StatusSuspended, time.Now().Unix(), userID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		if updated != 1 {
+			return database.ErrUserNotFound
+		}
+		err = endSessions(ctx, conn, userID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		logger.LogInfo(reqId, reqUrl, "user suspended in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *MySqlDB) ReactivateUser(ctx context.Context, userID string) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to reactivate user")
+	_, err := db.ExecContext(ctx, "update users set status=?,status_changed_at=? where id=? and status<>?",
+		models.StatusActive, time.Now().Unix(), userID, models.StatusActive)
+	if err != nil {
+		// the email of a deleted account can be taken by another account since
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, toDatabaseError(err)
+	}
+	logger.LogDebug(reqId, reqUrl, "fetching reactivated user")
+	var user models.UserOutput
+	err = db.QueryRowContext(ctx, "select "+UserColumns+" from users where id=?", userID).Scan(&user.ID, &user.Email, &user.Name, &user.Role, &user.Status)
+	if err == sql.ErrNoRows {
+		return nil, database.ErrUserNotFound
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "user reactivated in db successfully", 0)
+	return &user, nil
+}
+
+func (db *MySqlDB) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to purge deleted users")
+	var purged int64
+	err := db.RunInTx(ctx, func(conn database.Conn) error {
+		// the users are read first, mysql refuses to update users from a subquery selecting them
+		rows, err := conn.QueryContext(ctx, "select id,role from users where status=? and status_changed_at<=?", models.StatusDeleted, deletedBefore.Unix())
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		var users []models.UserAuth
+		for rows.Next() {
+			var user models.UserAuth
+			err = rows.Scan(&user.ID, &user.Role)
+			if err != nil {
+				break
+			}
+			users = append(users, user)
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+		rows.Close()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in reading deleted users: %v", err), 0)
+			return database.ErrInternal
+		}
+		for _, user := range users {
+			for _, query := range []string{
+				"delete from password_reset_tokens where user_id=?",
+				"delete from email_verification_tokens where user_id=?",
+				"delete from two_factor where user_id=?",
+				"delete from recovery_codes where user_id=?",
+				"delete from api_keys where user_id=?",
+				"delete from refresh_tokens where user_id=?",
+				"delete from sessions where user_id=?",
+				"update restaurants set creator_id=null where creator_id=?",
+				"update users set creator_id=null where creator_id=?",
+				"delete from users where id=?",
+			} {
+				_, err = conn.ExecContext(ctx, query, user.ID)
+				if err != nil {
+					logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+					return database.ErrInternal
+				}
+			}
+			_, err = conn.ExecContext(ctx, "delete from login_failures where id=?", database.TwoFactorLockKey(user.Role, user.ID))
+			if err != nil {
+				logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+				return database.ErrInternal
+			}
+		}
+		purged = int64(len(users))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("%d deleted users purged", purged), 0)
+	return purged, nil
+}
+
+func (db *MySqlDB) StorePasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to store password reset token")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		_, err := conn.ExecContext(ctx, "delete from password_reset_tokens where user_id=? and role=?", token.UserID, token.Role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		_, err = conn.ExecContext(ctx, "insert into password_reset_tokens(id,user_id,role,expires_at) values(?,?,?,?)",
+			token.Hash, token.UserID, token.Role, token.ExpiresAt.Unix())
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		logger.LogInfo(reqId, reqUrl, "password reset token stored in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *MySqlDB) ResetPassword(ctx context.Context, hash string, password string, now time.Time) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to reset password")
+	logger.LogDebug(reqId, reqUrl, "generating password hash")
+	pass, err := encryption.GenerateHash(db.hasher, password)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in generating password hash: %v", err), 0)
+		return database.ErrInternal
+	}
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		var userID, role string
+		var expiresAt int64
+		err := conn.QueryRowContext(ctx, "select user_id,role,expires_at from password_reset_tokens where id=?", hash).Scan(&userID, &role, &expiresAt)
+		if err == sql.ErrNoRows {
+			return database.ErrInvalidResetToken
+		}
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		// deleting the token before using it lets a single one of concurrent resets succeed
+		result, err := conn.ExecContext(ctx, "delete from password_reset_tokens where id=?", hash)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		if deleted != 1 || expiresAt <= now.Unix() {
+			return database.ErrInvalidResetToken
+		}
+		result, err = conn.ExecContext(ctx, "update users set password=? where id=? and role=?", pass, userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		if updated != 1 {
+			return database.ErrInvalidResetToken
+		}
+		for _, query := range []string{"delete from password_reset_tokens where user_id=? and role=?", "delete from refresh_tokens where user_id=? and role=?",
+			"delete from sessions where user_id=? and role=?"} {
+			_, err = conn.ExecContext(ctx, query, userID, role)
+			if err != nil {
+				logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+				return database.ErrInternal
+			}
+		}
+		logger.LogInfo(reqId, reqUrl, "password reset in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *MySqlDB) UpdateProfile(ctx context.Context, user *models.UserOutput) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to update profile of user")
+	// mysql assigns from left to right, verified is computed before the email changes
+	_, err := db.ExecContext(ctx, "update users set verified=(verified and email_id=?),email_id=?,name=? where id=? and role=?", user.Email, user.Email, user.Name, user.ID, user.Role)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrDupEmail
+	}
+	logger.LogDebug(reqId, reqUrl, "fetching updated user")
+	result, err := db.GetUser(ctx, user.ID, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	logger.LogInfo(reqId, reqUrl, "profile updated in db successfully", 0)
+	return result, nil
+}
+
+func (db *MySqlDB) ChangePassword(ctx context.Context, userID string, role string, current string, password string, keepID string) (int64, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to change password")
+	var oldHash string
+	err := db.QueryRowContext(ctx, "select password from users where id=? and role=?", userID, role).Scan(&oldHash)
+	if err == sql.ErrNoRows {
+		return 0, database.ErrUserNotFound
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return 0, database.ErrInternal
+	}
+	logger.LogDebug(reqId, reqUrl, "comparing passwords")
+	if !encryption.ComparePasswords(ctx, db.hasher, oldHash, current) {
+		return 0, database.ErrInvalidCredentials
+	}
+	logger.LogDebug(reqId, reqUrl, "generating password hash")
+	pass, err := encryption.GenerateHash(db.hasher, password)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in generating password hash: %v", err), 0)
+		return 0, database.ErrInternal
+	}
+	var revoked int64
+	err = db.RunInTx(ctx, func(conn database.Conn) error {
+		// matching the verified hash refuses the change when the password changed in the meantime
+		result, err := conn.ExecContext(ctx, "update users set password=? where id=? and role=? and password=?", pass, userID, role, oldHash)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		if updated != 1 {
+			return database.ErrInvalidCredentials
+		}
+		_, err = conn.ExecContext(ctx, "delete from password_reset_tokens where user_id=? and role=?", userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		_, err = conn.ExecContext(ctx, "delete from refresh_tokens where family_id in (select id from sessions where user_id=? and role=? and id<>?)", userID, role, keepID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		result, err = conn.ExecContext(ctx, "delete from sessions where user_id=? and role=? and id<>?", userID, role, keepID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		revoked, err = result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("password changed in db successfully, %d sessions revoked", revoked), 0)
+	return revoked, nil
+}
+
+func (db *MySqlDB) StoreVerificationToken(ctx context.Context, token *models.VerificationToken) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to store email verification token")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		var verified bool
+		err := conn.QueryRowContext(ctx, "select verified from users where id=? and role=? and "+database.NotDeletedCondition, token.UserID, token.Role).Scan(&verified)
+		if err == sql.ErrNoRows {
+			return database.ErrUserNotFound
+		}
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		if verified {
+			return database.ErrAlreadyVerified
+		}
+		_, err = conn.ExecContext(ctx, "delete from email_verification_tokens where user_id=? and role=?", token.UserID, token.Role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		_, err = conn.ExecContext(ctx, "insert into email_verification_tokens(id,user_id,role,expires_at) values(?,?,?,?)",
+			token.Hash, token.UserID, token.Role, token.ExpiresAt.Unix())
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		logger.LogInfo(reqId, reqUrl, "email verification token stored in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *MySqlDB) VerifyEmail(ctx context.Context, hash string, now time.Time) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to verify email")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		var userID, role string
+		var expiresAt int64
+		err := conn.QueryRowContext(ctx, "select user_id,role,expires_at from email_verification_tokens where id=?", hash).Scan(&userID, &role, &expiresAt)
+		if err == sql.ErrNoRows {
+			return database.ErrInvalidVerificationToken
+		}
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		if expiresAt <= now.Unix() {
+			return database.ErrInvalidVerificationToken
+		}
+		result, err := conn.ExecContext(ctx, "update users set verified=true where id=? and role=?", userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		if updated != 1 {
+			return database.ErrInvalidVerificationToken
+		}
+		_, err = conn.ExecContext(ctx, "delete from email_verification_tokens where user_id=? and role=?", userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		logger.LogInfo(reqId, reqUrl, "email verified in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *MySqlDB) GetTwoFactor(ctx context.Context, userID string, role string) (*models.TwoFactor, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to get two-factor enrolment")
+	tf := &models.TwoFactor{UserID: userID, Role: role}
+	err := db.QueryRowContext(ctx, "select secret,enabled,last_step from two_factor where user_id=? and role=?", userID, role).Scan(&tf.Secret, &tf.Enabled, &tf.LastStep)
+	if err != nil && err != sql.ErrNoRows {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	return tf, nil
+}
+
+func (db *MySqlDB) StoreTwoFactorSecret(ctx context.Context, userID string, role string, secret string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to store two-factor secret")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		var enabled bool
+		err := conn.QueryRowContext(ctx, "select enabled from two_factor where user_id=? and role=?", userID, role).Scan(&enabled)
+		if err != nil && err != sql.ErrNoRows {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		if enabled {
+			return database.ErrTwoFactorEnabled
+		}
+		_, err = conn.ExecContext(ctx, "delete from two_factor where user_id=? and role=?", userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		_, err = conn.ExecContext(ctx, "insert into two_factor(user_id,role,secret) values(?,?,?)", userID, role, secret)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		logger.LogInfo(reqId, reqUrl, "two-factor secret stored in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *MySqlDB) EnableTwoFactor(ctx context.Context, userID string, role string, step int64, recoveryHashes []string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to enable two-factor authentication")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		result, err := conn.ExecContext(ctx, "update two_factor set enabled=true,last_step=? where user_id=? and role=? and enabled=false", step, userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		if updated != 1 {
+			return database.ErrTwoFactorNotPending
+		}
+		err = replaceRecoveryCodes(ctx, conn, userID, role, recoveryHashes)
+		if err != nil {
+			return err
+		}
+		logger.LogInfo(reqId, reqUrl, "two-factor authentication enabled in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *MySqlDB) UseTwoFactorStep(ctx context.Context, userID string, role string, step int64) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to use two-factor code")
+	result, err := db.ExecContext(ctx, "update two_factor set last_step=? where user_id=? and role=? and enabled=true and last_step<?", step, userID, role, step)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+		return database.ErrInternal
+	}
+	if updated != 1 {
+		return database.ErrTwoFactorCodeUsed
+	}
+	return nil
+}
+
+func (db *MySqlDB) UseRecoveryCode(ctx context.Context, userID string, role string, hash string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to use recovery code")
+	result, err := db.ExecContext(ctx, "delete from recovery_codes where id=? and user_id=? and role=?", hash, userID, role)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+		return database.ErrInternal
+	}
+	if deleted != 1 {
+		return database.ErrInvalidRecoveryCode
+	}
+	logger.LogInfo(reqId, reqUrl, "recovery code used successfully", 0)
+	return nil
+}
+
+func (db *MySqlDB) ReplaceRecoveryCodes(ctx context.Context, userID string, role string, hashes []string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to replace recovery codes")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		return replaceRecoveryCodes(ctx, conn, userID, role, hashes)
+	})
+}
+
+func (db *MySqlDB) DisableTwoFactor(ctx context.Context, userID string, role string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to disable two-factor authentication")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		for _, query := range []string{"delete from two_factor where user_id=? and role=?", "delete from recovery_codes where user_id=? and role=?"} {
+			_, err := conn.ExecContext(ctx, query, userID, role)
+			if err != nil {
+				logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+				return database.ErrInternal
+			}
+		}
+		logger.LogInfo(reqId, reqUrl, "two-factor authentication disabled in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *MySqlDB) SetTwoFactorRequired(ctx context.Context, required bool) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to set two-factor policy")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		_, err := conn.ExecContext(ctx, "delete from settings where name=?", database.SettingTwoFactorRequired)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		_, err = conn.ExecContext(ctx, "insert into settings(name,value) values(?,?)", database.SettingTwoFactorRequired, strconv.FormatBool(required))
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		return nil
+	})
+}
+
+func (db *MySqlDB) IsTwoFactorRequired(ctx context.Context) (bool, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to get two-factor policy")
+	var value string
+	err := db.QueryRowContext(ctx, "select value from settings where name=?", database.SettingTwoFactorRequired).Scan(&value)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return false, database.ErrInternal
+	}
+	return value == "true", nil
+}
+
+func (db *MySqlDB) RecordLoginFailure(ctx context.Context, key string, now time.Time, expiresAt time.Time) (int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to record login failure")
+	var failures int
+	err := db.RunInTx(ctx, func(conn database.Conn) error {
+		var lockedUntil, expires int64
+		err := conn.QueryRowContext(ctx, "select failures,locked_until,expires_at from login_failures where id=?", key).Scan(&failures, &lockedUntil, &expires)
+		if err != nil && err != sql.ErrNoRows {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		if err == sql.ErrNoRows || expires <= now.Unix() {
+			failures, lockedUntil = 0, 0
+		}
+		failures++
+		if lockedUntil > expiresAt.Unix() {
+			expiresAt = time.Unix(lockedUntil, 0)
+		}
+		_, err = conn.ExecContext(ctx, "delete from login_failures where id=?", key)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		_, err = conn.ExecContext(ctx, "insert into login_failures(id,failures,locked_until,expires_at) values(?,?,?,?)", key, failures, lockedUntil, expiresAt.Unix())
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		return nil
+	})
+	return failures, err
+}
+
+func (db *MySqlDB) LockLogin(ctx context.Context, key string, until time.Time) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to lock login")
+	_, err := db.ExecContext(ctx, "update login_failures set locked_until=?,expires_at=(case when expires_at<? then ? else expires_at end) where id=?",
+		until.Unix(), until.Unix(), until.Unix(), key)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	return nil
+}
+
+func (db *MySqlDB) GetLoginLock(ctx context.Context, now time.Time, keys ...string) (time.Time, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to get login lock")
+	var latest int64
+	for _, key := range keys {
+		var lockedUntil int64
+		err := db.QueryRowContext(ctx, "select locked_until from login_failures where id=?", key).Scan(&lockedUntil)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return time.Time{}, database.ErrInternal
+		}
+		if lockedUntil > latest {
+			latest = lockedUntil
+		}
+	}
+	if latest <= now.Unix() {
+		return time.Time{}, nil
+	}
+	return time.Unix(latest, 0), nil
+}
+
+func (db *MySqlDB) ClearLoginFailures(ctx context.Context, keys ...string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to clear login failures")
+	for _, key := range keys {
+		_, err := db.ExecContext(ctx, "delete from login_failures where id=?", key)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+	}
+	return nil
+}
+
+func (db *MySqlDB) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to create api key")
+	_, err := db.ExecContext(ctx, "insert into api_keys(id,hash,prefix,name,user_id,role,permissions,created_at) values(?,?,?,?,?,?,?,?)",
+		key.ID, key.Hash, key.Prefix, key.Name, key.UserID, key.Role, strings.Join(key.Permissions, ","), key.CreatedAt.Unix())
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "api key created in db successfully", 0)
+	return nil
+}
+
+func (db *MySqlDB) ShowAPIKeys(ctx context.Context, userID string, role string) ([]models.APIKey, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to show api keys")
+	rows, err := db.QueryContext(ctx, "select "+database.APIKeyColumns+" from api_keys where user_id=? and role=? order by created_at,id", userID, role)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	defer rows.Close()
+	keys, err := database.ScanAPIKeys(rows)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in scanning rows: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	return keys, nil
+}
+
+func (db *MySqlDB) RevokeAPIKey(ctx context.Context, userID string, role string, keyID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to revoke api key")
+	result, err := db.ExecContext(ctx, "delete from api_keys where id=? and user_id=? and role=?", keyID, userID, role)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+		return database.ErrInternal
+	}
+	if deleted == 0 {
+		return database.ErrAPIKeyNotFound
+	}
+	logger.LogInfo(reqId, reqUrl, "api key revoked successfully", 0)
+	return nil
+}
+
+func (db *MySqlDB) UseAPIKey(ctx context.Context, hash string, now time.Time) (*models.APIKey, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to use api key")
+	var key *models.APIKey
+	err := db.RunInTx(ctx, func(conn database.Conn) error {
+		var err error
+		key, err = database.ScanAPIKey(conn.QueryRowContext(ctx, SelectUsableAPIKey, hash))
+		if err == sql.ErrNoRows {
+			return database.ErrInvalidAPIKey
+		}
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		_, err = conn.ExecContext(ctx, "update api_keys set last_used_at=? where id=?", now.Unix(), key.ID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	key.LastUsedAt = &now
+	return key, nil
+}
+
+func (db *MySqlDB) CreateSession(ctx context.Context, session *models.Session) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to create session")
+	_, err := db.ExecContext(ctx, "insert into sessions(id,user_id,role,device,ip,issued_at,last_seen_at,expires_at) values(?,?,?,?,?,?,?,?)",
+		session.ID, session.UserID, session.Role, session.Device, session.IP, session.IssuedAt.Unix(), session.LastSeenAt.Unix(), session.ExpiresAt.Unix())
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "session created in db successfully", 0)
+	return nil
+}
+
+func (db *MySqlDB) TouchSession(ctx context.Context, sessionID string, now time.Time, expiresAt time.Time) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to touch session")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		var expiry int64
+		err := conn.QueryRowContext(ctx, "select expires_at from sessions where id=?", sessionID).Scan(&expiry)
+		if err == sql.ErrNoRows || (err == nil && expiry <= now.Unix()) {
+			return database.ErrSessionNotFound
+		}
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		if expiresAt.Unix() > expiry {
+			expiry = expiresAt.Unix()
+		}
+		_, err = conn.ExecContext(ctx, "update sessions set last_seen_at=?,expires_at=? where id=?", now.Unix(), expiry, sessionID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		return nil
+	})
+}
+
+func (db *MySqlDB) ShowSessions(ctx context.Context, userID string, role string, now time.Time) ([]models.Session, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to show sessions")
+	rows, err := db.QueryContext(ctx, "select "+database.SessionColumns+" from sessions where user_id=? and role=? and expires_at>? order by last_seen_at desc,id", userID, role, now.Unix())
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	defer rows.Close()
+	sessions, err := database.ScanSessions(rows)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in scanning rows: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	return sessions, nil
+}
+
+func (db *MySqlDB) RevokeSession(ctx context.Context, userID string, role string, sessionID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to revoke session")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		result, err := conn.ExecContext(ctx, "delete from sessions where id=? and user_id=? and role=?", sessionID, userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		if deleted == 0 {
+			return database.ErrSessionNotFound
+		}
+		_, err = conn.ExecContext(ctx, "delete from refresh_tokens where family_id=?", sessionID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		logger.LogInfo(reqId, reqUrl, "session revoked successfully", 0)
+		return nil
+	})
+}
+
+func (db *MySqlDB) RevokeSessions(ctx context.Context, userID string, role string, keepID string) (int64, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to revoke sessions of user")
+	var revoked int64
+	err := db.RunInTx(ctx, func(conn database.Conn) error {
+		_, err := conn.ExecContext(ctx, "delete from refresh_tokens where family_id in (select id from sessions where user_id=? and role=? and id<>?)", userID, role, keepID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		result, err := conn.ExecContext(ctx, "delete from sessions where user_id=? and role=? and id<>?", userID, role, keepID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		revoked, err = result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("%d sessions revoked", revoked), 0)
+	return revoked, nil
+}
+
+func (db *MySqlDB) PurgeExpiredTokens(ctx context.Context, now time.Time) (int64, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to purge expired tokens")
+	var purged int64
+	for _, query := range []string{
+		"delete from revoked_tokens where expires_at<=?",
+		"delete from refresh_tokens where expires_at<=?",
+		"delete from password_reset_tokens where expires_at<=?",
+		"delete from email_verification_tokens where expires_at<=?",
+		"delete from login_failures where expires_at<=?",
+		"delete from sessions where expires_at<=?",
+	} {
+		result, err := db.ExecContext(ctx, query, now.Unix())
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return purged, database.ErrInternal
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return purged, database.ErrInternal
+		}
+		purged += deleted
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("%d expired tokens purged", purged), 0)
+	return purged, nil
+}
+
+// WithTx runs fn with a database bound to a single transaction, it is committed when fn returns nil
+func (db *MySqlDB) WithTx(ctx context.Context, fn func(tx database.Database) error) error {
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		return fn(&MySqlDB{Conn: conn, latestMigration: db.latestMigration, hasher: db.hasher})
+	})
+}
+
+func CheckOwnerID(ctx context.Context, db *MySqlDB, ownerID string) bool {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to check that owner id exist")
+	var count int
+	rows, err := db.Query("select count(*) from users where id=? and role=? and "+database.NotDeletedCondition, ownerID, middleware.Owner)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return false
+	}
+	defer rows.Close()
+
+	rows.Next()
+	err = rows.Scan(&count)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		return false
+	}
+	if count != 1 {
+		return false
+	}
+	logger.LogInfo(reqId, reqUrl, "owner id exist in db ", 0)
+	return true
+
+}
+func CheckRestaurantID(ctx context.Context, db *MySqlDB, resID int) bool {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	var count int
+	logger.LogDebug(reqId, reqUrl, "executing query to check that restaurant id exist")
+
+	rows, err := db.Query("select count(*) from restaurants where id=?", resID)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return false
+	}
+	defer rows.Close()
+
+	rows.Next()
+	err = rows.Scan(&count)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		return false
+	}
+	if count != 1 {
+		return false
+	}
+	logger.LogInfo(reqId, reqUrl, "restaurant id exist in db ", 0)
+	return true
+}
+
+////////////////////
+//Database migration
+
+// NewMigrate returns a migrate instance for the configured database, closing it closes the connection
+func NewMigrate(cfg *config.Database) (*migrate.Migrate, error) {
+	db, err := open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return migrations.New(migrations.MySQL, db)
+}
+
+func open(cfg *config.Database) (*sql.DB, error) {
+	db, err := sql.Open("mysql", strings.TrimPrefix(cfg.URL, "mysql://"))
+	if err != nil {
+		return nil, err
+	}
+	database.ConfigurePool(db, cfg)
+	return db, nil
+}
+
+// MigrationStatus pings the database and returns the schema version applied to it
+func (db *MySqlDB) MigrationStatus(ctx context.Context) (*models.MigrationStatus, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "checking database migration status")
+	status, err := database.QueryMigrationStatus(ctx, db.DB, db.latestMigration)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not get migration status: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	return status, nil
 }
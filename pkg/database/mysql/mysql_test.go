@@ -0,0 +1,40 @@
+package mysql_test
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database/databasetest"
+	"github.com/vds/go-resman/pkg/database/mysql"
+	"github.com/vds/go-resman/pkg/logger"
+	"os"
+	"testing"
+)
+
+func init() {
+	logger.InitLogger(logrus.ErrorLevel)
+}
+
+func TestMySqlDB(t *testing.T) {
+	dbUrl := os.Getenv("MYSQL_URL")
+	if dbUrl == "" {
+		t.Skip("MYSQL_URL not set")
+	}
+	db, err := mysql.NewMySqlDB(&config.Database{URL: dbUrl})
+	if err != nil {
+		t.Fatalf("can not get db instance: %v", err)
+	}
+	defer db.Close()
+	// mysql truncates a single table at a time, the rows are deleted in the order of their foreign keys
+	for _, query := range []string{
+		"delete from dishes", "delete from restaurants", "delete from revoked_tokens", "delete from refresh_tokens",
+		"delete from password_reset_tokens", "delete from email_verification_tokens", "delete from two_factor",
+		"delete from recovery_codes", "delete from settings", "delete from login_failures", "delete from api_keys",
+		"delete from sessions", "update users set creator_id=null", "delete from users",
+	} {
+		_, err = db.Exec(query)
+		if err != nil {
+			t.Fatalf("can not clear db: %v", err)
+		}
+	}
+	databasetest.RunTests(t, db)
+}
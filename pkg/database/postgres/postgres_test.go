@@ -0,0 +1,32 @@
+package postgres_test
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database/databasetest"
+	"github.com/vds/go-resman/pkg/database/postgres"
+	"github.com/vds/go-resman/pkg/logger"
+	"os"
+	"testing"
+)
+
+func init() {
+	logger.InitLogger(logrus.ErrorLevel)
+}
+
+func TestPostgresDB(t *testing.T) {
+	dbUrl := os.Getenv("POSTGRES_URL")
+	if dbUrl == "" {
+		t.Skip("POSTGRES_URL not set")
+	}
+	db, err := postgres.NewPostgresDB(&config.Database{URL: dbUrl})
+	if err != nil {
+		t.Fatalf("can not get db instance: %v", err)
+	}
+	defer db.Close()
+	_, err = db.Exec("truncate users, restaurants, dishes, revoked_tokens, refresh_tokens, password_reset_tokens, email_verification_tokens, two_factor, recovery_codes, settings, login_failures, api_keys, sessions restart identity")
+	if err != nil {
+		t.Fatalf("can not clear db: %v", err)
+	}
+	databasetest.RunTests(t, db)
+}
@@ -0,0 +1,1858 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/golang-migrate/migrate"
+	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/database/migrations"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DriverName               = "sqlite3_resman"
+	UserTable                = "users"
+	UserColumns              = "id,email_id,name,role,status"
+	RestaurantColumns        = "id,name,lat,lng"
+	InsertUser               = "insert into users(id,role,email_id,name,password,verified) values(?,?,?,?,?,?)"
+	GetUserIDPassword        = "select id,password,verified,status from users where role=? and email_id=? and " + database.NotDeletedCondition
+	RehashPassword           = "update users set password=? where id=? and password=?"
+	GetAdmin                 = "select " + UserColumns + " from users where id=? and " + database.AdminsCondition + " and " + database.NotDeletedCondition
+	GetOwner                 = "select " + UserColumns + " from users where id=? and role=? and " + database.NotDeletedCondition
+	InsertOwner              = "insert into users(id,role,email_id,name,password,creator_id,verified) values(?,?,?,?,?,?,?)"
+	AdminUpdate              = "update users set email_id=?,name=? where id=? and " + database.AdminsCondition + " and " + database.NotDeletedCondition
+	OwnerUpdate              = "update users set email_id=?,name=? where id=? and role=? and " + database.NotDeletedCondition
+	SelectNearBy             = "select id,name,lat,lng from restaurants where distance(lat,lng,?,?) < ? order by id"
+	SelectRestaurant         = "select id,name,lat,lng from restaurants where id=?"
+	SelectAvailable          = "select id,name,lat,lng from restaurants where owner_id is null order by id"
+	SelectAvailableCreated   = "select id,name,lat,lng from restaurants where owner_id is null and creator_id=? order by id"
+	InsertRestaurant         = "insert into restaurants(name,lat,lng,creator_id) values(?,?,?,?)"
+	RestaurantUpdate         = "update restaurants set name=?,lat=?,lng=? where id=?"
+	CheckRestaurantOwner     = "select owner_id from restaurants where id=?"
+	CheckRestaurantCreator   = "select creator_id from restaurants where id=?"
+	CheckRestaurantDish      = "select res_id from dishes where id=?"
+	SelectDish               = "select id,name,price from dishes where id=?"
+	InsertDish               = "insert into dishes(res_id,name,price) values(?,?,?)"
+	DishUpdate               = "update dishes set name=?,price=? where id=?"
+	DeleteAdmin              = "update users set status='" + models.StatusDeleted + "',status_changed_at=? where id=? and " + database.AdminsCondition + " and " + database.NotDeletedCondition
+	DeleteOwner              = "update users set status='" + models.StatusDeleted + "',status_changed_at=? where id=? and role=? and " + database.NotDeletedCondition
+	DeleteCreatedOwner       = "update users set status='" + models.StatusDeleted + "',status_changed_at=? where id=? and role=? and creator_id=? and " + database.NotDeletedCondition
+	RemoveOwnerOfRestaurants = "update restaurants set owner_id=null where owner_id=?"
+	DeleteRestaurant         = "delete from restaurants where id=?"
+	DeleteCreatedRestaurant  = "delete from restaurants where id=? and creator_id=?"
+	DeleteDishes             = "delete from dishes where id=?"
+	// SelectUsableAPIKey selects the api key with a hash if the account of its user is active
+	SelectUsableAPIKey = "select k.id,k.name,k.prefix,k.user_id,k.role,k.permissions,k.created_at,k.last_used_at from api_keys k " +
+		"join users u on u.id=k.user_id and u.role=k.role where k.hash=? and u.status='" + models.StatusActive + "'"
+)
+
+func init() {
+	// sqlite has no spatial functions so the haversine distance is provided to queries from go
+	sql.Register(DriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("distance", database.Distance, true)
+		},
+	})
+}
+
+type SqliteDB struct {
+	database.Conn
+	latestMigration uint
+	hasher          encryption.PasswordHasher
+}
+
+// NewSqliteDB opens the database file of the configured url, an optional sqlite:// prefix is ignored
+// and ":memory:" can be used for a throw away database. Pending migrations are applied unless cfg.SkipMigrate is set
+func NewSqliteDB(cfg *config.Database) (*SqliteDB, error) {
+	db, err := open(cfg)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if !cfg.SkipMigrate {
+		err = migrations.Up(migrations.SQLite, db)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+	}
+	latest, err := migrations.Latest(migrations.SQLite)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &SqliteDB{Conn: database.Conn{DB: db}, latestMigration: latest, hasher: encryption.DefaultPasswordHasher()}, nil
+}
+
+func (db *SqliteDB) SetPasswordHasher(hasher encryption.PasswordHasher) {
+	db.hasher = hasher
+}
+
+func (db *SqliteDB) ShowNearBy(ctx context.Context, location *models.Location) ([]models.RestaurantOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing GetNearByRestaurant query")
+	result, err := db.queryRestaurants(ctx, SelectNearBy, float64(location.Lat), float64(location.Lng), database.NearByRadius)
+	if err != nil {
+		return nil, err
+	}
+	logger.LogInfo(reqId, reqUrl, "getNearBy restaurant from db successful", 0)
+	return result, nil
+}
+
+func (db *SqliteDB) CreateUser(ctx context.Context, user *models.UserReg) (string, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing createUser query")
+	// owners are created with their creator by CreateOwner
+	if user.Role == "" || user.Role == middleware.Owner {
+		return "", database.ErrInternal
+	}
+	logger.LogDebug(reqId, reqUrl, "generating password hash")
+	pass, err := encryption.GenerateHash(db.hasher, user.Password)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in generating password hash: %v", err), 0)
+		return "", database.ErrInternal
+	}
+	id := uuid.New().String()
+	_, err = db.ExecContext(ctx, InsertUser, id, user.Role, user.Email, user.Name, pass, user.Verified)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return "", toDatabaseError(err)
+	}
+	logger.LogInfo(reqId, reqUrl, "createUser in db successful", 0)
+	return id, nil
+}
+
+func (db *SqliteDB) LogInUser(ctx context.Context, cred *models.Credentials) (string, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "logging in user")
+	var id string
+	var pass string
+	var verified bool
+	var status string
+	err := db.QueryRowContext(ctx, GetUserIDPassword, cred.Role, cred.Email).Scan(&id, &pass, &verified, &status)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		if err == sql.ErrNoRows {
+			return "", database.ErrInvalidCredentials
+		}
+		return "", database.ErrInternal
+	}
+	logger.LogDebug(reqId, reqUrl, "comparing passwords")
+	isValid := encryption.ComparePasswords(ctx, db.hasher, pass, cred.Password)
+	if !isValid {
+		return "", database.ErrInvalidCredentials
+	}
+	if status == models.StatusSuspended {
+		logger.LogError(reqId, reqUrl, "account of user is suspended", 0)
+		return "", database.ErrAccountSuspended
+	}
+	if !verified {
+		logger.LogError(reqId, reqUrl, "email of user is not verified", 0)
+		return "", database.ErrUnverifiedEmail
+	}
+	if db.hasher.NeedsRehash(pass) {
+		db.rehashPassword(ctx, id, pass, cred.Password)
+	}
+	logger.LogInfo(reqId, reqUrl, "login credentials verified from db", 0)
+	return id, nil
+}
+
+// rehashPassword replaces the hash of a user who just logged in with a hash of the current hasher,
+// a failure only leaves the old hash in place
+func (db *SqliteDB) rehashPassword(ctx context.Context, id string, oldHash string, password string) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "rehashing password of user")
+	hash, err := encryption.GenerateHash(db.hasher, password)
+	if err == nil {
+		_, err = db.ExecContext(ctx, RehashPassword, hash, id, oldHash)
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not rehash password: %v", err), 0)
+	}
+}
+
+func (db *SqliteDB) ShowAdmins(ctx context.Context, opts *models.ListOptions) ([]models.UserOutput, int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to get admins")
+	statusCondition, args := database.StatusCondition(opts)
+	query, countQuery, queryArgs, countArgs := database.ListQueries(UserColumns, UserTable, []string{database.AdminsCondition, statusCondition}, args, opts)
+	total, err := db.countRows(ctx, countQuery, countArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	result, err := db.queryUsers(ctx, query, queryArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	logger.LogInfo(reqId, reqUrl, "get admins from db successful", 0)
+	return result, total, nil
+}
+
+func (db *SqliteDB) UpdateAdmin(ctx context.Context, admin *models.UserOutput) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to update an admin")
+	_, err := db.ExecContext(ctx, AdminUpdate, admin.Email, admin.Name, admin.ID)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, toDatabaseError(err)
+	}
+	logger.LogDebug(reqId, reqUrl, "executing query to fetch updated admin")
+	result, err := db.queryUser(ctx, GetAdmin, admin.ID)
+	if err != nil {
+		return nil, err
+	}
+	logger.LogInfo(reqId, reqUrl, "admin updated in db successfully", 0)
+	return result, nil
+}
+
+func (db *SqliteDB) RemoveAdmins(ctx context.Context, adminIDs ...string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to delete admin")
+	args := make([][]interface{}, len(adminIDs))
+	now := time.Now().Unix()
+	for i, id := range adminIDs {
+		args[i] = []interface{}{now, id}
+	}
+	err := db.deleteEach(ctx, DeleteAdmin, "Admins", args, func(args []interface{}) error {
+		return endSessions(ctx, db.Conn, args[1])
+	})
+	if err != nil {
+		return err
+	}
+	logger.LogInfo(reqId, reqUrl, "admin deleted in db successfully", 0)
+	return nil
+}
+
+func (db *SqliteDB) ShowOwners(ctx context.Context, userAuth *models.UserAuth, opts *models.ListOptions) ([]models.UserOutput, int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogInfo(reqId, reqUrl, "selecting owners to show according to scope", 0)
+	conditions := []string{"role=?"}
+	args := []interface{}{middleware.Owner}
+	switch userAuth.Scope {
+	case models.ScopeAll:
+	case models.ScopeCreated:
+		conditions = append(conditions, "creator_id=?")
+		args = append(args, userAuth.ID)
+	default:
+		return nil, 0, database.ErrInternal
+	}
+	statusCondition, statusArgs := database.StatusCondition(opts)
+	conditions = append(conditions, statusCondition)
+	args = append(args, statusArgs...)
+	query, countQuery, queryArgs, countArgs := database.ListQueries(UserColumns, UserTable, conditions, args, opts)
+	total, err := db.countRows(ctx, countQuery, countArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	result, err := db.queryUsers(ctx, query, queryArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	logger.LogInfo(reqId, reqUrl, "owners retrieved from db successfully", 0)
+	return result, total, nil
+}
+
+func (db *SqliteDB) CreateOwner(ctx context.Context, creatorID string, owner *models.OwnerReg) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "generating password hash")
+	pass, err := encryption.GenerateHash(db.hasher, owner.Password)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in generating hash of password: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	logger.LogDebug(reqId, reqUrl, "executing query to create an owner")
+	id := uuid.New().String()
+	_, err = db.ExecContext(ctx, InsertOwner, id, middleware.Owner, owner.Email, owner.Name, pass, creatorID, owner.Verified)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, toDatabaseError(err)
+	}
+	logger.LogInfo(reqId, reqUrl, "owner created in db successful", 0)
+	return &models.UserOutput{ID: id, Email: owner.Email, Name: owner.Name, Role: middleware.Owner, Status: models.StatusActive}, nil
+}
+
+func (db *SqliteDB) CheckOwnerCreator(ctx context.Context, creatorID string, ownerID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to verify owner creator")
+	var creatorIDOut sql.NullString
+	err := db.QueryRowContext(ctx, "select creator_id from users where id=? and role=? and "+database.NotDeletedCondition, ownerID, middleware.Owner).Scan(&creatorIDOut)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		if err == sql.ErrNoRows {
+			return database.ErrInvalidOwner
+		}
+		return database.ErrInternal
+	}
+	if creatorIDOut.String != creatorID {
+		return database.ErrInvalidOwnerCreator
+	}
+	logger.LogInfo(reqId, reqUrl, "owner creator verified from db", 0)
+	return nil
+}
+
+func (db *SqliteDB) UpdateOwner(ctx context.Context, owner *models.UserOutput) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "checking that owner exist")
+	if !db.checkOwnerID(ctx, owner.ID) {
+		return nil, database.ErrInvalidOwner
+	}
+	logger.LogDebug(reqId, reqUrl, "executing query to update owner")
+	_, err := db.ExecContext(ctx, OwnerUpdate, owner.Email, owner.Name, owner.ID, middleware.Owner)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, toDatabaseError(err)
+	}
+	logger.LogDebug(reqId, reqUrl, "fetching updated owner")
+	result, err := db.queryUser(ctx, GetOwner, owner.ID, middleware.Owner)
+	if err != nil {
+		return nil, err
+	}
+	logger.LogInfo(reqId, reqUrl, "owner updated in db successfully", 0)
+	return result, nil
+}
+
+func (db *SqliteDB) RemoveOwners(ctx context.Context, userAuth *models.UserAuth, ownerIDs ...string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogInfo(reqId, reqUrl, "selecting owner delete query as per scope", 0)
+	var query string
+	args := make([][]interface{}, len(ownerIDs))
+	now := time.Now().Unix()
+	switch userAuth.Scope {
+	case models.ScopeAll:
+		query = DeleteOwner
+		for i, id := range ownerIDs {
+			args[i] = []interface{}{now, id, middleware.Owner}
+		}
+	case models.ScopeCreated:
+		query = DeleteCreatedOwner
+		for i, id := range ownerIDs {
+			args[i] = []interface{}{now, id, middleware.Owner, userAuth.ID}
+		}
+	default:
+		return database.ErrInternal
+	}
+	err := db.deleteEach(ctx, query, "Owners", args, func(args []interface{}) error {
+		_, err := db.ExecContext(ctx, RemoveOwnerOfRestaurants, args[1])
+		if err != nil {
+			return err
+		}
+		return endSessions(ctx, db.Conn, args[1])
+	})
+	if err != nil {
+		return err
+	}
+	logger.LogInfo(reqId, reqUrl, "owners deleted from db successfully", 0)
+	return nil
+}
+
+func (db *SqliteDB) CheckAdmin(ctx context.Context, adminID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to check if admin exist")
+	var count int
+	err := db.QueryRowContext(ctx, "select count(*) from users where id=? and "+database.AdminsCondition+" and "+database.NotDeletedCondition, adminID).Scan(&count)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		return database.ErrInternal
+	}
+	if count != 1 {
+		return database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "admin id verified from db", 0)
+	return nil
+}
+
+//restaurants
+
+func (db *SqliteDB) ShowRestaurants(ctx context.Context, userAuth *models.UserAuth, opts *models.ListOptions) ([]models.RestaurantOutput, int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogInfo(reqId, reqUrl, "selecting restaurants to show as per scope", 0)
+	var conditions []string
+	var args []interface{}
+	switch userAuth.Scope {
+	case models.ScopeAll:
+	case models.ScopeCreated:
+		conditions = append(conditions, "creator_id=?")
+		args = append(args, userAuth.ID)
+	case models.ScopeOwned:
+		conditions = append(conditions, "owner_id=?")
+		args = append(args, userAuth.ID)
+	default:
+		return nil, 0, database.ErrInternal
+	}
+	query, countQuery, queryArgs, countArgs := database.ListQueries(RestaurantColumns, "restaurants", conditions, args, opts)
+	total, err := db.countRows(ctx, countQuery, countArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	result, err := db.queryRestaurants(ctx, query, queryArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	logger.LogInfo(reqId, reqUrl, "restaurants retrieved from db successfully", 0)
+	return result, total, nil
+}
+
+func (db *SqliteDB) InsertRestaurant(ctx context.Context, restaurant *models.Restaurant) (*models.RestaurantOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to add a restaurant")
+	res, err := db.ExecContext(ctx, InsertRestaurant, restaurant.Name, restaurant.Lat, restaurant.Lng, restaurant.CreatorID)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting inserted id: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	result, err := db.queryRestaurant(ctx, int(id))
+	if err != nil {
+		return nil, database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "restaurant added successfully in db", 0)
+	return result, nil
+}
+
+func (db *SqliteDB) ShowAvailableRestaurants(ctx context.Context, userAuth *models.UserAuth) ([]models.RestaurantOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "selecting query to show available restaurant according to scope")
+	switch userAuth.Scope {
+	case models.ScopeAll:
+		return db.queryRestaurants(ctx, SelectAvailable)
+	case models.ScopeCreated:
+		return db.queryRestaurants(ctx, SelectAvailableCreated, userAuth.ID)
+	}
+	return nil, database.ErrInternal
+}
+
+func (db *SqliteDB) InsertOwnerForRestaurants(ctx context.Context, userAuth *models.UserAuth, ownerID string, resIDs ...int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to add owner to restaurants")
+	err := db.setRestaurantsOwner(ctx, userAuth, ownerID, sql.NullString{String: ownerID, Valid: true}, resIDs...)
+	if err != nil {
+		return err
+	}
+	logger.LogInfo(reqId, reqUrl, "owner assigned for the requested restaurants in db successfully", 0)
+	return nil
+}
+
+func (db *SqliteDB) RemoveOwnerForRestaurants(ctx context.Context, userAuth *models.UserAuth, ownerID string, resIDs ...int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to remove owner of restaurants")
+	err := db.setRestaurantsOwner(ctx, userAuth, ownerID, sql.NullString{}, resIDs...)
+	if err != nil {
+		return err
+	}
+	logger.LogInfo(reqId, reqUrl, "owner removed of the requested restaurants in db successfully", 0)
+	return nil
+}
+
+func (db *SqliteDB) CheckRestaurantCreator(ctx context.Context, creatorID string, resID int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to check restaurant creator")
+	var creatorIDOut sql.NullString
+	err := db.QueryRowContext(ctx, CheckRestaurantCreator, resID).Scan(&creatorIDOut)
+	if err != nil || !creatorIDOut.Valid {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		if err != nil && err != sql.ErrNoRows {
+			return database.ErrInternal
+		}
+		return database.ErrNonExistingRestaurant
+	}
+	if creatorIDOut.String != creatorID {
+		logger.LogError(reqId, reqUrl, "error invalid creator", 0)
+		return database.ErrInvalidRestaurantCreator
+	}
+	logger.LogInfo(reqId, reqUrl, "restaurant creator verified", 0)
+	return nil
+}
+
+func (db *SqliteDB) UpdateRestaurant(ctx context.Context, restaurant *models.RestaurantOutput) (*models.RestaurantOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to update a restaurant")
+	res, err := db.ExecContext(ctx, RestaurantUpdate, restaurant.Name, restaurant.Lat, restaurant.Lng, restaurant.ID)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	if numUpdatedRows, _ := res.RowsAffected(); numUpdatedRows == 0 {
+		return nil, database.ErrNonExistingRestaurant
+	}
+	logger.LogDebug(reqId, reqUrl, "executing query to fetch updated restaurant")
+	result, err := db.queryRestaurant(ctx, restaurant.ID)
+	if err != nil {
+		return nil, database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "restaurant updated in db successfully", 0)
+	return result, nil
+}
+
+func (db *SqliteDB) RemoveRestaurants(ctx context.Context, userAuth *models.UserAuth, resIDs ...int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "selecting query to delete restaurant according to scope")
+	var query string
+	args := make([][]interface{}, len(resIDs))
+	switch userAuth.Scope {
+	case models.ScopeAll:
+		query = DeleteRestaurant
+		for i, id := range resIDs {
+			args[i] = []interface{}{id}
+		}
+	case models.ScopeCreated:
+		query = DeleteCreatedRestaurant
+		for i, id := range resIDs {
+			args[i] = []interface{}{id, userAuth.ID}
+		}
+	default:
+		return database.ErrInternal
+	}
+	err := db.deleteEach(ctx, query, "Restaurants", args, nil)
+	if err != nil {
+		return err
+	}
+	logger.LogInfo(reqId, reqUrl, "restaurants deleted from db successfully", 0)
+	return nil
+}
+
+//menu
+
+func (db *SqliteDB) CheckRestaurantOwner(ctx context.Context, ownerID string, resID int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to verify restaurant owner")
+	var ownerIDOut sql.NullString
+	err := db.QueryRowContext(ctx, CheckRestaurantOwner, resID).Scan(&ownerIDOut)
+	if err != nil || !ownerIDOut.Valid {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		if err != nil && err != sql.ErrNoRows {
+			return database.ErrInternal
+		}
+		return database.ErrNonExistingRestaurant
+	}
+	if ownerIDOut.String != ownerID {
+		logger.LogError(reqId, reqUrl, "error invalid restaurant owner", 0)
+		return database.ErrInvalidRestaurantOwner
+	}
+	logger.LogInfo(reqId, reqUrl, "restaurant owner validated from db successfully", 0)
+	return nil
+}
+
+func (db *SqliteDB) ShowMenu(ctx context.Context, resID int, opts *models.ListOptions) ([]models.DishOutput, int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to get menu")
+	if !db.checkRestaurantID(ctx, resID) {
+		return nil, 0, database.ErrNonExistingRestaurant
+	}
+	query, countQuery, queryArgs, countArgs := database.ListQueries("id,name,price", "dishes", []string{"res_id=?"}, []interface{}{resID}, opts)
+	total, err := db.countRows(ctx, countQuery, countArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := db.QueryContext(ctx, query, queryArgs...)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, 0, database.ErrInternal
+	}
+	defer rows.Close()
+	result, err := database.ScanDishes(rows)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		return nil, 0, database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "menu retrieved from db successfully", 0)
+	return result, total, nil
+}
+
+func (db *SqliteDB) InsertDishes(ctx context.Context, dish models.Dish, resID int) (*models.DishOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to insert dish")
+	res, err := db.ExecContext(ctx, InsertDish, resID, dish.Name, dish.Price)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrNonExistingRestaurant
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting inserted id: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	logger.LogDebug(reqId, reqUrl, "executing query to fetch added dish")
+	addedDish, err := db.queryDish(ctx, int(id))
+	if err != nil {
+		return nil, database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "dish added in db successfully", 0)
+	return addedDish, nil
+}
+
+func (db *SqliteDB) UpdateDish(ctx context.Context, dish *models.DishOutput) (*models.DishOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to update dish")
+	_, err := db.ExecContext(ctx, DishUpdate, dish.Name, dish.Price, dish.ID)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	logger.LogDebug(reqId, reqUrl, "executing query to fetch updated dish")
+	updatedDish, err := db.queryDish(ctx, dish.ID)
+	if err != nil {
+		return nil, database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "dish updated in db successfully", 0)
+	return updatedDish, nil
+}
+
+func (db *SqliteDB) CheckRestaurantDish(ctx context.Context, resID int, dishID int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to check the requested dish in the restaurant")
+	var resIDOut int
+	err := db.QueryRowContext(ctx, CheckRestaurantDish, dishID).Scan(&resIDOut)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		if err == sql.ErrNoRows {
+			return database.ErrInvalidDish
+		}
+		return database.ErrInternal
+	}
+	if resIDOut != resID {
+		logger.LogError(reqId, reqUrl, "requested dish is of some other restaurant", 0)
+		return database.ErrInvalidRestaurantDish
+	}
+	logger.LogInfo(reqId, reqUrl, "checking of the requested dish in the restaurant successful", 0)
+	return nil
+}
+
+func (db *SqliteDB) RemoveDishes(ctx context.Context, dishIDs ...int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to delete the dish")
+	args := make([][]interface{}, len(dishIDs))
+	for i, id := range dishIDs {
+		args[i] = []interface{}{id}
+	}
+	err := db.deleteEach(ctx, DeleteDishes, "Dishes", args, nil)
+	if err != nil {
+		return err
+	}
+	logger.LogInfo(reqId, reqUrl, "dish deleted in db successfully", 0)
+	return nil
+}
+
+func (db *SqliteDB) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to store revoked token")
+	_, err := db.ExecContext(ctx, "insert or ignore into revoked_tokens(jti,expires_at) values(?,?)", jti, expiresAt.Unix())
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "revoked token stored in db successfully", 0)
+	return nil
+}
+
+func (db *SqliteDB) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to check revoked token")
+	var count int
+	err := db.QueryRowContext(ctx, "select count(*) from revoked_tokens where jti=?", jti).Scan(&count)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return false, database.ErrInternal
+	}
+	return count != 0, nil
+}
+
+func (db *SqliteDB) StoreRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to store refresh token")
+	_, err := db.ExecContext(ctx, "insert into refresh_tokens(id,family_id,user_id,role,expires_at,used) values(?,?,?,?,?,?)",
+		token.Hash, token.FamilyID, token.UserID, token.Role, token.ExpiresAt.Unix(), token.Used)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "refresh token stored in db successfully", 0)
+	return nil
+}
+
+func (db *SqliteDB) UseRefreshToken(ctx context.Context, hash string, now time.Time) (*models.RefreshToken, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to use refresh token")
+	// the conditional update lets a single one of concurrent refreshes with the same token succeed
+	result, err := db.ExecContext(ctx, "update refresh_tokens set used=true where id=? and used=false and expires_at>?", hash, now.Unix())
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	token := &models.RefreshToken{Hash: hash}
+	var expiresAt int64
+	err = db.QueryRowContext(ctx, "select family_id,user_id,role,expires_at,used from refresh_tokens where id=?", hash).
+		Scan(&token.FamilyID, &token.UserID, &token.Role, &expiresAt, &token.Used)
+	if err == sql.ErrNoRows {
+		return nil, database.ErrInvalidRefreshToken
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	token.ExpiresAt = time.Unix(expiresAt, 0)
+	if updated == 1 {
+		logger.LogInfo(reqId, reqUrl, "refresh token used successfully", 0)
+		return token, nil
+	}
+	if !token.Used {
+		return nil, database.ErrInvalidRefreshToken
+	}
+	logger.LogError(reqId, reqUrl, fmt.Sprintf("refresh token reused, revoking family %s", token.FamilyID), 0)
+	err = db.RevokeRefreshTokens(ctx, token.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	return nil, database.ErrRefreshTokenReused
+}
+
+func (db *SqliteDB) RevokeRefreshTokens(ctx context.Context, familyID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to revoke refresh token family")
+	err := db.RunInTx(ctx, func(conn database.Conn) error {
+		for _, query := range []string{"delete from refresh_tokens where family_id=?", "delete from sessions where id=?"} {
+			_, err := conn.ExecContext(ctx, query, familyID)
+			if err != nil {
+				logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+				return database.ErrInternal
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logger.LogInfo(reqId, reqUrl, "refresh token family revoked successfully", 0)
+	return nil
+}
+
+func (db *SqliteDB) FindUserID(ctx context.Context, role string, email string) (string, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to find user by email")
+	var id string
+	err := db.QueryRowContext(ctx, "select id from users where role=? and email_id=? and "+database.NotDeletedCondition, role, email).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", database.ErrUserNotFound
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return "", database.ErrInternal
+	}
+	return id, nil
+}
+
+func (db *SqliteDB) CountUsers(ctx context.Context, role string) (int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to count users")
+	var count int
+	err := db.QueryRowContext(ctx, "select count(*) from users where role=? and "+database.NotDeletedCondition, role).Scan(&count)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return 0, database.ErrInternal
+	}
+	return count, nil
+}
+
+func (db *SqliteDB) LockUsers(ctx context.Context, role string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to lock users")
+	// writing takes the database lock, sqlite transactions also hold its single connection
+	_, err := db.ExecContext(ctx, "insert or ignore into settings(name,value) values(?,'')", database.UsersLockSetting(role))
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	return nil
+}
+
+func (db *SqliteDB) GetUser(ctx context.Context, userID string, role string) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to get user")
+	user := &models.UserOutput{ID: userID, Role: role}
+	err := db.QueryRowContext(ctx, "select email_id,name,status from users where id=? and role=? and "+database.NotDeletedCondition, userID, role).
+		Scan(&user.Email, &user.Name, &user.Status)
+	if err == sql.ErrNoRows {
+		return nil, database.ErrUserNotFound
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	return user, nil
+}
+
+func (db *SqliteDB) GetUserStatus(ctx context.Context, userID string, role string) (string, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	var status string
+	err := db.QueryRowContext(ctx, "select status from users where id=? and role=?", userID, role).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", database.ErrUserNotFound
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return "", database.ErrInternal
+	}
+	return status, nil
+}
+
+func (db *SqliteDB) SuspendUser(ctx context.Context, userID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to suspend user")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		result, err := conn.ExecContext(ctx, "update users set status=?,status_changed_at=? where id=? and "+database.NotDeletedCondition,
+			models.StatusSuspended, time.Now().Unix(), userID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		if updated != 1 {
+			return database.ErrUserNotFound
+		}
+		err = endSessions(ctx, conn, userID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		logger.LogInfo(reqId, reqUrl, "user suspended in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *SqliteDB) ReactivateUser(ctx context.Context, userID string) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to reactivate user")
+	_, err := db.ExecContext(ctx, "update users set status=?,status_changed_at=? where id=? and status<>?",
+		models.StatusActive, time.Now().Unix(), userID, models.StatusActive)
+	if err != nil {
+		// the email of a deleted account can be taken by another account since
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, toDatabaseError(err)
+	}
+	logger.LogDebug(reqId, reqUrl, "fetching reactivated user")
+	var user models.UserOutput
+	err = db.QueryRowContext(ctx, "select "+UserColumns+" from users where id=?", userID).Scan(&user.ID, &user.Email, &user.Name, &user.Role, &user.Status)
+	if err == sql.ErrNoRows {
+		return nil, database.ErrUserNotFound
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "user reactivated in db successfully", 0)
+	return &user, nil
+}
+
+func (db *SqliteDB) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to purge deleted users")
+	var purged int64
+	err := db.RunInTx(ctx, func(conn database.Conn) error {
+		// the users are read first to build the lockout keys of their second factor
+		rows, err := conn.QueryContext(ctx, "select id,role from users where status=? and status_changed_at<=?", models.StatusDeleted, deletedBefore.Unix())
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		var users []models.UserAuth
+		for rows.Next() {
+			var user models.UserAuth
+			err = rows.Scan(&user.ID, &user.Role)
+			if err != nil {
+				break
+			}
+			users = append(users, user)
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+		rows.Close()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in reading deleted users: %v", err), 0)
+			return database.ErrInternal
+		}
+		for _, user := range users {
+			for _, query := range []string{
+				"delete from password_reset_tokens where user_id=?",
+				"delete from email_verification_tokens where user_id=?",
+				"delete from two_factor where user_id=?",
+				"delete from recovery_codes where user_id=?",
+				"delete from api_keys where user_id=?",
+				"delete from refresh_tokens where user_id=?",
+				"delete from sessions where user_id=?",
+				"update restaurants set creator_id=null where creator_id=?",
+				"update users set creator_id=null where creator_id=?",
+				"delete from users where id=?",
+			} {
+				_, err = conn.ExecContext(ctx, query, user.ID)
+				if err != nil {
+					logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+					return database.ErrInternal
+				}
+			}
+			_, err = conn.ExecContext(ctx, "delete from login_failures where id=?", database.TwoFactorLockKey(user.Role, user.ID))
+			if err != nil {
+				logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+				return database.ErrInternal
+			}
+		}
+		purged = int64(len(users))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("%d deleted users purged", purged), 0)
+	return purged, nil
+}
+
+func (db *SqliteDB) StorePasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to store password reset token")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		_, err := conn.ExecContext(ctx, "delete from password_reset_tokens where user_id=? and role=?", token.UserID, token.Role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		_, err = conn.ExecContext(ctx, "insert into password_reset_tokens(id,user_id,role,expires_at) values(?,?,?,?)",
+			token.Hash, token.UserID, token.Role, token.ExpiresAt.Unix())
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		logger.LogInfo(reqId, reqUrl, "password reset token stored in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *SqliteDB) ResetPassword(ctx context.Context, hash string, password string, now time.Time) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to reset password")
+	logger.LogDebug(reqId, reqUrl, "generating password hash")
+	pass, err := encryption.GenerateHash(db.hasher, password)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in generating password hash: %v", err), 0)
+		return database.ErrInternal
+	}
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		var userID, role string
+		var expiresAt int64
+		err := conn.QueryRowContext(ctx, "select user_id,role,expires_at from password_reset_tokens where id=?", hash).Scan(&userID, &role, &expiresAt)
+		if err == sql.ErrNoRows {
+			return database.ErrInvalidResetToken
+		}
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		// deleting the token before using it lets a single one of concurrent resets succeed
+		result, err := conn.ExecContext(ctx, "delete from password_reset_tokens where id=?", hash)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		if deleted != 1 || expiresAt <= now.Unix() {
+			return database.ErrInvalidResetToken
+		}
+		result, err = conn.ExecContext(ctx, "update users set password=? where id=? and role=?", pass, userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		if updated != 1 {
+			return database.ErrInvalidResetToken
+		}
+		for _, query := range []string{"delete from password_reset_tokens where user_id=? and role=?", "delete from refresh_tokens where user_id=? and role=?",
+			"delete from sessions where user_id=? and role=?"} {
+			_, err = conn.ExecContext(ctx, query, userID, role)
+			if err != nil {
+				logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+				return database.ErrInternal
+			}
+		}
+		logger.LogInfo(reqId, reqUrl, "password reset in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *SqliteDB) UpdateProfile(ctx context.Context, user *models.UserOutput) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to update profile of user")
+	_, err := db.ExecContext(ctx, "update users set verified=(verified and email_id=?),email_id=?,name=? where id=? and role=?", user.Email, user.Email, user.Name, user.ID, user.Role)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, toDatabaseError(err)
+	}
+	logger.LogDebug(reqId, reqUrl, "fetching updated user")
+	result, err := db.GetUser(ctx, user.ID, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	logger.LogInfo(reqId, reqUrl, "profile updated in db successfully", 0)
+	return result, nil
+}
+
+func (db *SqliteDB) ChangePassword(ctx context.Context, userID string, role string, current string, password string, keepID string) (int64, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to change password")
+	var oldHash string
+	err := db.QueryRowContext(ctx, "select password from users where id=? and role=?", userID, role).Scan(&oldHash)
+	if err == sql.ErrNoRows {
+		return 0, database.ErrUserNotFound
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return 0, database.ErrInternal
+	}
+	logger.LogDebug(reqId, reqUrl, "comparing passwords")
+	if !encryption.ComparePasswords(ctx, db.hasher, oldHash, current) {
+		return 0, database.ErrInvalidCredentials
+	}
+	logger.LogDebug(reqId, reqUrl, "generating password hash")
+	pass, err := encryption.GenerateHash(db.hasher, password)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in generating password hash: %v", err), 0)
+		return 0, database.ErrInternal
+	}
+	var revoked int64
+	err = db.RunInTx(ctx, func(conn database.Conn) error {
+		// matching the verified hash refuses the change when the password changed in the meantime
+		result, err := conn.ExecContext(ctx, "update users set password=? where id=? and role=? and password=?", pass, userID, role, oldHash)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		if updated != 1 {
+			return database.ErrInvalidCredentials
+		}
+		_, err = conn.ExecContext(ctx, "delete from password_reset_tokens where user_id=? and role=?", userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		_, err = conn.ExecContext(ctx, "delete from refresh_tokens where family_id in (select id from sessions where user_id=? and role=? and id<>?)", userID, role, keepID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		result, err = conn.ExecContext(ctx, "delete from sessions where user_id=? and role=? and id<>?", userID, role, keepID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		revoked, err = result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("password changed in db successfully, %d sessions revoked", revoked), 0)
+	return revoked, nil
+}
+
+func (db *SqliteDB) StoreVerificationToken(ctx context.Context, token *models.VerificationToken) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to store email verification token")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		var verified bool
+		err := conn.QueryRowContext(ctx, "select verified from users where id=? and role=? and "+database.NotDeletedCondition, token.UserID, token.Role).Scan(&verified)
+		if err == sql.ErrNoRows {
+			return database.ErrUserNotFound
+		}
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		if verified {
+			return database.ErrAlreadyVerified
+		}
+		_, err = conn.ExecContext(ctx, "delete from email_verification_tokens where user_id=? and role=?", token.UserID, token.Role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		_, err = conn.ExecContext(ctx, "insert into email_verification_tokens(id,user_id,role,expires_at) values(?,?,?,?)",
+			token.Hash, token.UserID, token.Role, token.ExpiresAt.Unix())
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		logger.LogInfo(reqId, reqUrl, "email verification token stored in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *SqliteDB) VerifyEmail(ctx context.Context, hash string, now time.Time) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to verify email")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		var userID, role string
+		var expiresAt int64
+		err := conn.QueryRowContext(ctx, "select user_id,role,expires_at from email_verification_tokens where id=?", hash).Scan(&userID, &role, &expiresAt)
+		if err == sql.ErrNoRows {
+			return database.ErrInvalidVerificationToken
+		}
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		if expiresAt <= now.Unix() {
+			return database.ErrInvalidVerificationToken
+		}
+		result, err := conn.ExecContext(ctx, "update users set verified=true where id=? and role=?", userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		if updated != 1 {
+			return database.ErrInvalidVerificationToken
+		}
+		_, err = conn.ExecContext(ctx, "delete from email_verification_tokens where user_id=? and role=?", userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		logger.LogInfo(reqId, reqUrl, "email verified in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *SqliteDB) GetTwoFactor(ctx context.Context, userID string, role string) (*models.TwoFactor, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to get two-factor enrolment")
+	tf := &models.TwoFactor{UserID: userID, Role: role}
+	err := db.QueryRowContext(ctx, "select secret,enabled,last_step from two_factor where user_id=? and role=?", userID, role).Scan(&tf.Secret, &tf.Enabled, &tf.LastStep)
+	if err != nil && err != sql.ErrNoRows {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	return tf, nil
+}
+
+func (db *SqliteDB) StoreTwoFactorSecret(ctx context.Context, userID string, role string, secret string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to store two-factor secret")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		var enabled bool
+		err := conn.QueryRowContext(ctx, "select enabled from two_factor where user_id=? and role=?", userID, role).Scan(&enabled)
+		if err != nil && err != sql.ErrNoRows {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		if enabled {
+			return database.ErrTwoFactorEnabled
+		}
+		_, err = conn.ExecContext(ctx, "delete from two_factor where user_id=? and role=?", userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		_, err = conn.ExecContext(ctx, "insert into two_factor(user_id,role,secret) values(?,?,?)", userID, role, secret)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		logger.LogInfo(reqId, reqUrl, "two-factor secret stored in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *SqliteDB) EnableTwoFactor(ctx context.Context, userID string, role string, step int64, recoveryHashes []string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to enable two-factor authentication")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		result, err := conn.ExecContext(ctx, "update two_factor set enabled=true,last_step=? where user_id=? and role=? and enabled=false", step, userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		if updated != 1 {
+			return database.ErrTwoFactorNotPending
+		}
+		err = replaceRecoveryCodes(ctx, conn, userID, role, recoveryHashes)
+		if err != nil {
+			return err
+		}
+		logger.LogInfo(reqId, reqUrl, "two-factor authentication enabled in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *SqliteDB) UseTwoFactorStep(ctx context.Context, userID string, role string, step int64) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to use two-factor code")
+	result, err := db.ExecContext(ctx, "update two_factor set last_step=? where user_id=? and role=? and enabled=true and last_step<?", step, userID, role, step)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+		return database.ErrInternal
+	}
+	if updated != 1 {
+		return database.ErrTwoFactorCodeUsed
+	}
+	return nil
+}
+
+func (db *SqliteDB) UseRecoveryCode(ctx context.Context, userID string, role string, hash string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to use recovery code")
+	result, err := db.ExecContext(ctx, "delete from recovery_codes where id=? and user_id=? and role=?", hash, userID, role)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+		return database.ErrInternal
+	}
+	if deleted != 1 {
+		return database.ErrInvalidRecoveryCode
+	}
+	logger.LogInfo(reqId, reqUrl, "recovery code used successfully", 0)
+	return nil
+}
+
+func (db *SqliteDB) ReplaceRecoveryCodes(ctx context.Context, userID string, role string, hashes []string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to replace recovery codes")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		return replaceRecoveryCodes(ctx, conn, userID, role, hashes)
+	})
+}
+
+func (db *SqliteDB) DisableTwoFactor(ctx context.Context, userID string, role string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to disable two-factor authentication")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		for _, query := range []string{"delete from two_factor where user_id=? and role=?", "delete from recovery_codes where user_id=? and role=?"} {
+			_, err := conn.ExecContext(ctx, query, userID, role)
+			if err != nil {
+				logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+				return database.ErrInternal
+			}
+		}
+		logger.LogInfo(reqId, reqUrl, "two-factor authentication disabled in db successfully", 0)
+		return nil
+	})
+}
+
+func (db *SqliteDB) SetTwoFactorRequired(ctx context.Context, required bool) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to set two-factor policy")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		_, err := conn.ExecContext(ctx, "delete from settings where name=?", database.SettingTwoFactorRequired)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		_, err = conn.ExecContext(ctx, "insert into settings(name,value) values(?,?)", database.SettingTwoFactorRequired, strconv.FormatBool(required))
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		return nil
+	})
+}
+
+func (db *SqliteDB) IsTwoFactorRequired(ctx context.Context) (bool, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to get two-factor policy")
+	var value string
+	err := db.QueryRowContext(ctx, "select value from settings where name=?", database.SettingTwoFactorRequired).Scan(&value)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return false, database.ErrInternal
+	}
+	return value == "true", nil
+}
+
+func (db *SqliteDB) RecordLoginFailure(ctx context.Context, key string, now time.Time, expiresAt time.Time) (int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to record login failure")
+	var failures int
+	err := db.RunInTx(ctx, func(conn database.Conn) error {
+		var lockedUntil, expires int64
+		err := conn.QueryRowContext(ctx, "select failures,locked_until,expires_at from login_failures where id=?", key).Scan(&failures, &lockedUntil, &expires)
+		if err != nil && err != sql.ErrNoRows {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		if err == sql.ErrNoRows || expires <= now.Unix() {
+			failures, lockedUntil = 0, 0
+		}
+		failures++
+		if lockedUntil > expiresAt.Unix() {
+			expiresAt = time.Unix(lockedUntil, 0)
+		}
+		_, err = conn.ExecContext(ctx, "delete from login_failures where id=?", key)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		_, err = conn.ExecContext(ctx, "insert into login_failures(id,failures,locked_until,expires_at) values(?,?,?,?)", key, failures, lockedUntil, expiresAt.Unix())
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		return nil
+	})
+	return failures, err
+}
+
+func (db *SqliteDB) LockLogin(ctx context.Context, key string, until time.Time) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to lock login")
+	_, err := db.ExecContext(ctx, "update login_failures set locked_until=?,expires_at=(case when expires_at<? then ? else expires_at end) where id=?",
+		until.Unix(), until.Unix(), until.Unix(), key)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	return nil
+}
+
+func (db *SqliteDB) GetLoginLock(ctx context.Context, now time.Time, keys ...string) (time.Time, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to get login lock")
+	var latest int64
+	for _, key := range keys {
+		var lockedUntil int64
+		err := db.QueryRowContext(ctx, "select locked_until from login_failures where id=?", key).Scan(&lockedUntil)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return time.Time{}, database.ErrInternal
+		}
+		if lockedUntil > latest {
+			latest = lockedUntil
+		}
+	}
+	if latest <= now.Unix() {
+		return time.Time{}, nil
+	}
+	return time.Unix(latest, 0), nil
+}
+
+func (db *SqliteDB) ClearLoginFailures(ctx context.Context, keys ...string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to clear login failures")
+	for _, key := range keys {
+		_, err := db.ExecContext(ctx, "delete from login_failures where id=?", key)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+	}
+	return nil
+}
+
+func (db *SqliteDB) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to create api key")
+	_, err := db.ExecContext(ctx, "insert into api_keys(id,hash,prefix,name,user_id,role,permissions,created_at) values(?,?,?,?,?,?,?,?)",
+		key.ID, key.Hash, key.Prefix, key.Name, key.UserID, key.Role, strings.Join(key.Permissions, ","), key.CreatedAt.Unix())
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "api key created in db successfully", 0)
+	return nil
+}
+
+func (db *SqliteDB) ShowAPIKeys(ctx context.Context, userID string, role string) ([]models.APIKey, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to show api keys")
+	rows, err := db.QueryContext(ctx, "select "+database.APIKeyColumns+" from api_keys where user_id=? and role=? order by created_at,id", userID, role)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	defer rows.Close()
+	keys, err := database.ScanAPIKeys(rows)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in scanning rows: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	return keys, nil
+}
+
+func (db *SqliteDB) RevokeAPIKey(ctx context.Context, userID string, role string, keyID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to revoke api key")
+	result, err := db.ExecContext(ctx, "delete from api_keys where id=? and user_id=? and role=?", keyID, userID, role)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+		return database.ErrInternal
+	}
+	if deleted == 0 {
+		return database.ErrAPIKeyNotFound
+	}
+	logger.LogInfo(reqId, reqUrl, "api key revoked successfully", 0)
+	return nil
+}
+
+func (db *SqliteDB) UseAPIKey(ctx context.Context, hash string, now time.Time) (*models.APIKey, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to use api key")
+	var key *models.APIKey
+	err := db.RunInTx(ctx, func(conn database.Conn) error {
+		var err error
+		key, err = database.ScanAPIKey(conn.QueryRowContext(ctx, SelectUsableAPIKey, hash))
+		if err == sql.ErrNoRows {
+			return database.ErrInvalidAPIKey
+		}
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		_, err = conn.ExecContext(ctx, "update api_keys set last_used_at=? where id=?", now.Unix(), key.ID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	key.LastUsedAt = &now
+	return key, nil
+}
+
+func (db *SqliteDB) CreateSession(ctx context.Context, session *models.Session) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to create session")
+	_, err := db.ExecContext(ctx, "insert into sessions(id,user_id,role,device,ip,issued_at,last_seen_at,expires_at) values(?,?,?,?,?,?,?,?)",
+		session.ID, session.UserID, session.Role, session.Device, session.IP, session.IssuedAt.Unix(), session.LastSeenAt.Unix(), session.ExpiresAt.Unix())
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	logger.LogInfo(reqId, reqUrl, "session created in db successfully", 0)
+	return nil
+}
+
+func (db *SqliteDB) TouchSession(ctx context.Context, sessionID string, now time.Time, expiresAt time.Time) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to touch session")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		var expiry int64
+		err := conn.QueryRowContext(ctx, "select expires_at from sessions where id=?", sessionID).Scan(&expiry)
+		if err == sql.ErrNoRows || (err == nil && expiry <= now.Unix()) {
+			return database.ErrSessionNotFound
+		}
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		if expiresAt.Unix() > expiry {
+			expiry = expiresAt.Unix()
+		}
+		_, err = conn.ExecContext(ctx, "update sessions set last_seen_at=?,expires_at=? where id=?", now.Unix(), expiry, sessionID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		return nil
+	})
+}
+
+func (db *SqliteDB) ShowSessions(ctx context.Context, userID string, role string, now time.Time) ([]models.Session, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing query to show sessions")
+	rows, err := db.QueryContext(ctx, "select "+database.SessionColumns+" from sessions where user_id=? and role=? and expires_at>? order by last_seen_at desc,id", userID, role, now.Unix())
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	defer rows.Close()
+	sessions, err := database.ScanSessions(rows)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in scanning rows: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	return sessions, nil
+}
+
+func (db *SqliteDB) RevokeSession(ctx context.Context, userID string, role string, sessionID string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to revoke session")
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		result, err := conn.ExecContext(ctx, "delete from sessions where id=? and user_id=? and role=?", sessionID, userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		if deleted == 0 {
+			return database.ErrSessionNotFound
+		}
+		_, err = conn.ExecContext(ctx, "delete from refresh_tokens where family_id=?", sessionID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		logger.LogInfo(reqId, reqUrl, "session revoked successfully", 0)
+		return nil
+	})
+}
+
+func (db *SqliteDB) RevokeSessions(ctx context.Context, userID string, role string, keepID string) (int64, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to revoke sessions of user")
+	var revoked int64
+	err := db.RunInTx(ctx, func(conn database.Conn) error {
+		_, err := conn.ExecContext(ctx, "delete from refresh_tokens where family_id in (select id from sessions where user_id=? and role=? and id<>?)", userID, role, keepID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		result, err := conn.ExecContext(ctx, "delete from sessions where user_id=? and role=? and id<>?", userID, role, keepID)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		revoked, err = result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return database.ErrInternal
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("%d sessions revoked", revoked), 0)
+	return revoked, nil
+}
+
+func (db *SqliteDB) PurgeExpiredTokens(ctx context.Context, now time.Time) (int64, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "executing queries to purge expired tokens")
+	var purged int64
+	for _, query := range []string{
+		"delete from revoked_tokens where expires_at<=?",
+		"delete from refresh_tokens where expires_at<=?",
+		"delete from password_reset_tokens where expires_at<=?",
+		"delete from email_verification_tokens where expires_at<=?",
+		"delete from login_failures where expires_at<=?",
+		"delete from sessions where expires_at<=?",
+	} {
+		result, err := db.ExecContext(ctx, query, now.Unix())
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return purged, database.ErrInternal
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in getting affected rows: %v", err), 0)
+			return purged, database.ErrInternal
+		}
+		purged += deleted
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("%d expired tokens purged", purged), 0)
+	return purged, nil
+}
+
+// WithTx runs fn with a database bound to a single transaction, it is committed when fn returns nil
+func (db *SqliteDB) WithTx(ctx context.Context, fn func(tx database.Database) error) error {
+	return db.RunInTx(ctx, func(conn database.Conn) error {
+		return fn(&SqliteDB{Conn: conn, latestMigration: db.latestMigration, hasher: db.hasher})
+	})
+}
+
+//helpers
+
+// replaceRecoveryCodes stores hashes in place of the recovery codes of the user within the transaction of conn
+func replaceRecoveryCodes(ctx context.Context, conn database.Conn, userID, role string, hashes []string) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	_, err := conn.ExecContext(ctx, "delete from recovery_codes where user_id=? and role=?", userID, role)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return database.ErrInternal
+	}
+	for _, hash := range hashes {
+		_, err = conn.ExecContext(ctx, "insert into recovery_codes(id,user_id,role) values(?,?,?)", hash, userID, role)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+	}
+	return nil
+}
+
+func (db *SqliteDB) queryUser(ctx context.Context, query string, args ...interface{}) (*models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	var user models.UserOutput
+	err := db.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.Email, &user.Name, &user.Role, &user.Status)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	return &user, nil
+}
+
+func (db *SqliteDB) queryUsers(ctx context.Context, query string, args ...interface{}) ([]models.UserOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	defer rows.Close()
+	result, err := database.ScanUsers(rows)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	return result, nil
+}
+
+func (db *SqliteDB) queryRestaurant(ctx context.Context, resID int) (*models.RestaurantOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	var result models.RestaurantOutput
+	err := db.QueryRowContext(ctx, SelectRestaurant, resID).Scan(&result.ID, &result.Name, &result.Lat, &result.Lng)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (db *SqliteDB) queryRestaurants(ctx context.Context, query string, args ...interface{}) ([]models.RestaurantOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	defer rows.Close()
+	result, err := database.ScanRestaurants(rows)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	return result, nil
+}
+
+func (db *SqliteDB) countRows(ctx context.Context, query string, args ...interface{}) (int, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	var count int
+	err := db.QueryRowContext(ctx, query, args...).Scan(&count)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in counting rows: %v", err), 0)
+		return 0, database.ErrInternal
+	}
+	return count, nil
+}
+
+func (db *SqliteDB) queryDish(ctx context.Context, dishID int) (*models.DishOutput, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	var result models.DishOutput
+	err := db.QueryRowContext(ctx, SelectDish, dishID).Scan(&result.ID, &result.Name, &result.Price)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("error in storing result in variable: %v", err), 0)
+		return nil, err
+	}
+	return &result, nil
+}
+
+// deleteEach executes query once per argument set and reports the entries which did not affect any row,
+// afterDelete if given is run with the arguments of every entry that was deleted
+func (db *SqliteDB) deleteEach(ctx context.Context, query string, data string, args [][]interface{}, afterDelete func([]interface{}) error) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	var ErrEntries []int
+	for i, arg := range args {
+		result, err := db.ExecContext(ctx, query, arg...)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+		numDeletedRows, _ := result.RowsAffected()
+		if numDeletedRows == 0 {
+			ErrEntries = append(ErrEntries, i)
+			continue
+		}
+		if afterDelete != nil {
+			err = afterDelete(arg)
+			if err != nil {
+				logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+				return database.ErrInternal
+			}
+		}
+	}
+	length := len(ErrEntries)
+	if length != 0 {
+		return database.SendErrorMessage(ctx, ErrEntries, length, data)
+	}
+	return nil
+}
+
+// endSessions deletes the sessions and refresh tokens of the user with the given id
+func endSessions(ctx context.Context, conn database.Conn, userID interface{}) error {
+	for _, query := range []string{"delete from refresh_tokens where user_id=?", "delete from sessions where user_id=?"} {
+		_, err := conn.ExecContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *SqliteDB) setRestaurantsOwner(ctx context.Context, userAuth *models.UserAuth, ownerID string, newOwnerID sql.NullString, resIDs ...int) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	if !db.checkOwnerID(ctx, ownerID) {
+		return database.ErrInvalidOwner
+	}
+	var ErrEntries []int
+	for i, id := range resIDs {
+		if userAuth.Scope != models.ScopeAll {
+			err := db.CheckRestaurantCreator(ctx, userAuth.ID, id)
+			if err != nil {
+				ErrEntries = append(ErrEntries, i)
+				continue
+			}
+		}
+		_, err := db.ExecContext(ctx, "update restaurants set owner_id=? where id=?", newOwnerID, id)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("error in executing query: %v", err), 0)
+			return database.ErrInternal
+		}
+	}
+	length := len(ErrEntries)
+	if length != 0 {
+		return database.SendErrorMessage(ctx, ErrEntries, length, "Restaurants")
+	}
+	return nil
+}
+
+func (db *SqliteDB) checkOwnerID(ctx context.Context, ownerID string) bool {
+	var count int
+	err := db.QueryRowContext(ctx, "select count(*) from users where id=? and role=? and "+database.NotDeletedCondition, ownerID, middleware.Owner).Scan(&count)
+	return err == nil && count == 1
+}
+
+func (db *SqliteDB) checkRestaurantID(ctx context.Context, resID int) bool {
+	var count int
+	err := db.QueryRowContext(ctx, "select count(*) from restaurants where id=?", resID).Scan(&count)
+	return err == nil && count == 1
+}
+
+func toDatabaseError(err error) error {
+	if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return database.ErrDupEmail
+	}
+	return database.ErrInternal
+}
+
+////////////////////
+//Database migration
+
+// NewMigrate returns a migrate instance for the configured database, closing it closes the connection
+func NewMigrate(cfg *config.Database) (*migrate.Migrate, error) {
+	db, err := open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return migrations.New(migrations.SQLite, db)
+}
+
+func open(cfg *config.Database) (*sql.DB, error) {
+	dsn := strings.TrimPrefix(cfg.URL, "sqlite://")
+	if strings.Contains(dsn, "?") {
+		dsn = dsn + "&_foreign_keys=1"
+	} else {
+		dsn = dsn + "?_foreign_keys=1"
+	}
+	db, err := sql.Open(DriverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite allows a single writer, a single connection also keeps ":memory:" databases shared
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// MigrationStatus pings the database and returns the schema version applied to it
+func (db *SqliteDB) MigrationStatus(ctx context.Context) (*models.MigrationStatus, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "checking database migration status")
+	status, err := database.QueryMigrationStatus(ctx, db.DB, db.latestMigration)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not get migration status: %v", err), 0)
+		return nil, database.ErrInternal
+	}
+	return status, nil
+}
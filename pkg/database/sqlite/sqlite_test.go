@@ -0,0 +1,67 @@
+package sqlite_test
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database/databasetest"
+	"github.com/vds/go-resman/pkg/database/sqlite"
+	"github.com/vds/go-resman/pkg/logger"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func init() {
+	logger.InitLogger(logrus.ErrorLevel)
+}
+
+func TestSqliteDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resman")
+	if err != nil {
+		t.Fatalf("can not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := sqlite.NewSqliteDB(&config.Database{URL: "sqlite://" + filepath.Join(dir, "resman.db")})
+	if err != nil {
+		t.Fatalf("can not get db instance: %v", err)
+	}
+	defer db.Close()
+	databasetest.RunTests(t, db)
+}
+
+func TestSqliteSkipMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resman")
+	if err != nil {
+		t.Fatalf("can not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := &config.Database{URL: filepath.Join(dir, "resman.db"), SkipMigrate: true}
+	db, err := sqlite.NewSqliteDB(cfg)
+	if err != nil {
+		t.Fatalf("can not get db instance: %v", err)
+	}
+	defer db.Close()
+	// without any migration there is not even a table recording the version
+	status, err := db.MigrationStatus(databasetest.Context())
+	if err == nil && status.Complete() {
+		t.Fatalf("migrations should not be applied, got %+v", status)
+	}
+
+	migration, err := sqlite.NewMigrate(cfg)
+	if err != nil {
+		t.Fatalf("can not get migrate instance: %v", err)
+	}
+	defer migration.Close()
+	err = migration.Up()
+	if err != nil {
+		t.Fatalf("can not apply migrations: %v", err)
+	}
+	status, err = db.MigrationStatus(databasetest.Context())
+	if err != nil {
+		t.Fatalf("can not get migration status: %v", err)
+	}
+	if !status.Complete() {
+		t.Errorf("migrations should be applied, got %+v", status)
+	}
+}
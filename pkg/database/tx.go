@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/vds/go-resman/pkg/logger"
+)
+
+// Conn is embedded by the sql backends in place of *sql.DB, its query methods run on Tx
+// when the backend is bound to a transaction and on DB otherwise
+type Conn struct {
+	*sql.DB
+	Tx *sql.Tx
+}
+
+func (c Conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.ExecContext(context.Background(), query, args...)
+}
+
+func (c Conn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if c.Tx != nil {
+		return c.Tx.ExecContext(ctx, query, args...)
+	}
+	return c.DB.ExecContext(ctx, query, args...)
+}
+
+func (c Conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.QueryContext(context.Background(), query, args...)
+}
+
+func (c Conn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if c.Tx != nil {
+		return c.Tx.QueryContext(ctx, query, args...)
+	}
+	return c.DB.QueryContext(ctx, query, args...)
+}
+
+func (c Conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.QueryRowContext(context.Background(), query, args...)
+}
+
+func (c Conn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if c.Tx != nil {
+		return c.Tx.QueryRowContext(ctx, query, args...)
+	}
+	return c.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (c Conn) Prepare(query string) (*sql.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c Conn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if c.Tx != nil {
+		return c.Tx.PrepareContext(ctx, query)
+	}
+	return c.DB.PrepareContext(ctx, query)
+}
+
+// RunInTx calls fn with a Conn bound to a new transaction, the transaction is committed when fn
+// returns nil and rolled back otherwise. When c is already bound to a transaction fn joins it.
+// Errors returned by fn are passed through unchanged, failures to begin or commit are reported as ErrInternal
+func (c Conn) RunInTx(ctx context.Context, fn func(conn Conn) error) (err error) {
+	if c.Tx != nil {
+		return fn(c)
+	}
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "beginning transaction")
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not begin transaction: %v", err), 0)
+		return ErrInternal
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	err = fn(Conn{DB: c.DB, Tx: tx})
+	if err != nil {
+		logger.LogDebug(reqId, reqUrl, "rolling back transaction")
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("can not roll back transaction: %v", rollbackErr), 0)
+		}
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not commit transaction: %v", err), 0)
+		return ErrInternal
+	}
+	logger.LogDebug(reqId, reqUrl, "transaction committed")
+	return nil
+}
@@ -2,29 +2,97 @@ package encryption
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
 	"github.com/vds/go-resman/pkg/logger"
 	"github.com/vds/go-resman/pkg/models"
 	"time"
 )
 
-func CreateToken(ctx context.Context, claims *models.Claims) (string, error) {
+// CreateToken signs claims with the signing key of keys, the token gets a unique id used to revoke it
+// and expires after the configured lifetime
+func CreateToken(ctx context.Context, claims *models.Claims, keys *KeySet) (string, error) {
 	reqIdVal := ctx.Value("reqId")
 	reqId := reqIdVal.(string)
 	reqUrlVal := ctx.Value("reqUrl")
 	reqUrl := reqUrlVal.(string)
-	jwtKey := []byte("SecretKey")
-
 	logger.LogDebug(reqId, reqUrl, "generating jwt token")
 
-	expirationTime := time.Now().Add(120 * time.Minute).Unix()
-	claims.ExpiresAt = expirationTime
-	//remember to change it later
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	tokenString, err := signToken(claims, keys, keys.Auth().TokenLifetime.Duration)
 	if err != nil {
 		return "", err
 	}
 	logger.LogInfo(reqId, reqUrl, "jwt token generated", 0)
 	return tokenString, nil
 }
+
+// CreateChallengeToken signs claims for the given purpose with the short challenge lifetime, challenge
+// tokens carry the user between the steps of a login and are not accepted as access tokens
+func CreateChallengeToken(ctx context.Context, claims *models.Claims, purpose string, keys *KeySet) (string, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "generating challenge token")
+	claims.Purpose = purpose
+	return signToken(claims, keys, keys.Auth().ChallengeLifetime.Duration)
+}
+
+// CreateInvitationToken signs claims as an invitation valid for the configured invitation lifetime,
+// like challenge tokens invitations are not accepted as access tokens
+func CreateInvitationToken(ctx context.Context, claims *models.Claims, keys *KeySet) (string, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "generating invitation token")
+	claims.Purpose = models.PurposeInvitation
+	return signToken(claims, keys, keys.Auth().InvitationLifetime.Duration)
+}
+
+// CreateImpersonationToken signs claims of the impersonated user with the actor set, it is an access
+// token valid for the configured impersonation lifetime and comes without a refresh token
+func CreateImpersonationToken(ctx context.Context, claims *models.Claims, actor *models.Actor, keys *KeySet) (string, error) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	logger.LogDebug(reqId, reqUrl, "generating impersonation token")
+	claims.Act = actor
+	return signToken(claims, keys, keys.Auth().ImpersonationLifetime.Duration)
+}
+
+// signToken sets a unique id, the issue time and the expiry of claims before signing them
+func signToken(claims *models.Claims, keys *KeySet, lifetime time.Duration) (string, error) {
+	now := time.Now()
+	claims.Id = uuid.New().String()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(lifetime).Unix()
+	return keys.sign(claims)
+}
+
+// ParseToken verifies the signature and expiry of tokenStr against keys and returns its claims
+func ParseToken(tokenStr string, keys *KeySet) (*models.Claims, error) {
+	claims := &models.Claims{}
+	tkn, err := jwt.ParseWithClaims(tokenStr, claims, keys.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	if !tkn.Valid {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return claims, nil
+}
+
+// NewOpaqueToken returns a random token such as a refresh or password reset token, only its hash
+// is meant to be stored
+func NewOpaqueToken() (string, error) {
+	data := make([]byte, 32)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// HashOpaqueToken returns the hex encoded sha256 of token, opaque tokens are random so a
+// fast hash is enough to keep them unusable if the database leaks
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -3,29 +3,36 @@ package encryption
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/vds/go-resman/pkg/logger"
-	"golang.org/x/crypto/bcrypt"
 )
 
 //errors
 var errGenHash = errors.New("error in generating hash for email id")
 
-func GenerateHash(value string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(value), bcrypt.DefaultCost)
+// GenerateHash hashes value with hasher
+func GenerateHash(hasher PasswordHasher, value string) (string, error) {
+	hash, err := hasher.Hash(value)
 	if err != nil {
 		return "", errGenHash
 	}
-	return string(hash), nil
+	return hash, nil
 }
-func ComparePasswords(ctx context.Context, phash, pass string) bool {
+// ComparePasswords verifies pass against phash with the hasher of the algorithm phash was made with,
+// hashes of an unknown algorithm are verified by hasher
+func ComparePasswords(ctx context.Context, hasher PasswordHasher, phash, pass string) bool {
 	reqIdVal := ctx.Value("reqId")
 	reqId := reqIdVal.(string)
 	reqUrlVal := ctx.Value("reqUrl")
 	reqUrl := reqUrlVal.(string)
 	logger.LogDebug(reqId, reqUrl, "password verification")
 
-	err := bcrypt.CompareHashAndPassword([]byte(phash), []byte(pass))
+	match, err := hasherOf(phash, hasher).Verify(phash, pass)
 	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not verify password: %v", err), 0)
+		return false
+	}
+	if !match {
 		logger.LogInfo(reqId, reqUrl, "password does not match", 0)
 		return false
 	}
@@ -0,0 +1,157 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/vds/go-resman/pkg/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+const (
+	argon2idPrefix  = "$argon2id$"
+	argon2SaltBytes = 16
+	argon2KeyBytes  = 32
+)
+
+var errInvalidHash = errors.New("password hash is not in a known format")
+
+// PasswordHasher hashes passwords into strings that carry the algorithm and the parameters they were
+// computed with, so hashes keep verifying after the parameters change
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches hash, hash can have other parameters than the hasher
+	Verify(hash string, password string) (bool, error)
+	// NeedsRehash reports whether hash was computed with another algorithm or other parameters
+	NeedsRehash(hash string) bool
+}
+
+// NewPasswordHasher returns the hasher selected by cfg
+func NewPasswordHasher(cfg *config.Password) (PasswordHasher, error) {
+	switch cfg.Hasher {
+	case "argon2id":
+		return NewArgon2idHasher(uint32(cfg.Memory), uint32(cfg.Iterations), uint8(cfg.Parallelism)), nil
+	case "bcrypt":
+		return NewBcryptHasher(cfg.BcryptCost), nil
+	}
+	return nil, fmt.Errorf("%v: unknown hasher %s", config.ErrInvalidPassword, cfg.Hasher)
+}
+
+// DefaultPasswordHasher returns the hasher of the default configuration, databases hash with it
+// until they are given the configured one
+func DefaultPasswordHasher() PasswordHasher {
+	return NewArgon2idHasher(19*1024, 2, 1)
+}
+
+// hasherOf returns a hasher able to verify hash, hashes of an unknown algorithm are left to
+// current so custom hashers can verify their own format
+func hasherOf(hash string, current PasswordHasher) PasswordHasher {
+	switch {
+	case strings.HasPrefix(hash, argon2idPrefix):
+		return &Argon2idHasher{}
+	case strings.HasPrefix(hash, "$2"):
+		return &BcryptHasher{}
+	}
+	return current
+}
+
+// Argon2idHasher hashes passwords with argon2id into the PHC string format
+type Argon2idHasher struct {
+	// Memory is in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+func NewArgon2idHasher(memory uint32, iterations uint32, parallelism uint8) *Argon2idHasher {
+	return &Argon2idHasher{Memory: memory, Iterations: iterations, Parallelism: parallelism}
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltBytes)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, argon2KeyBytes)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(hash string, password string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	return err != nil || *params != *h || len(salt) != argon2SaltBytes || len(key) != argon2KeyBytes
+}
+
+// decodeArgon2id parses a hash such as $argon2id$v=19$m=19456,t=2,p=1$salt$key
+func decodeArgon2id(hash string) (*Argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, errInvalidHash
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, nil, nil, errInvalidHash
+	}
+	params := new(Argon2idHasher)
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Iterations < 1 || params.Parallelism < 1 {
+		return nil, nil, nil, errInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, errInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, errInvalidHash
+	}
+	return params, salt, key, nil
+}
+
+// BcryptHasher hashes passwords with bcrypt, the hashes of earlier releases were made with the default cost
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{Cost: cost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Verify(hash string, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
@@ -0,0 +1,58 @@
+package encryption_test
+
+import (
+	"context"
+	"github.com/vds/go-resman/pkg/encryption"
+	"strings"
+	"testing"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	ctx := context.WithValue(context.WithValue(context.Background(), "reqId", "test"), "reqUrl", "test")
+	argon := encryption.NewArgon2idHasher(1024, 1, 1)
+	bcrypt := encryption.NewBcryptHasher(4)
+	argonHash, err := argon.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("can not hash password: %v", err)
+	}
+	if !strings.HasPrefix(argonHash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("got hash %s want the argon2id parameters in it", argonHash)
+	}
+	bcryptHash, err := bcrypt.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("can not hash password: %v", err)
+	}
+
+	// hashes of either algorithm verify whatever the current hasher is
+	for _, current := range []encryption.PasswordHasher{argon, bcrypt} {
+		for _, hash := range []string{argonHash, bcryptHash} {
+			if !encryption.ComparePasswords(ctx, current, hash, "correct horse") {
+				t.Errorf("password does not match its hash %s", hash)
+			}
+			if encryption.ComparePasswords(ctx, current, hash, "wrong horse") {
+				t.Errorf("wrong password matches hash %s", hash)
+			}
+		}
+	}
+	if encryption.ComparePasswords(ctx, argon, "$argon2id$v=19$m=1024,t=1,p=1$bad", "correct horse") {
+		t.Errorf("malformed hash matches")
+	}
+
+	tests := []struct {
+		hash   string
+		rehash bool
+	}{
+		{argonHash, false},
+		{bcryptHash, true},
+		{strings.Replace(argonHash, "t=1", "t=2", 1), true},
+	}
+	for _, test := range tests {
+		if argon.NeedsRehash(test.hash) != test.rehash {
+			t.Errorf("got rehash of %s %v want %v", test.hash, !test.rehash, test.rehash)
+		}
+	}
+	hash, err := encryption.GenerateHash(argon, "correct horse")
+	if err != nil || argon.NeedsRehash(hash) {
+		t.Fatalf("got hash %s of the current hasher needing a rehash: %v", hash, err)
+	}
+}
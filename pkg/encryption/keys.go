@@ -0,0 +1,180 @@
+package encryption
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/vds/go-resman/pkg/config"
+	"io/ioutil"
+	"math/big"
+)
+
+var (
+	ErrUnknownKey       = errors.New("token is signed with an unknown key")
+	ErrUnsupportedKey   = errors.New("key must be a PEM encoded RSA or Ed25519 key")
+	ErrSigningKeyPublic = errors.New("signing key must be a private key")
+)
+
+// JWK is the public part of a signing key as published on the jwks endpoint
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 curve and public key
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is the document served on /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	public  crypto.PublicKey
+	private crypto.PrivateKey
+}
+
+// KeySet signs access tokens with the configured signing key and verifies them with any configured
+// key selected by the kid header. Tokens without kid are verified with the HS256 secret when one is set
+type KeySet struct {
+	auth    *config.Auth
+	signing *key
+	keys    map[string]*key
+	// ids keeps the configured order for the jwks document
+	ids []string
+}
+
+// NewKeySet loads the keys of auth from their files
+func NewKeySet(auth *config.Auth) (*KeySet, error) {
+	ks := &KeySet{auth: auth, keys: map[string]*key{}}
+	for _, configured := range auth.Keys {
+		k, err := loadKey(configured)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %s: %v", configured.ID, err)
+		}
+		ks.keys[k.id] = k
+		ks.ids = append(ks.ids, k.id)
+	}
+	if auth.SigningKey != "" {
+		signing, ok := ks.keys[auth.SigningKey]
+		if !ok {
+			return nil, fmt.Errorf("jwt key %s: %v", auth.SigningKey, ErrUnknownKey)
+		}
+		if signing.private == nil {
+			return nil, fmt.Errorf("jwt key %s: %v", auth.SigningKey, ErrSigningKeyPublic)
+		}
+		ks.signing = signing
+	}
+	return ks, nil
+}
+
+// Auth returns the settings the key set was created from
+func (ks *KeySet) Auth() *config.Auth {
+	return ks.auth
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	if ks.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(ks.auth.Secret))
+	}
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["kid"] = ks.signing.id
+	return token.SignedString(ks.signing.private)
+}
+
+// keyFunc selects the verification key of token and rejects tokens whose algorithm does not match it
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if ks.auth.Secret == "" {
+			return nil, ErrUnknownKey
+		}
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(ks.auth.Secret), nil
+	}
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return k.public, nil
+}
+
+// JWKS returns the public keys of the set, the HS256 secret is never published
+func (ks *KeySet) JWKS() *JWKS {
+	jwks := &JWKS{Keys: []JWK{}}
+	for _, id := range ks.ids {
+		k := ks.keys[id]
+		jwk := JWK{KeyID: k.id, Use: "sig", Algorithm: k.method.Alg()}
+		switch public := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+func loadKey(configured config.Key) (*key, error) {
+	data, err := ioutil.ReadFile(configured.File)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrUnsupportedKey
+	}
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	k := &key{id: configured.ID}
+	switch typed := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.method, k.private, k.public = jwt.SigningMethodRS256, typed, &typed.PublicKey
+	case *rsa.PublicKey:
+		k.method, k.public = jwt.SigningMethodRS256, typed
+	case ed25519.PrivateKey:
+		k.method, k.private, k.public = SigningMethodEdDSA, typed, typed.Public()
+	case ed25519.PublicKey:
+		k.method, k.public = SigningMethodEdDSA, typed
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	return k, nil
+}
@@ -0,0 +1,190 @@
+package encryption_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/models"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func init() {
+	logger.InitLogger(logrus.ErrorLevel)
+}
+
+func testContext() context.Context {
+	ctx := context.WithValue(context.Background(), "reqId", "encryption")
+	return context.WithValue(ctx, "reqUrl", "encryption")
+}
+
+// writeKeys writes a private RSA key, a private Ed25519 key and the public part of each to dir
+func writeKeys(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("can not generate rsa key: %v", err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("can not generate ed25519 key: %v", err)
+	}
+	files := map[string]string{}
+	write := func(name, blockType string, der []byte, err error) {
+		if err != nil {
+			t.Fatalf("can not marshal %s: %v", name, err)
+		}
+		path := filepath.Join(dir, name+".pem")
+		err = ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+		if err != nil {
+			t.Fatalf("can not write %s: %v", name, err)
+		}
+		files[name] = path
+	}
+	write("rsa", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey), nil)
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	write("rsa.pub", "PUBLIC KEY", der, err)
+	der, err = x509.MarshalPKCS8PrivateKey(edPrivate)
+	write("ed", "PRIVATE KEY", der, err)
+	der, err = x509.MarshalPKIXPublicKey(edPublic)
+	write("ed.pub", "PUBLIC KEY", der, err)
+	return files
+}
+
+func newKeySet(t *testing.T, auth *config.Auth) *encryption.KeySet {
+	t.Helper()
+	auth.TokenLifetime = config.Duration{Duration: time.Minute}
+	keys, err := encryption.NewKeySet(auth)
+	if err != nil {
+		t.Fatalf("can not load keys: %v", err)
+	}
+	return keys
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resman-keys")
+	if err != nil {
+		t.Fatalf("can not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := writeKeys(t, dir)
+	secret := "resman-test-secret"
+
+	legacy := newKeySet(t, &config.Auth{Secret: secret})
+	legacyToken, err := encryption.CreateToken(testContext(), &models.Claims{ID: "user", Role: "admin"}, legacy)
+	if err != nil {
+		t.Fatalf("can not sign token: %v", err)
+	}
+
+	// switching to rsa keeps the secret so tokens issued before the switch stay valid
+	first := newKeySet(t, &config.Auth{Secret: secret, SigningKey: "rsa", Keys: []config.Key{{ID: "rsa", File: files["rsa"]}}})
+	rsaToken, err := encryption.CreateToken(testContext(), &models.Claims{ID: "user", Role: "admin"}, first)
+	if err != nil {
+		t.Fatalf("can not sign token: %v", err)
+	}
+	// rotating to ed25519 keeps the public rsa key to verify the tokens it signed
+	second := newKeySet(t, &config.Auth{SigningKey: "ed", Keys: []config.Key{
+		{ID: "rsa", File: files["rsa.pub"]},
+		{ID: "ed", File: files["ed"]},
+	}})
+	edToken, err := encryption.CreateToken(testContext(), &models.Claims{ID: "user", Role: "admin"}, second)
+	if err != nil {
+		t.Fatalf("can not sign token: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		keys  *encryption.KeySet
+		token string
+		valid bool
+	}{
+		{"hs256 with secret", first, legacyToken, true},
+		{"rs256 with private key", first, rsaToken, true},
+		{"rs256 with public key", second, rsaToken, true},
+		{"eddsa", second, edToken, true},
+		{"hs256 without secret", second, legacyToken, false},
+		{"eddsa with unknown kid", first, edToken, false},
+		{"rs256 without keys", legacy, rsaToken, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := encryption.ParseToken(test.token, test.keys)
+			if test.valid && (err != nil || claims.ID != "user" || claims.Id == "") {
+				t.Errorf("token should be valid, got %+v: %v", claims, err)
+			}
+			if !test.valid && err == nil {
+				t.Errorf("token should be rejected")
+			}
+		})
+	}
+}
+
+func TestAlgorithmMustMatchKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resman-keys")
+	if err != nil {
+		t.Fatalf("can not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := writeKeys(t, dir)
+	keys := newKeySet(t, &config.Auth{SigningKey: "rsa", Keys: []config.Key{{ID: "rsa", File: files["rsa"]}}})
+
+	// an attacker signing with the public key as an hmac secret must be rejected
+	public, err := ioutil.ReadFile(files["rsa.pub"])
+	if err != nil {
+		t.Fatalf("can not read public key: %v", err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &models.Claims{ID: "user", Role: "superAdmin"})
+	forged.Header["kid"] = "rsa"
+	forgedToken, err := forged.SignedString(public)
+	if err != nil {
+		t.Fatalf("can not sign forged token: %v", err)
+	}
+	_, err = encryption.ParseToken(forgedToken, keys)
+	if err == nil {
+		t.Errorf("token signed with a different algorithm than its key should be rejected")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resman-keys")
+	if err != nil {
+		t.Fatalf("can not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := writeKeys(t, dir)
+	keys := newKeySet(t, &config.Auth{Secret: "resman-test-secret", SigningKey: "ed", Keys: []config.Key{
+		{ID: "rsa", File: files["rsa.pub"]},
+		{ID: "ed", File: files["ed"]},
+	}})
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("got %d keys want 2, the secret must not be published", len(jwks.Keys))
+	}
+	rsaKey, edKey := jwks.Keys[0], jwks.Keys[1]
+	if rsaKey.KeyID != "rsa" || rsaKey.KeyType != "RSA" || rsaKey.Algorithm != "RS256" || rsaKey.N == "" || rsaKey.E != "AQAB" {
+		t.Errorf("got rsa key %+v", rsaKey)
+	}
+	if edKey.KeyID != "ed" || edKey.KeyType != "OKP" || edKey.Curve != "Ed25519" || edKey.Algorithm != "EdDSA" || edKey.X == "" {
+		t.Errorf("got ed25519 key %+v", edKey)
+	}
+
+	_, err = encryption.NewKeySet(&config.Auth{SigningKey: "rsa", Keys: []config.Key{{ID: "rsa", File: files["rsa.pub"]}}})
+	if err == nil {
+		t.Errorf("a public key should not be accepted as signing key")
+	}
+	_, err = encryption.NewKeySet(&config.Auth{SigningKey: "rsa", Keys: []config.Key{{ID: "rsa", File: filepath.Join(dir, "missing.pem")}}})
+	if err == nil {
+		t.Errorf("a missing key file should be reported")
+	}
+}
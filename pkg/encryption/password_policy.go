@@ -0,0 +1,82 @@
+package encryption
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/vds/go-resman/pkg/config"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrPasswordTooShort = errors.New("password is too short")
+	ErrPasswordTooLong  = errors.New("password is too long")
+	ErrPasswordBreached = errors.New("password appears in a list of breached passwords, choose another one")
+)
+
+// PasswordPolicy checks the passwords users choose, the passwords stored before it was configured
+// keep working
+type PasswordPolicy struct {
+	minLength int
+	maxLength int
+	// breached holds the sha1 of the breached passwords
+	breached map[[sha1.Size]byte]bool
+}
+
+// NewPasswordPolicy returns the policy of cfg with its breached password list loaded
+func NewPasswordPolicy(cfg *config.Password) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{minLength: cfg.MinLength, maxLength: cfg.MaxLength, breached: map[[sha1.Size]byte]bool{}}
+	if cfg.BreachedList == "" {
+		return policy, nil
+	}
+	file, err := os.Open(cfg.BreachedList)
+	if err != nil {
+		return nil, fmt.Errorf("can not open breached password list: %v", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		policy.breached[breachedDigest(line)] = true
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("can not read breached password list: %v", err)
+	}
+	return policy, nil
+}
+
+// breachedDigest returns the sha1 a line of the breached list stands for, lines starting with 40 hex
+// digits are a digest optionally followed by :count and any other line is a password
+func breachedDigest(line string) [sha1.Size]byte {
+	var digest [sha1.Size]byte
+	value := strings.SplitN(line, ":", 2)[0]
+	if len(value) == 2*sha1.Size {
+		if _, err := hex.Decode(digest[:], []byte(value)); err == nil {
+			return digest
+		}
+	}
+	return sha1.Sum([]byte(line))
+}
+
+// Check returns why password can not be chosen or nil when the policy accepts it
+func (p *PasswordPolicy) Check(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		return fmt.Errorf("%v, it needs at least %d characters", ErrPasswordTooShort, p.minLength)
+	}
+	if length > p.maxLength {
+		return fmt.Errorf("%v, it can have at most %d characters", ErrPasswordTooLong, p.maxLength)
+	}
+	if p.breached[sha1.Sum([]byte(password))] {
+		return ErrPasswordBreached
+	}
+	return nil
+}
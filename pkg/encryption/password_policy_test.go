@@ -0,0 +1,55 @@
+package encryption_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/encryption"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resman-breached")
+	if err != nil {
+		t.Fatalf("can not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	digest := sha1.Sum([]byte("letmein123"))
+	list := filepath.Join(dir, "breached.txt")
+	content := "password1\n\n" + strings.ToUpper(hex.EncodeToString(digest[:])) + ":3861493\n"
+	err = ioutil.WriteFile(list, []byte(content), 0600)
+	if err != nil {
+		t.Fatalf("can not write breached list: %v", err)
+	}
+	policy, err := encryption.NewPasswordPolicy(&config.Password{MinLength: 8, MaxLength: 12, BreachedList: list})
+	if err != nil {
+		t.Fatalf("can not create policy: %v", err)
+	}
+	tests := []struct {
+		password string
+		err      error
+	}{
+		{"correcthorse", nil},
+		// the length counts characters rather than bytes
+		{"šestznakůů", nil},
+		{"short", encryption.ErrPasswordTooShort},
+		{"a much too long password", encryption.ErrPasswordTooLong},
+		{"password1", encryption.ErrPasswordBreached},
+		{"letmein123", encryption.ErrPasswordBreached},
+	}
+	for _, test := range tests {
+		err := policy.Check(test.password)
+		if (err == nil) != (test.err == nil) || (err != nil && !strings.HasPrefix(err.Error(), test.err.Error())) {
+			t.Errorf("got error %v for %s want %v", err, test.password, test.err)
+		}
+	}
+
+	_, err = encryption.NewPasswordPolicy(&config.Password{MinLength: 8, MaxLength: 16, BreachedList: filepath.Join(dir, "missing.txt")})
+	if err == nil {
+		t.Fatalf("got policy with a missing breached list")
+	}
+}
@@ -0,0 +1,91 @@
+package encryption_test
+
+import (
+	"github.com/vds/go-resman/pkg/encryption"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the base32 form of the SHA1 key of the RFC 6238 test vectors
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// the RFC lists 8 digit codes, authenticator apps use their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, test := range tests {
+		code, err := encryption.TOTPCode(rfcSecret, encryption.TOTPStep(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatalf("can not compute code: %v", err)
+		}
+		if code != test.code {
+			t.Errorf("got code %s at %d want %s", code, test.unix, test.code)
+		}
+	}
+	_, err := encryption.TOTPCode("not base32!", 1)
+	if err != encryption.ErrInvalidTOTPSecret {
+		t.Fatalf("got error %v want %v", err, encryption.ErrInvalidTOTPSecret)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := encryption.NewTOTPSecret()
+	if err != nil {
+		t.Fatalf("can not create secret: %v", err)
+	}
+	now := time.Now()
+	for _, offset := range []time.Duration{-30 * time.Second, 0, 30 * time.Second} {
+		code, _ := encryption.TOTPCode(secret, encryption.TOTPStep(now.Add(offset)))
+		step, ok := encryption.ValidateTOTP(secret, code, now)
+		if !ok || step != encryption.TOTPStep(now.Add(offset)) {
+			t.Fatalf("code %v away should be accepted at its step", offset)
+		}
+	}
+	code, _ := encryption.TOTPCode(secret, encryption.TOTPStep(now.Add(-2*time.Minute)))
+	if _, ok := encryption.ValidateTOTP(secret, code, now); ok {
+		t.Fatalf("old code should be refused")
+	}
+	if _, ok := encryption.ValidateTOTP(secret, "12345", now); ok {
+		t.Fatalf("short code should be refused")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(encryption.TOTPURI("resman", "admin@example.com", "SECRET"))
+	if err != nil {
+		t.Fatalf("can not parse uri: %v", err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/resman:admin@example.com" {
+		t.Fatalf("got uri %v", uri)
+	}
+	if uri.Query().Get("secret") != "SECRET" || uri.Query().Get("issuer") != "resman" {
+		t.Fatalf("got query %v", uri.Query())
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := encryption.NewRecoveryCodes(8)
+	if err != nil {
+		t.Fatalf("can not create recovery codes: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || seen[code] {
+			t.Fatalf("got invalid or duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+	loose := " " + strings.ToUpper(strings.Replace(codes[0], "-", "", 1))
+	if encryption.HashRecoveryCode(loose) != encryption.HashRecoveryCode(codes[0]) {
+		t.Fatalf("recovery codes should match ignoring case and dashes")
+	}
+}
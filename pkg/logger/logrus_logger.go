@@ -41,6 +41,15 @@ func LogError(requestId string, requestUrl string, msg string, status int) {
 	logger.WithFields(fields).Error(msg)
 }
 
+// LogAudit records a request made by actor on behalf of subject, both are logged as role and id
+func LogAudit(requestId string, requestUrl string, msg string, status int, actor string, subject string) {
+	fields := getFields(requestId, requestUrl, status)
+	fields["audit"] = true
+	fields["actor"] = actor
+	fields["subject"] = subject
+	logger.WithFields(fields).Info(msg)
+}
+
 func LogFatal(msg string){
 	pc, _, _, ok := runtime.Caller(2)
 	var fname string
@@ -0,0 +1,164 @@
+// Package mail sends the emails of the server, such as password reset links.
+//
+// Messages are sent through SMTP in production, the file and log mailers keep them local so
+// flows depending on emails can be exercised without a mail server.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/logger"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidHeader = errors.New("email addresses and subject can not contain line breaks")
+	ErrUnknownDriver = errors.New("unknown mail driver")
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New returns the mailer selected by the driver of cfg
+func New(cfg *config.Mail) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	case "file":
+		return NewFileMailer(cfg.From, cfg.Dir), nil
+	case "log":
+		return NewLogMailer(cfg.From), nil
+	}
+	return nil, ErrUnknownDriver
+}
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	from string
+	addr string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(cfg *config.Mail) *SMTPMailer {
+	m := &SMTPMailer{
+		from: cfg.From,
+		addr: net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(cfg.SMTP.Port)),
+	}
+	if cfg.SMTP.Username != "" {
+		m.auth = smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Host)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	data, err := format(m.from, msg)
+	if err != nil {
+		return err
+	}
+	logger.LogDebug(reqId, reqUrl, "sending email through smtp")
+	err = smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, data)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not send email: %v", err), 0)
+		return err
+	}
+	logger.LogInfo(reqId, reqUrl, "email sent", 0)
+	return nil
+}
+
+// FileMailer writes every email to its own .eml file in a directory
+type FileMailer struct {
+	from string
+	dir  string
+	mu   sync.Mutex
+	sent int
+}
+
+func NewFileMailer(from, dir string) *FileMailer {
+	return &FileMailer{from: from, dir: dir}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	data, err := format(m.from, msg)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(m.dir, 0700)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not create mail directory: %v", err), 0)
+		return err
+	}
+	m.mu.Lock()
+	m.sent++
+	name := fmt.Sprintf("%d-%d.eml", time.Now().UnixNano(), m.sent)
+	m.mu.Unlock()
+	path := filepath.Join(m.dir, name)
+	err = ioutil.WriteFile(path, data, 0600)
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not write email: %v", err), 0)
+		return err
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("email written to %s", path), 0)
+	return nil
+}
+
+// LogMailer writes emails to the server log, including their body
+type LogMailer struct {
+	from string
+}
+
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	if hasLineBreak(msg.To) || hasLineBreak(msg.Subject) {
+		return ErrInvalidHeader
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("email from %s to %s: %s\n%s", m.from, msg.To, msg.Subject, msg.Body), 0)
+	return nil
+}
+
+// format builds the RFC 5322 form of msg
+func format(from string, msg *Message) ([]byte, error) {
+	if hasLineBreak(from) || hasLineBreak(msg.To) || hasLineBreak(msg.Subject) {
+		return nil, ErrInvalidHeader
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	body := strings.Replace(msg.Body, "\r\n", "\n", -1)
+	buf.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	return buf.Bytes(), nil
+}
+
+func hasLineBreak(value string) bool {
+	return strings.ContainsAny(value, "\r\n")
+}
@@ -0,0 +1,78 @@
+package mail
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/logger"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func init() {
+	logger.InitLogger(logrus.ErrorLevel)
+}
+
+func testContext() context.Context {
+	ctx := context.WithValue(context.Background(), "reqId", "mail")
+	return context.WithValue(ctx, "reqUrl", "mail")
+}
+
+func TestFileMailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resman-mail")
+	if err != nil {
+		t.Fatalf("can not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	mailer, err := New(&config.Mail{Driver: "file", From: "resman@example.com", Dir: filepath.Join(dir, "outbox")})
+	if err != nil {
+		t.Fatalf("can not create mailer: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		err = mailer.Send(testContext(), &Message{To: "owner@example.com", Subject: "Réinitialiser", Body: "first line\nsecond line"})
+		if err != nil {
+			t.Fatalf("can not send email: %v", err)
+		}
+	}
+	files, err := ioutil.ReadDir(filepath.Join(dir, "outbox"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("got %d files want 2: %v", len(files), err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "outbox", files[0].Name()))
+	if err != nil {
+		t.Fatalf("can not read email: %v", err)
+	}
+	email := string(data)
+	for _, want := range []string{"From: resman@example.com\r\n", "To: owner@example.com\r\n", "Subject: =?utf-8?q?R=C3=A9initialiser?=\r\n", "\r\n\r\nfirst line\r\nsecond line"} {
+		if !strings.Contains(email, want) {
+			t.Errorf("email %q does not contain %q", email, want)
+		}
+	}
+}
+
+func TestHeaderInjection(t *testing.T) {
+	mailers := []Mailer{NewLogMailer("resman@example.com"), NewFileMailer("resman@example.com", os.TempDir())}
+	for _, mailer := range mailers {
+		err := mailer.Send(testContext(), &Message{To: "owner@example.com\r\nBcc: everyone@example.com", Subject: "reset"})
+		if err != ErrInvalidHeader {
+			t.Errorf("%T: got error %v want %v", mailer, err, ErrInvalidHeader)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	mailer, err := New(&config.Mail{Driver: "smtp", From: "resman@example.com", SMTP: config.SMTP{Host: "mail.example.com", Port: 587}})
+	if err != nil {
+		t.Fatalf("can not create mailer: %v", err)
+	}
+	if smtpMailer, ok := mailer.(*SMTPMailer); !ok || smtpMailer.addr != "mail.example.com:587" || smtpMailer.auth != nil {
+		t.Errorf("got %#v", mailer)
+	}
+	_, err = New(&config.Mail{Driver: "pigeon"})
+	if err != ErrUnknownDriver {
+		t.Errorf("got error %v want %v", err, ErrUnknownDriver)
+	}
+}
@@ -1,54 +1,58 @@
 package middleware
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/config"
 	"github.com/vds/go-resman/pkg/logger"
 	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/rbac"
 	"net/http"
+	"strings"
 )
 
-func AdminAccessOnly(c *gin.Context) {
-	value, _ := c.Get("userAuth")
-	userAuth := value.(*models.UserAuth)
-	if userAuth.Role != Admin && userAuth.Role != SuperAdmin {
-		err := "only for  admin or superAdmin access"
-		reqId := c.Request.Context().Value("reqId")
-		logger.LogError(reqId.(string), c.Request.URL.String(), err, http.StatusUnauthorized)
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": err,
-		})
-		c.Abort()
+// RequirePermission lets the request through when the role of the user set by AuthMiddleware has permission,
+// requests made with an api key also need the key to grant it
+func RequirePermission(policy *rbac.Policy, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+		value, _ := c.Get("userAuth")
+		userAuth := value.(*models.UserAuth)
+		subject := userAuth.Role
+		allowed := policy.Can(userAuth.Role, permission)
+		if allowed && userAuth.APIKey != nil {
+			subject = "api key " + userAuth.APIKey.Name
+			allowed = userAuth.APIKey.Allows(permission)
+		}
+		if !allowed {
+			err := fmt.Sprintf("%s is not allowed to %s", subject, permission)
+			logger.LogError(reqId, reqUrl, err, http.StatusUnauthorized)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
 	}
-	c.Next()
-}
-
-func SuperAdminAccessOnly(c *gin.Context) {
-	value, _ := c.Get("userAuth")
-	userAuth := value.(*models.UserAuth)
-	if userAuth.Role != SuperAdmin {
-		err := "only for superAdmin access"
-		reqId := c.Request.Context().Value("reqId")
-		logger.LogError(reqId.(string), c.Request.URL.String(), err, http.StatusUnauthorized)
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": err,
-		})
-		c.Abort()
-		return
-	}
-	c.Next()
 }
 
 func SetResponseHeader(c *gin.Context) {
 	c.Writer.Header().Set("Content-Type", "applicatoin/json")
 	c.Next()
 }
-func AllowOptions(c *gin.Context) {
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-	c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Token")
-	c.Writer.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE")
-	if c.Request.Method == http.MethodOptions {
-		c.Writer.WriteHeader(http.StatusOK)
-		c.Abort()
+// AllowOptions sets the configured cors headers and answers preflight requests
+func AllowOptions(cors *config.CORS) gin.HandlerFunc {
+	allowHeaders := strings.Join(cors.AllowHeaders, ", ")
+	allowMethods := strings.Join(cors.AllowMethods, ",")
+	return func(c *gin.Context) {
+		c.Writer.Header().Set("Access-Control-Allow-Origin", cors.AllowOrigin)
+		c.Writer.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+		c.Writer.Header().Set("Access-Control-Allow-Methods", allowMethods)
+		if c.Request.Method == http.MethodOptions {
+			c.Writer.WriteHeader(http.StatusOK)
+			c.Abort()
+		}
+		c.Next()
 	}
-	c.Next()
 }
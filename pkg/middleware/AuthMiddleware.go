@@ -5,102 +5,245 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
 	"github.com/vds/go-resman/pkg/logger"
 	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/rbac"
 	"net/http"
 	"strings"
+	"time"
 )
 
 const (
-	Admin              = "admin"
-	SuperAdmin         = "superAdmin"
-	Owner              = "owner"
+	Admin              = rbac.Admin
+	SuperAdmin         = rbac.SuperAdmin
+	Owner              = rbac.Owner
 	tokenExpireMessage = "Token expired please login again"
 	StatusTokenInvalid = 498
+	// APIKeyHeader carries api keys, they are also accepted as bearer tokens
+	APIKeyHeader = "X-API-Key"
+	bearerPrefix = "Bearer "
 )
 
+// TokenValidator rejects access tokens that were revoked or whose session has ended and records the
+// request as the last activity of the session. It reads the claims set by AuthMiddleware so it has to
+// run after it. Requests authenticated with an api key are let through, revoked keys are already
+// refused by AuthMiddleware
 func TokenValidator(db database.Database) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		reqId := c.Request.Context().Value("reqId")
-		reqUrl := c.Request.URL.String()
-		tokenStr := c.Request.Header.Get("token")
-		logger.LogDebug(reqId.(string), reqUrl, "checking if the token is logged out validity")
-		isValid := db.VerifyToken(c.Request.Context(), tokenStr)
-		if !isValid {
+		reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+		if value, ok := c.Get("userAuth"); ok && value.(*models.UserAuth).APIKey != nil {
+			c.Next()
+			return
+		}
+		logger.LogDebug(reqId, reqUrl, "checking if the token is revoked")
+		value, _ := c.Get("claims")
+		claims, ok := value.(*models.Claims)
+		if !ok || claims.Id == "" {
+			logger.LogError(reqId, reqUrl, "token has no id", StatusTokenInvalid)
+			c.JSON(StatusTokenInvalid, gin.H{
+				"error": tokenExpireMessage,
+			})
+			c.Abort()
+			return
+		}
+		revoked, err := db.IsTokenRevoked(c.Request.Context(), claims.Id)
+		if err != nil {
+			logger.LogError(reqId, reqUrl, fmt.Sprintf("can not check token revocation: %v", err), http.StatusInternalServerError)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "internal server error",
+			})
+			c.Abort()
+			return
+		}
+		if revoked {
 			err := "invalid token"
-			logger.LogError(reqId.(string), reqUrl, err, StatusTokenInvalid)
+			logger.LogError(reqId, reqUrl, err, StatusTokenInvalid)
 			c.JSON(StatusTokenInvalid, gin.H{
 				"error": err,
 			})
 			c.Abort()
+			return
+		}
+		if claims.SessionID != "" {
+			logger.LogDebug(reqId, reqUrl, "checking the session of the token")
+			now := time.Now()
+			err = db.TouchSession(c.Request.Context(), claims.SessionID, now, now)
+			if err == database.ErrSessionNotFound {
+				logger.LogError(reqId, reqUrl, fmt.Sprintf("session %s of the token has ended", claims.SessionID), StatusTokenInvalid)
+				c.JSON(StatusTokenInvalid, gin.H{
+					"error": "session has ended please login again",
+				})
+				c.Abort()
+				return
+			}
+			if err != nil {
+				logger.LogError(reqId, reqUrl, fmt.Sprintf("can not check session: %v", err), http.StatusInternalServerError)
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "internal server error",
+				})
+				c.Abort()
+				return
+			}
 		}
 		c.Next()
 	}
 }
 
-func AuthMiddleware(c *gin.Context) {
-	jwtKey := []byte("SecretKey")
-	reqId, _ := c.Get("reqId")
-	reqUrl := c.Request.URL.String()
-	logger.LogDebug(reqId.(string), reqUrl, "checking token validity")
-	tokenStr := c.Request.Header.Get("token")
-	claims := &models.Claims{}
-	tkn, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-
-	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
-			logger.LogError(reqId.(string), reqUrl, fmt.Sprintf("auth token signature not valid: %v", err), StatusTokenInvalid)
+// AuthMiddleware sets userAuth from the claims of the token in the token header or an Authorization
+// bearer value, or from the api key sent in either header, and refuses inactive accounts
+func AuthMiddleware(db database.Database, keys *encryption.KeySet, policy *rbac.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reqId, _ := c.Get("reqId")
+		reqUrl := c.Request.URL.String()
+		tokenStr := c.Request.Header.Get("token")
+		bearer := strings.TrimPrefix(c.Request.Header.Get("Authorization"), bearerPrefix)
+		if apiKey := c.Request.Header.Get(APIKeyHeader); apiKey != "" {
+			authenticateAPIKey(c, db, policy, apiKey)
+			return
+		}
+		if strings.HasPrefix(bearer, models.APIKeyPrefix) {
+			authenticateAPIKey(c, db, policy, bearer)
+			return
+		}
+		if tokenStr == "" {
+			tokenStr = bearer
+		}
+		logger.LogDebug(reqId.(string), reqUrl, "checking token validity")
+		claims, err := encryption.ParseToken(tokenStr, keys)
+		if err != nil {
+			if err == jwt.ErrSignatureInvalid {
+				logger.LogError(reqId.(string), reqUrl, fmt.Sprintf("auth token signature not valid: %v", err), StatusTokenInvalid)
+				c.JSON(StatusTokenInvalid, gin.H{
+					"error": err.Error(),
+				})
+				c.Abort()
+				return
+			}
+			if strings.Contains(err.Error(), "expired") {
+				logger.LogError(reqId.(string), reqUrl, fmt.Sprintf("auth token expired: %v", err), StatusTokenInvalid)
+				c.JSON(StatusTokenInvalid, gin.H{
+					"error": tokenExpireMessage,
+				})
+				c.Abort()
+				return
+			}
+			logger.LogError(reqId.(string), reqUrl, fmt.Sprintf("error in parsing auth token: %v", err), StatusTokenInvalid)
 			c.JSON(StatusTokenInvalid, gin.H{
 				"error": err.Error(),
 			})
 			c.Abort()
 			return
 		}
-		if strings.Contains(err.Error(), "expired") {
-			logger.LogError(reqId.(string), reqUrl, fmt.Sprintf("auth token expired: %v", err), StatusTokenInvalid)
+		if claims.Purpose != "" {
+			logger.LogError(reqId.(string), reqUrl, fmt.Sprintf("%s challenge token used as access token", claims.Purpose), StatusTokenInvalid)
 			c.JSON(StatusTokenInvalid, gin.H{
-				"error": tokenExpireMessage,
+				"error": "challenge tokens can only be used to complete a login",
+			})
+			c.Abort()
+			return
+		}
+		if !policy.IsRole(claims.Role) {
+			logger.LogError(reqId.(string), reqUrl, fmt.Sprintf("Invalid role:%v", claims.Role), StatusTokenInvalid)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid role",
+			})
+			c.Abort()
+			return
+		}
+		if claims.Act != nil && !policy.Can(claims.Act.Role, rbac.UserImpersonate) {
+			logger.LogError(reqId.(string), reqUrl, fmt.Sprintf("%s can no longer impersonate", claims.Act.Role), StatusTokenInvalid)
+			c.JSON(StatusTokenInvalid, gin.H{
+				"error": "impersonation is no longer allowed",
 			})
 			c.Abort()
 			return
 		}
-		logger.LogError(reqId.(string), reqUrl, fmt.Sprintf("error in parsing auth token: %v", err), StatusTokenInvalid)
-		c.JSON(StatusTokenInvalid, gin.H{
+		if !accountActive(c, db, claims.ID, claims.Role) {
+			return
+		}
+		if claims.Act != nil && !accountActive(c, db, claims.Act.ID, claims.Act.Role) {
+			return
+		}
+		userAuth := &models.UserAuth{
+			ID:    claims.ID,
+			Role:  claims.Role,
+			Scope: policy.Scope(claims.Role),
+			Actor: claims.Act,
+		}
+		c.Set("userAuth", userAuth)
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
+// accountActive reports whether the account of the user with the given id and role is active, otherwise
+// the request is refused
+func accountActive(c *gin.Context, db database.Database, userID string, role string) bool {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+	status, err := db.GetUserStatus(c.Request.Context(), userID, role)
+	if err == database.ErrUserNotFound || err == nil && status == models.StatusDeleted {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("account of %s %s does not exist", role, userID), http.StatusUnauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "account does not exist",
+		})
+		c.Abort()
+		return false
+	}
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not check account status: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		c.Abort()
+		return false
+	}
+	if status != models.StatusActive {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("account of %s %s is %s", role, userID, status), http.StatusUnauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": database.ErrAccountSuspended.Error(),
+		})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// authenticateAPIKey sets userAuth from the stored api key, the request gets the scope of the role
+// of the key owner and only the permissions of the key
+func authenticateAPIKey(c *gin.Context, db database.Database, policy *rbac.Policy, apiKey string) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+	logger.LogDebug(reqId, reqUrl, "checking api key validity")
+	key, err := db.UseAPIKey(c.Request.Context(), encryption.HashOpaqueToken(apiKey), time.Now())
+	if err == database.ErrInvalidAPIKey {
+		logger.LogError(reqId, reqUrl, "unknown api key", http.StatusUnauthorized)
+		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": err.Error(),
 		})
 		c.Abort()
 		return
 	}
-	if !tkn.Valid {
-		logger.LogError(reqId.(string), reqUrl, "Invalid Token", StatusTokenInvalid)
-		c.JSON(StatusTokenInvalid, gin.H{
-			"error": "Invalid Token",
+	if err != nil {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("can not check api key: %v", err), http.StatusInternalServerError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
 		})
 		c.Abort()
 		return
 	}
-	isValid := IsValidUserType(claims.Role)
-	if !isValid {
-		logger.LogError(reqId.(string), reqUrl, fmt.Sprintf("Invalid role:%v", claims.Role), StatusTokenInvalid)
+	if !policy.IsRole(key.Role) {
+		logger.LogError(reqId, reqUrl, fmt.Sprintf("Invalid role:%v", key.Role), http.StatusUnauthorized)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": "Invalid role",
 		})
 		c.Abort()
 		return
 	}
-	userAuth := &models.UserAuth{
-		ID:   claims.ID,
-		Role: claims.Role,
-	}
-	c.Set("userAuth", userAuth)
+	c.Set("userAuth", &models.UserAuth{
+		ID:     key.UserID,
+		Role:   key.Role,
+		Scope:  policy.Scope(key.Role),
+		APIKey: key,
+	})
 	c.Next()
 }
-
-func IsValidUserType(userType string) bool {
-	if userType != Admin && userType != SuperAdmin && userType != Owner {
-		return false
-	}
-	return true
-}
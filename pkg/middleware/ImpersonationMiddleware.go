@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/models"
+	"net/http"
+)
+
+// ImpersonatedByHeader marks the responses to requests made with an impersonation token
+const ImpersonatedByHeader = "X-Impersonated-By"
+
+// Impersonation audits the requests made with an impersonation token, each one is logged with the
+// identity of the actor and of the impersonated user. With readOnly only GET and HEAD requests are
+// let through. It reads the user set by AuthMiddleware so it has to run after it
+func Impersonation(readOnly bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+		value, _ := c.Get("userAuth")
+		userAuth := value.(*models.UserAuth)
+		if userAuth.Actor == nil {
+			c.Next()
+			return
+		}
+		actor := identity(userAuth.Actor.Role, userAuth.Actor.ID)
+		subject := identity(userAuth.Role, userAuth.ID)
+		c.Header(ImpersonatedByHeader, actor)
+		if readOnly && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			logger.LogAudit(reqId, reqUrl, fmt.Sprintf("%s request refused while impersonating", c.Request.Method), http.StatusForbidden, actor, subject)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "only reading is allowed while impersonating",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+		logger.LogAudit(reqId, reqUrl, fmt.Sprintf("%s request made while impersonating", c.Request.Method), c.Writer.Status(), actor, subject)
+	}
+}
+
+// RefuseImpersonation refuses requests made with an impersonation token, it guards the credentials of
+// the impersonated user such as api keys and second factors. The refusal is audited by Impersonation
+func RefuseImpersonation(c *gin.Context) {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(c.Request.Context())
+	value, _ := c.Get("userAuth")
+	userAuth := value.(*models.UserAuth)
+	if userAuth.Actor != nil {
+		logger.LogError(reqId, reqUrl, "credentials can not be managed while impersonating", http.StatusForbidden)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "credentials can not be managed while impersonating",
+		})
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func identity(role string, id string) string {
+	return role + " " + id
+}
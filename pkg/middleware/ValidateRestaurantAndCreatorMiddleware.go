@@ -10,6 +10,8 @@ import (
 	"strconv"
 )
 
+// ValidateRestaurantAndCreator refuses the restaurants of the url outside the scope of the user,
+// users of the created scope need to have created it and users of the owned scope to own it
 func ValidateRestaurantAndCreator(db database.Database) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		reqId, _ := c.Get("reqId")
@@ -18,7 +20,8 @@ func ValidateRestaurantAndCreator(db database.Database) gin.HandlerFunc {
 		userAuth := value.(*models.UserAuth)
 		res := c.Param("resID")
 		resID, _ := strconv.Atoi(res)
-		if userAuth.Role == Admin {
+		switch userAuth.Scope {
+		case models.ScopeCreated:
 			logger.LogDebug(reqId.(string), reqUrl, "checking for creator")
 			err := db.CheckRestaurantCreator(c.Request.Context(), userAuth.ID, resID)
 			if err != nil {
@@ -37,7 +40,7 @@ func ValidateRestaurantAndCreator(db database.Database) gin.HandlerFunc {
 				c.Abort()
 				return
 			}
-		} else if userAuth.Role == Owner {
+		case models.ScopeOwned:
 			logger.LogDebug(reqId.(string), reqUrl, "checking for owner")
 			err := db.CheckRestaurantOwner(c.Request.Context(), userAuth.ID, resID)
 			if err != nil {
@@ -2,27 +2,34 @@ package middleware
 
 import (
 	prometheus2 "github.com/prometheus/client_golang/prometheus"
+	"github.com/vds/go-resman/pkg/config"
 	"github.com/vds/go-resman/pkg/prometheus"
+	"sync"
 )
 
 const(
 	requestDuration         = "request_duration_microseconds"
 )
 
-func init(){
-	prometheus.Global().RegisterHistogramVectors(histVecs)
+var registerOnce sync.Once
+
+// RegisterMetrics registers the request duration histogram with the configured buckets,
+// collectors can only be registered once per process so later calls are ignored
+func RegisterMetrics(metrics *config.Metrics) {
+	registerOnce.Do(func() {
+		prometheus.Global().RegisterHistogramVectors(histVecs(metrics.Buckets))
+	})
 }
 
-var(
-	histVecs = []prometheus.HistogramVecOpts{
+func histVecs(buckets []float64) []prometheus.HistogramVecOpts {
+	return []prometheus.HistogramVecOpts{
 		{
 			Opts: prometheus2.HistogramOpts{
 				Name: requestDuration,
 				Help: "time in each request completion",
-				Buckets: []float64{2,4,6,8,10},
+				Buckets: buckets,
 			},
 			Labels: []string{"method","path","handler","status"},
 		},
 	}
-
-)
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// APIKeyPrefix starts every api key, it tells them apart from access tokens in an Authorization header
+const APIKeyPrefix = "rk_"
+
+// APIKey is the stored form of an api key, only the hash of the key is kept. A key acts as the user
+// who created it but only with Permissions, so a leaked key is limited to what its client needs
+type APIKey struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Hash string `json:"-"`
+	// Prefix is the start of the key, it is shown to tell the keys of a user apart
+	Prefix      string     `json:"prefix"`
+	UserID      string     `json:"-"`
+	Role        string     `json:"-"`
+	Permissions []string   `json:"permissions"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt"`
+}
+
+// Allows reports whether the key was given permission
+func (k *APIKey) Allows(permission string) bool {
+	for _, p := range k.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -5,5 +5,32 @@ import "github.com/dgrijalva/jwt-go"
 type Claims struct {
 	ID   string
 	Role string
+	// SessionID is the family of the refresh token the access token was issued with
+	SessionID string `json:"sid,omitempty"`
+	// Purpose is empty for access tokens, challenge tokens issued during a two step login set it
+	// and are refused by the auth middleware
+	Purpose string `json:"pur,omitempty"`
+	// Email is the address an invitation token was sent to
+	Email string `json:"email,omitempty"`
+	// InviterRole is the role of the user ID who sent an invitation, Role is the invited one
+	InviterRole string `json:"inviter,omitempty"`
+	// Act is the user acting as ID and Role, it is only set in impersonation tokens
+	Act *Actor `json:"act,omitempty"`
 	jwt.StandardClaims
 }
+
+// Actor is the act claim of RFC 8693, it names the user who impersonates the subject of a token
+type Actor struct {
+	ID   string `json:"sub"`
+	Role string `json:"role"`
+}
+
+// purposes of challenge and invitation tokens
+const (
+	// PurposeTwoFactor asks for a code of an enabled second factor
+	PurposeTwoFactor = "2fa"
+	// PurposeTwoFactorEnrol asks to enrol a second factor before logging in
+	PurposeTwoFactorEnrol = "2fa-enrol"
+	// PurposeInvitation lets the invited email create an account of Role, ID and InviterRole are the user who invited it
+	PurposeInvitation = "invite"
+)
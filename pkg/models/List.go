@@ -0,0 +1,20 @@
+package models
+
+// ListOptions selects the page of a list and how it is sorted and filtered, a zero Limit returns every row
+type ListOptions struct {
+	Limit      int
+	Offset     int
+	Sort       string
+	NamePrefix string
+	// Assigned filters restaurants on whether they have an owner, nil returns both
+	Assigned *bool
+	// Status filters users on their account status, empty returns the users that are not deleted
+	Status string
+}
+
+// Page is the envelope list endpoints respond with
+type Page struct {
+	Data       interface{} `json:"data"`
+	Total      int         `json:"total"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
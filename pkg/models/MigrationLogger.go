@@ -9,7 +9,7 @@ type MigrationLogger struct {
 
 // Printf function
 func (ml *MigrationLogger) Printf(format string, v ...interface{}) {
-	log.Printf(format, v)
+	log.Printf(format, v...)
 }
 
 // Verbose will enable verbose logging
@@ -0,0 +1,13 @@
+package models
+
+// MigrationStatus is the schema version applied to a database and the latest version the server ships with
+type MigrationStatus struct {
+	Version uint `json:"version"`
+	Latest  uint `json:"latest"`
+	Dirty   bool `json:"dirty"`
+}
+
+// Complete reports whether every migration has been applied successfully
+func (s *MigrationStatus) Complete() bool {
+	return !s.Dirty && s.Version >= s.Latest
+}
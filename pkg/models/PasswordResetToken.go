@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// PasswordResetToken is the stored form of a password reset token, only the hash of the token is kept.
+// A token can be used once and a new one replaces the previous tokens of the user
+type PasswordResetToken struct {
+	Hash      string
+	UserID    string
+	Role      string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// RefreshToken is the stored form of a refresh token, only the hash of the token is kept.
+// Every refresh replaces the token with a new one of the same family, the family ends
+// when one of its used tokens is presented again
+type RefreshToken struct {
+	Hash      string
+	FamilyID  string
+	UserID    string
+	Role      string
+	ExpiresAt time.Time
+	Used      bool
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Session is a login of a user on a device, its id is the family of the refresh tokens and the sid of
+// the access tokens issued by the login. Revoking it refuses those tokens at once
+type Session struct {
+	ID     string `json:"id"`
+	UserID string `json:"-"`
+	Role   string `json:"-"`
+	// Device is the user agent the login was made with
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	IssuedAt   time.Time `json:"issuedAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	// ExpiresAt is the expiry of the latest refresh token of the session
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Current marks the session of the request listing the sessions
+	Current bool `json:"current"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// TwoFactor is the TOTP enrolment of a user. The secret is stored as soon as enrolment starts and
+// is only used to log in once Enabled is set by confirming a code.
+// LastStep is the time step of the last accepted code, so a code can not be used twice
+type TwoFactor struct {
+	UserID   string
+	Role     string
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
@@ -2,9 +2,11 @@ package models
 
 type UserReg struct {
 	Role     string `json:"role" binding:"required"`
-	Email    string `json:"email"  binding:"required"`
+	Email    string `json:"email"  binding:"required,email"`
 	Name     string `json:"name"  binding:"required"`
 	Password string `json:"password"  binding:"required"`
+	// Verified creates the account already verified, accounts registered through the api start pending
+	Verified bool `json:"-"`
 }
 type Credentials struct {
 	Role     string `json:"role" binding:"required"`
@@ -14,16 +16,44 @@ type Credentials struct {
 type UserAuth struct {
 	ID   string `json:"id" binding:"required"`
 	Role string `json:"role" binding:"required"`
+	// Scope is the scope of the role, one of ScopeAll, ScopeCreated or ScopeOwned
+	Scope string `json:"-"`
+	// APIKey is the key the request was authenticated with, it is nil for access tokens
+	APIKey *APIKey `json:"-"`
+	// Actor is the user impersonating this one, it is nil unless the request uses an impersonation token
+	Actor *Actor `json:"-"`
 }
+
+// scopes of the owners and restaurants a user acts on
+const (
+	ScopeAll = "all"
+	// ScopeCreated is limited to the owners and restaurants the user created
+	ScopeCreated = "created"
+	// ScopeOwned is limited to the restaurants the user owns
+	ScopeOwned = "owned"
+)
+
 type UserOutput struct {
 	ID    string `json:"id"`
 	Email string `json:"email" binding:"required"`
 	Name  string `json:"name" binding:"required"`
+	Role  string `json:"role,omitempty"`
+	// Status is one of StatusActive, StatusSuspended and StatusDeleted
+	Status string `json:"status,omitempty"`
 }
+
+// account statuses, suspended users can not log in and deleted ones are kept until they are purged
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+	StatusDeleted   = "deleted"
+)
+
 type OwnerReg struct {
-	Email    string `json:"email" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
 	Name     string `json:"name" binding:"required"`
 	Password string `json:"password"  binding:"required"`
+	Verified bool   `json:"-"`
 }
 
 /*type LoginInput struct {
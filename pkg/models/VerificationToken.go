@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// VerificationToken is the stored form of an email verification token, only the hash of the token is kept.
+// Verifying consumes the token and a new one replaces the previous tokens of the user
+type VerificationToken struct {
+	Hash      string
+	UserID    string
+	Role      string
+	ExpiresAt time.Time
+}
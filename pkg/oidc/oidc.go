@@ -0,0 +1,403 @@
+// Package oidc implements the client side of the OpenID Connect authorization code flow.
+//
+// The provider endpoints are read from its discovery document, the code is exchanged with a PKCE
+// verifier and the returned ID token is checked against the keys the provider publishes before its
+// identity is trusted.
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/encryption"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiscoveryPath is appended to the issuer to read the discovery document
+const DiscoveryPath = "/.well-known/openid-configuration"
+
+// clockSkew is the difference tolerated between the clocks of the provider and the server
+const clockSkew = time.Minute
+
+// maxResponseSize limits what is read from the provider
+const maxResponseSize = 1 << 20
+
+var (
+	ErrDiscovery       = errors.New("can not read the discovery document of the identity provider")
+	ErrExchange        = errors.New("identity provider refused the authorization code")
+	ErrInvalidIDToken  = errors.New("invalid id token")
+	ErrUnknownSigner   = errors.New("id token is signed with an unknown key")
+	ErrUnsupportedKey  = errors.New("identity provider key is not a supported RSA or Ed25519 key")
+	ErrIssuerMismatch  = errors.New("issuer of the discovery document does not match the configured one")
+	errMissingEndpoint = errors.New("discovery document lacks the authorization, token or jwks endpoint")
+)
+
+// Discovery is the part of the discovery document the authorization code flow needs
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Identity is the user an ID token was issued for
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider talks to the identity provider of cfg. Its discovery document is read on first use and
+// kept, its keys are read again when an ID token names an unknown one so key rotations are followed
+type Provider struct {
+	cfg    *config.OIDC
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      map[string]interface{}
+}
+
+func NewProvider(cfg *config.OIDC, client *http.Client) *Provider {
+	return &Provider{cfg: cfg, client: client}
+}
+
+// NewVerifier returns a random PKCE code verifier, it doubles as a source of state and nonce values
+func NewVerifier() (string, error) {
+	return encryption.NewOpaqueToken()
+}
+
+// codeChallenge is the S256 PKCE challenge of verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the page of the provider the user logs in on, it sends them back to the
+// redirect url with a code and state
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	discovery, err := p.Discovery(ctx)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems code with the verifier its challenge was sent with and returns the identity of
+// the ID token, which has to carry nonce
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	discovery, err := p.Discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	request, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	err = p.getJSON(request.WithContext(ctx), &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", ErrExchange, err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%v: no id token in the response", ErrExchange)
+	}
+	return p.Verify(ctx, tokens.IDToken, nonce)
+}
+
+// Verify checks the signature, issuer, audience, lifetime and nonce of an ID token
+func (p *Provider) Verify(ctx context.Context, idToken, nonce string) (*Identity, error) {
+	discovery, err := p.Discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims := &idTokenClaims{}
+	_, err = jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return p.key(ctx, token)
+	})
+	if err != nil {
+		if validation, ok := err.(*jwt.ValidationError); ok && validation.Inner != nil {
+			err = validation.Inner
+		}
+		return nil, fmt.Errorf("%v: %v", ErrInvalidIDToken, err)
+	}
+	switch {
+	case claims.Issuer != discovery.Issuer:
+		err = fmt.Errorf("issued by %q", claims.Issuer)
+	case !claims.Audience.contains(p.cfg.ClientID):
+		err = errors.New("issued for another client")
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID:
+		err = errors.New("authorized party is another client")
+	case claims.Nonce == "" || claims.Nonce != nonce:
+		err = errors.New("nonce does not match the login")
+	case claims.Subject == "":
+		err = errors.New("no subject")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", ErrInvalidIDToken, err)
+	}
+	return &Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+// Discovery returns the discovery document of the provider, it is read once
+func (p *Provider) Discovery(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	request, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(p.cfg.Issuer, "/")+DiscoveryPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	discovery := &Discovery{}
+	err = p.getJSON(request.WithContext(ctx), discovery)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", ErrDiscovery, err)
+	}
+	if discovery.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("%v: %q", ErrIssuerMismatch, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("%v: %v", ErrDiscovery, errMissingEndpoint)
+	}
+	p.discovery = discovery
+	return discovery, nil
+}
+
+// key returns the public key token names with its kid, the algorithm of token has to suit the key
+// so an ID token can not pick a weaker check such as an HMAC keyed with the public key
+func (p *Provider) key(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if !ok {
+		err := p.refreshKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		key, ok = p.keys[kid]
+		p.mu.Unlock()
+	}
+	if !ok {
+		return nil, ErrUnknownSigner
+	}
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); ok {
+			return key, nil
+		}
+	case ed25519.PublicKey:
+		if token.Method == encryption.SigningMethodEdDSA {
+			return key, nil
+		}
+	}
+	return nil, jwt.ErrSignatureInvalid
+}
+
+// refreshKeys reads the keys the provider publishes on its jwks endpoint
+func (p *Provider) refreshKeys(ctx context.Context) error {
+	discovery, err := p.Discovery(ctx)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodGet, discovery.JWKSURI, nil)
+	if err != nil {
+		return err
+	}
+	var jwks encryption.JWKS
+	err = p.getJSON(request.WithContext(ctx), &jwks)
+	if err != nil {
+		return fmt.Errorf("can not read the keys of the identity provider: %v", err)
+	}
+	keys := make(map[string]interface{})
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(jwk)
+		if err == ErrUnsupportedKey {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("key %s of the identity provider: %v", jwk.KeyID, err)
+		}
+		keys[jwk.KeyID] = key
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+	return nil
+}
+
+func parseJWK(jwk encryption.JWK) (interface{}, error) {
+	switch {
+	case jwk.KeyType == "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, ErrUnsupportedKey
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case jwk.KeyType == "OKP" && jwk.Curve == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// getJSON sends request and decodes its successful json response into v
+func (p *Provider) getJSON(request *http.Request, v interface{}) error {
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		json.Unmarshal(body, &oauthErr)
+		if oauthErr.Error != "" {
+			return fmt.Errorf("%s %s: %s %s", request.Method, request.URL.Path, oauthErr.Error, oauthErr.Description)
+		}
+		return fmt.Errorf("%s %s: status %d", request.Method, request.URL.Path, response.StatusCode)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// idTokenClaims are the claims of an ID token the login relies on
+type idTokenClaims struct {
+	Issuer          string       `json:"iss"`
+	Subject         string       `json:"sub"`
+	Audience        audience     `json:"aud"`
+	AuthorizedParty string       `json:"azp"`
+	ExpiresAt       int64        `json:"exp"`
+	IssuedAt        int64        `json:"iat"`
+	NotBefore       int64        `json:"nbf"`
+	Nonce           string       `json:"nonce"`
+	Email           string       `json:"email"`
+	EmailVerified   flexibleBool `json:"email_verified"`
+	Name            string       `json:"name"`
+}
+
+// Valid checks the lifetime of the ID token, it is called by jwt.ParseWithClaims
+func (c *idTokenClaims) Valid() error {
+	now := time.Now()
+	switch {
+	case c.ExpiresAt == 0:
+		return errors.New("token has no expiry")
+	case now.Add(-clockSkew).Unix() >= c.ExpiresAt:
+		return errors.New("token is expired")
+	case now.Add(clockSkew).Unix() < c.IssuedAt || now.Add(clockSkew).Unix() < c.NotBefore:
+		return errors.New("token is not valid yet")
+	}
+	return nil
+}
+
+// audience is the aud claim, providers send a single client as a string and several as an array
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+	var several []string
+	err := json.Unmarshal(data, &several)
+	*a = several
+	return err
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// flexibleBool is the email_verified claim, some providers send it as a string
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	switch typed := value.(type) {
+	case bool:
+		*b = flexibleBool(typed)
+	case string:
+		*b = flexibleBool(typed == "true")
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package oidc_test
+
+import (
+	"context"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/oidc"
+	"github.com/vds/go-resman/pkg/oidc/oidctest"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const redirectURL = "https://resman.example.com/login/oidc/callback"
+
+func newProvider(idp *oidctest.IdP, clientSecret string) *oidc.Provider {
+	cfg := &config.OIDC{
+		Issuer:       idp.Issuer(),
+		ClientID:     idp.ClientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "email"},
+	}
+	return oidc.NewProvider(cfg, &http.Client{Timeout: 5 * time.Second})
+}
+
+// authorize follows the authorization url up to the redirect back to the client and returns its query
+func authorize(t *testing.T, authURL string) url.Values {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("can not authorize: %v", err)
+	}
+	response.Body.Close()
+	location, err := url.Parse(response.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), redirectURL) {
+		t.Fatalf("got redirect to %q want the callback", response.Header.Get("Location"))
+	}
+	return location.Query()
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	idp := oidctest.NewIdP("resman", "s3cret")
+	defer idp.Close()
+	idp.SetUser(oidc.Identity{Subject: "42", Email: "admin@example.com", EmailVerified: true, Name: "admin"})
+	provider := newProvider(idp, "s3cret")
+
+	login := func(verifier string) (*oidc.Identity, error) {
+		authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+		if err != nil {
+			t.Fatalf("can not build the authorization url: %v", err)
+		}
+		callback := authorize(t, authURL)
+		if callback.Get("state") != "state-1" {
+			t.Fatalf("got state %q want state-1", callback.Get("state"))
+		}
+		return provider.Exchange(ctx, callback.Get("code"), verifier, "nonce-1")
+	}
+
+	identity, err := login("verifier-1")
+	if err != nil {
+		t.Fatalf("can not log in: %v", err)
+	}
+	if identity.Subject != "42" || identity.Email != "admin@example.com" || !identity.EmailVerified {
+		t.Fatalf("got identity %+v want the user of the provider", identity)
+	}
+	_, err = login("another-verifier")
+	if err == nil || !strings.HasPrefix(err.Error(), oidc.ErrExchange.Error()) {
+		t.Fatalf("got error %v want the code refused without its verifier", err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(claims jwt.MapClaims)
+	}{
+		{"other issuer", func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" }},
+		{"other client", func(claims jwt.MapClaims) { claims["aud"] = "other" }},
+		{"other authorized party", func(claims jwt.MapClaims) {
+			claims["aud"] = []string{"resman", "other"}
+			claims["azp"] = "other"
+		}},
+		{"other nonce", func(claims jwt.MapClaims) { claims["nonce"] = "nonce-2" }},
+		{"expired", func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp.Tamper(test.tamper)
+			defer idp.Tamper(nil)
+			_, err := login("verifier-1")
+			if err == nil || !strings.HasPrefix(err.Error(), oidc.ErrInvalidIDToken.Error()) {
+				t.Fatalf("got error %v want an invalid id token", err)
+			}
+		})
+	}
+
+	idp.Tamper(func(claims jwt.MapClaims) {
+		claims["aud"] = []string{"other", "resman"}
+		claims["azp"] = "resman"
+		claims["email_verified"] = "false"
+	})
+	identity, err = login("verifier-1")
+	if err != nil || identity.EmailVerified {
+		t.Fatalf("got identity %+v and error %v want an unverified email", identity, err)
+	}
+}
+
+func TestClientSecret(t *testing.T) {
+	idp := oidctest.NewIdP("resman", "s3cret")
+	defer idp.Close()
+	provider := newProvider(idp, "wrong")
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("can not build the authorization url: %v", err)
+	}
+	callback := authorize(t, authURL)
+	_, err = provider.Exchange(context.Background(), callback.Get("code"), "verifier", "nonce")
+	if err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Fatalf("got error %v want the client refused", err)
+	}
+}
+
+func TestDiscoveryIssuer(t *testing.T) {
+	idp := oidctest.NewIdP("resman", "s3cret")
+	defer idp.Close()
+	cfg := &config.OIDC{Issuer: idp.Issuer() + "/", ClientID: "resman", RedirectURL: redirectURL}
+	_, err := oidc.NewProvider(cfg, http.DefaultClient).Discovery(context.Background())
+	if err == nil || !strings.HasPrefix(err.Error(), oidc.ErrIssuerMismatch.Error()) {
+		t.Fatalf("got error %v want an issuer mismatch", err)
+	}
+}
@@ -0,0 +1,186 @@
+// Package rbac maps roles to the permissions routes require.
+//
+// The superAdmin, admin and owner roles are built in, more roles are defined in the configuration
+// by listing their permissions and scope, so adding a role needs no code change.
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/models"
+	"strings"
+)
+
+// built in roles
+const (
+	SuperAdmin = "superAdmin"
+	Admin      = "admin"
+	Owner      = "owner"
+)
+
+// permissions, they are named resource:action
+const (
+	// AdminCreate invites users of the admin roles, owners are invited with OwnerCreate
+	AdminCreate = "admin:create"
+	AdminRead   = "admin:read"
+	AdminUpdate = "admin:update"
+	AdminDelete = "admin:delete"
+
+	OwnerRead   = "owner:read"
+	OwnerCreate = "owner:create"
+	OwnerUpdate = "owner:update"
+	OwnerDelete = "owner:delete"
+
+	RestaurantRead   = "restaurant:read"
+	RestaurantCreate = "restaurant:create"
+	RestaurantUpdate = "restaurant:update"
+	RestaurantDelete = "restaurant:delete"
+	// RestaurantAssign lists the restaurants without an owner and gives them one
+	RestaurantAssign = "restaurant:assign"
+
+	MenuRead   = "menu:read"
+	MenuCreate = "menu:create"
+	MenuUpdate = "menu:update"
+	MenuDelete = "menu:delete"
+
+	// TwoFactorEnrol lets users of the role enrol a second factor, the two-factor policy applies to them
+	TwoFactorEnrol = "2fa:enrol"
+	// TwoFactorPolicy sets whether enrolling a second factor is required
+	TwoFactorPolicy = "2fa:policy"
+	// LoginUnlockIP lifts the lock of a source ip
+	LoginUnlockIP = "login:unlock-ip"
+	// APIKeyManage lets users of the role create, list and revoke their own api keys
+	APIKeyManage = "apikey:manage"
+	// UserImpersonate issues short lived tokens acting as another user, super admins can not be impersonated
+	UserImpersonate = "user:impersonate"
+	// UserReactivate makes suspended and deleted accounts of any role active again
+	UserReactivate = "user:reactivate"
+)
+
+// maxRoleLength is the size of the role columns
+const maxRoleLength = 20
+
+var (
+	ErrInvalidRole       = errors.New("invalid role")
+	ErrUnknownPermission = errors.New("unknown permission")
+)
+
+var permissions = []string{
+	AdminCreate, AdminRead, AdminUpdate, AdminDelete,
+	OwnerRead, OwnerCreate, OwnerUpdate, OwnerDelete,
+	RestaurantRead, RestaurantCreate, RestaurantUpdate, RestaurantDelete, RestaurantAssign,
+	MenuRead, MenuCreate, MenuUpdate, MenuDelete,
+	TwoFactorEnrol, TwoFactorPolicy, LoginUnlockIP, APIKeyManage, UserImpersonate, UserReactivate,
+}
+
+// DefaultRoles returns the built in roles
+func DefaultRoles() map[string]config.Role {
+	return map[string]config.Role{
+		SuperAdmin: {
+			Scope:       models.ScopeAll,
+			Permissions: []string{"*"},
+		},
+		Admin: {
+			Scope:       models.ScopeCreated,
+			Permissions: []string{"owner:*", "restaurant:*", "menu:*", TwoFactorEnrol, APIKeyManage},
+		},
+		Owner: {
+			Scope:       models.ScopeOwned,
+			Permissions: []string{RestaurantRead, "menu:*", APIKeyManage},
+		},
+	}
+}
+
+type role struct {
+	scope       string
+	permissions map[string]bool
+}
+
+// Policy answers which permissions a role has
+type Policy struct {
+	roles map[string]*role
+}
+
+// NewPolicy returns the policy of the built in roles and the roles of cfg, it fails on unknown
+// permissions and scopes so a typo in the configuration does not silently deny or grant access
+func NewPolicy(cfg *config.RBAC) (*Policy, error) {
+	roles := DefaultRoles()
+	for name, r := range cfg.Roles {
+		roles[name] = r
+	}
+	policy := &Policy{roles: make(map[string]*role)}
+	for name, r := range roles {
+		if name == "" || len(name) > maxRoleLength {
+			return nil, fmt.Errorf("%v: role name %q must have 1 to %d characters", ErrInvalidRole, name, maxRoleLength)
+		}
+		switch r.Scope {
+		case models.ScopeAll, models.ScopeCreated, models.ScopeOwned:
+		default:
+			return nil, fmt.Errorf("%v: scope %q of role %s is not all, created or owned", ErrInvalidRole, r.Scope, name)
+		}
+		expanded, err := Expand(r.Permissions)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v of role %s", ErrInvalidRole, err, name)
+		}
+		granted := make(map[string]bool)
+		for _, permission := range expanded {
+			granted[permission] = true
+		}
+		policy.roles[name] = &role{scope: r.Scope, permissions: granted}
+	}
+	return policy, nil
+}
+
+// IsRole reports whether role is defined
+func (p *Policy) IsRole(role string) bool {
+	_, ok := p.roles[role]
+	return ok
+}
+
+// Can reports whether role has permission, unknown roles have none
+func (p *Policy) Can(role string, permission string) bool {
+	r, ok := p.roles[role]
+	return ok && r.permissions[permission]
+}
+
+// Scope returns the scope of role, it is empty for unknown roles
+func (p *Policy) Scope(role string) string {
+	r, ok := p.roles[role]
+	if !ok {
+		return ""
+	}
+	return r.scope
+}
+
+// Expand returns the permissions matched by patterns once each, it fails on patterns matching none
+func Expand(patterns []string) ([]string, error) {
+	matchedBy := make(map[string]bool)
+	for _, pattern := range patterns {
+		matched := false
+		for _, permission := range permissions {
+			if matches(pattern, permission) {
+				matchedBy[permission] = true
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("%v %q", ErrUnknownPermission, pattern)
+		}
+	}
+	var expanded []string
+	for _, permission := range permissions {
+		if matchedBy[permission] {
+			expanded = append(expanded, permission)
+		}
+	}
+	return expanded, nil
+}
+
+// matches reports whether the permission pattern of a role grants permission
+func matches(pattern, permission string) bool {
+	if pattern == "*" || pattern == permission {
+		return true
+	}
+	return strings.HasSuffix(pattern, ":*") && strings.HasPrefix(permission, strings.TrimSuffix(pattern, "*"))
+}
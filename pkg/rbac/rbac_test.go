@@ -0,0 +1,88 @@
+package rbac_test
+
+import (
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/rbac"
+	"strings"
+	"testing"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	policy, err := rbac.NewPolicy(&config.RBAC{})
+	if err != nil {
+		t.Fatalf("can not create policy: %v", err)
+	}
+	tests := []struct {
+		role       string
+		permission string
+		want       bool
+	}{
+		{rbac.SuperAdmin, rbac.AdminDelete, true},
+		{rbac.SuperAdmin, rbac.LoginUnlockIP, true},
+		{rbac.SuperAdmin, rbac.UserImpersonate, true},
+		{rbac.Admin, rbac.UserImpersonate, false},
+		{rbac.SuperAdmin, rbac.UserReactivate, true},
+		{rbac.Admin, rbac.UserReactivate, false},
+		{rbac.Admin, rbac.OwnerDelete, true},
+		{rbac.Admin, rbac.RestaurantAssign, true},
+		{rbac.Admin, rbac.AdminRead, false},
+		{rbac.Admin, rbac.AdminCreate, false},
+		{rbac.Admin, rbac.TwoFactorPolicy, false},
+		{rbac.Owner, rbac.MenuUpdate, true},
+		{rbac.Owner, rbac.RestaurantUpdate, false},
+		{rbac.Owner, rbac.TwoFactorEnrol, false},
+		{"unknown", rbac.RestaurantRead, false},
+	}
+	for _, test := range tests {
+		if got := policy.Can(test.role, test.permission); got != test.want {
+			t.Errorf("got %v for %s %s want %v", got, test.role, test.permission, test.want)
+		}
+	}
+	if policy.Scope(rbac.Admin) != models.ScopeCreated || policy.Scope("unknown") != "" {
+		t.Fatalf("got scopes %q and %q", policy.Scope(rbac.Admin), policy.Scope("unknown"))
+	}
+}
+
+func TestCustomRoles(t *testing.T) {
+	policy, err := rbac.NewPolicy(&config.RBAC{Roles: map[string]config.Role{
+		"auditor":  {Scope: models.ScopeAll, Permissions: []string{"restaurant:read", "owner:read"}},
+		rbac.Owner: {Scope: models.ScopeOwned, Permissions: []string{"restaurant:*"}},
+	}})
+	if err != nil {
+		t.Fatalf("can not create policy: %v", err)
+	}
+	if !policy.IsRole("auditor") || !policy.Can("auditor", rbac.OwnerRead) || policy.Can("auditor", rbac.OwnerUpdate) {
+		t.Fatalf("auditor should only read")
+	}
+	if !policy.Can(rbac.Owner, rbac.RestaurantDelete) || policy.Can(rbac.Owner, rbac.MenuRead) {
+		t.Fatalf("configured owner role should replace the built in one")
+	}
+
+	for _, roles := range []map[string]config.Role{
+		{"typo": {Scope: models.ScopeAll, Permissions: []string{"restaurant:reed"}}},
+		{"typo": {Scope: models.ScopeAll, Permissions: []string{"restaurants:*"}}},
+		{"typo": {Scope: "everything", Permissions: []string{"*"}}},
+		{strings.Repeat("r", 21): {Scope: models.ScopeAll}},
+	} {
+		_, err = rbac.NewPolicy(&config.RBAC{Roles: roles})
+		if err == nil {
+			t.Errorf("wanted an error for %v", roles)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	expanded, err := rbac.Expand([]string{"menu:*", rbac.MenuRead, rbac.RestaurantRead})
+	if err != nil {
+		t.Fatalf("can not expand permissions: %v", err)
+	}
+	want := []string{rbac.RestaurantRead, rbac.MenuRead, rbac.MenuCreate, rbac.MenuUpdate, rbac.MenuDelete}
+	if strings.Join(expanded, ",") != strings.Join(want, ",") {
+		t.Fatalf("got %v want %v", expanded, want)
+	}
+	_, err = rbac.Expand([]string{"menu:cook"})
+	if err == nil || !strings.Contains(err.Error(), rbac.ErrUnknownPermission.Error()) {
+		t.Fatalf("got %v want an unknown permission error", err)
+	}
+}
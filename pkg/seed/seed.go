@@ -0,0 +1,310 @@
+// Package seed loads declarative fixtures of users, restaurants and dishes into a database.
+//
+// Records are matched by their natural keys, users by email and name, restaurants by name among
+// those visible to their creator and dishes by name within their restaurant, so applying the same fixture again only creates
+// what is missing. Existing records are left as they are and created users start with a verified email.
+package seed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/rbac"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrFileFormat     = errors.New("fixture file must be .yaml, .yml or .json")
+	ErrUnknownCreator = errors.New("creator is not a super admin or admin of the fixture")
+	ErrUnknownOwner   = errors.New("owner is not an owner of the fixture")
+	ErrPasswordDiffer = errors.New("super admin exists with a different password")
+)
+
+// Fixture is the content of a fixture file
+type Fixture struct {
+	SuperAdmins []User       `yaml:"superAdmins" json:"superAdmins"`
+	Admins      []User       `yaml:"admins" json:"admins"`
+	Owners      []Owner      `yaml:"owners" json:"owners"`
+	Restaurants []Restaurant `yaml:"restaurants" json:"restaurants"`
+}
+
+type User struct {
+	Email    string `yaml:"email" json:"email"`
+	Name     string `yaml:"name" json:"name"`
+	Password string `yaml:"password" json:"password"`
+}
+
+// Owner is created by the super admin or admin whose email is Creator
+type Owner struct {
+	User    `yaml:",inline"`
+	Creator string `yaml:"creator" json:"creator"`
+}
+
+// Restaurant is created by the super admin or admin whose email is Creator and assigned
+// to the owner whose email is Owner when it is set
+type Restaurant struct {
+	Name    string  `yaml:"name" json:"name"`
+	Lat     float64 `yaml:"lat" json:"lat"`
+	Lng     float64 `yaml:"lng" json:"lng"`
+	Creator string  `yaml:"creator" json:"creator"`
+	Owner   string  `yaml:"owner" json:"owner"`
+	Dishes  []Dish  `yaml:"dishes" json:"dishes"`
+}
+
+type Dish struct {
+	Name  string  `yaml:"name" json:"name"`
+	Price float32 `yaml:"price" json:"price"`
+}
+
+// Result holds the ids of the records of a fixture, whether they were created or already existed
+type Result struct {
+	// Users maps emails to user ids
+	Users map[string]string
+	// Restaurants holds the restaurant ids in the order of the fixture
+	Restaurants []int
+	// Dishes holds the dish ids of every restaurant in the order of the fixture
+	Dishes [][]int
+	// Created counts the records added to the database
+	Created int
+}
+
+// LoadFile reads a fixture, the format is chosen from the file extension
+func LoadFile(path string) (*Fixture, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".yaml" && ext != ".yml" && ext != ".json" {
+		return nil, ErrFileFormat
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fixture := new(Fixture)
+	if ext == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(fixture)
+	} else {
+		err = yaml.UnmarshalStrict(data, fixture)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return fixture, nil
+}
+
+// Apply creates the records of fixture that are missing from db in a single transaction
+func Apply(ctx context.Context, db database.Database, fixture *Fixture) (*Result, error) {
+	var result *Result
+	err := db.WithTx(ctx, func(tx database.Database) error {
+		s := &seeder{db: tx, roles: map[string]string{}, result: &Result{Users: map[string]string{}}}
+		err := s.apply(ctx, fixture)
+		if err != nil {
+			return err
+		}
+		result = s.result
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+type seeder struct {
+	db database.Database
+	// roles maps the emails of the fixture users to their role
+	roles  map[string]string
+	result *Result
+}
+
+func (s *seeder) apply(ctx context.Context, fixture *Fixture) error {
+	reqId, reqUrl := logger.GetRequestFieldsFromContext(ctx)
+	for _, user := range fixture.SuperAdmins {
+		err := s.superAdmin(ctx, user)
+		if err != nil {
+			return fmt.Errorf("super admin %s: %v", user.Email, err)
+		}
+	}
+	for _, user := range fixture.Admins {
+		err := s.admin(ctx, user)
+		if err != nil {
+			return fmt.Errorf("admin %s: %v", user.Email, err)
+		}
+	}
+	for _, owner := range fixture.Owners {
+		err := s.owner(ctx, owner)
+		if err != nil {
+			return fmt.Errorf("owner %s: %v", owner.Email, err)
+		}
+	}
+	for _, restaurant := range fixture.Restaurants {
+		err := s.restaurant(ctx, restaurant)
+		if err != nil {
+			return fmt.Errorf("restaurant %s: %v", restaurant.Name, err)
+		}
+	}
+	logger.LogInfo(reqId, reqUrl, fmt.Sprintf("fixture applied, %d records created", s.result.Created), 0)
+	return nil
+}
+
+// superAdmin finds or creates user, an existing super admin must have the password of the fixture.
+// Existing records are always looked up before inserting because a failed insert aborts the whole
+// transaction on some backends
+func (s *seeder) superAdmin(ctx context.Context, user User) error {
+	id, err := s.db.FindUserID(ctx, middleware.SuperAdmin, user.Email)
+	if err == database.ErrUserNotFound {
+		id, err = s.db.CreateUser(ctx, &models.UserReg{Role: middleware.SuperAdmin, Email: user.Email, Name: user.Name, Password: user.Password, Verified: true})
+		if err == nil {
+			s.result.Created++
+		}
+	} else if err == nil {
+		_, err = s.db.LogInUser(ctx, &models.Credentials{Role: middleware.SuperAdmin, Email: user.Email, Password: user.Password})
+		if err == database.ErrInvalidCredentials {
+			return ErrPasswordDiffer
+		}
+		// the password matched, fixtures do not verify emails of existing accounts
+		if err == database.ErrUnverifiedEmail {
+			err = nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	s.addUser(user.Email, id, middleware.SuperAdmin)
+	return nil
+}
+
+func (s *seeder) admin(ctx context.Context, user User) error {
+	admins, _, err := s.db.ShowAdmins(ctx, &models.ListOptions{NamePrefix: user.Name})
+	if err != nil {
+		return err
+	}
+	id := findUser(admins, user.Email)
+	if id == "" {
+		id, err = s.db.CreateUser(ctx, &models.UserReg{Role: middleware.Admin, Email: user.Email, Name: user.Name, Password: user.Password, Verified: true})
+		if err != nil {
+			return err
+		}
+		s.result.Created++
+	}
+	s.addUser(user.Email, id, middleware.Admin)
+	return nil
+}
+
+func (s *seeder) owner(ctx context.Context, owner Owner) error {
+	creator, err := s.creator(owner.Creator)
+	if err != nil {
+		return err
+	}
+	owners, _, err := s.db.ShowOwners(ctx, &models.UserAuth{Role: middleware.SuperAdmin, Scope: models.ScopeAll}, &models.ListOptions{NamePrefix: owner.Name})
+	if err != nil {
+		return err
+	}
+	id := findUser(owners, owner.Email)
+	if id == "" {
+		created, err := s.db.CreateOwner(ctx, creator.ID, &models.OwnerReg{Email: owner.Email, Name: owner.Name, Password: owner.Password, Verified: true})
+		if err != nil {
+			return err
+		}
+		id = created.ID
+		s.result.Created++
+	}
+	s.addUser(owner.Email, id, middleware.Owner)
+	return nil
+}
+
+func (s *seeder) restaurant(ctx context.Context, restaurant Restaurant) error {
+	creator, err := s.creator(restaurant.Creator)
+	if err != nil {
+		return err
+	}
+	existing, _, err := s.db.ShowRestaurants(ctx, creator, &models.ListOptions{NamePrefix: restaurant.Name})
+	if err != nil {
+		return err
+	}
+	id := 0
+	for _, res := range existing {
+		if res.Name == restaurant.Name {
+			id = res.ID
+			break
+		}
+	}
+	if id == 0 {
+		created, err := s.db.InsertRestaurant(ctx, &models.Restaurant{Name: restaurant.Name, Lat: restaurant.Lat, Lng: restaurant.Lng, CreatorID: creator.ID})
+		if err != nil {
+			return err
+		}
+		id = created.ID
+		s.result.Created++
+	}
+	s.result.Restaurants = append(s.result.Restaurants, id)
+
+	if restaurant.Owner != "" {
+		ownerID, ok := s.result.Users[restaurant.Owner]
+		if !ok || s.roles[restaurant.Owner] != middleware.Owner {
+			return ErrUnknownOwner
+		}
+		err = s.db.InsertOwnerForRestaurants(ctx, creator, ownerID, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	menu, _, err := s.db.ShowMenu(ctx, id, nil)
+	if err != nil {
+		return err
+	}
+	dishIDs := []int{}
+	for _, dish := range restaurant.Dishes {
+		dishID := 0
+		for _, existing := range menu {
+			if existing.Name == dish.Name {
+				dishID = existing.ID
+				break
+			}
+		}
+		if dishID == 0 {
+			created, err := s.db.InsertDishes(ctx, models.Dish{Name: dish.Name, Price: dish.Price}, id)
+			if err != nil {
+				return fmt.Errorf("dish %s: %v", dish.Name, err)
+			}
+			dishID = created.ID
+			s.result.Created++
+		}
+		dishIDs = append(dishIDs, dishID)
+	}
+	s.result.Dishes = append(s.result.Dishes, dishIDs)
+	return nil
+}
+
+// creator returns the credentials of the super admin or admin with the given email
+func (s *seeder) creator(email string) (*models.UserAuth, error) {
+	role := s.roles[email]
+	if role != middleware.SuperAdmin && role != middleware.Admin {
+		return nil, ErrUnknownCreator
+	}
+	return &models.UserAuth{ID: s.result.Users[email], Role: role, Scope: rbac.DefaultRoles()[role].Scope}, nil
+}
+
+func (s *seeder) addUser(email, id, role string) {
+	s.result.Users[email] = id
+	s.roles[email] = role
+}
+
+func findUser(users []models.UserOutput, email string) string {
+	for _, user := range users {
+		if user.Email == email {
+			return user.ID
+		}
+	}
+	return ""
+}
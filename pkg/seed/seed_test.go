@@ -0,0 +1,173 @@
+package seed_test
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/vds/go-resman/pkg/database/databasetest"
+	"github.com/vds/go-resman/pkg/database/memory"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/seed"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func init() {
+	logger.InitLogger(logrus.ErrorLevel)
+}
+
+func TestApplyIsIdempotent(t *testing.T) {
+	for _, path := range []string{"../testhelpers/testdata/fixture.yaml", "../../fixtures/demo.yaml"} {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			fixture, err := seed.LoadFile(path)
+			if err != nil {
+				t.Fatalf("can not load fixture: %v", err)
+			}
+			db := memory.NewMemoryDB()
+			first, err := seed.Apply(databasetest.Context(), db, fixture)
+			if err != nil {
+				t.Fatalf("can not apply fixture: %v", err)
+			}
+			if first.Created == 0 {
+				t.Fatalf("nothing was created")
+			}
+			second, err := seed.Apply(databasetest.Context(), db, fixture)
+			if err != nil {
+				t.Fatalf("can not apply fixture again: %v", err)
+			}
+			if second.Created != 0 {
+				t.Errorf("applying again created %d records", second.Created)
+			}
+			second.Created = first.Created
+			if !reflect.DeepEqual(first, second) {
+				t.Errorf("got %+v then %+v", first, second)
+			}
+			_, total, err := db.ShowRestaurants(databasetest.Context(), &models.UserAuth{Role: middleware.SuperAdmin, Scope: models.ScopeAll}, nil)
+			if err != nil || total != len(fixture.Restaurants) {
+				t.Errorf("got %d restaurants want %d: %v", total, len(fixture.Restaurants), err)
+			}
+		})
+	}
+}
+
+func TestApplyTestFixture(t *testing.T) {
+	fixture, err := seed.LoadFile("../testhelpers/testdata/fixture.yaml")
+	if err != nil {
+		t.Fatalf("can not load fixture: %v", err)
+	}
+	db := memory.NewMemoryDB()
+	result, err := seed.Apply(databasetest.Context(), db, fixture)
+	if err != nil {
+		t.Fatalf("can not apply fixture: %v", err)
+	}
+	if !reflect.DeepEqual(result.Restaurants, []int{1, 2}) || !reflect.DeepEqual(result.Dishes, [][]int{{1}, {2}}) {
+		t.Errorf("got restaurants %v dishes %v", result.Restaurants, result.Dishes)
+	}
+	owned, _, err := db.ShowRestaurants(databasetest.Context(), &models.UserAuth{ID: result.Users["ownerByAdmin@gmail.com"], Role: middleware.Owner, Scope: models.ScopeOwned}, nil)
+	if err != nil || len(owned) != 1 || owned[0].ID != 2 {
+		t.Errorf("got owned restaurants %v: %v", owned, err)
+	}
+}
+
+func TestApplyHashesWithTheDatabaseHasher(t *testing.T) {
+	fixture, err := seed.LoadFile("../testhelpers/testdata/fixture.yaml")
+	if err != nil {
+		t.Fatalf("can not load fixture: %v", err)
+	}
+	db := memory.NewMemoryDB()
+	hasher := &databasetest.CountingHasher{PasswordHasher: encryption.NewBcryptHasher(4)}
+	db.SetPasswordHasher(hasher)
+	_, err = seed.Apply(databasetest.Context(), db, fixture)
+	if err != nil {
+		t.Fatalf("can not apply fixture: %v", err)
+	}
+	users := len(fixture.SuperAdmins) + len(fixture.Admins) + len(fixture.Owners)
+	if hasher.Hashes != users {
+		t.Fatalf("got %d passwords hashed by the configured hasher want %d", hasher.Hashes, users)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	admin := seed.User{Email: "admin@test.com", Name: "admin", Password: "pass"}
+	tests := []struct {
+		name    string
+		fixture seed.Fixture
+		err     error
+	}{
+		{"unknown creator", seed.Fixture{
+			Owners: []seed.Owner{{User: seed.User{Email: "owner@test.com", Name: "owner", Password: "pass"}, Creator: "nobody@test.com"}},
+		}, seed.ErrUnknownCreator},
+		{"owner as creator", seed.Fixture{
+			Admins:      []seed.User{admin},
+			Owners:      []seed.Owner{{User: seed.User{Email: "owner@test.com", Name: "owner", Password: "pass"}, Creator: admin.Email}},
+			Restaurants: []seed.Restaurant{{Name: "res", Creator: "owner@test.com"}},
+		}, seed.ErrUnknownCreator},
+		{"unknown owner", seed.Fixture{
+			Admins:      []seed.User{admin},
+			Restaurants: []seed.Restaurant{{Name: "res", Creator: admin.Email, Owner: admin.Email}},
+		}, seed.ErrUnknownOwner},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := memory.NewMemoryDB()
+			_, err := seed.Apply(databasetest.Context(), db, &test.fixture)
+			if err == nil || !strings.HasSuffix(err.Error(), test.err.Error()) {
+				t.Fatalf("got error %v want %v", err, test.err)
+			}
+			// the fixture is applied in a transaction so nothing is left behind
+			admins, _, _ := db.ShowAdmins(databasetest.Context(), nil)
+			if len(admins) != 0 {
+				t.Errorf("failed fixture left admins %v", admins)
+			}
+		})
+	}
+
+	db := memory.NewMemoryDB()
+	_, err := db.CreateUser(databasetest.Context(), &models.UserReg{Role: middleware.SuperAdmin, Email: "super@test.com", Name: "super", Password: "other"})
+	if err != nil {
+		t.Fatalf("can not create super admin: %v", err)
+	}
+	_, err = seed.Apply(databasetest.Context(), db, &seed.Fixture{SuperAdmins: []seed.User{{Email: "super@test.com", Name: "super", Password: "pass"}}})
+	if err == nil || !strings.HasSuffix(err.Error(), seed.ErrPasswordDiffer.Error()) {
+		t.Errorf("got error %v want %v", err, seed.ErrPasswordDiffer)
+	}
+}
+
+func TestLoadFileJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resman-seed")
+	if err != nil {
+		t.Fatalf("can not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fixture.json")
+	err = ioutil.WriteFile(path, []byte(`{"admins": [{"email": "admin@test.com", "name": "admin", "password": "pass"}],
+		"owners": [{"email": "owner@test.com", "name": "owner", "password": "pass", "creator": "admin@test.com"}]}`), 0600)
+	if err != nil {
+		t.Fatalf("can not write fixture: %v", err)
+	}
+	fixture, err := seed.LoadFile(path)
+	if err != nil {
+		t.Fatalf("can not load fixture: %v", err)
+	}
+	if len(fixture.Owners) != 1 || fixture.Owners[0].Email != "owner@test.com" || fixture.Owners[0].Creator != "admin@test.com" {
+		t.Errorf("got owners %+v", fixture.Owners)
+	}
+
+	err = ioutil.WriteFile(path, []byte(`{"admin": []}`), 0600)
+	if err != nil {
+		t.Fatalf("can not write fixture: %v", err)
+	}
+	_, err = seed.LoadFile(path)
+	if err == nil {
+		t.Errorf("expected an error for an unknown key")
+	}
+	_, err = seed.LoadFile(filepath.Join(dir, "fixture.txt"))
+	if err != seed.ErrFileFormat {
+		t.Errorf("got error %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package server_test
+
+import (
+	"github.com/vds/go-resman/pkg/database/memory"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/testhelpers"
+	"net/http"
+	"testing"
+)
+
+func TestAccountStatus(t *testing.T) {
+	db := memory.NewMemoryDB()
+	ts := testhelpers.NewServer(t, db, nil,
+		models.UserReg{Role: middleware.SuperAdmin, Email: "super@example.com", Name: "super", Password: "superPass", Verified: true},
+		models.UserReg{Role: middleware.Admin, Email: "admin@example.com", Name: "admin", Password: "adminPass", Verified: true},
+		models.UserReg{Role: middleware.Admin, Email: "other@example.com", Name: "other", Password: "otherPass", Verified: true},
+	)
+	adminID := ts.UserIDs[1]
+	owner, err := db.CreateOwner(testhelpers.Context(), adminID, &models.OwnerReg{Email: "owner@example.com", Name: "owner", Password: "ownerPass", Verified: true})
+	if err != nil {
+		t.Fatalf("can not create owner: %v", err)
+	}
+	// login checks the status of a login that may be refused
+	login := func(role, email, password string, want int) string {
+		t.Helper()
+		status, login := doJSON(t, http.MethodPost, ts.URL+"/login", "", map[string]string{"role": role, "email": email, "password": password})
+		testhelpers.AssertStatus(t, status, want)
+		token, _ := login["token"].(string)
+		return token
+	}
+	listedOwners := func(token, status string) int {
+		t.Helper()
+		code, page := doJSON(t, http.MethodGet, ts.URL+"/manage/owners?status="+status, token, nil)
+		testhelpers.AssertStatus(t, code, http.StatusOK)
+		data, _ := page["data"].([]interface{})
+		return len(data)
+	}
+	super := ts.Login(middleware.SuperAdmin, "super@example.com", "superPass")
+	admin := ts.Login(middleware.Admin, "admin@example.com", "adminPass")
+	other := ts.Login(middleware.Admin, "other@example.com", "otherPass")
+	ownerToken := ts.Login(middleware.Owner, "owner@example.com", "ownerPass")
+
+	// suspension refuses the tokens already issued and new logins
+	status, _ := doJSON(t, http.MethodPost, ts.URL+"/manage/owners/"+owner.ID+"/suspend", other, nil)
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/owners/"+owner.ID+"/suspend", admin, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/me", ownerToken, nil)
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	login(middleware.Owner, "owner@example.com", "ownerPass", http.StatusForbidden)
+	if got := listedOwners(admin, models.StatusSuspended); got != 1 {
+		t.Fatalf("got %d suspended owners want 1", got)
+	}
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/manage/owners?status=gone", admin, nil)
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+
+	// only super admins reactivate accounts
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/users/"+owner.ID+"/reactivate", admin, nil)
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/users/unknown/reactivate", super, nil)
+	testhelpers.AssertStatus(t, status, http.StatusNotFound)
+	status, reactivated := doJSON(t, http.MethodPost, ts.URL+"/manage/users/"+owner.ID+"/reactivate", super, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if reactivated["status"] != models.StatusActive {
+		t.Fatalf("got reactivated user %v", reactivated)
+	}
+	login(middleware.Owner, "owner@example.com", "ownerPass", http.StatusOK)
+
+	// deleted accounts stop working, impersonating them included, until they are reactivated
+	status, started := doJSON(t, http.MethodPost, ts.URL+"/manage/impersonate", super, map[string]string{"role": middleware.Owner, "email": "owner@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	impersonation, _ := started["token"].(string)
+	status, _ = doJSON(t, http.MethodDelete, ts.URL+"/manage/owners?id="+owner.ID, admin, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/me", impersonation, nil)
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	login(middleware.Owner, "owner@example.com", "ownerPass", http.StatusUnauthorized)
+	if got := listedOwners(admin, ""); got != 0 {
+		t.Fatalf("got %d owners want the deleted one hidden", got)
+	}
+	if got := listedOwners(admin, models.StatusDeleted); got != 1 {
+		t.Fatalf("got %d deleted owners want 1", got)
+	}
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/owners/"+owner.ID+"/suspend", admin, nil)
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	// the email of a deleted account can be taken, it then stays deleted
+	taker, err := db.CreateOwner(testhelpers.Context(), adminID, &models.OwnerReg{Email: "owner@example.com", Name: "taker", Password: "takerPass", Verified: true})
+	if err != nil {
+		t.Fatalf("can not create owner: %v", err)
+	}
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/users/"+owner.ID+"/reactivate", super, nil)
+	testhelpers.AssertStatus(t, status, http.StatusConflict)
+	status, _ = doJSON(t, http.MethodDelete, ts.URL+"/manage/owners?id="+taker.ID, admin, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/users/"+owner.ID+"/reactivate", super, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	login(middleware.Owner, "owner@example.com", "ownerPass", http.StatusOK)
+
+	// suspended admins lose access to the management routes
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/admins/"+adminID+"/suspend", super, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/manage/owners", admin, nil)
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/admins/unknown/suspend", super, nil)
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+}
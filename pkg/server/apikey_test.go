@@ -0,0 +1,107 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/testhelpers"
+	"net/http"
+	"testing"
+)
+
+func TestAPIKeys(t *testing.T) {
+	ts := testhelpers.NewServer(t, nil, nil,
+		models.UserReg{Role: middleware.Admin, Email: "admin@example.com", Name: "admin", Password: "adminPass", Verified: true},
+	)
+	token := ts.Login(middleware.Admin, "admin@example.com", "adminPass")
+	status, _ := doJSON(t, http.MethodPost, ts.URL+"/manage/restaurants", token, models.Restaurant{Name: "diner", Lat: 1, Lng: 1})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+
+	for _, permissions := range [][]string{{"admin:read"}, {"menu:cook"}} {
+		status, _ = doJSON(t, http.MethodPost, ts.URL+"/apikeys", token, map[string]interface{}{"name": "pos", "permissions": permissions})
+		testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	}
+	status, created := doJSON(t, http.MethodPost, ts.URL+"/apikeys", token, map[string]interface{}{"name": "pos", "permissions": []string{"menu:read"}})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	key, _ := created["key"].(string)
+	keyID, _ := created["apiKey"].(map[string]interface{})["id"].(string)
+
+	menuURL := ts.URL + "/manage/restaurants/1/menu"
+	status, _ = doWithHeader(t, http.MethodGet, menuURL, middleware.APIKeyHeader, key, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doWithHeader(t, http.MethodGet, menuURL, "Authorization", "Bearer "+key, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doWithHeader(t, http.MethodPost, menuURL, middleware.APIKeyHeader, key, []models.Dish{{Name: "soup", Price: 5}})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	status, _ = doWithHeader(t, http.MethodGet, menuURL, middleware.APIKeyHeader, "rk_unknown", nil)
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	status, _ = doWithHeader(t, http.MethodGet, menuURL, "Authorization", "Bearer "+token, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+
+	_, created = doJSON(t, http.MethodPost, ts.URL+"/apikeys", token, map[string]interface{}{"name": "keys", "permissions": []string{"apikey:manage"}})
+	managerKey, _ := created["key"].(string)
+	status, _ = doWithHeader(t, http.MethodGet, ts.URL+"/apikeys", middleware.APIKeyHeader, managerKey, nil)
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+
+	status, list := doJSON(t, http.MethodGet, ts.URL+"/apikeys", token, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	keys, _ := list["apiKeys"].([]interface{})
+	if len(keys) != 2 {
+		t.Fatalf("got api keys %v want 2", list)
+	}
+	first, _ := keys[0].(map[string]interface{})
+	if first["id"] != keyID || first["lastUsedAt"] == nil || first["hash"] != nil {
+		t.Fatalf("got api key %v want %s used and without its hash", first, keyID)
+	}
+
+	status, _ = doJSON(t, http.MethodDelete, ts.URL+"/apikeys/"+keyID, token, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doJSON(t, http.MethodDelete, ts.URL+"/apikeys/"+keyID, token, nil)
+	testhelpers.AssertStatus(t, status, http.StatusNotFound)
+	status, _ = doWithHeader(t, http.MethodGet, menuURL, middleware.APIKeyHeader, key, nil)
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+}
+
+func TestAPIKeyManagedRoles(t *testing.T) {
+	ts := testhelpers.NewServer(t, nil, nil,
+		models.UserReg{Role: middleware.SuperAdmin, Email: "super@example.com", Name: "super", Password: "superPass", Verified: true},
+		models.UserReg{Role: middleware.Admin, Email: "admin@example.com", Name: "admin", Password: "adminPass", Verified: true},
+	)
+	token := ts.Login(middleware.SuperAdmin, "super@example.com", "superPass")
+	status, created := doJSON(t, http.MethodPost, ts.URL+"/apikeys", token, map[string]interface{}{"name": "support", "permissions": []string{"owner:update"}})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	key, _ := created["key"].(string)
+
+	// keys without admin:update only act on owners even when the role of their user may act on admins
+	admin := map[string]string{"role": middleware.Admin, "email": "admin@example.com"}
+	for _, url := range []string{ts.URL + "/manage/unlock", ts.URL + "/manage/verification", ts.URL + "/manage/logout"} {
+		status, _ = doWithHeader(t, http.MethodPost, url, middleware.APIKeyHeader, key, admin)
+		testhelpers.AssertStatus(t, status, http.StatusForbidden)
+	}
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/unlock", token, admin)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+}
+
+// doWithHeader is doJSON authenticating with value in header instead of the token header
+func doWithHeader(t *testing.T, method, url, header, value string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("can not marshal request: %v", err)
+	}
+	request, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("can not create request: %v", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(header, value)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("can not send %s %s: %v", method, url, err)
+	}
+	defer response.Body.Close()
+	result := make(map[string]interface{})
+	json.NewDecoder(response.Body).Decode(&result)
+	return response.StatusCode, result
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+)
+
+// bootstrapSuperAdmin creates the configured super admin when the database has none, the other
+// users are then invited by it since registration is closed once a super admin exists. The password
+// has to meet the policy like the ones users choose
+func bootstrapSuperAdmin(db database.Database, boot *config.Bootstrap, passwords *encryption.PasswordPolicy) error {
+	if boot.Email == "" {
+		return nil
+	}
+	ctx := context.WithValue(context.Background(), "reqId", "bootstrap")
+	ctx = context.WithValue(ctx, "reqUrl", "bootstrap")
+	return db.WithTx(ctx, func(tx database.Database) error {
+		err := tx.LockUsers(ctx, middleware.SuperAdmin)
+		if err != nil {
+			return err
+		}
+		count, err := tx.CountUsers(ctx, middleware.SuperAdmin)
+		if err != nil || count > 0 {
+			return err
+		}
+		err = passwords.Check(boot.Password)
+		if err != nil {
+			return fmt.Errorf("bootstrap super admin: %v", err)
+		}
+		_, err = tx.CreateUser(ctx, &models.UserReg{Role: middleware.SuperAdmin, Email: boot.Email, Name: boot.Name, Password: boot.Password, Verified: true})
+		if err != nil {
+			return err
+		}
+		logger.LogInfo("bootstrap", "bootstrap", "created the bootstrap super admin "+boot.Email, 0)
+		return nil
+	})
+}
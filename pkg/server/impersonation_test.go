@@ -0,0 +1,90 @@
+package server_test
+
+import (
+	"fmt"
+	"github.com/vds/go-resman/pkg/database/memory"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/testhelpers"
+	"net/http"
+	"testing"
+)
+
+func TestImpersonation(t *testing.T) {
+	db := memory.NewMemoryDB()
+	ts := testhelpers.NewServer(t, db, nil,
+		models.UserReg{Role: middleware.SuperAdmin, Email: "super@example.com", Name: "super", Password: "superPass", Verified: true},
+		models.UserReg{Role: middleware.Admin, Email: "admin@example.com", Name: "admin", Password: "adminPass", Verified: true},
+	)
+	superID, adminID := ts.UserIDs[0], ts.UserIDs[1]
+	owner, err := db.CreateOwner(testhelpers.Context(), adminID, &models.OwnerReg{Email: "owner@example.com", Name: "owner", Password: "ownerPass", Verified: true})
+	if err != nil {
+		t.Fatalf("can not create owner: %v", err)
+	}
+	superToken := ts.Login(middleware.SuperAdmin, "super@example.com", "superPass")
+	for _, name := range []string{"diner", "cafe"} {
+		status, _ := doJSON(t, http.MethodPost, ts.URL+"/manage/restaurants", superToken, models.Restaurant{Name: name, Lat: 1, Lng: 1})
+		testhelpers.AssertStatus(t, status, http.StatusOK)
+	}
+	status, _ := doJSON(t, http.MethodPost, ts.URL+"/manage/owners/"+owner.ID+"/restaurants", superToken, map[string][]int{"assign": {1}})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+
+	adminToken := ts.Login(middleware.Admin, "admin@example.com", "adminPass")
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/impersonate", adminToken, map[string]string{"role": middleware.Owner, "email": "owner@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/impersonate", superToken, map[string]string{"role": middleware.SuperAdmin, "email": "super@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/impersonate", superToken, map[string]string{"role": middleware.Owner, "email": "nobody@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusNotFound)
+	status, started := doJSON(t, http.MethodPost, ts.URL+"/manage/impersonate", superToken, map[string]string{"role": middleware.Owner, "email": "owner@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	token, _ := started["token"].(string)
+	if _, ok := started["refreshToken"]; ok {
+		t.Fatalf("got a refresh token with the impersonation token")
+	}
+
+	// the super admin sees the restaurants of the owner
+	request, err := http.NewRequest(http.MethodGet, ts.URL+"/manage/restaurants", nil)
+	if err != nil {
+		t.Fatalf("can not create request: %v", err)
+	}
+	request.Header.Set("token", token)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("can not list restaurants: %v", err)
+	}
+	response.Body.Close()
+	testhelpers.AssertStatus(t, response.StatusCode, http.StatusOK)
+	if got, want := response.Header.Get(middleware.ImpersonatedByHeader), fmt.Sprintf("%s %s", middleware.SuperAdmin, superID); got != want {
+		t.Fatalf("got %s header %q want %q", middleware.ImpersonatedByHeader, got, want)
+	}
+	status, listed := doJSON(t, http.MethodGet, ts.URL+"/manage/restaurants", token, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	data, _ := listed["data"].([]interface{})
+	if len(data) != 1 {
+		t.Fatalf("got restaurants %v want the one of the owner", listed)
+	}
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/restaurants/1/menu", token, models.Dish{Name: "soup", Price: 5})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+
+	// credentials of the owner stay out of reach and impersonation does not nest
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/apikeys", token, map[string]interface{}{"name": "pos", "permissions": []string{"menu:read"}})
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/impersonate", token, map[string]string{"role": middleware.Admin, "email": "admin@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+
+	cfg := testhelpers.Config("memory://")
+	cfg.Auth.ImpersonationReadOnly = true
+	readOnly := testhelpers.NewServer(t, db, cfg)
+	status, _ = doJSON(t, http.MethodGet, readOnly.URL+"/manage/restaurants/1/menu", token, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doJSON(t, http.MethodDelete, readOnly.URL+"/manage/restaurants/1/menu?id=1", token, nil)
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+	status, _ = doJSON(t, http.MethodGet, readOnly.URL+"/sessions", superToken, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/logout", token, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/manage/restaurants", token, nil)
+	testhelpers.AssertStatus(t, status, middleware.StatusTokenInvalid)
+}
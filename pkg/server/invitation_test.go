@@ -0,0 +1,94 @@
+package server_test
+
+import (
+	"github.com/vds/go-resman/pkg/database/memory"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/testhelpers"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestInvitations(t *testing.T) {
+	db := memory.NewMemoryDB()
+	cfg := testhelpers.Config("memory://")
+	cfg.Bootstrap.Email = "super@example.com"
+	cfg.Bootstrap.Name = "super"
+	cfg.Bootstrap.Password = "superPass"
+	ts := testhelpers.NewServer(t, db, cfg)
+	// starting again keeps the bootstrapped super admin
+	cfg.Bootstrap.Email = "other@example.com"
+	testhelpers.NewServer(t, db, cfg)
+	count, err := db.CountUsers(testhelpers.Context(), middleware.SuperAdmin)
+	if err != nil || count != 1 {
+		t.Fatalf("got %d super admins want 1: %v", count, err)
+	}
+
+	status := postJSON(t, ts.URL+"/register", map[string]string{"role": middleware.SuperAdmin, "email": "late@example.com", "name": "late", "password": "latePass"})
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+	superToken := ts.Login(middleware.SuperAdmin, "super@example.com", "superPass")
+
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/invitations", superToken, map[string]string{"role": middleware.SuperAdmin, "email": "next@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	status, invited := doJSON(t, http.MethodPost, ts.URL+"/manage/invitations", superToken, map[string]string{"role": middleware.Admin, "email": "admin@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	invitation, _ := invited["invitation"].(string)
+
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/manage/owners", invitation, nil)
+	testhelpers.AssertStatus(t, status, middleware.StatusTokenInvalid)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/invitations/accept", "", map[string]string{"token": invitation + "x", "name": "admin", "password": "adminPass"})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/invitations/accept", "", map[string]string{"token": invitation, "name": "admin", "password": "adminPass"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/invitations/accept", "", map[string]string{"token": invitation, "name": "again", "password": "againPass"})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/invitations", superToken, map[string]string{"role": middleware.Admin, "email": "admin@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusConflict)
+
+	adminToken := ts.Login(middleware.Admin, "admin@example.com", "adminPass")
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/invitations", adminToken, map[string]string{"role": middleware.Admin, "email": "peer@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+	status, invited = doJSON(t, http.MethodPost, ts.URL+"/manage/invitations", adminToken, map[string]string{"role": middleware.Owner, "email": "owner@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	invitation, _ = invited["invitation"].(string)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/invitations/accept", "", map[string]string{"token": invitation, "name": "owner", "password": "ownerPass"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	ts.Login(middleware.Owner, "owner@example.com", "ownerPass")
+
+	// the owner is managed by the admin who invited it
+	status, owners := doJSON(t, http.MethodGet, ts.URL+"/manage/owners", adminToken, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	data, _ := owners["data"].([]interface{})
+	if len(data) != 1 {
+		t.Fatalf("got owners %v want the invited one", owners)
+	}
+
+	// invitations are only accepted while their inviter is active
+	status, invited = doJSON(t, http.MethodPost, ts.URL+"/manage/invitations", adminToken, map[string]string{"role": middleware.Owner, "email": "later@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	later, _ := invited["invitation"].(string)
+	adminID, err := db.FindUserID(testhelpers.Context(), middleware.Admin, "admin@example.com")
+	if err != nil {
+		t.Fatalf("can not find admin: %v", err)
+	}
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/admins/"+adminID+"/suspend", superToken, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/invitations/accept", "", map[string]string{"token": later, "name": "later", "password": "laterPass"})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/users/"+adminID+"/reactivate", superToken, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/invitations/accept", "", map[string]string{"token": later, "name": "later", "password": "laterPass"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+
+	// purging an account frees its email but not the invitation it was created with
+	adminToken = ts.Login(middleware.Admin, "admin@example.com", "adminPass")
+	owner, _ := data[0].(map[string]interface{})
+	status, _ = doJSON(t, http.MethodDelete, ts.URL+"/manage/owners?id="+owner["id"].(string), adminToken, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	purged, err := db.PurgeDeletedUsers(testhelpers.Context(), time.Now())
+	if err != nil || purged != 1 {
+		t.Fatalf("got %d purged users want 1: %v", purged, err)
+	}
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/invitations/accept", "", map[string]string{"token": invitation, "name": "owner", "password": "ownerPass"})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+}
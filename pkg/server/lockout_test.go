@@ -0,0 +1,77 @@
+package server_test
+
+import (
+	"context"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/database/memory"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/testhelpers"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginLockout(t *testing.T) {
+	cfg := testhelpers.Config("memory://")
+	cfg.Lockout.AccountThreshold = 3
+	cfg.Lockout.IPThreshold = 0
+	cfg.Lockout.BaseDuration = config.Duration{Duration: time.Minute}
+	ts := testhelpers.NewServer(t, nil, cfg,
+		models.UserReg{Role: middleware.Admin, Email: "admin@example.com", Name: "admin", Password: "adminPass", Verified: true},
+		models.UserReg{Role: middleware.SuperAdmin, Email: "super@example.com", Name: "super", Password: "superPass", Verified: true},
+	)
+	admin := map[string]string{"role": middleware.Admin, "email": "admin@example.com", "password": "adminPass"}
+	wrong := map[string]string{"role": middleware.Admin, "email": "ADMIN@example.com", "password": "wrong"}
+
+	for i := 0; i < 3; i++ {
+		status, _ := doJSON(t, http.MethodPost, ts.URL+"/login", "", wrong)
+		testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	}
+	response := postLogin(t, ts.URL+"/login", admin)
+	testhelpers.AssertStatus(t, response.StatusCode, http.StatusTooManyRequests)
+	if response.Header.Get("Retry-After") == "" {
+		t.Fatalf("locked login should tell when to retry")
+	}
+
+	superToken := ts.Login(middleware.SuperAdmin, "super@example.com", "superPass")
+	status, _ := doJSON(t, http.MethodPost, ts.URL+"/manage/unlock", superToken, map[string]string{"role": middleware.Admin, "email": "nobody@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusNotFound)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/unlock", superToken, map[string]string{"role": middleware.Admin, "email": "admin@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	adminToken := ts.Login(middleware.Admin, "admin@example.com", "adminPass")
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/unlock", adminToken, map[string]string{"ip": "127.0.0.1"})
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+}
+
+// unclearableDB is a memory database failing to forget failed logins
+type unclearableDB struct {
+	*memory.MemoryDB
+}
+
+func (db unclearableDB) ClearLoginFailures(ctx context.Context, keys ...string) error {
+	return database.ErrInternal
+}
+
+func TestLoginWithoutClearedFailures(t *testing.T) {
+	ts := testhelpers.NewServer(t, unclearableDB{memory.NewMemoryDB()}, nil,
+		models.UserReg{Role: middleware.Admin, Email: "admin@example.com", Name: "admin", Password: "adminPass", Verified: true},
+	)
+
+	// a right password logs in even when the earlier failures can not be cleared
+	ts.Login(middleware.Admin, "admin@example.com", "adminPass")
+}
+
+// postLogin sends a login request and returns the raw response to check its headers
+func postLogin(t *testing.T, url string, cred map[string]string) *http.Response {
+	t.Helper()
+	body := `{"role":"` + cred["role"] + `","email":"` + cred["email"] + `","password":"` + cred["password"] + `"}`
+	response, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("can not send login: %v", err)
+	}
+	response.Body.Close()
+	return response
+}
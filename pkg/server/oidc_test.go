@@ -0,0 +1,69 @@
+package server_test
+
+import (
+	"encoding/json"
+	"github.com/vds/go-resman/pkg/database/memory"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/oidc"
+	"github.com/vds/go-resman/pkg/oidc/oidctest"
+	"github.com/vds/go-resman/pkg/server"
+	"github.com/vds/go-resman/pkg/testhelpers"
+	"net/http"
+	"net/http/cookiejar"
+	"testing"
+)
+
+func TestOIDCLogin(t *testing.T) {
+	idp := oidctest.NewIdP("resman", "s3cret")
+	defer idp.Close()
+	cfg := testhelpers.Config("memory://")
+	cfg.OIDC.Issuer = idp.Issuer()
+	cfg.OIDC.ClientID = "resman"
+	cfg.OIDC.ClientSecret = "s3cret"
+	db := memory.NewMemoryDB()
+	ts := testhelpers.NewServer(t, db, cfg,
+		models.UserReg{Role: middleware.Admin, Email: "admin@example.com", Name: "admin", Password: "adminPass", Verified: true},
+	)
+	cfg.OIDC.RedirectURL = ts.URL + "/login/oidc/callback"
+
+	// login follows the redirects through the provider like a browser and returns the response of the callback
+	login := func() (int, map[string]interface{}) {
+		jar, _ := cookiejar.New(nil)
+		response, err := (&http.Client{Jar: jar}).Get(ts.URL + "/login/oidc")
+		if err != nil {
+			t.Fatalf("can not log in: %v", err)
+		}
+		defer response.Body.Close()
+		result := make(map[string]interface{})
+		json.NewDecoder(response.Body).Decode(&result)
+		return response.StatusCode, result
+	}
+
+	idp.SetUser(oidc.Identity{Subject: "1", Email: "admin@example.com", EmailVerified: true})
+	status, result := login()
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	token, _ := result["token"].(string)
+	if result["role"] != middleware.Admin || result["refreshToken"] == nil {
+		t.Fatalf("got %v want the tokens of the admin", result)
+	}
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/manage/owners", token, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+
+	idp.SetUser(oidc.Identity{Subject: "2", Email: "stranger@example.com", EmailVerified: true})
+	status, _ = login()
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+	idp.SetUser(oidc.Identity{Subject: "1", Email: "admin@example.com"})
+	status, _ = login()
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+
+	// a callback the server did not start is refused
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/login/oidc/callback?code=stolen&state=guessed", "", nil)
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+
+	cfg.OIDC.Role = middleware.Owner
+	_, err := server.NewRouter(db, cfg)
+	if err == nil {
+		t.Fatalf("identities should only log in as admins")
+	}
+}
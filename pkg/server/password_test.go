@@ -0,0 +1,128 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database/memory"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/server"
+	"github.com/vds/go-resman/pkg/testhelpers"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func postJSON(t *testing.T, url string, body interface{}) int {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("can not marshal request: %v", err)
+	}
+	response, err := http.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("can not post %s: %v", url, err)
+	}
+	response.Body.Close()
+	return response.StatusCode
+}
+
+func TestPasswordReset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resman-mail")
+	if err != nil {
+		t.Fatalf("can not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := testhelpers.Config("memory://")
+	cfg.Mail.Driver = "file"
+	cfg.Mail.Dir = dir
+	cfg.Auth.PasswordResetURL = "https://resman.example.com/reset?lang=en"
+	ts := testhelpers.NewServer(t, nil, cfg,
+		models.UserReg{Role: middleware.Admin, Email: "admin@example.com", Name: "admin", Password: "oldPass", Verified: true},
+	)
+
+	status := postJSON(t, ts.URL+"/password/forgot", map[string]string{"role": middleware.Admin, "email": "unknown@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Fatalf("no email should be sent for an unknown user, got %d", len(files))
+	}
+
+	status = postJSON(t, ts.URL+"/password/forgot", map[string]string{"role": middleware.Admin, "email": "admin@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	files, _ = ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("got %d emails want 1", len(files))
+	}
+	email, err := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatalf("can not read email: %v", err)
+	}
+	match := regexp.MustCompile(`https://resman\.example\.com/reset\?\S+`).Find(email)
+	if match == nil {
+		t.Fatalf("email does not contain the reset link: %s", email)
+	}
+	link, err := url.Parse(string(match))
+	if err != nil || link.Query().Get("lang") != "en" || link.Query().Get("token") == "" {
+		t.Fatalf("got reset link %s: %v", match, err)
+	}
+	token := link.Query().Get("token")
+
+	status = postJSON(t, ts.URL+"/password/reset", map[string]string{"token": "invalid", "password": "newPass"})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	// a password refused by the policy leaves the token usable
+	status = postJSON(t, ts.URL+"/password/reset", map[string]string{"token": token, "password": "newPass"})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	status = postJSON(t, ts.URL+"/password/reset", map[string]string{"token": token, "password": "newPassword"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status = postJSON(t, ts.URL+"/password/reset", map[string]string{"token": token, "password": "againPassword"})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+
+	status = postJSON(t, ts.URL+"/login", map[string]string{"role": middleware.Admin, "email": "admin@example.com", "password": "oldPass"})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	status = postJSON(t, ts.URL+"/login", map[string]string{"role": middleware.Admin, "email": "admin@example.com", "password": "newPassword"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resman-breached")
+	if err != nil {
+		t.Fatalf("can not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	list := filepath.Join(dir, "breached.txt")
+	err = ioutil.WriteFile(list, []byte("breachedPass1\n"), 0600)
+	if err != nil {
+		t.Fatalf("can not write breached list: %v", err)
+	}
+	db := memory.NewMemoryDB()
+	cfg := testhelpers.Config("memory://")
+	cfg.Password.BreachedList = list
+	cfg.Bootstrap = config.Bootstrap{Email: "super@example.com", Name: "super", Password: "breachedPass1"}
+	svr, err := server.NewServer(db, cfg)
+	if err != nil {
+		t.Fatalf("can not create new server instance: %v", err)
+	}
+	_, err = svr.Start()
+	if err == nil {
+		t.Fatalf("server started with a breached bootstrap password")
+	}
+	cfg.Bootstrap.Password = "superPassword"
+	ts := testhelpers.NewServer(t, db, cfg)
+
+	token := ts.Login(middleware.SuperAdmin, "super@example.com", "superPassword")
+	status, invited := doJSON(t, http.MethodPost, ts.URL+"/manage/invitations", token, map[string]string{"role": middleware.Owner, "email": "owner@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	invitation, _ := invited["invitation"].(string)
+	for _, password := range []string{"short", "breachedPass1"} {
+		status = postJSON(t, ts.URL+"/invitations/accept", map[string]string{"token": invitation, "name": "owner", "password": password})
+		testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	}
+	status = postJSON(t, ts.URL+"/invitations/accept", map[string]string{"token": invitation, "name": "owner", "password": "ownerPassword"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+}
@@ -0,0 +1,117 @@
+package server_test
+
+import (
+	"github.com/vds/go-resman/pkg/database/memory"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/testhelpers"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resman-mail")
+	if err != nil {
+		t.Fatalf("can not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := testhelpers.Config("memory://")
+	cfg.Mail.Driver = "file"
+	cfg.Mail.Dir = dir
+	cfg.Auth.EmailVerificationURL = "https://resman.example.com/verify"
+	db := memory.NewMemoryDB()
+	ts := testhelpers.NewServer(t, db, cfg,
+		models.UserReg{Role: middleware.SuperAdmin, Email: "super@example.com", Name: "super", Password: "superPass", Verified: true},
+		models.UserReg{Role: middleware.Admin, Email: "admin@example.com", Name: "admin", Password: "adminPass", Verified: true},
+	)
+	for _, email := range []string{"owner@example.com", "other@example.com"} {
+		_, err := db.CreateOwner(testhelpers.Context(), ts.UserIDs[1], &models.OwnerReg{Email: email, Name: "owner", Password: "ownerPass", Verified: true})
+		if err != nil {
+			t.Fatalf("can not create owner: %v", err)
+		}
+	}
+	// login also returns the refresh token of the session
+	login := func(role, email, password string) (string, string) {
+		t.Helper()
+		status, login := doJSON(t, http.MethodPost, ts.URL+"/login", "", map[string]string{"role": role, "email": email, "password": password})
+		testhelpers.AssertStatus(t, status, http.StatusOK)
+		token, _ := login["token"].(string)
+		refresh, _ := login["refreshToken"].(string)
+		return token, refresh
+	}
+
+	// owners edit their own profile
+	owner, _ := login(middleware.Owner, "owner@example.com", "ownerPass")
+	status, profile := doJSON(t, http.MethodGet, ts.URL+"/me", owner, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if profile["email"] != "owner@example.com" || profile["role"] != middleware.Owner {
+		t.Fatalf("got profile %v", profile)
+	}
+	status, _ = doJSON(t, http.MethodPut, ts.URL+"/me", owner, map[string]string{"email": "not an email", "name": "owner"})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	status, _ = doJSON(t, http.MethodPut, ts.URL+"/me", owner, map[string]string{"email": "other@example.com", "name": "owner"})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	status, _ = doJSON(t, http.MethodPut, ts.URL+"/me", owner, map[string]string{"email": "owner@example.com", "name": "renamed"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	login(middleware.Owner, "owner@example.com", "ownerPass")
+	status, profile = doJSON(t, http.MethodPut, ts.URL+"/me", owner, map[string]string{"email": "new@example.com", "name": "new"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if profile["email"] != "new@example.com" || profile["name"] != "new" {
+		t.Fatalf("got profile %v", profile)
+	}
+	// the new email has to be verified before logging in again, keeping the email sends no verification
+	verification := lastVerificationToken(t, dir, 1)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/login", "", map[string]string{"role": middleware.Owner, "email": "new@example.com", "password": "ownerPass"})
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+	status = postJSON(t, ts.URL+"/email/verify", map[string]string{"token": verification})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	login(middleware.Owner, "new@example.com", "ownerPass")
+
+	// changing the password ends the other sessions
+	admin, _ := login(middleware.Admin, "admin@example.com", "adminPass")
+	laptop, laptopRefresh := login(middleware.Admin, "admin@example.com", "adminPass")
+	status, _ = doJSON(t, http.MethodPut, ts.URL+"/me/password", admin, map[string]string{"currentPassword": "wrongPass", "password": "newAdminPass"})
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+	status, _ = doJSON(t, http.MethodPut, ts.URL+"/me/password", admin, map[string]string{"currentPassword": "adminPass", "password": "short"})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	status, _ = doJSON(t, http.MethodPut, ts.URL+"/me/password", admin, map[string]string{"currentPassword": "adminPass", "password": "adminPass"})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	status, changed := doJSON(t, http.MethodPut, ts.URL+"/me/password", admin, map[string]string{"currentPassword": "adminPass", "password": "newAdminPass"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if changed["revoked"] != float64(1) {
+		t.Fatalf("got %v want one revoked session", changed)
+	}
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/me", admin, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/me", laptop, nil)
+	testhelpers.AssertStatus(t, status, middleware.StatusTokenInvalid)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/token/refresh", "", map[string]string{"refreshToken": laptopRefresh})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/login", "", map[string]string{"role": middleware.Admin, "email": "admin@example.com", "password": "adminPass"})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	login(middleware.Admin, "admin@example.com", "newAdminPass")
+
+	// api keys and impersonation tokens only read the profile
+	status, created := doJSON(t, http.MethodPost, ts.URL+"/apikeys", admin, map[string]interface{}{"name": "pos", "permissions": []string{"menu:read"}})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	key, _ := created["key"].(string)
+	status, _ = doWithHeader(t, http.MethodGet, ts.URL+"/me", middleware.APIKeyHeader, key, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doWithHeader(t, http.MethodPut, ts.URL+"/me/password", middleware.APIKeyHeader, key, map[string]string{"currentPassword": "newAdminPass", "password": "otherAdminPass"})
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+	super, _ := login(middleware.SuperAdmin, "super@example.com", "superPass")
+	status, started := doJSON(t, http.MethodPost, ts.URL+"/manage/impersonate", super, map[string]string{"role": middleware.Owner, "email": "new@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	impersonation, _ := started["token"].(string)
+	status, profile = doJSON(t, http.MethodGet, ts.URL+"/me", impersonation, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if profile["email"] != "new@example.com" {
+		t.Fatalf("got profile %v", profile)
+	}
+	status, _ = doJSON(t, http.MethodPut, ts.URL+"/me", impersonation, map[string]string{"email": "taken@example.com", "name": "new"})
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+	status, _ = doJSON(t, http.MethodPut, ts.URL+"/me/password", impersonation, map[string]string{"currentPassword": "ownerPass", "password": "takenPassword"})
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+}
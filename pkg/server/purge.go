@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/logger"
+	"time"
+)
+
+// purgeExpired deletes expired token revocations and refresh tokens every interval until ctx is done,
+// accounts deleted more than retention ago are purged along with them unless retention is zero
+func purgeExpired(ctx context.Context, db database.Database, interval time.Duration, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purgeCtx := context.WithValue(ctx, "reqId", "purge")
+			purgeCtx = context.WithValue(purgeCtx, "reqUrl", "purge")
+			purged, err := db.PurgeExpiredTokens(purgeCtx, now)
+			if err != nil {
+				logger.LogError("purge", "purge", fmt.Sprintf("can not purge expired tokens: %v", err), 0)
+			} else {
+				logger.LogDebug("purge", "purge", fmt.Sprintf("purged %d expired tokens", purged))
+			}
+			if retention == 0 {
+				continue
+			}
+			purged, err = db.PurgeDeletedUsers(purgeCtx, now.Add(-retention))
+			if err != nil {
+				logger.LogError("purge", "purge", fmt.Sprintf("can not purge deleted accounts: %v", err), 0)
+				continue
+			}
+			logger.LogDebug("purge", "purge", fmt.Sprintf("purged %d deleted accounts", purged))
+		}
+	}
+}
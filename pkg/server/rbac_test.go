@@ -0,0 +1,47 @@
+package server_test
+
+import (
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/rbac"
+	"github.com/vds/go-resman/pkg/testhelpers"
+	"net/http"
+	"testing"
+)
+
+func TestCustomRole(t *testing.T) {
+	cfg := testhelpers.Config("memory://")
+	cfg.RBAC.Roles = map[string]config.Role{
+		"auditor": {Scope: models.ScopeAll, Permissions: []string{rbac.OwnerRead, rbac.RestaurantRead, "menu:read"}},
+	}
+	ts := testhelpers.NewServer(t, nil, cfg,
+		models.UserReg{Role: "auditor", Email: "auditor@example.com", Name: "auditor", Password: "auditorPass", Verified: true},
+		models.UserReg{Role: middleware.SuperAdmin, Email: "super@example.com", Name: "super", Password: "superPass", Verified: true},
+	)
+
+	superToken := ts.Login(middleware.SuperAdmin, "super@example.com", "superPass")
+	status, _ := doJSON(t, http.MethodPost, ts.URL+"/manage/restaurants", superToken, models.Restaurant{Name: "diner", Lat: 1, Lng: 1})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+
+	token := ts.Login("auditor", "auditor@example.com", "auditorPass")
+	status, page := doJSON(t, http.MethodGet, ts.URL+"/manage/restaurants", token, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if page["total"] != float64(1) {
+		t.Fatalf("auditor of scope all should see every restaurant, got %v", page)
+	}
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/manage/restaurants/1/menu", token, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/restaurants", token, models.Restaurant{Name: "cafe", Lat: 1, Lng: 1})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/manage/admins", token, nil)
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/2fa/enrol", token, nil)
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+
+	status, page = doJSON(t, http.MethodGet, ts.URL+"/manage/admins", superToken, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if page["total"] != float64(1) {
+		t.Fatalf("users of custom roles should be managed as admins, got %v", page)
+	}
+}
@@ -1,22 +1,69 @@
 package server
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/vds/go-resman/pkg/config"
 	"github.com/vds/go-resman/pkg/controller"
 	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/mail"
 	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/oidc"
 	"github.com/vds/go-resman/pkg/prometheus"
+	"github.com/vds/go-resman/pkg/rbac"
+	"net/http"
+	"time"
 )
 
+// oidcTimeout limits each request to the identity provider
+const oidcTimeout = 10 * time.Second
+
 type Router struct {
 	db      database.Database
+	cfg     *config.Config
+	keys    *encryption.KeySet
+	mailer  mail.Mailer
+	policy  *rbac.Policy
+	// passwords checks the passwords users choose
+	passwords *encryption.PasswordPolicy
+	// oidc is nil unless admins log in with an identity provider
+	oidc    *oidc.Provider
+	health  *controller.HealthController
 	pathMap map[string]string
 	Engine *gin.Engine
 }
 
-func NewRouter(db database.Database) (*Router, error) {
+func NewRouter(db database.Database, cfg *config.Config) (*Router, error) {
 	router := new(Router)
 	router.db = db
+	router.cfg = cfg
+	keys, err := encryption.NewKeySet(&cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+	router.keys = keys
+	mailer, err := mail.New(&cfg.Mail)
+	if err != nil {
+		return nil, err
+	}
+	router.mailer = mailer
+	policy, err := rbac.NewPolicy(&cfg.RBAC)
+	if err != nil {
+		return nil, err
+	}
+	router.policy = policy
+	passwords, err := encryption.NewPasswordPolicy(&cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+	router.passwords = passwords
+	if cfg.OIDC.Issuer != "" {
+		if !policy.IsRole(cfg.OIDC.Role) || !database.IsAdminRole(cfg.OIDC.Role) {
+			return nil, fmt.Errorf("%v: %s is not an admin role", config.ErrInvalidOIDC, cfg.OIDC.Role)
+		}
+		router.oidc = oidc.NewProvider(&cfg.OIDC, &http.Client{Timeout: oidcTimeout})
+	}
 	router.pathMap = make(map[string]string)
 	return router, nil
 }
@@ -24,64 +71,125 @@ func (r *Router) Create() *Router {
 	ginRouter := gin.New()
 
 	//Controllers
-	regController := controller.NewRegisterController(r.db)
-	loginController := controller.NewLogInController(r.db)
+	regController := controller.NewRegisterController(r.db, r.mailer, &r.cfg.Auth, &r.cfg.Bootstrap, r.policy, r.passwords)
+	loginController := controller.NewLogInController(r.db, r.keys, &r.cfg.Lockout, r.policy)
+	tokenController := controller.NewTokenController(r.db, r.keys)
+	passwordController := controller.NewPasswordController(r.db, r.mailer, &r.cfg.Auth, r.policy, r.passwords)
+	verificationController := controller.NewVerificationController(r.db, r.mailer, &r.cfg.Auth, r.policy)
+	twoFactorController := controller.NewTwoFactorController(r.db, r.keys, &r.cfg.Lockout, r.policy)
+	apiKeyController := controller.NewAPIKeyController(r.db, r.policy)
+	sessionController := controller.NewSessionController(r.db, r.policy)
+	profileController := controller.NewProfileController(r.db, r.mailer, &r.cfg.Auth, &r.cfg.Lockout, r.passwords)
+	impersonationController := controller.NewImpersonationController(r.db, r.keys, &r.cfg.Auth, r.policy)
+	invitationController := controller.NewInvitationController(r.db, r.mailer, r.keys, &r.cfg.Auth, r.policy, r.passwords)
 	resController := controller.NewRestaurantController(r.db)
 	menuController := controller.NewMenuController(r.db)
 	adminController := controller.NewAdminController(r.db)
 	helloworldController := controller.NewHelloWorldController(r.db)
-	ownerController := controller.NewOwnerController(r.db)
+	ownerController := controller.NewOwnerController(r.db, r.mailer, &r.cfg.Auth, r.passwords)
+	r.health = controller.NewHealthController(r.db)
 
 	//Routes
 	//added for cors
-	ginRouter.Use(middleware.AllowOptions, middleware.SetResponseHeader)
+	ginRouter.Use(middleware.AllowOptions(&r.cfg.CORS), middleware.SetResponseHeader)
+	middleware.RegisterMetrics(&r.cfg.Metrics)
 	ginRouter.Use(middleware.InstrumentPrometheus(&r.pathMap),middleware.GenerateRequestId)
 
 	ginRouter.GET("/metrics", gin.WrapH(prometheus.NewHandler()))
+	ginRouter.GET("/healthz", r.health.Liveness)
+	ginRouter.GET("/readyz", r.health.Readiness)
 	ginRouter.POST("/register", regController.Register)
+	ginRouter.POST("/invitations/accept", invitationController.Accept)
 	ginRouter.POST("/login", loginController.LogIn)
+	ginRouter.POST("/login/2fa", twoFactorController.LogInCode)
+	ginRouter.POST("/login/2fa/enrol", twoFactorController.LogInEnrol)
+	if r.oidc != nil {
+		oidcController := controller.NewOIDCController(r.db, r.keys, r.oidc, &r.cfg.OIDC)
+		ginRouter.GET("/login/oidc", oidcController.Start)
+		ginRouter.GET("/login/oidc/callback", oidcController.Callback)
+	}
 	ginRouter.GET("/logout", loginController.LogOut)
+	ginRouter.POST("/token/refresh", tokenController.Refresh)
+	ginRouter.GET("/.well-known/jwks.json", tokenController.JWKS)
+	ginRouter.POST("/password/forgot", passwordController.Forgot)
+	ginRouter.POST("/password/reset", passwordController.Reset)
+	ginRouter.POST("/email/verify", verificationController.Verify)
 	ginRouter.GET("/", helloworldController.SayHello)
 
-	manage := ginRouter.Group("/manage")
-	manage.Use(middleware.TokenValidator(r.db), middleware.AuthMiddleware, middleware.AdminAccessOnly)
+	authMiddleware := middleware.AuthMiddleware(r.db, r.keys, r.policy)
+	impersonation := middleware.Impersonation(r.cfg.Auth.ImpersonationReadOnly)
+	// can returns the middleware refusing the users whose role lacks permission
+	can := func(permission string) gin.HandlerFunc {
+		return middleware.RequirePermission(r.policy, permission)
+	}
+	twoFactor := ginRouter.Group("/2fa")
+	twoFactor.Use(authMiddleware, middleware.TokenValidator(r.db), impersonation, middleware.RefuseImpersonation, can(rbac.TwoFactorEnrol))
 	{
-		manage.GET("/owners", ownerController.GetOwners)
-		manage.POST("/owners", ownerController.AddOwner)
-		manage.PUT("/owners/:ownerID", ownerController.EditOwner)
-		manage.DELETE("/owners", ownerController.DeleteOwners)
-		manage.GET("/owners/:ownerID/restaurants", resController.GetOwnerRestaurants)
-		manage.GET("/available/restaurants", resController.GetAvailableRestaurants)
-		manage.POST("/owners/:ownerID/restaurants", resController.AddOwnerForRestaurants)
-
-		manage.POST("/restaurants", resController.AddRestaurant)
-		manage.DELETE("/restaurants", resController.DeleteRestaurants)
-
+		twoFactor.POST("/enrol", twoFactorController.Enrol)
+		twoFactor.POST("/confirm", twoFactorController.Confirm)
+		twoFactor.POST("/recovery-codes", twoFactorController.RecoveryCodes)
+		twoFactor.DELETE("", twoFactorController.Disable)
 	}
-	manageRestaurant := ginRouter.Group("/manage")
-	manageRestaurant.Use(middleware.TokenValidator(r.db), middleware.AuthMiddleware)
+	apiKeys := ginRouter.Group("/apikeys")
+	apiKeys.Use(authMiddleware, middleware.TokenValidator(r.db), impersonation, middleware.RefuseImpersonation, can(rbac.APIKeyManage))
 	{
-		manageRestaurant.GET("/restaurants", resController.GetRestaurants)
-
+		apiKeys.POST("", apiKeyController.Create)
+		apiKeys.GET("", apiKeyController.List)
+		apiKeys.DELETE("/:keyID", apiKeyController.Revoke)
 	}
-	manageMenu := ginRouter.Group("/manage")
-	manageMenu.Use(middleware.TokenValidator(r.db), middleware.AuthMiddleware)
-	manageMenu.Use(middleware.ValidateRestaurantAndCreator(r.db))
+	sessions := ginRouter.Group("/sessions")
+	sessions.Use(authMiddleware, middleware.TokenValidator(r.db), impersonation)
+	{
+		sessions.GET("", sessionController.List)
+		sessions.DELETE("", sessionController.RevokeOthers)
+		sessions.DELETE("/:sessionID", sessionController.Revoke)
+	}
+	me := ginRouter.Group("/me")
+	me.Use(authMiddleware, middleware.TokenValidator(r.db), impersonation)
 	{
-		manageMenu.PUT("/restaurants/:resID", resController.EditRestaurant)
+		me.GET("", profileController.Get)
+		me.PUT("", middleware.RefuseImpersonation, profileController.Update)
+		me.PUT("/password", middleware.RefuseImpersonation, profileController.ChangePassword)
+	}
+	manage := ginRouter.Group("/manage")
+	manage.Use(authMiddleware, middleware.TokenValidator(r.db), impersonation)
+	{
+		manage.GET("/owners", can(rbac.OwnerRead), ownerController.GetOwners)
+		manage.POST("/owners", can(rbac.OwnerCreate), ownerController.AddOwner)
+		manage.PUT("/owners/:ownerID", can(rbac.OwnerUpdate), ownerController.EditOwner)
+		manage.DELETE("/owners", can(rbac.OwnerDelete), ownerController.DeleteOwners)
+		manage.POST("/owners/:ownerID/suspend", can(rbac.OwnerUpdate), ownerController.SuspendOwner)
+		manage.POST("/verification", can(rbac.OwnerUpdate), verificationController.Resend)
+		// the permission checked depends on the invited role
+		manage.POST("/invitations", invitationController.Invite)
+		manage.POST("/unlock", can(rbac.OwnerUpdate), loginController.Unlock)
+		manage.POST("/logout", can(rbac.OwnerUpdate), sessionController.ForceLogout)
+		manage.POST("/impersonate", can(rbac.UserImpersonate), impersonationController.Impersonate)
+		manage.GET("/owners/:ownerID/restaurants", can(rbac.OwnerRead), resController.GetOwnerRestaurants)
+		manage.GET("/available/restaurants", can(rbac.RestaurantAssign), resController.GetAvailableRestaurants)
+		manage.POST("/owners/:ownerID/restaurants", can(rbac.RestaurantAssign), resController.AddOwnerForRestaurants)
 
-		manageMenu.GET("/restaurants/:resID/menu", menuController.GetMenu)
-		manageMenu.POST("/restaurants/:resID/menu", menuController.AddDishes)
-		manageMenu.PUT("/restaurants/:resID/menu/:dishID", menuController.EditDish)
-		manageMenu.DELETE("/restaurants/:resID/menu", menuController.DeleteDishes)
+		manage.GET("/restaurants", can(rbac.RestaurantRead), resController.GetRestaurants)
+		manage.POST("/restaurants", can(rbac.RestaurantCreate), resController.AddRestaurant)
+		manage.DELETE("/restaurants", can(rbac.RestaurantDelete), resController.DeleteRestaurants)
+
+		manage.GET("/admins", can(rbac.AdminRead), adminController.GetAdmins)
+		manage.PUT("/admins/:adminID", can(rbac.AdminUpdate), adminController.EditAdmin)
+		manage.DELETE("/admins", can(rbac.AdminDelete), adminController.DeleteAdmins)
+		manage.POST("/admins/:adminID/suspend", can(rbac.AdminUpdate), adminController.SuspendAdmin)
+		manage.POST("/users/:userID/reactivate", can(rbac.UserReactivate), adminController.Reactivate)
+		manage.PUT("/2fa", can(rbac.TwoFactorPolicy), twoFactorController.SetPolicy)
 	}
-	superAdminOnly := ginRouter.Group("/manage")
-	superAdminOnly.Use(middleware.TokenValidator(r.db), middleware.AuthMiddleware, middleware.SuperAdminAccessOnly)
+	manageMenu := ginRouter.Group("/manage")
+	manageMenu.Use(authMiddleware, middleware.TokenValidator(r.db), impersonation)
 	{
-		superAdminOnly.GET("/admins", adminController.GetAdmins)
-		superAdminOnly.PUT("/admins/:adminID", adminController.EditAdmin)
-		superAdminOnly.DELETE("/admins", adminController.DeleteAdmins)
+		validate := middleware.ValidateRestaurantAndCreator(r.db)
+		manageMenu.PUT("/restaurants/:resID", can(rbac.RestaurantUpdate), validate, resController.EditRestaurant)
 
+		manageMenu.GET("/restaurants/:resID/menu", can(rbac.MenuRead), validate, menuController.GetMenu)
+		manageMenu.POST("/restaurants/:resID/menu", can(rbac.MenuCreate), validate, menuController.AddDishes)
+		manageMenu.PUT("/restaurants/:resID/menu/:dishID", can(rbac.MenuUpdate), validate, menuController.EditDish)
+		manageMenu.DELETE("/restaurants/:resID/menu", can(rbac.MenuDelete), validate, menuController.DeleteDishes)
 	}
 	ginRouter.GET("/restaurantsNearBy", resController.GetNearBy)
 	r.Engine = ginRouter
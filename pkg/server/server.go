@@ -1,26 +1,91 @@
 package server
 
 import (
+	"context"
 	"errors"
+	"github.com/vds/go-resman/pkg/config"
 	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"net"
+	"net/http"
 )
 
 type Server struct {
-	DB database.Database
+	DB     database.Database
+	Config *config.Config
 }
 
-func NewServer(data database.Database) (*Server, error) {
+// NewServer serves data with cfg, the passwords stored from now on are hashed with the configured hasher
+func NewServer(data database.Database, cfg *config.Config) (*Server, error) {
 	if data == nil {
 		return nil, errors.New("server expects a valid database instance")
 	}
-	return &Server{DB: data}, nil
+	if cfg == nil {
+		return nil, errors.New("server expects a configuration")
+	}
+	hasher, err := encryption.NewPasswordHasher(&cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+	data.SetPasswordHasher(hasher)
+	return &Server{DB: data, Config: cfg}, nil
 }
 
 func (server *Server) Start() (*Router, error) {
-	router, err := NewRouter(server.DB)
+	router, err := NewRouter(server.DB, server.Config)
+	if err != nil {
+		return nil, err
+	}
+	err = bootstrapSuperAdmin(server.DB, &server.Config.Bootstrap, router.passwords)
 	if err != nil {
 		return nil, err
 	}
 	r := router.Create()
 	return r, nil
 }
+
+// ListenAndServe listens on the configured port and serves requests until ctx is done
+func (server *Server) ListenAndServe(ctx context.Context) error {
+	listener, err := net.Listen("tcp", ":"+server.Config.Port)
+	if err != nil {
+		return err
+	}
+	return server.Serve(ctx, listener)
+}
+
+// Serve handles requests on listener and periodically purges expired tokens until ctx is done, it then fails readiness, stops accepting
+// connections and waits up to the configured shutdown timeout for in-flight requests to complete
+func (server *Server) Serve(ctx context.Context, listener net.Listener) error {
+	router, err := server.Start()
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	httpServer := &http.Server{Handler: router.Engine}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpServer.Serve(listener)
+	}()
+	logger.LogInfo("", "", "server listening on "+listener.Addr().String(), 0)
+	purgeCtx, stopPurge := context.WithCancel(ctx)
+	defer stopPurge()
+	go purgeExpired(purgeCtx, server.DB, server.Config.Auth.PurgeInterval.Duration, server.Config.Auth.DeletedAccountRetention.Duration)
+
+	select {
+	case err = <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.LogInfo("", "", "shutting down server", 0)
+	router.health.Drain()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), server.Config.ShutdownTimeout.Duration)
+	defer cancel()
+	err = httpServer.Shutdown(shutdownCtx)
+	if err != nil {
+		return err
+	}
+	logger.LogInfo("", "", "server stopped", 0)
+	return nil
+}
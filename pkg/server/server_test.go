@@ -0,0 +1,95 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"github.com/vds/go-resman/pkg/database/memory"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/logger"
+	"github.com/vds/go-resman/pkg/server"
+	"github.com/vds/go-resman/pkg/testhelpers"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func init() {
+	logger.InitLogger(logrus.ErrorLevel)
+}
+
+func TestServeUntilCancelled(t *testing.T) {
+	svr, err := server.NewServer(memory.NewMemoryDB(), testhelpers.Config("memory://"))
+	if err != nil {
+		t.Fatalf("can not create new server instance: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can not listen: %v", err)
+	}
+	baseUrl := "http://" + listener.Addr().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- svr.Serve(ctx, listener)
+	}()
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		response, err := http.Get(baseUrl + path)
+		if err != nil {
+			t.Fatalf("can not get %s: %v", path, err)
+		}
+		var body map[string]interface{}
+		err = json.NewDecoder(response.Body).Decode(&body)
+		response.Body.Close()
+		if err != nil {
+			t.Fatalf("response is not in appropriate format: %v", err)
+		}
+		testhelpers.AssertStatus(t, response.StatusCode, http.StatusOK)
+	}
+
+	cancel()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatalf("server should stop cleanly, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server did not stop after cancellation")
+	}
+	_, err = http.Get(baseUrl + "/healthz")
+	if err == nil {
+		t.Fatalf("server should not accept requests after shutdown")
+	}
+}
+
+// hasherDB records the password hasher it is given
+type hasherDB struct {
+	*memory.MemoryDB
+	hasher encryption.PasswordHasher
+}
+
+func (db *hasherDB) SetPasswordHasher(hasher encryption.PasswordHasher) {
+	db.hasher = hasher
+	db.MemoryDB.SetPasswordHasher(hasher)
+}
+
+func TestNewServerAppliesPasswordHasher(t *testing.T) {
+	cfg := testhelpers.Config("memory://")
+	cfg.Password.Hasher = "bcrypt"
+	cfg.Password.BcryptCost = 4
+	db := &hasherDB{MemoryDB: memory.NewMemoryDB()}
+	_, err := server.NewServer(db, cfg)
+	if err != nil {
+		t.Fatalf("can not create new server instance: %v", err)
+	}
+	if _, ok := db.hasher.(*encryption.BcryptHasher); !ok {
+		t.Fatalf("got hasher %T want the configured bcrypt one", db.hasher)
+	}
+	cfg.Password.Hasher = "unknown"
+	_, err = server.NewServer(db, cfg)
+	if err == nil {
+		t.Fatalf("wanted an error for an unknown hasher")
+	}
+}
@@ -0,0 +1,96 @@
+package server_test
+
+import (
+	"github.com/vds/go-resman/pkg/database/memory"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/testhelpers"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	db := memory.NewMemoryDB()
+	ts := testhelpers.NewServer(t, db, nil,
+		models.UserReg{Role: middleware.Admin, Email: "admin@example.com", Name: "admin", Password: "adminPass", Verified: true},
+	)
+	adminID := ts.UserIDs[0]
+	_, err := db.CreateOwner(testhelpers.Context(), adminID, &models.OwnerReg{Email: "owner@example.com", Name: "owner", Password: "ownerPass", Verified: true})
+	if err != nil {
+		t.Fatalf("can not create owner: %v", err)
+	}
+
+	// login names the device of the session with the user agent
+	login := func(role, email, password, device string) (string, string) {
+		t.Helper()
+		status, login := doWithHeader(t, http.MethodPost, ts.URL+"/login", "User-Agent", device, map[string]string{"role": role, "email": email, "password": password})
+		testhelpers.AssertStatus(t, status, http.StatusOK)
+		token, _ := login["token"].(string)
+		refreshToken, _ := login["refreshToken"].(string)
+		return token, refreshToken
+	}
+	laptop, laptopRefresh := login(middleware.Owner, "owner@example.com", "ownerPass", "laptop")
+	phone, _ := login(middleware.Owner, "owner@example.com", "ownerPass", "phone")
+
+	status, listed := doJSON(t, http.MethodGet, ts.URL+"/sessions", phone, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	sessions, _ := listed["sessions"].([]interface{})
+	if len(sessions) != 2 {
+		t.Fatalf("got sessions %v want 2", listed)
+	}
+	laptopID := ""
+	for _, value := range sessions {
+		session := value.(map[string]interface{})
+		current, _ := session["current"].(bool)
+		if current != (session["device"] == "phone") {
+			t.Fatalf("got session %v want only the phone current", session)
+		}
+		if session["device"] == "laptop" {
+			laptopID, _ = session["id"].(string)
+		}
+	}
+
+	// the stolen laptop is logged out from the phone
+	status, _ = doJSON(t, http.MethodDelete, ts.URL+"/sessions/unknown", phone, nil)
+	testhelpers.AssertStatus(t, status, http.StatusNotFound)
+	status, _ = doJSON(t, http.MethodDelete, ts.URL+"/sessions/"+laptopID, phone, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/sessions", laptop, nil)
+	testhelpers.AssertStatus(t, status, middleware.StatusTokenInvalid)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/token/refresh", "", map[string]string{"refreshToken": laptopRefresh})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+
+	tablet, _ := login(middleware.Owner, "owner@example.com", "ownerPass", "tablet")
+	status, revoked := doJSON(t, http.MethodDelete, ts.URL+"/sessions", phone, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if revoked["revoked"] != float64(1) {
+		t.Fatalf("got %v want the tablet session revoked", revoked)
+	}
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/sessions", tablet, nil)
+	testhelpers.AssertStatus(t, status, middleware.StatusTokenInvalid)
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/sessions", phone, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+
+	// admins log out the owners they manage but not other admins
+	adminToken, _ := login(middleware.Admin, "admin@example.com", "adminPass", "desk")
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/logout", adminToken, map[string]string{"role": middleware.Admin, "email": "admin@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/manage/logout", adminToken, map[string]string{"role": middleware.Owner, "email": "nobody@example.com"})
+	testhelpers.AssertStatus(t, status, http.StatusNotFound)
+	status, loggedOut := doJSON(t, http.MethodPost, ts.URL+"/manage/logout", adminToken, map[string]string{"role": middleware.Owner})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if loggedOut["users"] != float64(1) || loggedOut["revoked"] != float64(1) {
+		t.Fatalf("got %v want the phone session of the owner revoked", loggedOut)
+	}
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/sessions", phone, nil)
+	testhelpers.AssertStatus(t, status, middleware.StatusTokenInvalid)
+
+	// logging out ends the session
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/logout", adminToken, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	left, err := db.ShowSessions(testhelpers.Context(), adminID, middleware.Admin, time.Now())
+	if err != nil || len(left) != 0 {
+		t.Fatalf("got sessions %v want none after logout: %v", left, err)
+	}
+}
@@ -0,0 +1,127 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/testhelpers"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// doJSON sends body to url with the access token and decodes the json response
+func doJSON(t *testing.T, method, url, token string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("can not marshal request: %v", err)
+	}
+	request, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("can not create request: %v", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("token", token)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("can not send %s %s: %v", method, url, err)
+	}
+	defer response.Body.Close()
+	result := make(map[string]interface{})
+	json.NewDecoder(response.Body).Decode(&result)
+	return response.StatusCode, result
+}
+
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	code, err := encryption.TOTPCode(secret, encryption.TOTPStep(at))
+	if err != nil {
+		t.Fatalf("can not compute code: %v", err)
+	}
+	return code
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	ts := testhelpers.NewServer(t, nil, nil,
+		models.UserReg{Role: middleware.Admin, Email: "admin@example.com", Name: "admin", Password: "adminPass", Verified: true},
+		models.UserReg{Role: middleware.SuperAdmin, Email: "super@example.com", Name: "super", Password: "superPass", Verified: true},
+	)
+	admin := map[string]string{"role": middleware.Admin, "email": "admin@example.com", "password": "adminPass"}
+	superAdmin := map[string]string{"role": middleware.SuperAdmin, "email": "super@example.com", "password": "superPass"}
+
+	status, login := doJSON(t, http.MethodPost, ts.URL+"/login", "", admin)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	token, _ := login["token"].(string)
+	if token == "" {
+		t.Fatalf("login without two-factor should return a token, got %v", login)
+	}
+
+	status, enrolment := doJSON(t, http.MethodPost, ts.URL+"/2fa/enrol", token, nil)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	secret, _ := enrolment["secret"].(string)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/2fa/confirm", token, map[string]string{"code": "000000"})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	now := time.Now()
+	status, confirmed := doJSON(t, http.MethodPost, ts.URL+"/2fa/confirm", token, map[string]string{"code": totpCode(t, secret, now)})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	recoveryCodes, _ := confirmed["recoveryCodes"].([]interface{})
+	if len(recoveryCodes) == 0 {
+		t.Fatalf("confirming should return recovery codes, got %v", confirmed)
+	}
+
+	status, login = doJSON(t, http.MethodPost, ts.URL+"/login", "", admin)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	challenge, _ := login["challenge"].(string)
+	if challenge == "" || login["token"] != nil {
+		t.Fatalf("login with two-factor should only return a challenge, got %v", login)
+	}
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/2fa/enrol", challenge, nil)
+	testhelpers.AssertStatus(t, status, middleware.StatusTokenInvalid)
+	status, _ = doJSON(t, http.MethodGet, ts.URL+"/logout", challenge, nil)
+	testhelpers.AssertStatus(t, status, middleware.StatusTokenInvalid)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/login/2fa", "", map[string]string{"challenge": challenge, "code": totpCode(t, secret, now)})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	status, login = doJSON(t, http.MethodPost, ts.URL+"/login/2fa", "", map[string]string{"challenge": challenge, "code": recoveryCodes[0].(string)})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if login["token"] == nil {
+		t.Fatalf("completed login should return a token, got %v", login)
+	}
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/login/2fa", "", map[string]string{"challenge": challenge, "code": recoveryCodes[1].(string)})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+
+	_, login = doJSON(t, http.MethodPost, ts.URL+"/login", "", admin)
+	status, _ = doJSON(t, http.MethodPost, ts.URL+"/login/2fa", "", map[string]string{"challenge": login["challenge"].(string), "code": recoveryCodes[0].(string)})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	status, login = doJSON(t, http.MethodPost, ts.URL+"/login/2fa", "", map[string]string{"challenge": login["challenge"].(string), "code": totpCode(t, secret, now.Add(30*time.Second))})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	token = login["token"].(string)
+
+	_, login = doJSON(t, http.MethodPost, ts.URL+"/login", "", superAdmin)
+	superToken := login["token"].(string)
+	status, _ = doJSON(t, http.MethodPut, ts.URL+"/manage/2fa", token, map[string]bool{"required": true})
+	testhelpers.AssertStatus(t, status, http.StatusUnauthorized)
+	status, _ = doJSON(t, http.MethodPut, ts.URL+"/manage/2fa", superToken, map[string]bool{"required": true})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status, _ = doJSON(t, http.MethodDelete, ts.URL+"/2fa", token, map[string]string{"code": recoveryCodes[2].(string)})
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+
+	status, login = doJSON(t, http.MethodPost, ts.URL+"/login", "", superAdmin)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if login["purpose"] != models.PurposeTwoFactorEnrol {
+		t.Fatalf("super admin without two-factor should be asked to enrol, got %v", login)
+	}
+	challenge = login["challenge"].(string)
+	status, enrolment = doJSON(t, http.MethodPost, ts.URL+"/login/2fa/enrol", "", map[string]string{"challenge": challenge})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	secret, _ = enrolment["secret"].(string)
+	status, login = doJSON(t, http.MethodPost, ts.URL+"/login/2fa", "", map[string]string{"challenge": challenge, "code": totpCode(t, secret, time.Now())})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	if login["token"] == nil || login["recoveryCodes"] == nil {
+		t.Fatalf("enrolling during login should return tokens and recovery codes, got %v", login)
+	}
+}
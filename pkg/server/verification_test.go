@@ -0,0 +1,99 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/vds/go-resman/pkg/middleware"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/testhelpers"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+// lastVerificationToken returns the token of the newest email written to dir
+func lastVerificationToken(t *testing.T, dir string, count int) string {
+	t.Helper()
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != count {
+		t.Fatalf("got %d emails want %d", len(files), count)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	email, err := ioutil.ReadFile(filepath.Join(dir, files[len(files)-1].Name()))
+	if err != nil {
+		t.Fatalf("can not read email: %v", err)
+	}
+	match := regexp.MustCompile(`https://resman\.example\.com/verify\?\S+`).Find(email)
+	if match == nil {
+		t.Fatalf("email does not contain the verification link: %s", email)
+	}
+	link, err := url.Parse(string(match))
+	if err != nil || link.Query().Get("token") == "" {
+		t.Fatalf("got verification link %s: %v", match, err)
+	}
+	return link.Query().Get("token")
+}
+
+func TestEmailVerification(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resman-mail")
+	if err != nil {
+		t.Fatalf("can not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := testhelpers.Config("memory://")
+	cfg.Mail.Driver = "file"
+	cfg.Mail.Dir = dir
+	cfg.Auth.EmailVerificationURL = "https://resman.example.com/verify"
+	ts := testhelpers.NewServer(t, nil, cfg,
+		models.UserReg{Role: middleware.Admin, Email: "admin@example.com", Name: "admin", Password: "adminPass"},
+	)
+
+	superAdmin := map[string]string{"role": middleware.SuperAdmin, "email": "super@example.com", "name": "super", "password": "superPass"}
+	status := postJSON(t, ts.URL+"/register", map[string]string{"role": middleware.SuperAdmin, "email": "not an email", "name": "super", "password": "superPass"})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	status = postJSON(t, ts.URL+"/register", superAdmin)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	superVerification := lastVerificationToken(t, dir, 1)
+	status = postJSON(t, ts.URL+"/login", superAdmin)
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+	status = postJSON(t, ts.URL+"/email/verify", map[string]string{"token": superVerification})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+
+	superToken := ts.Login(middleware.SuperAdmin, "super@example.com", "superPass")
+
+	resend := func(email string) int {
+		data, _ := json.Marshal(map[string]string{"role": middleware.Admin, "email": email})
+		request, _ := http.NewRequest(http.MethodPost, ts.URL+"/manage/verification", bytes.NewReader(data))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("token", superToken)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("can not resend verification: %v", err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	testhelpers.AssertStatus(t, resend("unknown@example.com"), http.StatusNotFound)
+	testhelpers.AssertStatus(t, resend("admin@example.com"), http.StatusOK)
+	firstToken := lastVerificationToken(t, dir, 2)
+	credentials := map[string]string{"role": middleware.Admin, "email": "admin@example.com", "password": "adminPass"}
+	status = postJSON(t, ts.URL+"/login", credentials)
+	testhelpers.AssertStatus(t, status, http.StatusForbidden)
+	testhelpers.AssertStatus(t, resend("admin@example.com"), http.StatusOK)
+	token := lastVerificationToken(t, dir, 3)
+
+	status = postJSON(t, ts.URL+"/email/verify", map[string]string{"token": firstToken})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	status = postJSON(t, ts.URL+"/email/verify", map[string]string{"token": token})
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	status = postJSON(t, ts.URL+"/email/verify", map[string]string{"token": token})
+	testhelpers.AssertStatus(t, status, http.StatusBadRequest)
+	status = postJSON(t, ts.URL+"/login", credentials)
+	testhelpers.AssertStatus(t, status, http.StatusOK)
+	testhelpers.AssertStatus(t, resend("admin@example.com"), http.StatusConflict)
+}
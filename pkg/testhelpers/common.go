@@ -2,6 +2,7 @@ package testhelpers
 
 import (
 	"encoding/json"
+	"github.com/vds/go-resman/pkg/config"
 	"net/http"
 	"testing"
 )
@@ -89,3 +90,11 @@ func GetOwnerBySuperAdminToken(baseUrl string) (string,error) {
 	token := data["token"]
 	return token,err
 }
+
+// Config returns the default configuration with a fixed test secret and the given database url
+func Config(dbUrl string) *config.Config {
+	cfg := config.Default()
+	cfg.Database.URL = dbUrl
+	cfg.Auth.Secret = "resman-test-secret"
+	return cfg
+}
@@ -1,68 +1,43 @@
 package testhelpers
 
 import (
+	"context"
 	"fmt"
-	"github.com/google/uuid"
 	"github.com/vds/go-resman/pkg/database/mysql"
-	"github.com/vds/go-resman/pkg/encryption"
+	"github.com/vds/go-resman/pkg/middleware"
 	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/seed"
+	"path/filepath"
+	"runtime"
 )
 
 const (
-	RestaurantTable   = "restaurants"
-	MenuTable         = "dishes"
-	InvalidTokenTable = "invalid_tokens"
+	RestaurantTable        = "restaurants"
+	MenuTable              = "dishes"
+	RevokedTokenTable      = "revoked_tokens"
+	RefreshTokenTable      = "refresh_tokens"
+	ResetTokenTable        = "password_reset_tokens"
+	VerificationTokenTable = "email_verification_tokens"
+	TwoFactorTable         = "two_factor"
+	RecoveryCodeTable      = "recovery_codes"
+	SettingsTable          = "settings"
+	LoginFailureTable      = "login_failures"
+	APIKeyTable            = "api_keys"
+	SessionTable           = "sessions"
 )
 
 var (
-	admin = models.UserReg{
-		Role:     "admin",
-		Email:    "admin@gmail.com",
-		Name:     "admin",
-		Password: "pass",
-	}
-	adminForUD = models.UserReg{
-		Role:     "admin",
-		Email:    "admin100@gmail.com",
-		Name:     "admin100",
-		Password: "pass100",
-	}
-	superAdmin = models.UserReg{
-		Role:     "superAdmin",
-		Email:    "superAdmin@gmail.com",
-		Name:     "superAdmin",
-		Password: "superPass",
-	}
-	ownerByAdmin = models.UserReg{
-		Role:     "owner",
-		Email:    "ownerByAdmin@gmail.com",
-		Name:     "ownerByAdmin",
-		Password: "ownerByAdminPass",
-	}
-	ownerBySuperAdmin = models.UserReg{
-		Role:     "owner",
-		Email:    "ownerBySuperAdmin@gmail.com",
-		Name:     "ownerBySuperAdmin",
-		Password: "ownerBySuperAdmin",
-	}
-	restaurantByAdmin = models.Restaurant{
-		Name: "restaurantByAdmin",
-		Lat:  10,
-		Lng:  15,
-	}
-	restaurantOfOwner = models.Restaurant{
-		Name: "restaurantOfOwner",
-		Lat:  5,
-		Lng:  8,
-	}
-	ownerRestaurantDish = models.Dish{
-		Name:  "ownerDish",
-		Price: 100,
-	}
-	adminRestaurantDish = models.Dish{
-		Name:  "adminDish",
-		Price: 10,
-	}
+	fixture = mustLoadFixture()
+
+	superAdmin          = userReg(middleware.SuperAdmin, fixture.SuperAdmins[0])
+	admin               = userReg(middleware.Admin, fixture.Admins[0])
+	adminForUD          = userReg(middleware.Admin, fixture.Admins[1])
+	ownerByAdmin        = userReg(middleware.Owner, fixture.Owners[0].User)
+	ownerBySuperAdmin   = userReg(middleware.Owner, fixture.Owners[1].User)
+	restaurantByAdmin   = restaurant(fixture.Restaurants[0])
+	restaurantOfOwner   = restaurant(fixture.Restaurants[1])
+	adminRestaurantDish = dish(fixture.Restaurants[0].Dishes[0])
+	ownerRestaurantDish = dish(fixture.Restaurants[1].Dishes[0])
 
 	adminId             string
 	superAdminId        string
@@ -72,157 +47,78 @@ var (
 	Db *mysql.MySqlDB
 )
 
-func InitDB(db *mysql.MySqlDB) error {
-	Db = db
-	err := createAdmins(db)
-	if err != nil {
-		return err
-	}
-	err = createOwners(db)
+// mustLoadFixture reads testdata/fixture.yaml next to this file so it is found from any test directory
+func mustLoadFixture() *seed.Fixture {
+	_, file, _, _ := runtime.Caller(0)
+	fixture, err := seed.LoadFile(filepath.Join(filepath.Dir(file), "testdata", "fixture.yaml"))
 	if err != nil {
-		return err
-	}
-	err = createRestaurants(db)
-	if err != nil {
-		return err
+		panic(err)
 	}
-	err = createDishes(db)
-	if err != nil {
-		return err
-	}
-	return nil
+	return fixture
 }
 
-func createAdmins(db *mysql.MySqlDB) error {
-	adminId = uuid.New().String()
-	adminForUDId = uuid.New().String()
-	superAdminId = uuid.New().String()
-	adminPass, err := encryption.GenerateHash(admin.Password)
-	if err != nil {
-		return err
-	}
-	superAdminPass, err := encryption.GenerateHash(superAdmin.Password)
-	if err != nil {
-		return err
-	}
-	adminForUDPass, err := encryption.GenerateHash(superAdmin.Password)
-	if err != nil {
-		return err
-	}
-	_, err = db.Exec(fmt.Sprintf(
-		`insert into %s(id,email_id,name,password) 
-							value(?,?,?,?)
-			`, mysql.AdminTable), adminId, admin.Email, admin.Name, adminPass)
-	if err != nil {
-		return err
-	}
-	_, err = db.Exec(fmt.Sprintf(
-		`insert into %s(id,email_id,name,password) 
-							value(?,?,?,?)
-			`, mysql.AdminTable), adminForUDId, adminForUD.Email, adminForUD.Name, adminForUDPass)
-	if err != nil {
-		return err
-	}
-	_, err = db.Exec(fmt.Sprintf(
-		`insert into %s(id,email_id,name,password) 
-							value(?,?,?,?)
-			`, mysql.SuperAdminTable), superAdminId, superAdmin.Email, superAdmin.Name, superAdminPass)
-	if err != nil {
-		return err
-	}
-	return nil
+func userReg(role string, user seed.User) models.UserReg {
+	return models.UserReg{Role: role, Email: user.Email, Name: user.Name, Password: user.Password}
 }
 
-func createOwners(db *mysql.MySqlDB) error {
-	ownerByAdminId = uuid.New().String()
-	ownerBySuperAdminId = uuid.New().String()
-	ownerByAdminPass, err := encryption.GenerateHash(ownerByAdmin.Password)
-	if err != nil {
-		return err
-	}
-	ownerBySuperAdminPass, err := encryption.GenerateHash(ownerBySuperAdmin.Password)
-	if err != nil {
-		return err
-	}
-	_, err = db.Exec(fmt.Sprintf(
-		`insert into %s(id,email_id,name,password,creator_id) 
-							value(?,?,?,?,?)
-			`, mysql.OwnerTable), ownerByAdminId, ownerByAdmin.Email, ownerByAdmin.Name, ownerByAdminPass, adminId)
-	if err != nil {
-		return err
-	}
-	_, err = db.Exec(fmt.Sprintf(
-		`insert into %s(id,email_id,name,password,creator_id) 
-							value(?,?,?,?,?)
-			`, mysql.OwnerTable), ownerBySuperAdminId, ownerBySuperAdmin.Email, ownerBySuperAdmin.Name, ownerBySuperAdminPass, superAdminId)
-	if err != nil {
-		return err
-	}
-	return nil
+func restaurant(res seed.Restaurant) models.Restaurant {
+	return models.Restaurant{Name: res.Name, Lat: res.Lat, Lng: res.Lng}
 }
 
-func createRestaurants(db *mysql.MySqlDB) error {
-	_, err := db.Exec(fmt.Sprintf(
-		`insert into %s(name,lat,lng,creator_id) 
-							value(?,?,?,?)
-			`, RestaurantTable), restaurantByAdmin.Name, restaurantByAdmin.Lat, restaurantByAdmin.Lng, adminId)
-	if err != nil {
-		return err
-	}
+func dish(d seed.Dish) models.Dish {
+	return models.Dish{Name: d.Name, Price: d.Price}
+}
 
-	_, err = db.Exec(fmt.Sprintf(
-		`insert into %s(name,lat,lng,creator_id,owner_id) 
-							value(?,?,?,?,?)
-			`, RestaurantTable), restaurantOfOwner.Name, restaurantOfOwner.Lat, restaurantOfOwner.Lng, superAdminId, ownerByAdminId)
+func InitDB(db *mysql.MySqlDB) error {
+	Db = db
+	ctx := context.WithValue(context.Background(), "reqId", "testhelpers")
+	ctx = context.WithValue(ctx, "reqUrl", "testhelpers")
+	result, err := seed.Apply(ctx, db, fixture)
 	if err != nil {
 		return err
 	}
+	superAdminId = result.Users[superAdmin.Email]
+	adminId = result.Users[admin.Email]
+	adminForUDId = result.Users[adminForUD.Email]
+	ownerByAdminId = result.Users[ownerByAdmin.Email]
+	ownerBySuperAdminId = result.Users[ownerBySuperAdmin.Email]
 	return nil
 }
 
-func createDishes(db *mysql.MySqlDB) error {
-	_, err := db.Exec(fmt.Sprintf(
-		`insert into %s(name,price,res_id) 
-							value(?,?,?)
-			`, MenuTable), adminRestaurantDish.Name, adminRestaurantDish.Price, 1)
+func ClearDB(db *mysql.MySqlDB) error {
+	_, err := db.Exec(fmt.Sprintf("delete from %s", mysql.UserTable))
 	if err != nil {
 		return err
 	}
-
-	_, err = db.Exec(fmt.Sprintf(
-		`insert into %s(name,price,res_id) 
-							value(?,?,?)
-			`, MenuTable), ownerRestaurantDish.Name, ownerRestaurantDish.Price, 2)
+	_, err = db.Exec(fmt.Sprintf("delete from %s", RestaurantTable))
 	if err != nil {
 		return err
 	}
-	return nil
-}
-
-func ClearDB(db *mysql.MySqlDB) error {
-	_, err := db.Exec(fmt.Sprintf("delete from %s", mysql.AdminTable))
+	_, err = db.Exec(fmt.Sprintf("delete from %s", MenuTable))
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec(fmt.Sprintf("delete from %s", mysql.SuperAdminTable))
+	_, err = db.Exec(fmt.Sprintf("delete from %s", RevokedTokenTable))
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec(fmt.Sprintf("delete from %s", mysql.OwnerTable))
+	_, err = db.Exec(fmt.Sprintf("delete from %s", RefreshTokenTable))
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec(fmt.Sprintf("delete from %s", RestaurantTable))
+	_, err = db.Exec(fmt.Sprintf("delete from %s", ResetTokenTable))
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec(fmt.Sprintf("delete from %s", MenuTable))
+	_, err = db.Exec(fmt.Sprintf("delete from %s", VerificationTokenTable))
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec(fmt.Sprintf("delete from %s", InvalidTokenTable))
-	if err != nil {
-		return err
+	for _, table := range []string{TwoFactorTable, RecoveryCodeTable, SettingsTable, LoginFailureTable, APIKeyTable, SessionTable} {
+		_, err = db.Exec(fmt.Sprintf("delete from %s", table))
+		if err != nil {
+			return err
+		}
 	}
 	_, err = db.Exec(fmt.Sprintf("alter table %s  AUTO_INCREMENT=1", RestaurantTable))
 	if err != nil {
@@ -64,8 +64,12 @@ func NewLogOutRequest(token string,baseUrl string) (*http.Request,error) {
 }
 
 
-func ClearInvalidTokens(){
-	_, err := Db.Exec(fmt.Sprintf("delete from %s", InvalidTokenTable))
+func ClearRevokedTokens(){
+	_, err := Db.Exec(fmt.Sprintf("delete from %s", RevokedTokenTable))
+	if err != nil {
+		panic(err)
+	}
+	_, err = Db.Exec(fmt.Sprintf("delete from %s", RefreshTokenTable))
 	if err != nil {
 		panic(err)
 	}
@@ -14,7 +14,7 @@ var (
 		Role:     "admin",
 		Email:    "admin1@gmail.com",
 		Name:     "admin1",
-		Password: "pass1",
+		Password: "adminPass1",
 	}
 	SuperAdminToRegister = models.UserReg{
 		Role:     "superAdmin",
@@ -39,11 +39,11 @@ func NewRegisterRequest(user *models.UserReg,baseUrl string) (*http.Request,erro
 }
 
 func ClearRegisteredUsers(){
-	_, err := Db.Exec(fmt.Sprintf("delete from %s where email_id=?", mysql.AdminTable),AdminToRegister.Email)
+	_, err := Db.Exec(fmt.Sprintf("delete from %s where role=? and email_id=?", mysql.UserTable),AdminToRegister.Role,AdminToRegister.Email)
 	if err != nil {
 		panic(err)
 	}
-	_, err = Db.Exec(fmt.Sprintf("delete from %s where email_id=?", mysql.SuperAdminTable),SuperAdminToRegister.Email)
+	_, err = Db.Exec(fmt.Sprintf("delete from %s where role=? and email_id=?", mysql.UserTable),SuperAdminToRegister.Role,SuperAdminToRegister.Email)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,82 @@
+package testhelpers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/vds/go-resman/pkg/config"
+	"github.com/vds/go-resman/pkg/database"
+	"github.com/vds/go-resman/pkg/database/memory"
+	"github.com/vds/go-resman/pkg/models"
+	"github.com/vds/go-resman/pkg/server"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestServer serves the api to the requests of a test
+type TestServer struct {
+	*httptest.Server
+	// UserIDs are the ids of the users given to NewServer, in the same order
+	UserIDs []string
+	t       *testing.T
+}
+
+// Context returns the context with request fields that the database methods log
+func Context() context.Context {
+	return context.WithValue(context.WithValue(context.Background(), "reqId", "test"), "reqUrl", "test")
+}
+
+// NewServer creates users in db and serves the api on it until the end of the test. A nil db is a new
+// memory database and a nil cfg the configuration of Config
+func NewServer(t *testing.T, db database.Database, cfg *config.Config, users ...models.UserReg) *TestServer {
+	t.Helper()
+	if db == nil {
+		db = memory.NewMemoryDB()
+	}
+	if cfg == nil {
+		cfg = Config("memory://")
+	}
+	ids := make([]string, 0, len(users))
+	for i := range users {
+		id, err := db.CreateUser(Context(), &users[i])
+		if err != nil {
+			t.Fatalf("can not create user: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	svr, err := server.NewServer(db, cfg)
+	if err != nil {
+		t.Fatalf("can not create new server instance: %v", err)
+	}
+	router, err := svr.Start()
+	if err != nil {
+		t.Fatalf("can not create router: %v", err)
+	}
+	ts := httptest.NewServer(router.Engine)
+	t.Cleanup(ts.Close)
+	return &TestServer{Server: ts, UserIDs: ids, t: t}
+}
+
+// Login logs in with the credentials of a user and returns its token, the test fails when the login is refused
+func (s *TestServer) Login(role, email, password string) string {
+	s.t.Helper()
+	data, err := json.Marshal(models.Credentials{Role: role, Email: email, Password: password})
+	if err != nil {
+		s.t.Fatalf("can not marshal credentials: %v", err)
+	}
+	response, err := http.Post(s.URL+"/login", "application/json", bytes.NewReader(data))
+	if err != nil {
+		s.t.Fatalf("can not log in: %v", err)
+	}
+	defer response.Body.Close()
+	AssertStatus(s.t, response.StatusCode, http.StatusOK)
+	var login struct {
+		Token string `json:"token"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&login)
+	if err != nil || login.Token == "" {
+		s.t.Fatalf("login of %s returned no token: %v", email, err)
+	}
+	return login.Token
+}